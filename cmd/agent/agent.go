@@ -2,97 +2,81 @@
 package main
 
 import (
-	"flag"
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
-	"github.com/tiraill/go_collect_metrics/internal/clients"
+	"go.uber.org/zap"
+
+	"github.com/tiraill/go_collect_metrics/internal/agent"
+	"github.com/tiraill/go_collect_metrics/internal/config"
+	"github.com/tiraill/go_collect_metrics/internal/logger"
+	"github.com/tiraill/go_collect_metrics/internal/tracing"
 	"github.com/tiraill/go_collect_metrics/internal/utils"
 )
 
+// serviceName - имя сервиса агента в span.
+const serviceName = "metrics-agent"
+
 var (
-	address        *string
-	reportInterval *time.Duration
-	pollInterval   *time.Duration
-	timeout        = 5 * time.Second
-	hashKey        *string
-	cryptoKey      *string
-	configFile     *string
-	rateLimit      *int
-	buildVersion   = "N/A"
-	buildDate      = "N/A"
-	buildCommit    = "N/A"
+	buildVersion = "N/A"
+	buildDate    = "N/A"
+	buildCommit  = "N/A"
 )
 
-func init() {
-	address = flag.String("a", "127.0.0.1:8080", "server address")
-	reportInterval = flag.Duration("r", 10*time.Second, "report interval")
-	pollInterval = flag.Duration("p", 2*time.Second, "pool interval")
-	hashKey = flag.String("k", "", "hash key")
-	cryptoKey = flag.String("crypto-key", "", "public crypto key")
-	configFile = flag.String("config", "", "config file")
-	rateLimit = flag.Int("l", 10, "rate limit")
-}
-
-func reportStatistic(statistic *utils.Statistic, config utils.AgentConfig, metricClient *clients.MetricClient) {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Println("Recovered in f", r)
-		}
-	}()
-	log.Println("Sending report...")
-	statCopy := statistic.Copy()
-	report := utils.NewJSONReport(statCopy, config.HashKey)
-	err := metricClient.SendBatchJSONReport(report)
+// run - метод запуска агента до получения сигнала остановки.
+// конфигурация, включая настройки журнала, перечитывается по SIGHUP и при изменении файла конфигурации.
+func run(loader *config.Loader[utils.AgentConfig], loaded *config.Effective[utils.AgentConfig]) error {
+	if err := logger.Configure(loaded.Config.Log); err != nil {
+		return err
+	}
+	defer logger.Sync()
+	stopTracing, err := tracing.Setup(loaded.Config.Trace, serviceName)
 	if err != nil {
-		log.Println("Fail send report", statCopy.Counter, err)
-	} else {
-		log.Println("Send report successfully", statCopy.Counter)
-		statistic.ResetCounter()
+		return err
 	}
+	a, err := agent.New(loaded.Config)
+	if err != nil {
+		return err
+	}
+	if err = a.Start(context.Background()); err != nil {
+		return err
+	}
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	go loader.Watch(watchCtx, loaded, func(next *config.Effective[utils.AgentConfig], _ []string) error {
+		if err := a.Reload(next.Config); err != nil {
+			return err
+		}
+		return logger.Configure(next.Config.Log)
+	})
+
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	sig := <-done
+	logger.L("agent").Info("agent stopping", zap.String("signal", sig.String()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), loaded.Config.ShutdownTimeout)
+	defer cancel()
+	if err := a.Stop(ctx); err != nil {
+		logger.L("agent").Error("agent stopped with error", zap.Error(err))
+	}
+	if err := stopTracing(ctx); err != nil {
+		logger.L("agent").Error("failed to flush traces", zap.Error(err))
+	}
+	return nil
 }
 
 func main() {
 	fmt.Println("Build version:", buildVersion)
 	fmt.Println("Build date:", buildDate)
 	fmt.Println("Build commit:", buildCommit)
-	flag.Parse()
-	config, err := utils.MakeAgentConfig(*configFile, *address, *reportInterval, *pollInterval, *hashKey, *cryptoKey, *rateLimit)
-	if err != nil {
-		log.Fatal(err)
-	}
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-	stat := utils.NewStatistic()
-	metricClient, err := clients.NewMetricClient(config.Address, timeout, config.RateLimit, config.CryptoKey)
-	if err != nil {
+	loader := config.NewAgentLoader("agent", "127.0.0.1:8080")
+	loaded := loader.MustLoad(os.Args[1:])
+	if err := run(loader, loaded); err != nil {
 		log.Fatal(err)
 	}
-	reportStatisticTicker := time.NewTicker(config.ReportInterval)
-	updateStatisticTicker := time.NewTicker(config.PollInterval)
-	updateMemCPUStatisticTicker := time.NewTicker(config.PollInterval)
-
-	log.Print("Agent Started")
-	for {
-		select {
-		case <-reportStatisticTicker.C:
-			reportStatistic(stat, config, metricClient)
-		case <-updateStatisticTicker.C:
-			stat.CollectRuntime()
-		case <-updateMemCPUStatisticTicker.C:
-			stat.CollectMemCPU()
-		case s := <-done:
-			log.Print("Agent Stopped. Signal: ", s)
-			reportStatisticTicker.Stop()
-			updateStatisticTicker.Stop()
-			updateMemCPUStatisticTicker.Stop()
-			reportStatistic(stat, config, metricClient)
-			log.Print("Exit")
-			return
-		}
-	}
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// Состояния проверок health.
+const (
+	checkOK      = "ok"
+	checkFailed  = "failed"
+	checkFiring  = "firing"
+	checkSkipped = "skipped"
+)
+
+// errHash ошибка подписи метрики в ответе сервера.
+var errHash = errors.New("invalid metric hash in server response")
+
+// check - результат одной проверки health.
+type check struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// backend - общий интерфейс работы с сервером по HTTP и gRPC.
+type backend interface {
+	// Get получение одной метрики
+	Get(ctx context.Context, mType, id string) (utils.JSONMetric, error)
+	// Search получение страницы метрик
+	Search(ctx context.Context, q storage.ListQuery) (storage.ListPage, error)
+	// Push сохранение списка метрик, все или ни одной
+	Push(ctx context.Context, metrics []utils.JSONMetric) ([]utils.JSONMetric, error)
+	// Delete удаление одной метрики
+	Delete(ctx context.Context, mType, id string) error
+	// Watch получение изменений метрик до отмены ctx или ошибки fn
+	Watch(ctx context.Context, mType string, names []string, fn func(utils.JSONMetric) error) error
+	// Ping проверка доступности сервера и хранилища
+	Ping(ctx context.Context) error
+	// Health набор проверок состояния сервера
+	Health(ctx context.Context) []check
+	// Close закрытие соединения
+	Close() error
+}
+
+// newBackend - метод создания подключения к серверу по транспорту из конфигурации.
+func newBackend(config ctlConfig) (backend, error) {
+	if config.Transport == transportGRPC {
+		return newGRPCBackend(config)
+	}
+	return newHTTPBackend(config)
+}
+
+// signMetrics - метод подписи метрик ключом, как это делает агент.
+func signMetrics(metrics []utils.JSONMetric, hashKey string) {
+	for i := range metrics {
+		metrics[i].Hash = utils.CalcHash(metrics[i].String(), hashKey)
+	}
+}
+
+// checkHash - метод проверки подписи метрики из ответа сервера.
+// при заданном ключе сервер подписывает каждую метрику, поэтому метрика без подписи невалидна.
+func checkHash(metric utils.JSONMetric, hashKey string) error {
+	if hashKey == "" {
+		return nil
+	}
+	if metric.Hash == nil || !metric.IsValidHash(hashKey) {
+		return errHash
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// parseFlags - метод разбора флагов подкоманды, ошибка разбора считается ошибкой аргументов.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return usageError{msg: err.Error()}
+	}
+	return nil
+}
+
+// withTimeout - контекст одного запроса к серверу.
+func withTimeout(ctx context.Context, e env) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, e.config.Timeout)
+}
+
+func runGet(ctx context.Context, e env, args []string) error {
+	if len(args) != 2 {
+		return usageError{msg: "expected <type> <id>"}
+	}
+	ctx, cancel := withTimeout(ctx, e)
+	defer cancel()
+	metric, err := e.client.Get(ctx, args[0], args[1])
+	if err != nil {
+		return err
+	}
+	return e.out.Metric(metric)
+}
+
+// runList - получение всех страниц списка метрик, -limit задает размер страницы.
+func runList(ctx context.Context, e env, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	var q storage.ListQuery
+	fs.StringVar(&q.Type, "type", "", "metric type")
+	fs.StringVar(&q.Prefix, "prefix", "", "name prefix")
+	fs.StringVar(&q.Glob, "glob", "", "name glob, for example cpu_*")
+	fs.StringVar(&q.Regex, "regex", "", "name regular expression")
+	fs.StringVar(&q.Sort, "sort", "", "sort order: name, -name, type, -type")
+	fs.IntVar(&q.Limit, "limit", 0, "page size")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usageError{msg: "unexpected arguments"}
+	}
+	metrics := make([]utils.JSONMetric, 0)
+	for {
+		reqCtx, cancel := withTimeout(ctx, e)
+		page, err := e.client.Search(reqCtx, q)
+		cancel()
+		if err != nil {
+			return err
+		}
+		metrics = append(metrics, page.Metrics...)
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	return e.out.Metrics(metrics)
+}
+
+// runPush - сохранение одной метрики из аргументов или списка метрик из файла.
+func runPush(ctx context.Context, e env, args []string) error {
+	fs := flag.NewFlagSet("push", flag.ContinueOnError)
+	file := fs.String("f", "", "file with metrics, - reads stdin")
+	format := fs.String("format", storage.FormatNDJSON, "file format: ndjson or csv")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	var metrics []utils.JSONMetric
+	switch {
+	case *file != "" && fs.NArg() == 0:
+		if !storage.IsValidFormat(*format) {
+			return usageError{msg: storage.ErrTransferFormat.Error()}
+		}
+		r := e.stdin
+		if *file != "-" {
+			f, err := os.Open(*file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		var err error
+		if metrics, err = storage.ReadMetrics(r, *format); err != nil {
+			return err
+		}
+	case *file == "" && fs.NArg() == 3:
+		metric, err := utils.NewJSONMetric(fs.Arg(0), fs.Arg(1), fs.Arg(2))
+		if err != nil {
+			return usageError{msg: err.Error()}
+		}
+		metrics = []utils.JSONMetric{metric}
+	default:
+		return usageError{msg: "expected <type> <id> <value> or -f <file>"}
+	}
+	if len(metrics) == 0 {
+		return nil
+	}
+	ctx, cancel := withTimeout(ctx, e)
+	defer cancel()
+	saved, err := e.client.Push(ctx, metrics)
+	if err != nil {
+		return err
+	}
+	return e.out.Metrics(saved)
+}
+
+// runWatch - вывод изменений метрик до прерывания, время ожидания не ограничивается.
+func runWatch(ctx context.Context, e env, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	mType := fs.String("type", "", "metric type")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := e.out.WatchHeader(); err != nil {
+		return err
+	}
+	return e.client.Watch(ctx, *mType, fs.Args(), e.out.WatchMetric)
+}
+
+func runDelete(ctx context.Context, e env, args []string) error {
+	if len(args) != 2 {
+		return usageError{msg: "expected <type> <id>"}
+	}
+	ctx, cancel := withTimeout(ctx, e)
+	defer cancel()
+	return e.client.Delete(ctx, args[0], args[1])
+}
+
+// runPing - проверка доступности сервера с выводом времени ответа.
+func runPing(ctx context.Context, e env, args []string) error {
+	if len(args) != 0 {
+		return usageError{msg: "unexpected arguments"}
+	}
+	ctx, cancel := withTimeout(ctx, e)
+	defer cancel()
+	start := time.Now()
+	if err := e.client.Ping(ctx); err != nil {
+		return err
+	}
+	latency := time.Since(start).Round(time.Microsecond)
+	return e.out.Checks([]check{{Name: "ping", Status: checkOK, Detail: fmt.Sprint(latency)}})
+}
+
+// runHealth - вывод проверок состояния, при неуспешной проверке код выхода 1.
+func runHealth(ctx context.Context, e env, args []string) error {
+	if len(args) != 0 {
+		return usageError{msg: "unexpected arguments"}
+	}
+	ctx, cancel := withTimeout(ctx, e)
+	defer cancel()
+	checks := e.client.Health(ctx)
+	if err := e.out.Checks(checks); err != nil {
+		return err
+	}
+	for _, c := range checks {
+		if c.Status != checkOK && c.Status != checkSkipped {
+			return failedError{}
+		}
+	}
+	return nil
+}
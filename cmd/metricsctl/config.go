@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tiraill/go_collect_metrics/internal/config"
+)
+
+// Транспорты подключения к серверу.
+const (
+	transportHTTP = "http"
+	transportGRPC = "grpc"
+)
+
+// Форматы вывода.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputCSV   = "csv"
+)
+
+// ctlConfig - конфигурация клиента.
+// ключи и переменные окружения адреса, ключа подписи и ключа шифрования совпадают с агентом.
+type ctlConfig struct {
+	Address   string        `json:"address,omitempty"`
+	Transport string        `json:"transport,omitempty"`
+	HashKey   string        `json:"hash_key,omitempty"`
+	CryptoKey string        `json:"crypto_key,omitempty"`
+	Output    string        `json:"output,omitempty"`
+	Timeout   time.Duration `json:"timeout,omitempty"`
+}
+
+// newLoader - метод создания загрузчика конфигурации клиента.
+func newLoader() *config.Loader[ctlConfig] {
+	options := []config.Option[ctlConfig]{
+		{Key: "address", Env: "ADDRESS", Flags: []string{"a", "address"}, Default: "127.0.0.1:8080",
+			Usage: "server address", Field: func(c *ctlConfig) any { return &c.Address }},
+		{Key: "transport", Env: "METRICSCTL_TRANSPORT", Flags: []string{"transport"}, Default: transportHTTP,
+			Usage: "server transport: http or grpc", Field: func(c *ctlConfig) any { return &c.Transport }},
+		{Key: "hash_key", Env: "KEY", Flags: []string{"k", "key"}, Secret: true,
+			Usage: "hash key for request signing", Field: func(c *ctlConfig) any { return &c.HashKey }},
+		{Key: "crypto_key", Env: "CRYPTO_KEY", Flags: []string{"crypto-key"},
+			Usage: "public crypto key file for request encryption, http only", Field: func(c *ctlConfig) any { return &c.CryptoKey }},
+		{Key: "output", Env: "METRICSCTL_OUTPUT", Flags: []string{"o", "output"}, Default: outputTable,
+			Usage: "output format: table, json or csv", Field: func(c *ctlConfig) any { return &c.Output }},
+		{Key: "timeout", Env: "METRICSCTL_TIMEOUT", Flags: []string{"timeout"}, Default: 5 * time.Second,
+			Usage: "request timeout, watch is not limited", Field: func(c *ctlConfig) any { return &c.Timeout }},
+	}
+	return config.NewLoader("metricsctl", options, checkConfig)
+}
+
+func checkConfig(c *ctlConfig) error {
+	switch c.Transport {
+	case transportHTTP:
+	case transportGRPC:
+		// gRPC агент не шифрует запросы, сервер принимает их только в открытом виде
+		if c.CryptoKey != "" {
+			return fmt.Errorf("crypto_key is supported by the http transport only")
+		}
+	default:
+		return fmt.Errorf("transport must be http or grpc, got %q", c.Transport)
+	}
+	switch c.Output {
+	case outputTable, outputJSON, outputCSV:
+	default:
+		return fmt.Errorf("output must be table, json or csv, got %q", c.Output)
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("timeout must be positive")
+	}
+	return nil
+}
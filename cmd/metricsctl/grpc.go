@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+
+	pb "github.com/tiraill/go_collect_metrics/cmd/proto"
+)
+
+// grpcBackend - работа с сервером через gRPC.
+// метрики подписываются ключом, изменяющие запросы подписываются для защиты от повторной отправки.
+type grpcBackend struct {
+	conn    *grpc.ClientConn
+	client  pb.MetricsClient
+	hashKey string
+}
+
+func newGRPCBackend(config ctlConfig) (*grpcBackend, error) {
+	conn, err := grpc.Dial(config.Address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	return &grpcBackend{conn: conn, client: pb.NewMetricsClient(conn), hashKey: config.HashKey}, nil
+}
+
+// fromPb - метод преобразования метрики gRPC, значение заполняется только для ее типа.
+func fromPb(m *pb.Metric) utils.JSONMetric {
+	metric := utils.JSONMetric{ID: m.Id, MType: m.Type}
+	switch m.Type {
+	case "gauge":
+		metric.Value = &m.Value
+	case "counter":
+		metric.Delta = &m.Delta
+	}
+	if m.Hash != "" {
+		metric.Hash = &m.Hash
+	}
+	return metric
+}
+
+func (b *grpcBackend) Get(ctx context.Context, mType, id string) (utils.JSONMetric, error) {
+	response, err := b.client.GetMetric(ctx, &pb.GetMetricRequest{Metric: &pb.Metric{Id: id, Type: mType}})
+	if err != nil {
+		return utils.JSONMetric{}, err
+	}
+	metric := fromPb(response.Metric)
+	return metric, checkHash(metric, b.hashKey)
+}
+
+func (b *grpcBackend) Search(ctx context.Context, q storage.ListQuery) (storage.ListPage, error) {
+	response, err := b.client.SearchMetrics(ctx, &pb.SearchMetricsRequest{
+		Type:   q.Type,
+		Prefix: q.Prefix,
+		Glob:   q.Glob,
+		Regex:  q.Regex,
+		Sort:   q.Sort,
+		Limit:  int32(q.Limit),
+		Cursor: q.Cursor,
+	})
+	if err != nil {
+		return storage.ListPage{}, err
+	}
+	page := storage.ListPage{Metrics: make([]utils.JSONMetric, 0, len(response.Metrics)), NextCursor: response.NextCursor}
+	for _, m := range response.Metrics {
+		metric := fromPb(m)
+		if err = checkHash(metric, b.hashKey); err != nil {
+			return page, err
+		}
+		page.Metrics = append(page.Metrics, metric)
+	}
+	return page, nil
+}
+
+func (b *grpcBackend) Push(ctx context.Context, metrics []utils.JSONMetric) ([]utils.JSONMetric, error) {
+	signMetrics(metrics, b.hashKey)
+	request := &pb.SaveBatchMetricRequest{Metrics: make([]*pb.Metric, 0, len(metrics))}
+	for i := range metrics {
+		request.Metrics = append(request.Metrics, utils.JSONMetricToPbMetric(&metrics[i]))
+	}
+	ctx, err := utils.SignContext(ctx, request, "", b.hashKey)
+	if err != nil {
+		return nil, err
+	}
+	response, err := b.client.SaveBatchMetrics(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	saved := make([]utils.JSONMetric, 0, len(response.Metrics))
+	for _, m := range response.Metrics {
+		saved = append(saved, fromPb(m))
+	}
+	return saved, nil
+}
+
+func (b *grpcBackend) Delete(ctx context.Context, mType, id string) error {
+	request := &pb.DeleteMetricRequest{Id: id, Type: mType}
+	if hash := utils.CalcHash(string(utils.DeletePayload(mType, id)), b.hashKey); hash != nil {
+		request.Hash = *hash
+	}
+	ctx, err := utils.SignContext(ctx, request, "", b.hashKey)
+	if err != nil {
+		return err
+	}
+	_, err = b.client.DeleteMetric(ctx, request)
+	return err
+}
+
+func (b *grpcBackend) Watch(ctx context.Context, mType string, names []string, fn func(utils.JSONMetric) error) error {
+	watch, err := b.client.WatchMetrics(ctx, &pb.WatchMetricsRequest{Type: mType, Names: names})
+	if err != nil {
+		return err
+	}
+	for {
+		event, err := watch.Recv()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, io.EOF) {
+			return errors.New("stream closed by server")
+		}
+		if err != nil {
+			return err
+		}
+		if event.Metric == nil {
+			continue
+		}
+		metric := fromPb(event.Metric)
+		if err = checkHash(metric, b.hashKey); err != nil {
+			return err
+		}
+		if err = fn(metric); err != nil {
+			return err
+		}
+	}
+}
+
+func (b *grpcBackend) Ping(ctx context.Context) error {
+	_, err := b.client.Ping(ctx, &pb.PingRequest{})
+	return err
+}
+
+// Health - метод проверки состояния сервера, оповещения по gRPC недоступны.
+func (b *grpcBackend) Health(ctx context.Context) []check {
+	checks := make([]check, 0, 2)
+	if err := b.Ping(ctx); err != nil {
+		checks = append(checks, check{Name: "storage", Status: checkFailed, Detail: err.Error()})
+	} else {
+		checks = append(checks, check{Name: "storage", Status: checkOK})
+	}
+	return append(checks, check{Name: "alerts", Status: checkSkipped, Detail: "not available over grpc"})
+}
+
+func (b *grpcBackend) Close() error {
+	return b.conn.Close()
+}
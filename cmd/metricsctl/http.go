@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/tiraill/go_collect_metrics/internal/alert"
+	"github.com/tiraill/go_collect_metrics/internal/clients"
+	"github.com/tiraill/go_collect_metrics/internal/handlers"
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// httpBackend - работа с сервером через версионированное HTTP API.
+// запросы подписываются и шифруются клиентом агента.
+type httpBackend struct {
+	client  *clients.BaseClient
+	hashKey string
+}
+
+func newHTTPBackend(config ctlConfig) (*httpBackend, error) {
+	client, err := clients.NewBaseClient(config.Address, config.Timeout, 1, config.CryptoKey, config.HashKey)
+	if err != nil {
+		return nil, err
+	}
+	return &httpBackend{client: client, hashKey: config.HashKey}, nil
+}
+
+// do - метод выполнения запроса к API и разбора JSON ответа в v, если v не nil.
+func (b *httpBackend) do(method, path string, body, payload []byte, okStatusCode int, v any) error {
+	headers := map[string]string{"Accept-Encoding": "gzip"}
+	if body != nil {
+		headers["Content-Type"] = "application/json"
+		headers["Content-Encoding"] = "gzip"
+	}
+	resp, err := b.client.DoRequest(&clients.Request{
+		Method:       method,
+		URL:          b.client.MakeURL(handlers.APIPrefix + path),
+		Headers:      headers,
+		Body:         body,
+		Payload:      payload,
+		OkStatusCode: okStatusCode,
+	})
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Body, v)
+}
+
+func (b *httpBackend) Get(_ context.Context, mType, id string) (utils.JSONMetric, error) {
+	var metric utils.JSONMetric
+	path := "/metrics/" + url.PathEscape(mType) + "/" + url.PathEscape(id)
+	if err := b.do(http.MethodGet, path, nil, nil, http.StatusOK, &metric); err != nil {
+		return metric, err
+	}
+	return metric, checkHash(metric, b.hashKey)
+}
+
+func (b *httpBackend) Search(_ context.Context, q storage.ListQuery) (storage.ListPage, error) {
+	params := url.Values{}
+	for key, value := range map[string]string{
+		"type": q.Type, "prefix": q.Prefix, "glob": q.Glob, "regex": q.Regex,
+		"sort": q.Sort, "cursor": q.Cursor,
+	} {
+		if value != "" {
+			params.Set(key, value)
+		}
+	}
+	if q.Limit > 0 {
+		params.Set("limit", strconv.Itoa(q.Limit))
+	}
+	var page storage.ListPage
+	if err := b.do(http.MethodGet, "/metrics/search?"+params.Encode(), nil, nil, http.StatusOK, &page); err != nil {
+		return page, err
+	}
+	for _, metric := range page.Metrics {
+		if err := checkHash(metric, b.hashKey); err != nil {
+			return page, err
+		}
+	}
+	return page, nil
+}
+
+func (b *httpBackend) Push(_ context.Context, metrics []utils.JSONMetric) ([]utils.JSONMetric, error) {
+	// тело подписывается целиком, поэтому хеш-суммы отдельных метрик не нужны
+	body, err := json.Marshal(metrics)
+	if err != nil {
+		return nil, err
+	}
+	saved := make([]utils.JSONMetric, 0, len(metrics))
+	if err = b.do(http.MethodPost, "/metrics/batch", body, nil, http.StatusOK, &saved); err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+func (b *httpBackend) Delete(_ context.Context, mType, id string) error {
+	path := "/metrics/" + url.PathEscape(mType) + "/" + url.PathEscape(id)
+	return b.do(http.MethodDelete, path, nil, utils.DeletePayload(mType, id), http.StatusNoContent, nil)
+}
+
+// Watch - метод чтения потока Server-Sent Events /stream.
+// тело потока не подписывается целиком, поэтому проверяется подпись каждой метрики.
+func (b *httpBackend) Watch(ctx context.Context, mType string, names []string, fn func(utils.JSONMetric) error) error {
+	params := url.Values{}
+	if mType != "" {
+		params.Set("type", mType)
+	}
+	if len(names) > 0 {
+		params.Set("name", strings.Join(names, ","))
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, b.client.MakeURL("/stream?"+params.Encode()), nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error: %s", resp.Status)
+	}
+
+	var event, data string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		case line == "":
+			if event == "metric" {
+				var metric utils.JSONMetric
+				if err = json.Unmarshal([]byte(data), &metric); err != nil {
+					return err
+				}
+				if err = checkHash(metric, b.hashKey); err != nil {
+					return err
+				}
+				if err = fn(metric); err != nil {
+					return err
+				}
+			}
+			event, data = "", ""
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("stream closed by server")
+}
+
+func (b *httpBackend) Ping(_ context.Context) error {
+	return b.do(http.MethodGet, "/ping", nil, nil, http.StatusOK, nil)
+}
+
+func (b *httpBackend) Health(ctx context.Context) []check {
+	checks := make([]check, 0, 2)
+	if err := b.Ping(ctx); err != nil {
+		checks = append(checks, check{Name: "storage", Status: checkFailed, Detail: err.Error()})
+	} else {
+		checks = append(checks, check{Name: "storage", Status: checkOK})
+	}
+	var alerts []alert.Alert
+	if err := b.do(http.MethodGet, "/alerts", nil, nil, http.StatusOK, &alerts); err != nil {
+		return append(checks, check{Name: "alerts", Status: checkFailed, Detail: err.Error()})
+	}
+	firing := make([]string, 0)
+	for _, a := range alerts {
+		if a.State == alert.StateFiring {
+			firing = append(firing, a.Fingerprint)
+		}
+	}
+	if len(firing) > 0 {
+		return append(checks, check{Name: "alerts", Status: checkFiring, Detail: strings.Join(firing, ", ")})
+	}
+	return append(checks, check{Name: "alerts", Status: checkOK})
+}
+
+func (b *httpBackend) Close() error {
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// keyRow - описание файла ключа для вывода.
+type keyRow struct {
+	File string `json:"file"`
+	utils.KeyInfo
+}
+
+var keysCommands = map[string]command{
+	"generate":    runKeysGenerate,
+	"hmac":        runKeysHMAC,
+	"fingerprint": runKeysFingerprint,
+	"inspect":     runKeysInspect,
+}
+
+// runKeys - работа с ключами шифрования и подписи, сервер не используется.
+func runKeys(ctx context.Context, e env, args []string) error {
+	if len(args) == 0 {
+		return usageError{msg: "expected generate, hmac, fingerprint or inspect"}
+	}
+	cmd, ok := keysCommands[args[0]]
+	if !ok {
+		return usageError{msg: fmt.Sprintf("unknown keys command %q", args[0])}
+	}
+	return cmd(ctx, e, args[1:])
+}
+
+// passphrase - пароль зашифрованного закрытого ключа из переменной окружения.
+func passphrase() []byte {
+	return []byte(os.Getenv(utils.PassphraseEnv))
+}
+
+// runKeysGenerate - создание пары RSA ключей: закрытый для сервера, открытый для агента.
+func runKeysGenerate(_ context.Context, e env, args []string) error {
+	fs := flag.NewFlagSet("keys generate", flag.ContinueOnError)
+	bits := fs.Int("bits", 4096, "RSA key size")
+	format := fs.String("format", utils.KeyFormatPKCS8, "private key format: pkcs1 or pkcs8")
+	encrypt := fs.Bool("encrypt", false, "encrypt private key with passphrase from "+utils.PassphraseEnv)
+	privatePath := fs.String("out", "private.pem", "private key file")
+	publicPath := fs.String("pub", "public.pem", "public key file")
+	force := fs.Bool("force", false, "overwrite existing files")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usageError{msg: "unexpected arguments"}
+	}
+	if *format != utils.KeyFormatPKCS1 && *format != utils.KeyFormatPKCS8 {
+		return usageError{msg: fmt.Sprintf("unknown format %q", *format)}
+	}
+	var secret []byte
+	if *encrypt {
+		if secret = passphrase(); len(secret) == 0 {
+			return usageError{msg: utils.PassphraseEnv + " is not set"}
+		}
+		if *format != utils.KeyFormatPKCS8 {
+			return usageError{msg: "-encrypt requires -format pkcs8"}
+		}
+	}
+	if *bits < utils.MinRSABits {
+		return usageError{msg: fmt.Sprintf("-bits must be at least %d", utils.MinRSABits)}
+	}
+	if !*force {
+		for _, path := range []string{*privatePath, *publicPath} {
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("%s already exists, use -force to overwrite", path)
+			}
+		}
+	}
+
+	key, err := utils.GenerateRSAKey(*bits)
+	if err != nil {
+		return err
+	}
+	privatePEM, err := utils.EncodePrivateKey(key, *format, secret)
+	if err != nil {
+		return err
+	}
+	publicPEM, err := utils.EncodePublicKey(&key.PublicKey)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(*privatePath, privatePEM, 0600); err != nil {
+		return err
+	}
+	if err = os.WriteFile(*publicPath, publicPEM, 0644); err != nil {
+		return err
+	}
+	rows := []keyRow{{File: *privatePath}, {File: *publicPath}}
+	for i, data := range [][]byte{privatePEM, publicPEM} {
+		if rows[i].KeyInfo, err = utils.InspectKey(data, secret); err != nil {
+			return err
+		}
+	}
+	return e.out.Keys(rows)
+}
+
+// runKeysHMAC - создание секрета подписи метрик для параметра KEY агента и сервера.
+func runKeysHMAC(_ context.Context, e env, args []string) error {
+	fs := flag.NewFlagSet("keys hmac", flag.ContinueOnError)
+	size := fs.Int("bytes", 32, "secret size in bytes")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usageError{msg: "unexpected arguments"}
+	}
+	if *size < 16 {
+		return usageError{msg: "-bytes must be at least 16"}
+	}
+	secret, err := utils.GenerateHMACKey(*size)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(e.out.w, secret)
+	return err
+}
+
+// runKeysFingerprint - вывод отпечатков ключей, у закрытого и открытого ключа пары они совпадают.
+func runKeysFingerprint(_ context.Context, e env, args []string) error {
+	if len(args) == 0 {
+		return usageError{msg: "expected <file>..."}
+	}
+	rows := make([]keyRow, 0, len(args))
+	for _, path := range args {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		key, err := utils.PublicKeyFromPEM(data, passphrase())
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		fingerprint, err := utils.Fingerprint(key)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		rows = append(rows, keyRow{File: path, KeyInfo: utils.KeyInfo{Fingerprint: fingerprint}})
+	}
+	return e.out.Fingerprints(rows)
+}
+
+// runKeysInspect - вывод типа, формата, размера и отпечатка ключей.
+// зашифрованный ключ без пароля описывается без размера и отпечатка.
+func runKeysInspect(_ context.Context, e env, args []string) error {
+	if len(args) == 0 {
+		return usageError{msg: "expected <file>..."}
+	}
+	rows := make([]keyRow, 0, len(args))
+	for _, path := range args {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		info, err := utils.InspectKey(data, passphrase())
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		rows = append(rows, keyRow{File: path, KeyInfo: info})
+	}
+	return e.out.Keys(rows)
+}
@@ -0,0 +1,145 @@
+// metricsctl - клиент командной строки сервера метрик, работает по HTTP и gRPC.
+//
+// Использование:
+//
+//	metricsctl [flags] <command> [command flags] [args]
+//
+// Команды:
+//
+//	get <type> <id>                        получение метрики
+//	list [-type] [-prefix] [-glob] [-regex] [-sort] [-limit]
+//	                                       получение списка метрик, все страницы
+//	push <type> <id> <value>               сохранение метрики
+//	push -f <file|-> [-format ndjson|csv]  сохранение метрик из файла в формате выгрузки сервера
+//	watch [-type] [id...]                  вывод изменений метрик до прерывания
+//	delete <type> <id>                     удаление метрики
+//	ping                                   проверка доступности сервера и хранилища
+//	health                                 проверки состояния, код выхода 1 при любой неуспешной проверке
+//	keys generate [-bits] [-format pkcs1|pkcs8] [-encrypt] [-out] [-pub] [-force]
+//	                                       создание пары RSA ключей для -crypto-key сервера и агента
+//	keys hmac [-bytes]                     создание секрета подписи для -k
+//	keys fingerprint <file>...             отпечатки ключей, у ключей одной пары совпадают
+//	keys inspect <file>...                 тип, формат, размер и отпечаток ключей
+//
+// Команды keys выполняются без обращения к серверу. Пароль зашифрованного закрытого ключа
+// задается переменной CRYPTO_KEY_PASSPHRASE, ее же читает сервер при загрузке ключа.
+//
+// Адрес, ключ подписи и ключ шифрования задаются так же, как у агента: флагами -a, -k, -crypto-key,
+// переменными ADDRESS, KEY, CRYPTO_KEY или файлом конфигурации -config.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Коды выхода.
+const (
+	exitOK        = 0
+	exitFailed    = 1 // ошибка выполнения команды или неуспешная проверка
+	exitUsage     = 2 // неверные аргументы
+	commandsUsage = "commands: get, list, push, watch, delete, ping, health, keys"
+)
+
+// env - окружение выполнения команды.
+type env struct {
+	config ctlConfig
+	client backend
+	out    printer
+	stdin  io.Reader
+}
+
+// command - подкоманда, args - аргументы после имени подкоманды.
+type command func(ctx context.Context, e env, args []string) error
+
+var commands = map[string]command{
+	"get":    runGet,
+	"list":   runList,
+	"push":   runPush,
+	"watch":  runWatch,
+	"delete": runDelete,
+	"ping":   runPing,
+	"health": runHealth,
+	"keys":   runKeys,
+}
+
+// localCommands - подкоманды, которым не нужно подключение к серверу.
+var localCommands = map[string]bool{
+	"keys": true,
+}
+
+// usageError - ошибка аргументов команды.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+// failedError - команда выполнена, но результат неуспешный, например health.
+type failedError struct{}
+
+func (failedError) Error() string {
+	return "check failed"
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run - метод выполнения команды, возвращает код выхода.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	loaded, err := newLoader().Load(args)
+	if loaded != nil && loaded.PrintConfig {
+		loaded.Print(stdout)
+		if err == nil {
+			return exitOK
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "metricsctl:", err)
+		return exitUsage
+	}
+	if len(loaded.Args) == 0 {
+		fmt.Fprintln(stderr, "metricsctl:", commandsUsage)
+		return exitUsage
+	}
+	name, cmdArgs := loaded.Args[0], loaded.Args[1:]
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "metricsctl: unknown command %q, %s\n", name, commandsUsage)
+		return exitUsage
+	}
+
+	e := env{config: loaded.Config, out: printer{w: stdout, format: loaded.Config.Output}, stdin: stdin}
+	if !localCommands[name] {
+		client, err := newBackend(loaded.Config)
+		if err != nil {
+			fmt.Fprintln(stderr, "metricsctl:", err)
+			return exitFailed
+		}
+		defer client.Close()
+		e.client = client
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = cmd(ctx, e, cmdArgs)
+	switch err.(type) {
+	case nil:
+		return exitOK
+	case failedError:
+		return exitFailed
+	case usageError:
+		fmt.Fprintf(stderr, "metricsctl %s: %v\n", name, err)
+		return exitUsage
+	default:
+		fmt.Fprintf(stderr, "metricsctl %s: %v\n", name, err)
+		return exitFailed
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tiraill/go_collect_metrics/internal/handlers"
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+func startServer(t *testing.T, hashKey string) string {
+	config := utils.ServerConfig{HashKey: hashKey}
+	srv := httptest.NewServer(handlers.GetRouter(storage.NewStorage(&utils.StorageConfig{}), config, nil, nil))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func runCtl(t *testing.T, stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_HTTP(t *testing.T) {
+	addr := startServer(t, "secret")
+	base := []string{"-a", addr, "-k", "secret"}
+
+	code, out, errOut := runCtl(t, "", append(base, "push", "gauge", "Alloc", "1.5")...)
+	require.Equal(t, exitOK, code, errOut)
+	assert.Equal(t, "ID     TYPE   VALUE\nAlloc  gauge  1.5\n", out)
+
+	code, _, errOut = runCtl(t, "id,type,value\nPollCount,counter,3\n", append(base, "push", "-f", "-", "-format", "csv")...)
+	require.Equal(t, exitOK, code, errOut)
+
+	code, out, _ = runCtl(t, "", append(base, "-o", "csv", "list", "-limit", "1")...)
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "id,type,value\nAlloc,gauge,1.5\nPollCount,counter,3\n", out)
+
+	code, out, _ = runCtl(t, "", append(base, "-o", "json", "get", "counter", "PollCount")...)
+	assert.Equal(t, exitOK, code)
+	assert.JSONEq(t, `{"id":"PollCount","type":"counter","delta":3}`, out)
+
+	code, _, errOut = runCtl(t, "", "-a", addr, "delete", "gauge", "Alloc")
+	assert.Equal(t, exitFailed, code)
+	assert.Contains(t, errOut, "401")
+
+	code, _, _ = runCtl(t, "", append(base, "delete", "gauge", "Alloc")...)
+	assert.Equal(t, exitOK, code)
+	code, _, errOut = runCtl(t, "", append(base, "get", "gauge", "Alloc")...)
+	assert.Equal(t, exitFailed, code)
+	assert.Contains(t, errOut, "404")
+
+	code, out, _ = runCtl(t, "", append(base, "health")...)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, "storage  ok")
+}
+
+func TestRun_WrongKey(t *testing.T) {
+	addr := startServer(t, "secret")
+	code, _, _ := runCtl(t, "", "-a", addr, "-k", "secret", "push", "gauge", "Alloc", "1")
+	require.Equal(t, exitOK, code)
+
+	code, _, errOut := runCtl(t, "", "-a", addr, "-k", "other", "get", "gauge", "Alloc")
+	assert.Equal(t, exitFailed, code)
+	assert.Contains(t, errOut, "hash")
+}
+
+func TestRun_Usage(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "no command", args: nil},
+		{name: "unknown command", args: []string{"drop"}},
+		{name: "bad output", args: []string{"-o", "xml", "ping"}},
+		{name: "encrypted grpc", args: []string{"-transport", "grpc", "-crypto-key", "key.pem", "ping"}},
+		{name: "get arguments", args: []string{"get", "gauge"}},
+		{name: "push value", args: []string{"push", "gauge", "Alloc", "abc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, errOut := runCtl(t, "", tt.args...)
+			assert.Equal(t, exitUsage, code)
+			assert.NotEmpty(t, errOut)
+		})
+	}
+}
+
+func TestRun_Keys(t *testing.T) {
+	dir := t.TempDir()
+	privatePath, publicPath := filepath.Join(dir, "private.pem"), filepath.Join(dir, "public.pem")
+	t.Setenv(utils.PassphraseEnv, "passphrase")
+
+	code, out, errOut := runCtl(t, "", "keys", "generate", "-bits", "2048", "-encrypt", "-out", privatePath, "-pub", publicPath)
+	require.Equal(t, exitOK, code, errOut)
+	assert.Contains(t, out, "private  pkcs8   true")
+
+	code, _, errOut = runCtl(t, "", "keys", "generate", "-bits", "2048", "-out", privatePath, "-pub", publicPath)
+	assert.Equal(t, exitFailed, code)
+	assert.Contains(t, errOut, "already exists")
+
+	code, out, errOut = runCtl(t, "", "keys", "fingerprint", privatePath, publicPath)
+	require.Equal(t, exitOK, code, errOut)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, strings.Fields(lines[0])[0], strings.Fields(lines[1])[0])
+
+	t.Setenv(utils.PassphraseEnv, "")
+	code, out, errOut = runCtl(t, "", "-o", "json", "keys", "inspect", privatePath)
+	require.Equal(t, exitOK, code, errOut)
+	assert.JSONEq(t, `[{"file":"`+privatePath+`","kind":"private","format":"pkcs8","encrypted":true,"algorithm":"RSA"}]`, out)
+
+	code, out, errOut = runCtl(t, "", "keys", "hmac", "-bytes", "16")
+	require.Equal(t, exitOK, code, errOut)
+	assert.Len(t, strings.TrimSpace(out), 32)
+
+	require.NoError(t, os.WriteFile(privatePath, []byte("not a key"), 0600))
+	code, _, errOut = runCtl(t, "", "keys", "inspect", privatePath)
+	assert.Equal(t, exitFailed, code)
+	assert.Contains(t, errOut, utils.ErrNoPEMBlock.Error())
+
+	code, _, _ = runCtl(t, "", "keys", "rotate")
+	assert.Equal(t, exitUsage, code)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// printer - вывод результатов команд в выбранном формате.
+// csv совпадает с форматом выгрузки сервера и может быть загружен командой push -f.
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+// metricRow - метрика без хеш-суммы для вывода в JSON.
+func metricRow(metric utils.JSONMetric) utils.JSONMetric {
+	metric.Hash = nil
+	return metric
+}
+
+// Metrics - метод вывода списка метрик.
+func (p printer) Metrics(metrics []utils.JSONMetric) error {
+	switch p.format {
+	case outputJSON:
+		rows := make([]utils.JSONMetric, 0, len(metrics))
+		for _, metric := range metrics {
+			rows = append(rows, metricRow(metric))
+		}
+		return p.json(rows)
+	case outputCSV:
+		return storage.WriteMetrics(p.w, metrics, storage.FormatCSV)
+	default:
+		tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tTYPE\tVALUE")
+		for _, metric := range metrics {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", metric.ID, metric.MType, metric.ValueString())
+		}
+		return tw.Flush()
+	}
+}
+
+// Metric - метод вывода одной метрики, в JSON выводится объект, а не список.
+func (p printer) Metric(metric utils.JSONMetric) error {
+	if p.format == outputJSON {
+		return p.json(metricRow(metric))
+	}
+	return p.Metrics([]utils.JSONMetric{metric})
+}
+
+// WatchHeader - метод вывода заголовка перед потоком изменений.
+func (p printer) WatchHeader() error {
+	switch p.format {
+	case outputJSON:
+		return nil
+	case outputCSV:
+		writer := csv.NewWriter(p.w)
+		writer.Write([]string{"id", "type", "value"})
+		writer.Flush()
+		return writer.Error()
+	default:
+		_, err := fmt.Fprintln(p.w, "ID\tTYPE\tVALUE")
+		return err
+	}
+}
+
+// WatchMetric - метод вывода одного изменения, в JSON по одному объекту на строку.
+func (p printer) WatchMetric(metric utils.JSONMetric) error {
+	switch p.format {
+	case outputJSON:
+		return json.NewEncoder(p.w).Encode(metricRow(metric))
+	case outputCSV:
+		writer := csv.NewWriter(p.w)
+		writer.Write([]string{metric.ID, metric.MType, metric.ValueString()})
+		writer.Flush()
+		return writer.Error()
+	default:
+		_, err := fmt.Fprintf(p.w, "%s\t%s\t%s\n", metric.ID, metric.MType, metric.ValueString())
+		return err
+	}
+}
+
+// Checks - метод вывода результатов health.
+func (p printer) Checks(checks []check) error {
+	switch p.format {
+	case outputJSON:
+		return p.json(checks)
+	case outputCSV:
+		writer := csv.NewWriter(p.w)
+		writer.Write([]string{"name", "status", "detail"})
+		for _, c := range checks {
+			writer.Write([]string{c.Name, c.Status, c.Detail})
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "CHECK\tSTATUS\tDETAIL")
+		for _, c := range checks {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Name, c.Status, c.Detail)
+		}
+		return tw.Flush()
+	}
+}
+
+// Keys - метод вывода описаний файлов ключей.
+func (p printer) Keys(rows []keyRow) error {
+	switch p.format {
+	case outputJSON:
+		return p.json(rows)
+	case outputCSV:
+		writer := csv.NewWriter(p.w)
+		writer.Write([]string{"file", "kind", "format", "encrypted", "bits", "fingerprint"})
+		for _, r := range rows {
+			writer.Write([]string{r.File, r.Kind, r.Format, strconv.FormatBool(r.Encrypted), strconv.Itoa(r.Bits), r.Fingerprint})
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "FILE\tKIND\tFORMAT\tENCRYPTED\tBITS\tFINGERPRINT")
+		for _, r := range rows {
+			bits, fingerprint := "-", "-"
+			if r.Bits > 0 {
+				bits, fingerprint = strconv.Itoa(r.Bits), r.Fingerprint
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%t\t%s\t%s\n", r.File, r.Kind, r.Format, r.Encrypted, bits, fingerprint)
+		}
+		return tw.Flush()
+	}
+}
+
+// Fingerprints - метод вывода отпечатков ключей, в таблице в виде "отпечаток файл".
+func (p printer) Fingerprints(rows []keyRow) error {
+	switch p.format {
+	case outputJSON:
+		type fingerprintRow struct {
+			File        string `json:"file"`
+			Fingerprint string `json:"fingerprint"`
+		}
+		out := make([]fingerprintRow, 0, len(rows))
+		for _, r := range rows {
+			out = append(out, fingerprintRow{File: r.File, Fingerprint: r.Fingerprint})
+		}
+		return p.json(out)
+	case outputCSV:
+		writer := csv.NewWriter(p.w)
+		writer.Write([]string{"file", "fingerprint"})
+		for _, r := range rows {
+			writer.Write([]string{r.File, r.Fingerprint})
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		for _, r := range rows {
+			if _, err := fmt.Fprintf(p.w, "%s  %s\n", r.Fingerprint, r.File); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (p printer) json(v any) error {
+	encoder := json.NewEncoder(p.w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
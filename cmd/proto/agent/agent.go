@@ -2,120 +2,109 @@ package main
 
 import (
 	"context"
-	"flag"
 	"fmt"
-	"github.com/tiraill/go_collect_metrics/internal/utils"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
 	"google.golang.org/grpc/credentials/insecure"
 
+	"github.com/tiraill/go_collect_metrics/internal/agent"
+	"github.com/tiraill/go_collect_metrics/internal/config"
+	"github.com/tiraill/go_collect_metrics/internal/logger"
+	"github.com/tiraill/go_collect_metrics/internal/tracing"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+
 	pb "github.com/tiraill/go_collect_metrics/cmd/proto"
 )
 
+// serviceName - имя сервиса агента в span.
+const serviceName = "metrics-agent"
+
 var (
-	address        *string
-	reportInterval *time.Duration
-	pollInterval   *time.Duration
-	timeout        = 5 * time.Second
-	hashKey        *string
-	cryptoKey      *string
-	configFile     *string
-	rateLimit      *int
-	buildVersion   = "N/A"
-	buildDate      = "N/A"
-	buildCommit    = "N/A"
+	timeout      = 5 * time.Second
+	buildVersion = "N/A"
+	buildDate    = "N/A"
+	buildCommit  = "N/A"
 )
 
-func init() {
-	address = flag.String("a", "127.0.0.1:3200", "server address")
-	reportInterval = flag.Duration("r", 10*time.Second, "report interval")
-	pollInterval = flag.Duration("p", 2*time.Second, "pool interval")
-	hashKey = flag.String("k", "", "hash key")
-	cryptoKey = flag.String("crypto-key", "", "public crypto key")
-	configFile = flag.String("config", "", "config file")
-	rateLimit = flag.Int("l", 10, "rate limit")
-}
-
-func reportStatistic(statistic *utils.Statistic, config utils.AgentConfig, metricClient pb.MetricsClient) {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Println("Recovered in f", r)
-		}
-	}()
-	log.Println("Sending report...")
-	statCopy := statistic.Copy()
-	report := utils.NewJSONReport(statCopy, config.HashKey)
-	metrics := make([]*pb.Metric, 0, len(report.Metrics))
-	for _, m := range report.Metrics {
-		pbMetric := utils.JSONMetricToPbMetric(&m)
-		metrics = append(metrics, pbMetric)
+// run - метод запуска агента до получения сигнала остановки.
+// сбор метрик и отправка отчетов выполняются воркерами agent.Agent, отчеты доставляет streamReporter.
+// конфигурация, включая настройки журнала, перечитывается по SIGHUP и при изменении файла конфигурации.
+func run(loader *config.Loader[utils.AgentConfig], loaded *config.Effective[utils.AgentConfig]) error {
+	agentConfig := loaded.Config
+	if err := logger.Configure(agentConfig.Log); err != nil {
+		return err
 	}
-	_, err := metricClient.SaveBatchMetrics(
-		context.Background(),
-		&pb.SaveBatchMetricRequest{Metrics: metrics},
-	)
-	if err != nil {
-		log.Println("Fail send report", statCopy.Counter, err)
-	} else {
-		log.Println("Send report successfully", statCopy.Counter)
-		statistic.ResetCounter()
+	defer logger.Sync()
+	// отправка на несколько серверов реализована в HTTP агенте
+	if servers := agentConfig.Servers(); len(servers) != 1 {
+		return fmt.Errorf("grpc agent supports a single server address, got %d", len(servers))
 	}
-}
-
-func main() {
-	fmt.Println("Build version:", buildVersion)
-	fmt.Println("Build date:", buildDate)
-	fmt.Println("Build commit:", buildCommit)
-	flag.Parse()
-
-	config, err := utils.MakeAgentConfig(*configFile, *address, *reportInterval, *pollInterval, *hashKey, *cryptoKey, *rateLimit)
+	stopTracing, err := tracing.Setup(agentConfig.Trace, serviceName)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-	stat := utils.NewStatistic()
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout*time.Second)
-	defer cancel()
-
-	conn, err := grpc.DialContext(
-		ctx,
-		config.Address,
+	conn, err := grpc.Dial(
+		agentConfig.Address,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithKeepaliveParams(clientKeepalive),
+		grpc.WithUnaryInterceptor(otelgrpc.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(otelgrpc.StreamClientInterceptor()),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff:           backoff.Config{BaseDelay: reconnectMinDelay, Multiplier: 2, Jitter: 0.2, MaxDelay: reconnectMaxDelay},
+			MinConnectTimeout: timeout,
+		}),
 	)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer conn.Close()
-	client := pb.NewMetricsClient(conn)
+	reporter := newStreamReporter(pb.NewMetricsClient(conn), agentConfig)
+	a := agent.NewWithReporter(agentConfig, reporter)
+	if err = a.Start(context.Background()); err != nil {
+		return err
+	}
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	go loader.Watch(watchCtx, loaded, func(next *config.Effective[utils.AgentConfig], _ []string) error {
+		if err := a.Reload(next.Config); err != nil {
+			return err
+		}
+		reporter.SetHashKey(next.Config.HashKey)
+		return logger.Configure(next.Config.Log)
+	})
 
-	reportStatisticTicker := time.NewTicker(config.ReportInterval)
-	updateStatisticTicker := time.NewTicker(config.PollInterval)
-	updateMemCPUStatisticTicker := time.NewTicker(config.PollInterval)
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	sig := <-done
+	logger.L("agent").Info("agent stopping", zap.String("signal", sig.String()))
 
-	log.Print("Agent Started")
-	for {
-		select {
-		case <-reportStatisticTicker.C:
-			reportStatistic(stat, config, client)
-		case <-updateStatisticTicker.C:
-			stat.CollectRuntime()
-		case <-updateMemCPUStatisticTicker.C:
-			stat.CollectMemCPU()
-		case s := <-done:
-			log.Print("Agent Stopped. Signal: ", s)
-			reportStatisticTicker.Stop()
-			updateStatisticTicker.Stop()
-			updateMemCPUStatisticTicker.Stop()
-			reportStatistic(stat, config, client)
-			log.Print("Exit")
-			return
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), a.Config().ShutdownTimeout)
+	defer cancel()
+	if err := a.Stop(ctx); err != nil {
+		logger.L("agent").Error("agent stopped with error", zap.Error(err))
+	}
+	if err := stopTracing(ctx); err != nil {
+		logger.L("agent").Error("failed to flush traces", zap.Error(err))
+	}
+	return nil
+}
+
+func main() {
+	fmt.Println("Build version:", buildVersion)
+	fmt.Println("Build date:", buildDate)
+	fmt.Println("Build commit:", buildCommit)
+	loader := config.NewAgentLoader("agent", "127.0.0.1:3200")
+	loaded := loader.MustLoad(os.Args[1:])
+	if err := run(loader, loaded); err != nil {
+		log.Fatal(err)
 	}
 }
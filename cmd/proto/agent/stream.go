@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+
+	"github.com/tiraill/go_collect_metrics/internal/logger"
+	"github.com/tiraill/go_collect_metrics/internal/tracing"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+
+	pb "github.com/tiraill/go_collect_metrics/cmd/proto"
+)
+
+// streamWindow - максимальное количество неподтвержденных пачек в потоке.
+// пока окно заполнено, отчеты не отправляются, а PollCount продолжает накапливаться.
+const streamWindow = 4
+
+// Задержка переподключения потока, удваивается после каждой неудачной попытки.
+const (
+	reconnectMinDelay = time.Second
+	reconnectMaxDelay = 30 * time.Second
+)
+
+// clientKeepalive - ping соединения без активности, интервал не меньше разрешенного сервером.
+var clientKeepalive = keepalive.ClientParameters{Time: 20 * time.Second, Timeout: 10 * time.Second, PermitWithoutStream: true}
+
+// streamReporter - отправка отчетов через поток StreamMetrics, пока поток не подключен - unary вызовом SaveBatchMetrics.
+// значение PollCount пачки, которая не подтверждена или отклонена сервером, отправляется со следующим отчетом,
+// поэтому при обрыве потока после записи пачки сервером PollCount может быть учтен повторно.
+type streamReporter struct {
+	client   pb.MetricsClient
+	hashKey  string        // ключ подписи, изменяется при перезагрузке конфигурации
+	agentID  string        // идентификатор агента в подписи unary вызовов для ограничения частоты запросов на сервере
+	timeout  time.Duration // время ожидания ответа на unary вызов
+	partial  bool          // unary вызовы в режиме частичной загрузки
+	mutex    sync.Mutex
+	stream   pb.Metrics_StreamMetricsClient
+	sequence uint64
+	pending  map[uint64]int64 // неподтвержденные пачки: номер пачки - значение PollCount в ней
+	unsent   int64            // значение PollCount, которое не принято сервером
+	acked    chan struct{}
+}
+
+func newStreamReporter(client pb.MetricsClient, config utils.AgentConfig) *streamReporter {
+	return &streamReporter{
+		client:  client,
+		hashKey: config.HashKey,
+		agentID: utils.AgentID(),
+		timeout: config.SendTimeout,
+		partial: config.PartialBatch,
+		pending: make(map[uint64]int64),
+		acked:   make(chan struct{}, 1),
+	}
+}
+
+// SetHashKey - метод замены ключа подписи при перезагрузке конфигурации.
+// новый ключ применяется к следующим отчетам.
+func (r *streamReporter) SetHashKey(hashKey string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.hashKey = hashKey
+}
+
+// Run - метод поддержки открытого потока с переподключением до отмены ctx.
+func (r *streamReporter) Run(ctx context.Context) {
+	delay := reconnectMinDelay
+	for {
+		// WaitForReady - вызов ждет восстановления соединения вместо немедленной ошибки
+		s, err := r.client.StreamMetrics(ctx, grpc.WaitForReady(true))
+		if err == nil {
+			r.attach(s)
+			logger.L("agent").Info("metrics stream connected")
+			var acks int
+			acks, err = r.receive(s)
+			r.detach(s)
+			if acks > 0 {
+				delay = reconnectMinDelay
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		logger.L("agent").Warn("metrics stream closed", zap.Error(err), zap.Duration("reconnect_in", delay))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > reconnectMaxDelay {
+			delay = reconnectMaxDelay
+		}
+	}
+}
+
+func (r *streamReporter) attach(s pb.Metrics_StreamMetricsClient) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.stream = s
+}
+
+// detach - отключение потока, PollCount неподтвержденных пачек отправляется со следующим отчетом.
+func (r *streamReporter) detach(s pb.Metrics_StreamMetricsClient) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.stream == s {
+		r.stream = nil
+	}
+	for sequence, counter := range r.pending {
+		r.unsent += counter
+		delete(r.pending, sequence)
+	}
+	r.notify()
+}
+
+// receive - чтение подтверждений до ошибки потока.
+func (r *streamReporter) receive(s pb.Metrics_StreamMetricsClient) (int, error) {
+	acks := 0
+	for {
+		ack, err := s.Recv()
+		if err != nil {
+			return acks, err
+		}
+		acks++
+		r.mutex.Lock()
+		counter, ok := r.pending[ack.Sequence]
+		delete(r.pending, ack.Sequence)
+		if ok && ack.Error != "" {
+			r.unsent += counter
+		}
+		r.notify()
+		r.mutex.Unlock()
+		if ack.Error != "" {
+			logger.L("agent").Error("failed to send report", zap.Uint64("sequence", ack.Sequence), zap.String("error", ack.Error))
+		} else {
+			logger.L("agent").Info("report sent", zap.Uint64("sequence", ack.Sequence), zap.Int64("poll_count", counter))
+		}
+	}
+}
+
+func (r *streamReporter) notify() {
+	select {
+	case r.acked <- struct{}{}:
+	default:
+	}
+}
+
+// Send - метод отправки отчета в поток или, если поток не подключен, unary вызовом.
+// отчет, записанный в поток, считается отправленным, подтверждение приходит позже.
+func (r *streamReporter) Send(ctx context.Context, stat *utils.Statistic, delta int64) bool {
+	if r.sendStream(stat, delta) {
+		return true
+	}
+	return r.sendUnary(ctx, stat, delta)
+}
+
+// Flush - метод отправки последнего отчета с ожиданием подтверждения всех пачек потока.
+// PollCount пачек, отклоненных сервером или отложенных из-за заполненного окна, досылается unary вызовом.
+func (r *streamReporter) Flush(ctx context.Context, stat *utils.Statistic, delta int64) bool {
+	if !r.sendStream(stat, delta) {
+		return r.sendUnary(ctx, stat, delta)
+	}
+	if !r.wait(ctx) {
+		return false
+	}
+	r.mutex.Lock()
+	unsent := r.unsent
+	r.mutex.Unlock()
+	return unsent == 0 || r.sendUnary(ctx, stat, 0)
+}
+
+// sendStream - метод записи отчета в поток.
+// возвращает false, если поток не подключен и отчет нужно отправить другим способом.
+func (r *streamReporter) sendStream(stat *utils.Statistic, delta int64) bool {
+	r.mutex.Lock()
+	s := r.stream
+	if s == nil {
+		r.mutex.Unlock()
+		return false
+	}
+	if len(r.pending) >= streamWindow {
+		r.unsent += delta
+		r.mutex.Unlock()
+		logger.L("agent").Warn("stream window is full, report postponed")
+		return true
+	}
+	delta += r.unsent
+	r.unsent = 0
+	r.sequence++
+	sequence := r.sequence
+	r.pending[sequence] = delta
+	hashKey := r.hashKey
+	r.mutex.Unlock()
+
+	statCopy := stat.Copy()
+	statCopy.Counter = delta
+	report := utils.NewJSONReport(statCopy, hashKey)
+	request := &pb.StreamMetricsRequest{Sequence: sequence, Metrics: make([]*pb.Metric, 0, len(report.Metrics))}
+	for _, m := range report.Metrics {
+		request.Metrics = append(request.Metrics, utils.JSONMetricToPbMetric(&m))
+	}
+	if err := utils.SignStreamBatch(request, hashKey); err != nil {
+		logger.L("agent").Error("failed to sign report", zap.Error(err))
+		r.mutex.Lock()
+		delete(r.pending, sequence)
+		r.unsent += delta
+		r.mutex.Unlock()
+		return true
+	}
+	// при ошибке отправки поток будет закрыт, и detach сохранит PollCount пачки для следующего отчета
+	if err := s.Send(request); err != nil {
+		logger.L("agent").Error("failed to send report", zap.Uint64("sequence", sequence), zap.Error(err))
+	}
+	return true
+}
+
+// sendUnary - метод отправки отчета unary вызовом SaveBatchMetrics, возвращает true, если сервер принял PollCount.
+func (r *streamReporter) sendUnary(ctx context.Context, stat *utils.Statistic, delta int64) bool {
+	r.mutex.Lock()
+	delta += r.unsent
+	r.unsent = 0
+	hashKey := r.hashKey
+	r.mutex.Unlock()
+	applied := false
+	defer func() {
+		if !applied {
+			r.mutex.Lock()
+			r.unsent += delta
+			r.mutex.Unlock()
+		}
+	}()
+
+	_, buildSpan := tracing.Start(ctx, "build report")
+	statCopy := stat.Copy()
+	statCopy.Counter = delta
+	report := utils.NewJSONReport(statCopy, hashKey)
+	request := &pb.SaveBatchMetricRequest{Metrics: make([]*pb.Metric, 0, len(report.Metrics)), Partial: r.partial}
+	for _, m := range report.Metrics {
+		request.Metrics = append(request.Metrics, utils.JSONMetricToPbMetric(&m))
+	}
+	buildSpan.SetAttributes(attribute.Int64("poll_count", delta), attribute.Int("metrics", len(request.Metrics)))
+	buildSpan.End()
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	_, signSpan := tracing.Start(ctx, "sign")
+	ctx, err := utils.SignContext(ctx, request, r.agentID, hashKey)
+	tracing.End(signSpan, err)
+	if err != nil {
+		logger.L("agent").Error("failed to sign report", zap.Error(err))
+		return false
+	}
+	response, err := r.client.SaveBatchMetrics(ctx, request)
+	if err != nil {
+		logger.L("agent").Error("failed to send report", zap.Int64("poll_count", delta), zap.Error(err))
+		return false
+	}
+	// без частичной загрузки или на сервере без нее результатов нет, и успешный ответ означает запись всего отчета
+	applied = len(response.Results) == 0
+	for _, result := range response.Results {
+		switch {
+		case result.Status != utils.BatchStatusOK:
+			logger.L("agent").Warn("metric rejected",
+				zap.String("type", result.Type), zap.String("id", result.Id), zap.String("code", result.Code), zap.String("message", result.Message))
+		case result.Id == "PollCount":
+			applied = true
+		}
+	}
+	logger.L("agent").Info("report sent", zap.Int64("poll_count", delta))
+	return applied
+}
+
+// wait - метод ожидания подтверждения всех отправленных пачек.
+func (r *streamReporter) wait(ctx context.Context) bool {
+	for {
+		r.mutex.Lock()
+		pending := len(r.pending)
+		r.mutex.Unlock()
+		if pending == 0 {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-r.acked:
+		}
+	}
+}
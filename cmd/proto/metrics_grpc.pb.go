@@ -23,7 +23,11 @@ const (
 	Metrics_SaveBatchMetrics_FullMethodName = "/main.Metrics/SaveBatchMetrics"
 	Metrics_GetMetric_FullMethodName        = "/main.Metrics/GetMetric"
 	Metrics_GetListMetrics_FullMethodName   = "/main.Metrics/GetListMetrics"
+	Metrics_SearchMetrics_FullMethodName    = "/main.Metrics/SearchMetrics"
 	Metrics_Ping_FullMethodName             = "/main.Metrics/Ping"
+	Metrics_DeleteMetric_FullMethodName     = "/main.Metrics/DeleteMetric"
+	Metrics_StreamMetrics_FullMethodName    = "/main.Metrics/StreamMetrics"
+	Metrics_WatchMetrics_FullMethodName     = "/main.Metrics/WatchMetrics"
 )
 
 // MetricsClient is the client API for Metrics service.
@@ -34,7 +38,14 @@ type MetricsClient interface {
 	SaveBatchMetrics(ctx context.Context, in *SaveBatchMetricRequest, opts ...grpc.CallOption) (*SaveBatchMetricResponse, error)
 	GetMetric(ctx context.Context, in *GetMetricRequest, opts ...grpc.CallOption) (*GetMetricResponse, error)
 	GetListMetrics(ctx context.Context, in *ListMetricRequest, opts ...grpc.CallOption) (*ListMetricResponse, error)
+	SearchMetrics(ctx context.Context, in *SearchMetricsRequest, opts ...grpc.CallOption) (*SearchMetricsResponse, error)
 	Ping(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*PingResponse, error)
+	// DeleteMetric - удаление метрики, изменяющий метод с проверкой подсети записи
+	DeleteMetric(ctx context.Context, in *DeleteMetricRequest, opts ...grpc.CallOption) (*DeleteMetricResponse, error)
+	// StreamMetrics - поток пачек метрик от агента, сервер подтверждает каждую пачку
+	StreamMetrics(ctx context.Context, opts ...grpc.CallOption) (Metrics_StreamMetricsClient, error)
+	// WatchMetrics - поток изменений метрик с фильтром по типу и именам
+	WatchMetrics(ctx context.Context, in *WatchMetricsRequest, opts ...grpc.CallOption) (Metrics_WatchMetricsClient, error)
 }
 
 type metricsClient struct {
@@ -81,6 +92,15 @@ func (c *metricsClient) GetListMetrics(ctx context.Context, in *ListMetricReques
 	return out, nil
 }
 
+func (c *metricsClient) SearchMetrics(ctx context.Context, in *SearchMetricsRequest, opts ...grpc.CallOption) (*SearchMetricsResponse, error) {
+	out := new(SearchMetricsResponse)
+	err := c.cc.Invoke(ctx, Metrics_SearchMetrics_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *metricsClient) Ping(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*PingResponse, error) {
 	out := new(PingResponse)
 	err := c.cc.Invoke(ctx, Metrics_Ping_FullMethodName, in, out, opts...)
@@ -90,6 +110,78 @@ func (c *metricsClient) Ping(ctx context.Context, in *PingRequest, opts ...grpc.
 	return out, nil
 }
 
+func (c *metricsClient) DeleteMetric(ctx context.Context, in *DeleteMetricRequest, opts ...grpc.CallOption) (*DeleteMetricResponse, error) {
+	out := new(DeleteMetricResponse)
+	err := c.cc.Invoke(ctx, Metrics_DeleteMetric_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsClient) StreamMetrics(ctx context.Context, opts ...grpc.CallOption) (Metrics_StreamMetricsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Metrics_ServiceDesc.Streams[0], Metrics_StreamMetrics_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &metricsStreamMetricsClient{stream}
+	return x, nil
+}
+
+type Metrics_StreamMetricsClient interface {
+	Send(*StreamMetricsRequest) error
+	Recv() (*StreamMetricsAck, error)
+	grpc.ClientStream
+}
+
+type metricsStreamMetricsClient struct {
+	grpc.ClientStream
+}
+
+func (x *metricsStreamMetricsClient) Send(m *StreamMetricsRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *metricsStreamMetricsClient) Recv() (*StreamMetricsAck, error) {
+	m := new(StreamMetricsAck)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *metricsClient) WatchMetrics(ctx context.Context, in *WatchMetricsRequest, opts ...grpc.CallOption) (Metrics_WatchMetricsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Metrics_ServiceDesc.Streams[1], Metrics_WatchMetrics_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &metricsWatchMetricsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Metrics_WatchMetricsClient interface {
+	Recv() (*WatchMetricsEvent, error)
+	grpc.ClientStream
+}
+
+type metricsWatchMetricsClient struct {
+	grpc.ClientStream
+}
+
+func (x *metricsWatchMetricsClient) Recv() (*WatchMetricsEvent, error) {
+	m := new(WatchMetricsEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // MetricsServer is the server API for Metrics service.
 // All implementations must embed UnimplementedMetricsServer
 // for forward compatibility
@@ -98,7 +190,14 @@ type MetricsServer interface {
 	SaveBatchMetrics(context.Context, *SaveBatchMetricRequest) (*SaveBatchMetricResponse, error)
 	GetMetric(context.Context, *GetMetricRequest) (*GetMetricResponse, error)
 	GetListMetrics(context.Context, *ListMetricRequest) (*ListMetricResponse, error)
+	SearchMetrics(context.Context, *SearchMetricsRequest) (*SearchMetricsResponse, error)
 	Ping(context.Context, *PingRequest) (*PingResponse, error)
+	// DeleteMetric - удаление метрики, изменяющий метод с проверкой подсети записи
+	DeleteMetric(context.Context, *DeleteMetricRequest) (*DeleteMetricResponse, error)
+	// StreamMetrics - поток пачек метрик от агента, сервер подтверждает каждую пачку
+	StreamMetrics(Metrics_StreamMetricsServer) error
+	// WatchMetrics - поток изменений метрик с фильтром по типу и именам
+	WatchMetrics(*WatchMetricsRequest, Metrics_WatchMetricsServer) error
 	mustEmbedUnimplementedMetricsServer()
 }
 
@@ -118,9 +217,21 @@ func (UnimplementedMetricsServer) GetMetric(context.Context, *GetMetricRequest)
 func (UnimplementedMetricsServer) GetListMetrics(context.Context, *ListMetricRequest) (*ListMetricResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetListMetrics not implemented")
 }
+func (UnimplementedMetricsServer) SearchMetrics(context.Context, *SearchMetricsRequest) (*SearchMetricsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchMetrics not implemented")
+}
 func (UnimplementedMetricsServer) Ping(context.Context, *PingRequest) (*PingResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Ping not implemented")
 }
+func (UnimplementedMetricsServer) DeleteMetric(context.Context, *DeleteMetricRequest) (*DeleteMetricResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteMetric not implemented")
+}
+func (UnimplementedMetricsServer) StreamMetrics(Metrics_StreamMetricsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamMetrics not implemented")
+}
+func (UnimplementedMetricsServer) WatchMetrics(*WatchMetricsRequest, Metrics_WatchMetricsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchMetrics not implemented")
+}
 func (UnimplementedMetricsServer) mustEmbedUnimplementedMetricsServer() {}
 
 // UnsafeMetricsServer may be embedded to opt out of forward compatibility for this service.
@@ -206,6 +317,24 @@ func _Metrics_GetListMetrics_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Metrics_SearchMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchMetricsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServer).SearchMetrics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Metrics_SearchMetrics_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServer).SearchMetrics(ctx, req.(*SearchMetricsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Metrics_Ping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(PingRequest)
 	if err := dec(in); err != nil {
@@ -224,6 +353,71 @@ func _Metrics_Ping_Handler(srv interface{}, ctx context.Context, dec func(interf
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Metrics_DeleteMetric_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteMetricRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServer).DeleteMetric(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Metrics_DeleteMetric_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServer).DeleteMetric(ctx, req.(*DeleteMetricRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Metrics_StreamMetrics_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MetricsServer).StreamMetrics(&metricsStreamMetricsServer{stream})
+}
+
+type Metrics_StreamMetricsServer interface {
+	Send(*StreamMetricsAck) error
+	Recv() (*StreamMetricsRequest, error)
+	grpc.ServerStream
+}
+
+type metricsStreamMetricsServer struct {
+	grpc.ServerStream
+}
+
+func (x *metricsStreamMetricsServer) Send(m *StreamMetricsAck) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *metricsStreamMetricsServer) Recv() (*StreamMetricsRequest, error) {
+	m := new(StreamMetricsRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Metrics_WatchMetrics_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchMetricsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MetricsServer).WatchMetrics(m, &metricsWatchMetricsServer{stream})
+}
+
+type Metrics_WatchMetricsServer interface {
+	Send(*WatchMetricsEvent) error
+	grpc.ServerStream
+}
+
+type metricsWatchMetricsServer struct {
+	grpc.ServerStream
+}
+
+func (x *metricsWatchMetricsServer) Send(m *WatchMetricsEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // Metrics_ServiceDesc is the grpc.ServiceDesc for Metrics service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -247,11 +441,31 @@ var Metrics_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetListMetrics",
 			Handler:    _Metrics_GetListMetrics_Handler,
 		},
+		{
+			MethodName: "SearchMetrics",
+			Handler:    _Metrics_SearchMetrics_Handler,
+		},
 		{
 			MethodName: "Ping",
 			Handler:    _Metrics_Ping_Handler,
 		},
+		{
+			MethodName: "DeleteMetric",
+			Handler:    _Metrics_DeleteMetric_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamMetrics",
+			Handler:       _Metrics_StreamMetrics_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchMetrics",
+			Handler:       _Metrics_WatchMetrics_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "cmd/proto/metrics.proto",
 }
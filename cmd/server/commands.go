@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// runCommand - метод выполнения подкоманды сервера над хранилищем из конфигурации.
+// export [-format ndjson|csv] [file] - выгрузка метрик в файл или stdout.
+// import [-format ndjson|csv] [-mode merge|replace] [file] - загрузка метрик из файла или stdin.
+func runCommand(args []string, config utils.StorageConfig) error {
+	// файловое хранилище читается при запуске и сохраняется сразу после изменения
+	config.StoreInterval = 0
+	config.Restore = true
+
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	format := fs.String("format", storage.FormatNDJSON, "data format: ndjson or csv")
+	var mode *string
+	switch args[0] {
+	case "export":
+	case "import":
+		mode = fs.String("mode", storage.ImportMerge, "import mode: merge or replace")
+	default:
+		return fmt.Errorf("unknown command %q, expected export or import", args[0])
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("%s: too many arguments", args[0])
+	}
+
+	ctx := context.Background()
+	db := storage.NewStorage(&config)
+	if err := db.Init(ctx); err != nil {
+		if config.DatabaseDSN != "" {
+			return err
+		}
+		// отсутствие файла означает пустое хранилище
+		log.Printf("Error init db: %s", err)
+	}
+	defer db.Close(ctx)
+
+	if args[0] == "export" {
+		var w io.Writer = os.Stdout
+		if fs.NArg() == 1 {
+			file, err := os.Create(fs.Arg(0))
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			w = file
+		}
+		n, err := storage.Export(ctx, db, w, *format)
+		if err != nil {
+			return err
+		}
+		log.Printf("Exported %d metrics", n)
+		return nil
+	}
+
+	var r io.Reader = os.Stdin
+	if fs.NArg() == 1 {
+		file, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+	n, err := storage.Import(ctx, db, r, *format, *mode)
+	if err != nil {
+		return err
+	}
+	log.Printf("Imported %d metrics in %s mode", n, *mode)
+	return nil
+}
@@ -0,0 +1,326 @@
+// Package agent - агент сбора метрик и отправки отчетов на серверы.
+// агент состоит из воркеров сбора, формирования отчетов, очереди отправки и доставки отчетов (Reporter),
+// которые работают в общем корневом контексте и перезапускаются после паники.
+// пакет используется командами cmd/agent и cmd/proto/agent и может запускаться в интеграционных тестах через Start и Stop.
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+
+	"github.com/tiraill/go_collect_metrics/internal/clients"
+	"github.com/tiraill/go_collect_metrics/internal/logger"
+	"github.com/tiraill/go_collect_metrics/internal/telemetry"
+	"github.com/tiraill/go_collect_metrics/internal/tracing"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// Время на этапы работы агента по умолчанию.
+const (
+	DefaultCollectTimeout  = 2 * time.Second  // сбор метрик
+	DefaultSendTimeout     = 5 * time.Second  // отправка отчета одному серверу
+	DefaultShutdownTimeout = 10 * time.Second // последний сбор и отправка при остановке
+)
+
+// restartDelay - пауза перед перезапуском воркера после паники.
+const restartDelay = time.Second
+
+// ErrNotDelivered - последний отчет при остановке не принят ни одним сервером.
+var ErrNotDelivered = errors.New("final report is not delivered")
+
+// Reporter - доставка отчетов агента на серверы.
+// значение PollCount недоставленного отчета хранится в Reporter и отправляется со следующим отчетом.
+type Reporter interface {
+	// Send - метод отправки отчета, возвращает true, если отчет принят хотя бы одним сервером.
+	Send(ctx context.Context, stat *utils.Statistic, delta int64) bool
+	// Flush - метод отправки последнего отчета при остановке агента, ожидает ответа серверов до отмены ctx.
+	Flush(ctx context.Context, stat *utils.Statistic, delta int64) bool
+	// Run - фоновая работа до отмены ctx: проверка серверов или поддержка соединения.
+	Run(ctx context.Context)
+}
+
+// Agent - агент сбора и отправки метрик.
+type Agent struct {
+	mutex    sync.RWMutex
+	config   utils.AgentConfig
+	stat     *utils.Statistic
+	fanout   *clients.Fanout // nil, если отчеты доставляет Reporter, переданный в NewWithReporter
+	reporter Reporter
+	spool    *spool
+	diagSrv  *http.Server
+	cancel   context.CancelFunc
+	workers  sync.WaitGroup
+}
+
+// New - метод создания агента по конфигурации.
+// отчеты отправляются по HTTP на серверы из config.Address в режиме config.FanoutMode.
+// незаданное время этапов заменяется значениями по умолчанию.
+func New(config utils.AgentConfig) (*Agent, error) {
+	config = withDefaults(config)
+	metricClients, err := newClients(config)
+	if err != nil {
+		return nil, err
+	}
+	fanout := clients.NewFanout(config.FanoutMode, config.HealthInterval, config.SendTimeout, metricClients...)
+	a := NewWithReporter(config, fanoutReporter{fanout})
+	a.fanout = fanout
+	return a, nil
+}
+
+// NewWithReporter - метод создания агента, отчеты которого доставляет reporter.
+func NewWithReporter(config utils.AgentConfig, reporter Reporter) *Agent {
+	config = withDefaults(config)
+	a := &Agent{
+		config:   config,
+		stat:     utils.NewStatistic(),
+		reporter: reporter,
+	}
+	if config.SpoolSize > 0 {
+		a.spool = newSpool(config.SpoolSize)
+	}
+	return a
+}
+
+// withDefaults - метод замены незаданного времени этапов значениями по умолчанию.
+func withDefaults(config utils.AgentConfig) utils.AgentConfig {
+	if config.CollectTimeout <= 0 {
+		config.CollectTimeout = DefaultCollectTimeout
+	}
+	if config.SendTimeout <= 0 {
+		config.SendTimeout = DefaultSendTimeout
+	}
+	if config.ShutdownTimeout <= 0 {
+		config.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if config.HealthInterval <= 0 {
+		config.HealthInterval = clients.DefaultHealthInterval
+	}
+	return config
+}
+
+// newClients - метод создания клиентов серверов в порядке приоритета.
+func newClients(config utils.AgentConfig) ([]*clients.MetricClient, error) {
+	servers := config.Servers()
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no server address")
+	}
+	metricClients := make([]*clients.MetricClient, 0, len(servers))
+	for _, server := range servers {
+		client, err := clients.NewMetricClient(server, config.SendTimeout, config.RateLimit, config.CryptoKey, config.HashKey)
+		if err != nil {
+			return nil, err
+		}
+		client.Partial = config.PartialBatch
+		metricClients = append(metricClients, client)
+	}
+	return metricClients, nil
+}
+
+// Config - метод получения текущей конфигурации агента.
+func (a *Agent) Config() utils.AgentConfig {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.config
+}
+
+// Reload - метод применения новой конфигурации без перезапуска.
+// интервалы применяются со следующего ожидания воркеров, клиенты с новыми ключами заменяются между отправками.
+// адреса серверов, режим отправки и время этапов не меняются.
+// клиенты заменяются только у агента, созданного New.
+func (a *Agent) Reload(config utils.AgentConfig) error {
+	current := a.Config()
+	config.Address, config.FanoutMode, config.HealthInterval = current.Address, current.FanoutMode, current.HealthInterval
+	config.CollectTimeout, config.SendTimeout, config.ShutdownTimeout = current.CollectTimeout, current.SendTimeout, current.ShutdownTimeout
+	config.SpoolSize, config.DiagAddress, config.DiagPprof = current.SpoolSize, current.DiagAddress, current.DiagPprof
+	config.PartialBatch = current.PartialBatch
+	if a.fanout != nil {
+		metricClients, err := newClients(config)
+		if err != nil {
+			return err
+		}
+		a.fanout.SetClients(metricClients...)
+	}
+	a.mutex.Lock()
+	a.config = config
+	a.mutex.Unlock()
+	return nil
+}
+
+// Start - метод запуска воркеров агента.
+// воркеры работают до вызова Stop или отмены ctx, ошибка открытия порта диагностики возвращается сразу.
+func (a *Agent) Start(ctx context.Context) error {
+	config := a.Config()
+	if config.DiagAddress != "" {
+		address := telemetry.DiagAddress(config.DiagAddress)
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return err
+		}
+		a.diagSrv = telemetry.NewServer(address, config.DiagPprof)
+		go func() {
+			if err := a.diagSrv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.L("agent").Error("diagnostics server failed", zap.Error(err))
+			}
+		}()
+		logger.L("agent").Info("diagnostics server started", zap.String("address", address), zap.Bool("pprof", config.DiagPprof))
+	}
+
+	ctx, a.cancel = context.WithCancel(ctx)
+	a.supervise(ctx, "collect", a.collectLoop)
+	a.supervise(ctx, "report", a.reportLoop)
+	if a.spool != nil {
+		a.supervise(ctx, "spool", a.spoolLoop)
+	}
+	a.supervise(ctx, "reporter", a.reporter.Run)
+	logger.L("agent").Info("agent started", zap.Strings("servers", config.Servers()), zap.String("mode", config.FanoutMode))
+	return nil
+}
+
+// Stop - метод остановки агента.
+// после остановки воркеров метрики собираются последний раз и отправляются вместе с неотправленными отчетами очереди.
+// ctx ограничивает время остановки, при его истечении возвращается ошибка контекста.
+func (a *Agent) Stop(ctx context.Context) error {
+	if a.cancel == nil {
+		return nil
+	}
+	a.cancel()
+	if a.diagSrv != nil {
+		a.diagSrv.Shutdown(ctx)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		a.workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		return fmt.Errorf("workers are not stopped: %w", ctx.Err())
+	}
+
+	a.collect(ctx)
+	final := a.snapshot()
+	if a.spool != nil {
+		final.delta += a.spool.drain()
+	}
+	if !a.send(ctx, final, a.reporter.Flush) {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("%w: %v", ErrNotDelivered, err)
+		}
+		return ErrNotDelivered
+	}
+	logger.L("agent").Info("agent stopped")
+	return nil
+}
+
+// supervise - метод запуска воркера name, воркер перезапускается после паники до отмены ctx.
+func (a *Agent) supervise(ctx context.Context, name string, worker func(ctx context.Context)) {
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		for runWorker(ctx, name, worker) {
+			if !sleep(ctx, restartDelay) {
+				return
+			}
+		}
+	}()
+}
+
+// runWorker - метод выполнения воркера, возвращает true, если воркер завершился паникой.
+func runWorker(ctx context.Context, name string, worker func(ctx context.Context)) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L("agent").Error("worker panicked, restarting",
+				zap.String("worker", name), zap.Any("panic", r), zap.Stack("stack"))
+			panicked = true
+		}
+	}()
+	worker(ctx)
+	return false
+}
+
+// sleep - метод ожидания d, возвращает false при отмене ctx.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// collectLoop - воркер сбора метрик.
+// Runtime, Memory и CPU метрики собираются одним проходом, поэтому сборы не пересекаются.
+func (a *Agent) collectLoop(ctx context.Context) {
+	for sleep(ctx, a.Config().PollInterval) {
+		a.collect(ctx)
+	}
+}
+
+// collect - метод сбора метрик с ограничением времени collect_timeout.
+func (a *Agent) collect(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, a.Config().CollectTimeout)
+	defer cancel()
+	ctx, span := tracing.Start(ctx, "collect")
+	err := a.stat.Collect(ctx)
+	tracing.End(span, err)
+	if err != nil {
+		logger.L("agent").Warn("failed to collect metrics", zap.Error(err))
+	}
+}
+
+// reportLoop - воркер формирования отчетов.
+// без очереди отчет отправляется сразу, отправка не задерживает сбор метрик.
+func (a *Agent) reportLoop(ctx context.Context) {
+	for sleep(ctx, a.Config().ReportInterval) {
+		item := a.snapshot()
+		if a.spool == nil {
+			a.send(ctx, item, a.reporter.Send)
+			continue
+		}
+		if a.spool.push(item) {
+			logger.L("agent").Warn("report spool is full, oldest report dropped", zap.Int("spool_size", a.spool.size))
+		}
+	}
+}
+
+// spoolLoop - воркер отправки отчетов из очереди.
+func (a *Agent) spoolLoop(ctx context.Context) {
+	for {
+		item, ok := a.spool.pop(ctx)
+		if !ok {
+			return
+		}
+		a.send(ctx, item, a.reporter.Send)
+	}
+}
+
+// snapshot - метод получения копии метрик и значения PollCount со сбросом счетчика.
+// значение PollCount хранится в Reporter, пока сервер его не примет.
+func (a *Agent) snapshot() snapshot {
+	delta := a.stat.TakeCounter()
+	return snapshot{stat: a.stat.Copy(), delta: delta}
+}
+
+// send - метод отправки отчета методом deliver, возвращает true, если отчет принял хотя бы один сервер.
+func (a *Agent) send(ctx context.Context, item snapshot, deliver func(context.Context, *utils.Statistic, int64) bool) bool {
+	ctx, span := tracing.Start(ctx, "report", attribute.Int64("poll_count", item.delta))
+	defer span.End()
+	logger.L("agent").Debug("sending report", zap.Int64("poll_count", item.delta))
+	sent := deliver(ctx, item.stat, item.delta)
+	if !sent {
+		span.SetStatus(codes.Error, "report is not sent")
+	}
+	return sent
+}
@@ -0,0 +1,229 @@
+package agent
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// metricServer - сервер метрик, считающий принятые отчеты и значения PollCount.
+type metricServer struct {
+	*httptest.Server
+	reports   atomic.Int64
+	pollCount atomic.Int64
+	hold      chan struct{} // если не nil, ответ задерживается до закрытия канала
+}
+
+func newMetricServer(t *testing.T, hold chan struct{}) *metricServer {
+	s := &metricServer{hold: hold}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		var metrics []utils.JSONMetric
+		require.NoError(t, json.NewDecoder(reader).Decode(&metrics))
+		// отмена запроса клиентом видна серверу только после чтения тела
+		if s.hold != nil {
+			select {
+			case <-s.hold:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		for _, metric := range metrics {
+			if metric.ID == "PollCount" {
+				s.pollCount.Add(*metric.Delta)
+			}
+		}
+		s.reports.Add(1)
+		if r.URL.Query().Get(utils.PartialParam) == "" {
+			return
+		}
+		valid, response := utils.NewBatchResponse(metrics, nil)
+		response.SetStored(valid, "")
+		w.WriteHeader(http.StatusMultiStatus)
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func testConfig(address string) utils.AgentConfig {
+	return utils.AgentConfig{
+		Address:        address,
+		PollInterval:   10 * time.Millisecond,
+		ReportInterval: 30 * time.Millisecond,
+		RateLimit:      1,
+		FanoutMode:     "failover",
+	}
+}
+
+func TestAgent_StartStop(t *testing.T) {
+	for _, spoolSize := range []int{0, 2} {
+		t.Run(fmt.Sprintf("spool %d", spoolSize), func(t *testing.T) {
+			server := newMetricServer(t, nil)
+			config := testConfig(server.URL)
+			config.SpoolSize = spoolSize
+			a, err := New(config)
+			require.NoError(t, err)
+			require.NoError(t, a.Start(context.Background()))
+
+			require.Eventually(t, func() bool { return server.reports.Load() >= 2 }, 5*time.Second, 10*time.Millisecond)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			reports := server.reports.Load()
+			require.NoError(t, a.Stop(ctx))
+
+			// при остановке отправляется последний отчет, все собранные значения PollCount приняты сервером
+			assert.Greater(t, server.reports.Load(), reports)
+			assert.Positive(t, server.pollCount.Load())
+			assert.Zero(t, a.stat.Copy().Counter)
+		})
+	}
+}
+
+func TestAgent_SlowServer(t *testing.T) {
+	hold := make(chan struct{})
+	server := newMetricServer(t, hold)
+	config := testConfig(server.URL)
+	config.SendTimeout = 10 * time.Second
+	a, err := New(config)
+	require.NoError(t, err)
+	require.NoError(t, a.Start(context.Background()))
+
+	// отправка отчета ждет ответа сервера, а сбор метрик продолжается
+	require.Eventually(t, func() bool { return a.stat.Copy().Counter >= 10 }, 5*time.Second, 10*time.Millisecond)
+	assert.Zero(t, server.reports.Load())
+
+	close(hold)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, a.Stop(ctx))
+	assert.Zero(t, a.stat.Copy().Counter)
+}
+
+func TestAgent_StopDeadline(t *testing.T) {
+	server := newMetricServer(t, make(chan struct{}))
+	config := testConfig(server.URL)
+	config.SendTimeout = 10 * time.Second
+	a, err := New(config)
+	require.NoError(t, err)
+	require.NoError(t, a.Start(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = a.Stop(ctx)
+	assert.True(t, errors.Is(err, ErrNotDelivered))
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+// fakeReporter - Reporter, запоминающий отправленные значения PollCount.
+type fakeReporter struct {
+	mutex   sync.Mutex
+	sent    int64
+	flushed bool
+	accept  bool
+	running atomic.Bool
+}
+
+func (r *fakeReporter) Send(_ context.Context, _ *utils.Statistic, delta int64) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.sent += delta
+	return r.accept
+}
+
+func (r *fakeReporter) Flush(ctx context.Context, stat *utils.Statistic, delta int64) bool {
+	r.mutex.Lock()
+	r.flushed = true
+	r.mutex.Unlock()
+	return r.Send(ctx, stat, delta)
+}
+
+func (r *fakeReporter) Run(ctx context.Context) {
+	r.running.Store(true)
+	<-ctx.Done()
+}
+
+func TestAgent_Reporter(t *testing.T) {
+	for _, accept := range []bool{true, false} {
+		t.Run(fmt.Sprintf("accept %t", accept), func(t *testing.T) {
+			reporter := &fakeReporter{accept: accept}
+			a := NewWithReporter(testConfig(""), reporter)
+			require.NoError(t, a.Start(context.Background()))
+			require.Eventually(t, func() bool {
+				reporter.mutex.Lock()
+				defer reporter.mutex.Unlock()
+				return reporter.sent >= 3
+			}, 5*time.Second, 10*time.Millisecond)
+			assert.True(t, reporter.running.Load())
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err := a.Stop(ctx)
+			assert.True(t, reporter.flushed)
+			if accept {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrNotDelivered)
+			}
+		})
+	}
+}
+
+func TestAgent_Supervise(t *testing.T) {
+	a := &Agent{}
+	ctx, cancel := context.WithCancel(context.Background())
+	var mutex sync.Mutex
+	runs := 0
+	a.supervise(ctx, "test", func(ctx context.Context) {
+		mutex.Lock()
+		runs++
+		first := runs == 1
+		mutex.Unlock()
+		if first {
+			panic("worker failed")
+		}
+		<-ctx.Done()
+	})
+
+	// воркер перезапускается после паники и завершается при отмене контекста
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return runs == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	a.workers.Wait()
+}
+
+func TestSpool(t *testing.T) {
+	s := newSpool(2)
+	assert.False(t, s.push(snapshot{delta: 1}))
+	assert.False(t, s.push(snapshot{delta: 2}))
+	// при переполнении значение PollCount самого старого отчета переносится в следующий
+	assert.True(t, s.push(snapshot{delta: 4}))
+
+	item, ok := s.pop(context.Background())
+	require.True(t, ok)
+	assert.Equal(t, int64(3), item.delta)
+	assert.Equal(t, int64(4), s.drain())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, ok = s.pop(ctx)
+	assert.False(t, ok)
+}
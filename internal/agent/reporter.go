@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"github.com/tiraill/go_collect_metrics/internal/clients"
+	"github.com/tiraill/go_collect_metrics/internal/logger"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// fanoutReporter - доставка отчетов по HTTP на несколько серверов через clients.Fanout.
+type fanoutReporter struct {
+	fanout *clients.Fanout
+}
+
+func (r fanoutReporter) Send(ctx context.Context, stat *utils.Statistic, delta int64) bool {
+	return logDeliveries(r.fanout.Send(ctx, stat, delta))
+}
+
+func (r fanoutReporter) Flush(ctx context.Context, stat *utils.Statistic, delta int64) bool {
+	return logDeliveries(r.fanout.Flush(ctx, stat, delta))
+}
+
+// Run - проверка готовности серверов.
+func (r fanoutReporter) Run(ctx context.Context) {
+	r.fanout.Run(ctx)
+}
+
+// logDeliveries - метод записи в журнал результата отправки на каждый сервер,
+// возвращает true, если отчет принял хотя бы один сервер.
+func logDeliveries(deliveries []clients.Delivery) bool {
+	sent := false
+	for _, delivery := range deliveries {
+		l := logger.L("agent").With(zap.String("server", delivery.Server), zap.Int64("poll_count", delivery.PollCount))
+		switch {
+		case delivery.Skipped:
+			l.Debug("report postponed after server errors")
+		case delivery.Err != nil:
+			l.Error("failed to send report", zap.Error(delivery.Err))
+		default:
+			sent = true
+			for _, result := range delivery.Response.Rejected() {
+				l.Warn("metric rejected and quarantined",
+					zap.String("type", result.MType), zap.String("id", result.ID), zap.String("code", result.Code), zap.String("message", result.Message))
+			}
+			l.Info("report sent", zap.Int("applied", delivery.Response.Applied), zap.Int("rejected", delivery.Response.Failed))
+		}
+	}
+	return sent
+}
@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// snapshot - отчет агента: копия метрик и значение PollCount, собранное после предыдущего отчета.
+type snapshot struct {
+	stat  *utils.Statistic
+	delta int64
+}
+
+// spool - ограниченная очередь отчетов между воркером формирования и воркером отправки.
+// отчеты формируются по расписанию, даже пока сервер медленно принимает предыдущий.
+// при переполнении удаляется самый старый отчет, а его значение PollCount переносится в следующий.
+type spool struct {
+	size   int
+	mutex  sync.Mutex
+	items  []snapshot
+	notify chan struct{}
+}
+
+func newSpool(size int) *spool {
+	return &spool{size: size, items: make([]snapshot, 0, size), notify: make(chan struct{}, 1)}
+}
+
+// push - метод добавления отчета, возвращает true, если старый отчет был удален.
+func (s *spool) push(item snapshot) bool {
+	s.mutex.Lock()
+	dropped := len(s.items) >= s.size
+	if dropped {
+		oldest := s.items[0]
+		s.items = s.items[1:]
+		if len(s.items) > 0 {
+			s.items[0].delta += oldest.delta
+		} else {
+			item.delta += oldest.delta
+		}
+	}
+	s.items = append(s.items, item)
+	s.mutex.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return dropped
+}
+
+// pop - метод получения самого старого отчета, ожидает отчет до отмены контекста.
+func (s *spool) pop(ctx context.Context) (snapshot, bool) {
+	for {
+		s.mutex.Lock()
+		if len(s.items) > 0 {
+			item := s.items[0]
+			s.items = s.items[1:]
+			s.mutex.Unlock()
+			return item, true
+		}
+		s.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return snapshot{}, false
+		case <-s.notify:
+		}
+	}
+}
+
+// drain - метод получения суммы значений PollCount неотправленных отчетов с очисткой очереди.
+func (s *spool) drain() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var delta int64
+	for _, item := range s.items {
+		delta += item.delta
+	}
+	s.items = s.items[:0]
+	return delta
+}
@@ -0,0 +1,366 @@
+// Package alert - оповещения о выходе значений метрик за пороги.
+package alert
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/tiraill/go_collect_metrics/internal/logger"
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// Состояния оповещения.
+const (
+	StatePending  = "pending"  // порог нарушен, но меньше длительности For правила
+	StateFiring   = "firing"   // порог нарушен дольше For, оповещение отправлено
+	StateResolved = "resolved" // значение вернулось в норму или метрика удалена
+)
+
+// queueSize - размер очереди оповещений, ожидающих отправки.
+const queueSize = 64
+
+// notifyAttempts - количество попыток отправки одной пачки оповещений.
+const notifyAttempts = 5
+
+// notifyRetryDelay - пауза перед второй попыткой отправки, перед каждой следующей пауза удваивается.
+var notifyRetryDelay = time.Second
+
+// Alert - оповещение по правилу для одной метрики.
+type Alert struct {
+	Fingerprint string     `json:"fingerprint"` // ключ для дедупликации: правило, тип и имя метрики
+	Rule        string     `json:"rule"`
+	Severity    string     `json:"severity,omitempty"`
+	ID          string     `json:"id"`   // имя метрики
+	MType       string     `json:"type"` // тип метрики
+	State       string     `json:"state"`
+	Value       float64    `json:"value"` // последнее проверенное значение метрики
+	Op          string     `json:"op"`
+	Threshold   float64    `json:"threshold"`
+	ActiveAt    time.Time  `json:"active_at"`             // начало нарушения порога
+	FiredAt     *time.Time `json:"fired_at,omitempty"`    // время перехода в firing
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"` // время перехода в resolved
+}
+
+// Notifier - общий интерфейс получателя оповещений.
+type Notifier interface {
+	// Notify отправка пачки оповещений
+	Notify([]Alert) error
+	// Close закрытие получателя
+	Close() error
+}
+
+type entry struct {
+	alert      Alert
+	notifiedAt time.Time
+}
+
+// Engine - проверка правил оповещений.
+// правила проверяются для измененных метрик после записи и для всех метрик по таймеру,
+// оповещения отправляются при переходе в firing и resolved и повторяются с интервалом repeat.
+type Engine struct {
+	rules    []Rule
+	repeat   time.Duration
+	notifier Notifier
+	now      func() time.Time
+	mutex    sync.Mutex
+	active   map[string]*entry
+	queue    chan []Alert
+	stop     chan struct{} // закрывается при остановке, прерывает паузы между попытками отправки
+	wg       sync.WaitGroup
+	closed   bool
+	status   Status
+}
+
+// Status - состояние проверки правил для отчета о здоровье сервера.
+type Status struct {
+	Rules            int        `json:"rules"`
+	Pending          int        `json:"pending"`
+	Firing           int        `json:"firing"`
+	Queued           int        `json:"queued"`                      // пачки оповещений, ожидающие отправки
+	Dropped          int        `json:"dropped"`                     // пачки, отброшенные при переполнении очереди
+	LastEvaluation   *time.Time `json:"last_evaluation,omitempty"`   // последняя проверка всех метрик по таймеру
+	LastNotification *time.Time `json:"last_notification,omitempty"` // последняя успешная отправка
+	LastError        string     `json:"last_error,omitempty"`        // ошибка последней отправки, пустая после успешной
+}
+
+// NewEngine - метод создания проверки правил.
+// notifier может быть nil, тогда оповещения только отображаются в списке активных.
+func NewEngine(rules []Rule, notifier Notifier, repeat time.Duration) *Engine {
+	e := &Engine{
+		rules:    rules,
+		repeat:   repeat,
+		notifier: notifier,
+		now:      time.Now,
+		active:   make(map[string]*entry),
+		queue:    make(chan []Alert, queueSize),
+		stop:     make(chan struct{}),
+	}
+	e.wg.Add(1)
+	go e.run()
+	return e
+}
+
+// NewEngineFromConfig - метод создания проверки правил по конфигурации.
+// если правила не заданы, возвращается nil.
+func NewEngineFromConfig(config utils.AlertConfig) (*Engine, error) {
+	if len(config.AlertRules) == 0 {
+		return nil, nil
+	}
+	rules, err := NewRules(config.AlertRules)
+	if err != nil {
+		return nil, err
+	}
+	var notifier Notifier
+	if config.AlertURL != "" {
+		notifier = NewWebhookNotifier(config.AlertURL, config.AlertTimeout)
+	}
+	return NewEngine(rules, notifier, config.AlertRepeat), nil
+}
+
+func (e *Engine) run() {
+	defer e.wg.Done()
+	for alerts := range e.queue {
+		if e.notifier == nil {
+			continue
+		}
+		err := e.notify(alerts)
+		if err != nil {
+			logger.L("alert").Error("failed to send alerts", zap.Int("alerts", len(alerts)), zap.Error(err))
+		}
+		e.mutex.Lock()
+		if err != nil {
+			e.status.LastError = err.Error()
+		} else {
+			// время отправки берется из часов процесса: run выполняется в своей горутине
+			now := time.Now()
+			e.status.LastNotification, e.status.LastError = &now, ""
+		}
+		e.mutex.Unlock()
+	}
+}
+
+// notify - метод отправки пачки оповещений с повтором после ошибки.
+// время повтора firing и переход в resolved фиксируются до отправки, поэтому без повтора
+// оповещение о resolved терялось бы, а о firing - откладывалось до следующего повтора.
+// после остановки паузы между попытками прерываются и возвращается последняя ошибка.
+func (e *Engine) notify(alerts []Alert) error {
+	delay := notifyRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := e.notifier.Notify(alerts)
+		if err == nil || attempt == notifyAttempts {
+			return err
+		}
+		logger.L("alert").Warn("failed to send alerts, retrying",
+			zap.Int("attempt", attempt), zap.Duration("delay", delay), zap.Error(err))
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-e.stop:
+			timer.Stop()
+			return err
+		}
+		delay *= 2
+	}
+}
+
+func fingerprint(rule Rule, m utils.JSONMetric) string {
+	return rule.Name + "/" + m.MType + ":" + m.ID
+}
+
+// Observe - метод проверки правил для измененных метрик.
+// оповещения по метрикам, которых нет в списке, не меняются.
+func (e *Engine) Observe(metrics []utils.JSONMetric) {
+	e.evaluate(metrics, false)
+}
+
+// Evaluate - метод проверки правил по всем метрикам хранилища.
+// оповещения по метрикам, которых нет в списке, переходят в resolved.
+func (e *Engine) Evaluate(metrics []utils.JSONMetric) {
+	e.evaluate(metrics, true)
+}
+
+func (e *Engine) evaluate(metrics []utils.JSONMetric, full bool) {
+	now := e.now()
+	notify := make([]Alert, 0)
+	seen := make(map[string]bool)
+	e.mutex.Lock()
+	for _, rule := range e.rules {
+		for _, metric := range metrics {
+			value, ok := metricValue(metric)
+			if !ok || !rule.Matches(metric) {
+				continue
+			}
+			key := fingerprint(rule, metric)
+			seen[key] = true
+			var alert *Alert
+			if rule.Check(value) {
+				alert = e.fire(rule, metric, key, value, now)
+			} else {
+				alert = e.resolve(key, now)
+			}
+			if alert != nil {
+				notify = append(notify, *alert)
+			}
+		}
+	}
+	if full {
+		e.status.LastEvaluation = &now
+		for key := range e.active {
+			if seen[key] {
+				continue
+			}
+			if alert := e.resolve(key, now); alert != nil {
+				notify = append(notify, *alert)
+			}
+		}
+	}
+	e.send(notify)
+	e.mutex.Unlock()
+}
+
+// fire - метод обработки нарушения порога, вызывается под блокировкой mutex.
+// возвращает оповещение, если его нужно отправить.
+func (e *Engine) fire(rule Rule, metric utils.JSONMetric, key string, value float64, now time.Time) *Alert {
+	current, ok := e.active[key]
+	if !ok {
+		current = &entry{alert: Alert{
+			Fingerprint: key,
+			Rule:        rule.Name,
+			Severity:    rule.Severity,
+			ID:          metric.ID,
+			MType:       metric.MType,
+			State:       StatePending,
+			Op:          rule.Op,
+			Threshold:   rule.Threshold,
+			ActiveAt:    now,
+		}}
+		e.active[key] = current
+	}
+	current.alert.Value = value
+	switch current.alert.State {
+	case StatePending:
+		if now.Sub(current.alert.ActiveAt) < rule.forDuration {
+			return nil
+		}
+		firedAt := now
+		current.alert.State = StateFiring
+		current.alert.FiredAt = &firedAt
+	case StateFiring:
+		if e.repeat <= 0 || now.Sub(current.notifiedAt) < e.repeat {
+			return nil
+		}
+	}
+	current.notifiedAt = now
+	alert := current.alert
+	return &alert
+}
+
+// resolve - метод обработки возврата значения в норму, вызывается под блокировкой mutex.
+// оповещение в состоянии pending удаляется без отправки.
+func (e *Engine) resolve(key string, now time.Time) *Alert {
+	current, ok := e.active[key]
+	if !ok {
+		return nil
+	}
+	delete(e.active, key)
+	if current.alert.State != StateFiring {
+		return nil
+	}
+	resolvedAt := now
+	alert := current.alert
+	alert.State = StateResolved
+	alert.ResolvedAt = &resolvedAt
+	return &alert
+}
+
+// send - метод постановки оповещений в очередь, вызывается под блокировкой mutex.
+// если очередь переполнена, оповещения отбрасываются.
+func (e *Engine) send(alerts []Alert) {
+	if len(alerts) == 0 || e.closed {
+		return
+	}
+	select {
+	case e.queue <- alerts:
+	default:
+		e.status.Dropped++
+		logger.L("alert").Warn("alert queue is full, alerts dropped", zap.Int("alerts", len(alerts)))
+	}
+}
+
+// Status - метод получения состояния проверки правил и отправки оповещений.
+func (e *Engine) Status() Status {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	status := e.status
+	status.Rules = len(e.rules)
+	status.Queued = len(e.queue)
+	for _, current := range e.active {
+		switch current.alert.State {
+		case StatePending:
+			status.Pending++
+		case StateFiring:
+			status.Firing++
+		}
+	}
+	return status
+}
+
+// Alerts - метод получения активных оповещений в состояниях pending и firing.
+func (e *Engine) Alerts() []Alert {
+	e.mutex.Lock()
+	alerts := make([]Alert, 0, len(e.active))
+	for _, current := range e.active {
+		alerts = append(alerts, current.alert)
+	}
+	e.mutex.Unlock()
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Fingerprint < alerts[j].Fingerprint
+	})
+	return alerts
+}
+
+// Run - метод периодической проверки правил по всем метрикам хранилища до отмены контекста.
+// нужен для перехода в firing по истечении For и повтора оповещений без новых записей.
+func (e *Engine) Run(ctx context.Context, db storage.Storage, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			metrics, err := db.GetAllMetrics(ctx)
+			if err != nil {
+				logger.L("alert").Error("failed to evaluate alert rules", zap.Error(err))
+				continue
+			}
+			e.Evaluate(metrics)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Close - метод остановки: дожидается отправки оповещений из очереди и закрывает получателя.
+// оповещения из очереди отправляются по одному разу, без повтора после ошибки.
+func (e *Engine) Close() {
+	e.mutex.Lock()
+	if e.closed {
+		e.mutex.Unlock()
+		return
+	}
+	e.closed = true
+	close(e.stop)
+	close(e.queue)
+	e.mutex.Unlock()
+
+	e.wg.Wait()
+	if e.notifier != nil {
+		if err := e.notifier.Close(); err != nil {
+			logger.L("alert").Error("failed to close alert notifier", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+type memNotifier struct {
+	mutex  sync.Mutex
+	alerts []Alert
+}
+
+func (n *memNotifier) Notify(alerts []Alert) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.alerts = append(n.alerts, alerts...)
+	return nil
+}
+
+func (n *memNotifier) Close() error {
+	return nil
+}
+
+// states - метод получения отправленных состояний в формате правило/состояние.
+func (n *memNotifier) states() []string {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	states := make([]string, 0, len(n.alerts))
+	for _, a := range n.alerts {
+		states = append(states, a.Fingerprint+" "+a.State)
+	}
+	return states
+}
+
+func newTestEngine(t *testing.T, repeat time.Duration, configs ...utils.AlertRule) (*Engine, *memNotifier, *time.Time) {
+	rules, err := NewRules(configs)
+	require.NoError(t, err)
+	notifier := &memNotifier{}
+	engine := NewEngine(rules, notifier, repeat)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	engine.now = func() time.Time { return now }
+	return engine, notifier, &now
+}
+
+func TestNewRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  []utils.AlertRule
+		errMsg string
+	}{
+		{name: "valid", rules: []utils.AlertRule{{Name: "high", Metric: "cpu_*", Op: ">", Threshold: 90, For: "1m"}}},
+		{name: "empty name", rules: []utils.AlertRule{{Metric: "Alloc", Op: ">"}}, errMsg: "empty name"},
+		{name: "op", rules: []utils.AlertRule{{Name: "a", Metric: "Alloc", Op: "=>"}}, errMsg: `unknown comparison "=>"`},
+		{name: "type", rules: []utils.AlertRule{{Name: "a", Metric: "Alloc", Type: "histogram", Op: ">"}}, errMsg: "unknown metric type"},
+		{name: "for", rules: []utils.AlertRule{{Name: "a", Metric: "Alloc", Op: ">", For: "soon"}}, errMsg: "invalid for duration"},
+		{
+			name: "duplicate",
+			rules: []utils.AlertRule{
+				{Name: "a", Metric: "Alloc", Op: ">"},
+				{Name: "a", Metric: "Sys", Op: ">"},
+			},
+			errMsg: "duplicate name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRules(tt.rules)
+			if tt.errMsg == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, ErrRule)
+			assert.Contains(t, err.Error(), tt.errMsg)
+		})
+	}
+}
+
+func TestEngine_Lifecycle(t *testing.T) {
+	engine, notifier, now := newTestEngine(t, 10*time.Minute,
+		utils.AlertRule{Name: "high", Metric: "cpu_*", Type: "gauge", Op: ">", Threshold: 90, For: "1m", Severity: "critical"},
+	)
+
+	engine.Observe([]utils.JSONMetric{utils.NewGaugeJSONMetric("cpu_1", 95), utils.NewGaugeJSONMetric("mem", 99)})
+	alerts := engine.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StatePending, alerts[0].State)
+	assert.Equal(t, "high/gauge:cpu_1", alerts[0].Fingerprint)
+
+	// порог нарушен меньше For, оповещение не отправляется
+	*now = now.Add(30 * time.Second)
+	engine.Evaluate([]utils.JSONMetric{utils.NewGaugeJSONMetric("cpu_1", 96)})
+	*now = now.Add(30 * time.Second)
+	engine.Evaluate([]utils.JSONMetric{utils.NewGaugeJSONMetric("cpu_1", 97)})
+	alerts = engine.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateFiring, alerts[0].State)
+	assert.Equal(t, 97.0, alerts[0].Value)
+	assert.Equal(t, "critical", alerts[0].Severity)
+	status := engine.Status()
+	assert.Equal(t, 1, status.Rules)
+	assert.Equal(t, 1, status.Firing)
+	assert.Zero(t, status.Pending)
+	require.NotNil(t, status.LastEvaluation)
+	assert.Equal(t, *now, *status.LastEvaluation)
+
+	// повтор отправляется не раньше интервала repeat
+	*now = now.Add(5 * time.Minute)
+	engine.Evaluate([]utils.JSONMetric{utils.NewGaugeJSONMetric("cpu_1", 98)})
+	*now = now.Add(5 * time.Minute)
+	engine.Evaluate([]utils.JSONMetric{utils.NewGaugeJSONMetric("cpu_1", 98)})
+
+	*now = now.Add(time.Minute)
+	engine.Observe([]utils.JSONMetric{utils.NewGaugeJSONMetric("cpu_1", 50)})
+	assert.Empty(t, engine.Alerts())
+
+	engine.Close()
+	assert.Equal(t, []string{
+		"high/gauge:cpu_1 firing",
+		"high/gauge:cpu_1 firing",
+		"high/gauge:cpu_1 resolved",
+	}, notifier.states())
+}
+
+func TestEngine_Resolve(t *testing.T) {
+	engine, notifier, now := newTestEngine(t, 0,
+		utils.AlertRule{Name: "polls", Metric: "PollCount", Op: ">=", Threshold: 10},
+		utils.AlertRule{Name: "slow", Metric: "Alloc", Op: "<", Threshold: 1, For: "1h"},
+	)
+	engine.Observe([]utils.JSONMetric{utils.NewCounterJSONMetric("PollCount", 10), utils.NewGaugeJSONMetric("Alloc", 0)})
+	engine.Observe([]utils.JSONMetric{utils.NewCounterJSONMetric("PollCount", 12)})
+	require.Len(t, engine.Alerts(), 2)
+
+	// частичная проверка не меняет оповещения по отсутствующим метрикам
+	*now = now.Add(time.Minute)
+	engine.Observe([]utils.JSONMetric{utils.NewGaugeJSONMetric("Other", 1)})
+	require.Len(t, engine.Alerts(), 2)
+
+	// полная проверка закрывает оповещения по удаленным метрикам, pending закрывается без отправки
+	engine.Evaluate(nil)
+	assert.Empty(t, engine.Alerts())
+
+	engine.Close()
+	assert.Equal(t, []string{"polls/counter:PollCount firing", "polls/counter:PollCount resolved"}, notifier.states())
+}
+
+func TestStorage_Observe(t *testing.T) {
+	engine, notifier, _ := newTestEngine(t, 0, utils.AlertRule{Name: "polls", Metric: "PollCount", Op: ">", Threshold: 5})
+	db := NewStorage(storage.NewStorage(&utils.StorageConfig{StoreInterval: time.Hour}), engine)
+	ctx := context.Background()
+
+	// проверяется итоговое значение counter, а не приращение
+	_, err := db.UpdateJSONMetric(ctx, utils.NewCounterJSONMetric("PollCount", 4))
+	require.NoError(t, err)
+	assert.Empty(t, engine.Alerts())
+	_, err = db.UpdateJSONMetrics(ctx, []utils.JSONMetric{utils.NewCounterJSONMetric("PollCount", 4)})
+	require.NoError(t, err)
+	require.Len(t, engine.Alerts(), 1)
+	assert.Equal(t, 8.0, engine.Alerts()[0].Value)
+
+	require.NoError(t, db.ReplaceMetrics(ctx, []utils.JSONMetric{utils.NewCounterJSONMetric("PollCount", 1)}))
+	assert.Empty(t, engine.Alerts())
+
+	engine.Close()
+	assert.Equal(t, []string{"polls/counter:PollCount firing", "polls/counter:PollCount resolved"}, notifier.states())
+}
+
+// flakyNotifier - получатель, первые failures попыток отправки которого завершаются ошибкой.
+type flakyNotifier struct {
+	memNotifier
+	failures int
+	attempts int
+	sent     chan struct{}
+}
+
+func (n *flakyNotifier) Notify(alerts []Alert) error {
+	n.mutex.Lock()
+	n.attempts++
+	failed := n.attempts <= n.failures
+	n.mutex.Unlock()
+	if failed {
+		return errors.New("webhook unavailable")
+	}
+	err := n.memNotifier.Notify(alerts)
+	n.sent <- struct{}{}
+	return err
+}
+
+func TestEngine_NotifyRetry(t *testing.T) {
+	delay := notifyRetryDelay
+	notifyRetryDelay = time.Millisecond
+	defer func() { notifyRetryDelay = delay }()
+
+	rules, err := NewRules([]utils.AlertRule{{Name: "high", Metric: "Alloc", Op: ">", Threshold: 10}})
+	require.NoError(t, err)
+	notifier := &flakyNotifier{failures: 2, sent: make(chan struct{}, 1)}
+	engine := NewEngine(rules, notifier, 0)
+
+	engine.Observe([]utils.JSONMetric{utils.NewGaugeJSONMetric("Alloc", 20)})
+	engine.Observe([]utils.JSONMetric{utils.NewGaugeJSONMetric("Alloc", 5)})
+	for i := 0; i < 2; i++ {
+		select {
+		case <-notifier.sent:
+		case <-time.After(5 * time.Second):
+			t.Fatal("alerts were not sent after retries")
+		}
+	}
+	engine.Close()
+
+	// оповещения firing и resolved доставлены после двух неудачных попыток
+	assert.Equal(t, []string{"high/gauge:Alloc firing", "high/gauge:Alloc resolved"}, notifier.states())
+	assert.Equal(t, 4, notifier.attempts)
+	assert.Empty(t, engine.Status().LastError)
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	received := make(chan []Alert, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alerts []Alert
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&alerts))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		received <- alerts
+	}))
+	defer ts.Close()
+
+	notifier := NewWebhookNotifier(ts.URL, time.Second)
+	require.NoError(t, notifier.Notify([]Alert{{Fingerprint: "a/gauge:Alloc", Rule: "a", State: StateFiring}}))
+	alerts := <-received
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "a/gauge:Alloc", alerts[0].Fingerprint)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	err := NewWebhookNotifier(failing.URL, time.Second).Notify([]Alert{{Rule: "a"}})
+	assert.ErrorContains(t, err, "502")
+}
@@ -0,0 +1,45 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WebhookNotifier - получатель, отправляющий пачки оповещений POST запросом в формате JSON.
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookNotifier - метод создания получателя для отправки оповещений на HTTP webhook.
+func NewWebhookNotifier(url string, timeout time.Duration) *WebhookNotifier {
+	return &WebhookNotifier{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+// Notify - метод отправки пачки оповещений.
+func (n *WebhookNotifier) Notify(alerts []Alert) error {
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("alert webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// Close - метод закрытия получателя.
+func (n *WebhookNotifier) Close() error {
+	n.client.CloseIdleConnections()
+	return nil
+}
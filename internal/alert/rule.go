@@ -0,0 +1,113 @@
+package alert
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// ErrRule ошибка невалидного правила оповещения.
+var ErrRule = errors.New("invalid alert rule")
+
+// Rule - проверенное правило оповещения.
+type Rule struct {
+	utils.AlertRule
+	forDuration time.Duration
+	pattern     *regexp.Regexp
+}
+
+// NewRule - метод создания правила оповещения из конфигурации.
+func NewRule(config utils.AlertRule) (Rule, error) {
+	rule := Rule{AlertRule: config}
+	if config.Name == "" {
+		return rule, errors.Wrap(ErrRule, "empty name")
+	}
+	if config.Metric == "" {
+		return rule, errors.Wrapf(ErrRule, "%s: empty metric", config.Name)
+	}
+	switch config.Type {
+	case "", "gauge", "counter":
+	default:
+		return rule, errors.Wrapf(ErrRule, "%s: unknown metric type %q", config.Name, config.Type)
+	}
+	switch config.Op {
+	case ">", ">=", "<", "<=", "==", "!=":
+	default:
+		return rule, errors.Wrapf(ErrRule, "%s: unknown comparison %q", config.Name, config.Op)
+	}
+	if config.For != "" {
+		forDuration, err := time.ParseDuration(config.For)
+		if err != nil || forDuration < 0 {
+			return rule, errors.Wrapf(ErrRule, "%s: invalid for duration %q", config.Name, config.For)
+		}
+		rule.forDuration = forDuration
+	}
+	pattern, err := regexp.Compile(storage.GlobToRegex(config.Metric))
+	if err != nil {
+		return rule, errors.Wrapf(ErrRule, "%s: invalid metric pattern: %s", config.Name, err)
+	}
+	rule.pattern = pattern
+	return rule, nil
+}
+
+// NewRules - метод создания списка правил из конфигурации, имена правил должны быть уникальны.
+func NewRules(configs []utils.AlertRule) ([]Rule, error) {
+	rules := make([]Rule, 0, len(configs))
+	names := make(map[string]bool)
+	for _, config := range configs {
+		rule, err := NewRule(config)
+		if err != nil {
+			return nil, err
+		}
+		if names[rule.Name] {
+			return nil, errors.Wrapf(ErrRule, "%s: duplicate name", rule.Name)
+		}
+		names[rule.Name] = true
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Matches - метод проверки, относится ли правило к метрике.
+func (r Rule) Matches(m utils.JSONMetric) bool {
+	if r.Type != "" && r.Type != m.MType {
+		return false
+	}
+	return r.pattern.MatchString(m.ID)
+}
+
+// Check - метод проверки значения метрики, возвращает true при нарушении порога.
+func (r Rule) Check(value float64) bool {
+	switch r.Op {
+	case ">":
+		return value > r.Threshold
+	case ">=":
+		return value >= r.Threshold
+	case "<":
+		return value < r.Threshold
+	case "<=":
+		return value <= r.Threshold
+	case "==":
+		return value == r.Threshold
+	case "!=":
+		return value != r.Threshold
+	default:
+		return false
+	}
+}
+
+// metricValue - метод получения значения метрики для сравнения с порогом.
+func metricValue(m utils.JSONMetric) (float64, bool) {
+	switch {
+	case m.MType == "gauge" && m.Value != nil:
+		return *m.Value, true
+	case m.MType == "counter" && m.Delta != nil:
+		return float64(*m.Delta), true
+	default:
+		return 0, false
+	}
+}
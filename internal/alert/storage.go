@@ -0,0 +1,61 @@
+package alert
+
+import (
+	"context"
+
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// Storage - обертка над storage.Storage, проверяющая правила оповещений после изменения метрик.
+type Storage struct {
+	storage.Storage
+	engine *Engine
+}
+
+// NewStorage - метод создания хранилища с проверкой правил оповещений.
+func NewStorage(db storage.Storage, engine *Engine) *Storage {
+	return &Storage{Storage: db, engine: engine}
+}
+
+// UpdateJSONMetric - метод обновления одной метрики с проверкой правил.
+func (s *Storage) UpdateJSONMetric(ctx context.Context, metric utils.JSONMetric) (utils.JSONMetric, error) {
+	out, err := s.Storage.UpdateJSONMetric(ctx, metric)
+	if err != nil {
+		return out, err
+	}
+	s.engine.Observe([]utils.JSONMetric{out})
+	return out, nil
+}
+
+// UpdateJSONMetrics - метод обновления списка метрик с проверкой правил.
+func (s *Storage) UpdateJSONMetrics(ctx context.Context, metrics []utils.JSONMetric) ([]utils.JSONMetric, error) {
+	out, err := s.Storage.UpdateJSONMetrics(ctx, metrics)
+	if err != nil {
+		return out, err
+	}
+	s.engine.Observe(out)
+	return out, nil
+}
+
+// ReplaceMetrics - метод замены всех метрик с проверкой правил по всему хранилищу.
+func (s *Storage) ReplaceMetrics(ctx context.Context, metrics []utils.JSONMetric) error {
+	if err := s.Storage.ReplaceMetrics(ctx, metrics); err != nil {
+		return err
+	}
+	if all, err := s.Storage.GetAllMetrics(ctx); err == nil {
+		s.engine.Evaluate(all)
+	}
+	return nil
+}
+
+// DeleteMetric - метод удаления метрики, оповещения по удаленной метрике разрешаются.
+func (s *Storage) DeleteMetric(ctx context.Context, mName, mType string) error {
+	if err := s.Storage.DeleteMetric(ctx, mName, mType); err != nil {
+		return err
+	}
+	if all, err := s.Storage.GetAllMetrics(ctx); err == nil {
+		s.engine.Evaluate(all)
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+// Package app - сборка и запуск сервера метрик.
+// HTTP и gRPC обслуживаются одним процессом над одним инициализированным хранилищем
+// и общим слоем service, на разных портах или на одном порту.
+package app
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+
+	"github.com/tiraill/go_collect_metrics/internal/alert"
+	"github.com/tiraill/go_collect_metrics/internal/audit"
+	"github.com/tiraill/go_collect_metrics/internal/config"
+	"github.com/tiraill/go_collect_metrics/internal/grpcserver"
+	"github.com/tiraill/go_collect_metrics/internal/handlers"
+	"github.com/tiraill/go_collect_metrics/internal/health"
+	"github.com/tiraill/go_collect_metrics/internal/logger"
+	"github.com/tiraill/go_collect_metrics/internal/service"
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/telemetry"
+	"github.com/tiraill/go_collect_metrics/internal/tracing"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// shutdownTimeout - время на завершение запросов и сохранение хранилища при остановке.
+const shutdownTimeout = 15 * time.Second
+
+// serviceName - имя сервера в трассировке.
+const serviceName = "metrics-server"
+
+// Options - параметры сборки сервера, не задаваемые конфигурацией.
+type Options struct {
+	// GRPCOnly - обслуживать только gRPC на адресе address, без HTTP.
+	GRPCOnly bool
+}
+
+// Server - сервер метрик: хранилище, слой service и транспорты над ним.
+type Server struct {
+	config       utils.ServerConfig
+	db           storage.Storage
+	svc          *service.Service
+	auditor      *audit.Auditor
+	alerts       *alert.Engine
+	cancel       context.CancelFunc
+	checker      *health.Checker
+	stopHealth   context.CancelFunc
+	router       *handlers.Router
+	grpcSrv      *grpc.Server
+	grpcHealth   *grpcserver.HealthService
+	metricServer *grpcserver.MetricsServer
+	httpSrv      *http.Server
+	diagSrv      *http.Server
+	listeners    []net.Listener
+}
+
+// New - метод сборки сервера по конфигурации.
+// хранилище инициализируется один раз и оборачивается журналом изменений, оповещениями
+// и потоком событий, поэтому изменения через любой транспорт видны всем остальным.
+func New(cfg config.Server, opts Options) (*Server, error) {
+	serverConfig := cfg.Server
+	if opts.GRPCOnly {
+		serverConfig.GRPCAddress = serverConfig.Address
+	}
+	s := &Server{config: serverConfig}
+	var err error
+	if s.auditor, err = audit.NewAuditorFromConfig(cfg.Audit); err != nil {
+		return nil, fmt.Errorf("failed to init audit: %w", err)
+	}
+	if s.alerts, err = alert.NewEngineFromConfig(cfg.Alert); err != nil {
+		return nil, fmt.Errorf("failed to init alerts: %w", err)
+	}
+	var privateKey *utils.PrivateKey
+	if !opts.GRPCOnly {
+		if privateKey, err = utils.LoadPrivateKey(serverConfig.CryptoKey); err != nil {
+			return nil, fmt.Errorf("failed to load private key: %w", err)
+		}
+	}
+
+	var ctx context.Context
+	ctx, s.cancel = context.WithCancel(context.Background())
+	storageConfig := cfg.Storage
+	base := storage.NewStorage(&storageConfig)
+	if err = base.Init(ctx); err != nil {
+		logger.L("app").Error("failed to init storage", zap.Error(err))
+	} else {
+		logger.L("app").Info("storage initialized", zap.String("backend", storage.Backend(base)))
+	}
+	s.db = storage.NewInstrumentedStorage(base)
+	if s.auditor != nil {
+		s.db = audit.NewStorage(s.db, s.auditor)
+	}
+	if s.alerts != nil {
+		s.db = alert.NewStorage(s.db, s.alerts)
+		if cfg.Alert.AlertInterval > 0 {
+			go s.alerts.Run(ctx, s.db, cfg.Alert.AlertInterval)
+		}
+	}
+	s.svc = service.New(s.db, serverConfig.HashKey)
+
+	s.checker = health.New(health.DefaultTimeout)
+	s.checker.Register("storage", true, health.StorageCheck(s.db, base))
+	if s.alerts != nil {
+		s.checker.Register("alerts", false, health.AlertCheck(s.alerts))
+	}
+	if !opts.GRPCOnly {
+		s.router = handlers.NewServiceRouter(s.svc, serverConfig, privateKey, s.alerts, s.checker)
+	}
+	if serverConfig.GRPCAddress != "" {
+		s.grpcSrv, s.metricServer = grpcserver.NewServer(serverConfig, s.svc)
+		s.grpcHealth = grpcserver.RegisterHealth(s.grpcSrv, s.checker)
+	}
+	return s, nil
+}
+
+// Reload - метод применения новой конфигурации к HTTP и gRPC без перезапуска.
+func (s *Server) Reload(cfg config.Server) error {
+	if s.router != nil {
+		key, err := utils.LoadPrivateKey(cfg.Server.CryptoKey)
+		if err != nil {
+			return fmt.Errorf("failed to load private key: %w", err)
+		}
+		s.router.Reload(cfg.Server, key)
+	}
+	if s.metricServer != nil {
+		s.metricServer.Reload(cfg.Server)
+	}
+	return nil
+}
+
+// isMultiplexed - gRPC обслуживается на одном порту с HTTP.
+func (s *Server) isMultiplexed() bool {
+	return s.router != nil && s.grpcSrv != nil && s.config.GRPCAddress == s.config.Address
+}
+
+// Handler - обработчик HTTP сервера.
+// при общем порту запросы HTTP/2 с content-type application/grpc передаются gRPC серверу,
+// а HTTP/2 без TLS принимается через h2c. параметры keepalive gRPC в этом режиме не применяются.
+func (s *Server) Handler() http.Handler {
+	if !s.isMultiplexed() {
+		return s.router
+	}
+	return h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			s.grpcSrv.ServeHTTP(w, r)
+			return
+		}
+		s.router.ServeHTTP(w, r)
+	}), &http2.Server{})
+}
+
+// listen - метод открытия порта, открытые порты закрываются при ошибке Start.
+func (s *Server) listen(address string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	s.listeners = append(s.listeners, listener)
+	return listener, nil
+}
+
+// Start - метод открытия портов и запуска серверов.
+// ошибка открытия порта возвращается сразу, а не при первом запросе.
+func (s *Server) Start() error {
+	if err := s.start(); err != nil {
+		for _, listener := range s.listeners {
+			listener.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Server) start() error {
+	var httpListener, grpcListener net.Listener
+	var err error
+	if s.router != nil {
+		if httpListener, err = s.listen(s.config.Address); err != nil {
+			return err
+		}
+	}
+	if s.grpcSrv != nil && !s.isMultiplexed() {
+		if grpcListener, err = s.listen(s.config.GRPCAddress); err != nil {
+			return err
+		}
+	}
+	var diagListener net.Listener
+	if s.config.DiagAddress != "" {
+		if diagListener, err = s.listen(telemetry.DiagAddress(s.config.DiagAddress)); err != nil {
+			return err
+		}
+	}
+
+	if httpListener != nil {
+		s.httpSrv = &http.Server{Handler: s.Handler()}
+		// потоки событий не завершаются сами, поэтому закрываем подписки в начале остановки
+		s.httpSrv.RegisterOnShutdown(s.svc.Broker().Close)
+		go func() {
+			if err := s.httpSrv.Serve(httpListener); err != nil && err != http.ErrServerClosed {
+				logger.L("app").Fatal("HTTP server failed", zap.Error(err))
+			}
+		}()
+		logger.L("app").Info("HTTP server started", zap.String("address", s.config.Address))
+	}
+	if s.isMultiplexed() {
+		logger.L("app").Info("gRPC server started", zap.String("address", s.config.Address))
+	}
+	if grpcListener != nil {
+		go func() {
+			if err := s.grpcSrv.Serve(grpcListener); err != nil {
+				logger.L("app").Fatal("gRPC server failed", zap.Error(err))
+			}
+		}()
+		logger.L("app").Info("gRPC server started", zap.String("address", s.config.GRPCAddress))
+	}
+	s.checker.SetServing(true)
+	var healthCtx context.Context
+	healthCtx, s.stopHealth = context.WithCancel(context.Background())
+	if s.grpcHealth != nil {
+		go s.grpcHealth.Run(healthCtx)
+	}
+	if diagListener != nil {
+		s.diagSrv = telemetry.NewServer(diagListener.Addr().String(), s.config.DiagPprof)
+		go func() {
+			if err := s.diagSrv.Serve(diagListener); err != nil && err != http.ErrServerClosed {
+				logger.L("app").Error("diagnostics server failed", zap.Error(err))
+			}
+		}()
+		logger.L("app").Info("diagnostics server started", zap.String("address", diagListener.Addr().String()), zap.Bool("pprof", s.config.DiagPprof))
+	}
+	return nil
+}
+
+// Shutdown - метод остановки серверов, сохранения хранилища и закрытия журнала и оповещений.
+// до остановки серверов проверки готовности начинают возвращать отказ.
+func (s *Server) Shutdown(ctx context.Context) {
+	s.checker.SetServing(false)
+	if s.stopHealth != nil {
+		s.stopHealth()
+	}
+	if s.diagSrv != nil {
+		s.diagSrv.Shutdown(ctx)
+	}
+	if s.metricServer != nil {
+		s.metricServer.Stop()
+	}
+	if s.httpSrv != nil {
+		if err := s.httpSrv.Shutdown(ctx); err != nil {
+			logger.L("app").Error("HTTP server shutdown failed", zap.Error(err))
+		}
+	}
+	switch {
+	case s.isMultiplexed():
+		// GracefulStop не поддерживает соединения, принятые через ServeHTTP
+		s.grpcSrv.Stop()
+	case s.grpcSrv != nil:
+		s.grpcSrv.GracefulStop()
+	}
+	s.cancel()
+	s.db.Close(ctx)
+	if s.auditor != nil {
+		s.auditor.Close()
+	}
+	if s.alerts != nil {
+		s.alerts.Close()
+	}
+}
+
+// Run - метод запуска сервера до получения сигнала остановки.
+// конфигурация, включая настройки журнала, перечитывается по SIGHUP и при изменении файла конфигурации.
+func Run(loader *config.Loader[config.Server], loaded *config.Effective[config.Server], opts Options) error {
+	if err := logger.Configure(loaded.Config.Log); err != nil {
+		return err
+	}
+	defer logger.Sync()
+	stopTracing, err := tracing.Setup(loaded.Config.Trace, serviceName)
+	if err != nil {
+		return err
+	}
+	s, err := New(loaded.Config, opts)
+	if err != nil {
+		return err
+	}
+	if err = s.Start(); err != nil {
+		s.Shutdown(context.Background())
+		return err
+	}
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	go loader.Watch(watchCtx, loaded, func(next *config.Effective[config.Server], _ []string) error {
+		if err := s.Reload(next.Config); err != nil {
+			return err
+		}
+		return logger.Configure(next.Config.Log)
+	})
+
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	sig := <-done
+	logger.L("app").Info("server stopping", zap.String("signal", sig.String()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	s.Shutdown(ctx)
+	if err := stopTracing(ctx); err != nil {
+		logger.L("app").Error("failed to flush traces", zap.Error(err))
+	}
+	logger.L("app").Info("server stopped")
+	return nil
+}
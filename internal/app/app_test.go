@@ -0,0 +1,119 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/tiraill/go_collect_metrics/internal/config"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+
+	pb "github.com/tiraill/go_collect_metrics/cmd/proto"
+)
+
+func startApp(t *testing.T, cfg config.Server, opts Options) *Server {
+	s, err := New(cfg, opts)
+	require.NoError(t, err)
+	require.NoError(t, s.Start())
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+	return s
+}
+
+func grpcClient(t *testing.T, address string) pb.MetricsClient {
+	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewMetricsClient(conn)
+}
+
+// checkShared - изменения через gRPC видны по HTTP и наоборот.
+func checkShared(t *testing.T, httpAddress, grpcAddress string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := grpcClient(t, grpcAddress)
+
+	_, err := client.SaveMetric(ctx, &pb.SaveMetricRequest{Metric: &pb.Metric{Id: "PollCount", Type: "counter", Delta: 2}})
+	require.NoError(t, err)
+	resp, err := http.Post("http://"+httpAddress+"/update/counter/PollCount/3", "text/plain", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	got, err := client.GetMetric(ctx, &pb.GetMetricRequest{Metric: &pb.Metric{Id: "PollCount", Type: "counter"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), got.Metric.Delta)
+
+	resp, err = http.Get("http://" + httpAddress + "/value/counter/PollCount")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "5", strings.TrimSpace(string(body)))
+}
+
+// checkHealth - проверки готовности по HTTP и grpc.health.v1.
+func checkHealth(t *testing.T, httpAddress, grpcAddress string) {
+	resp, err := http.Get("http://" + httpAddress + "/readyz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	conn, err := grpc.Dial(grpcAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+	for _, service := range []string{"", pb.Metrics_ServiceDesc.ServiceName} {
+		assert.Eventually(t, func() bool {
+			resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+			return err == nil && resp.Status == healthpb.HealthCheckResponse_SERVING
+		}, 5*time.Second, 10*time.Millisecond, service)
+	}
+}
+
+func TestServer_Multiplexed(t *testing.T) {
+	s := startApp(t, config.Server{Server: utils.ServerConfig{Address: "127.0.0.1:0", GRPCAddress: "127.0.0.1:0"}}, Options{})
+	require.Len(t, s.listeners, 1)
+	address := s.listeners[0].Addr().String()
+	checkShared(t, address, address)
+	checkHealth(t, address, address)
+}
+
+func TestServer_SeparatePorts(t *testing.T) {
+	s := startApp(t, config.Server{Server: utils.ServerConfig{Address: "127.0.0.1:0", GRPCAddress: "localhost:0"}}, Options{})
+	require.Len(t, s.listeners, 2)
+	checkShared(t, s.listeners[0].Addr().String(), s.listeners[1].Addr().String())
+}
+
+func TestServer_GRPCOnlyRestore(t *testing.T) {
+	cfg := config.Server{
+		Server:  utils.ServerConfig{Address: "127.0.0.1:0"},
+		Storage: utils.StorageConfig{StoreFile: filepath.Join(t.TempDir(), "metrics.json"), Restore: true},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s, err := New(cfg, Options{GRPCOnly: true})
+	require.NoError(t, err)
+	require.NoError(t, s.Start())
+	_, err = grpcClient(t, s.listeners[0].Addr().String()).SaveMetric(ctx,
+		&pb.SaveMetricRequest{Metric: &pb.Metric{Id: "PollCount", Type: "counter", Delta: 7}})
+	require.NoError(t, err)
+	s.Shutdown(ctx)
+
+	// хранилище, которое обслуживает gRPC, сохраняется при остановке и восстанавливается при запуске
+	s = startApp(t, cfg, Options{GRPCOnly: true})
+	got, err := grpcClient(t, s.listeners[0].Addr().String()).GetMetric(ctx,
+		&pb.GetMetricRequest{Metric: &pb.Metric{Id: "PollCount", Type: "counter"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), got.Metric.Delta)
+}
@@ -0,0 +1,165 @@
+// Package audit - журнал изменений метрик с подключаемыми приемниками записей.
+package audit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/tiraill/go_collect_metrics/internal/logger"
+	"github.com/tiraill/go_collect_metrics/internal/telemetry"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// Транспорт, через который пришло изменение метрики.
+const (
+	TransportHTTP = "http"
+	TransportGRPC = "grpc"
+)
+
+// queueSize - размер очереди записей, ожидающих отправки в приемники.
+const queueSize = 1024
+
+// enqueueTimeout - время ожидания места в переполненной очереди, после которого записи отбрасываются.
+var enqueueTimeout = time.Second
+
+// Record - запись журнала об изменении метрики.
+type Record struct {
+	Timestamp time.Time `json:"ts"`                  // время изменения
+	Client    string    `json:"client"`              // адрес или идентификатор клиента
+	Transport string    `json:"transport"`           // http или grpc
+	ID        string    `json:"id"`                  // имя метрики
+	MType     string    `json:"type"`                // тип метрики
+	OldValue  *string   `json:"old_value,omitempty"` // значение до изменения, если метрика существовала
+	NewValue  string    `json:"new_value"`           // значение после изменения, пустое - метрика удалена
+}
+
+// Sink - общий интерфейс приемника записей журнала.
+type Sink interface {
+	// Write запись пачки записей
+	Write([]Record) error
+	// Close закрытие приемника
+	Close() error
+}
+
+// Source - источник изменения: клиент и транспорт.
+type Source struct {
+	Client    string
+	Transport string
+}
+
+type sourceKey struct{}
+
+// WithSource - метод сохранения источника изменения в контексте запроса.
+func WithSource(ctx context.Context, source Source) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+// SourceFromContext - метод получения источника изменения из контекста запроса.
+func SourceFromContext(ctx context.Context) Source {
+	source, _ := ctx.Value(sourceKey{}).(Source)
+	return source
+}
+
+// Auditor - журнал изменений метрик.
+// записи передаются приемникам асинхронно, чтобы не задерживать обработку запросов.
+type Auditor struct {
+	sinks  []Sink
+	queue  chan []Record
+	wg     sync.WaitGroup
+	mutex  sync.RWMutex
+	closed bool
+}
+
+// NewAuditor - метод создания журнала изменений метрик.
+func NewAuditor(sinks ...Sink) *Auditor {
+	a := &Auditor{
+		sinks: sinks,
+		queue: make(chan []Record, queueSize),
+	}
+	a.wg.Add(1)
+	go a.run()
+	return a
+}
+
+func (a *Auditor) run() {
+	defer a.wg.Done()
+	for records := range a.queue {
+		for _, sink := range a.sinks {
+			if err := sink.Write(records); err != nil {
+				logger.L("audit").Error("failed to write audit records", zap.Int("records", len(records)), zap.Error(err))
+			}
+		}
+	}
+}
+
+// Log - метод добавления записей в журнал.
+// если очередь переполнена, запрос ждет место в очереди не дольше enqueueTimeout,
+// затем записи отбрасываются и учитываются в счетчике audit_records_dropped_total.
+func (a *Auditor) Log(records []Record) {
+	if len(records) == 0 {
+		return
+	}
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	if a.closed {
+		return
+	}
+	select {
+	case a.queue <- records:
+		return
+	default:
+	}
+	timer := time.NewTimer(enqueueTimeout)
+	defer timer.Stop()
+	select {
+	case a.queue <- records:
+	case <-timer.C:
+		telemetry.AuditDropped.With().Add(float64(len(records)))
+		logger.L("audit").Error("audit queue is full, records dropped", zap.Int("records", len(records)))
+	}
+}
+
+// Close - метод закрытия журнала: дожидается отправки записей из очереди и закрывает приемники.
+func (a *Auditor) Close() {
+	a.mutex.Lock()
+	if a.closed {
+		a.mutex.Unlock()
+		return
+	}
+	a.closed = true
+	close(a.queue)
+	a.mutex.Unlock()
+
+	a.wg.Wait()
+	for _, sink := range a.sinks {
+		if err := sink.Close(); err != nil {
+			logger.L("audit").Error("failed to close audit sink", zap.Error(err))
+		}
+	}
+}
+
+// NewAuditorFromConfig - метод создания журнала по конфигурации.
+// если ни один приемник не настроен, возвращается nil.
+func NewAuditorFromConfig(config utils.AuditConfig) (*Auditor, error) {
+	sinks := make([]Sink, 0)
+	if config.AuditFile != "" {
+		sink, err := NewFileSink(config.AuditFile, int64(config.AuditMaxSize), config.AuditMaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if config.AuditStdout {
+		sinks = append(sinks, NewStdoutSink())
+	}
+	if config.AuditURL != "" {
+		sinks = append(sinks, NewWebhookSink(config.AuditURL, config.AuditTimeout))
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	return NewAuditor(sinks...), nil
+}
@@ -0,0 +1,221 @@
+package audit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/telemetry"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+type memorySink struct {
+	mutex   sync.Mutex
+	records []Record
+	closed  bool
+}
+
+func (s *memorySink) Write(records []Record) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.records = append(s.records, records...)
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	s.closed = true
+	return nil
+}
+
+// blockingSink - приемник, который сообщает о начале записи в started и ждет закрытия release.
+type blockingSink struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingSink) Write([]Record) error {
+	select {
+	case s.started <- struct{}{}:
+	default:
+	}
+	<-s.release
+	return nil
+}
+
+func (s *blockingSink) Close() error {
+	return nil
+}
+
+func TestStorage_UpdateJSONMetrics(t *testing.T) {
+	sink := &memorySink{}
+	auditor := NewAuditor(sink)
+	db := NewStorage(storage.NewStorage(&utils.StorageConfig{StoreInterval: 1}), auditor)
+	ctx := WithSource(context.Background(), Source{Client: "10.0.0.1", Transport: TransportHTTP})
+
+	_, err := db.UpdateJSONMetric(ctx, utils.NewGaugeJSONMetric("Alloc", 1.5))
+	require.NoError(t, err)
+	_, err = db.UpdateJSONMetrics(ctx, []utils.JSONMetric{
+		utils.NewGaugeJSONMetric("Alloc", 2.5),
+		utils.NewGaugeJSONMetric("Alloc", 3.5),
+		utils.NewCounterJSONMetric("PollCount", 5),
+		utils.NewCounterJSONMetric("PollCount", 7),
+	})
+	require.NoError(t, err)
+	auditor.Close()
+
+	require.Len(t, sink.records, 5)
+	assert.True(t, sink.closed)
+	values := func(r Record) (old *string, new string) { return r.OldValue, r.NewValue }
+	str := func(s string) *string { return &s }
+
+	for _, r := range sink.records {
+		assert.Equal(t, "10.0.0.1", r.Client)
+		assert.Equal(t, TransportHTTP, r.Transport)
+	}
+	old, value := values(sink.records[0])
+	assert.Nil(t, old)
+	assert.Equal(t, "1.5", value)
+	old, value = values(sink.records[1])
+	assert.Equal(t, str("1.5"), old)
+	assert.Equal(t, "2.5", value)
+	old, value = values(sink.records[2])
+	assert.Equal(t, str("2.5"), old)
+	assert.Equal(t, "3.5", value)
+	old, value = values(sink.records[3])
+	assert.Nil(t, old)
+	assert.Equal(t, "5", value)
+	old, value = values(sink.records[4])
+	assert.Equal(t, str("5"), old)
+	assert.Equal(t, "12", value)
+}
+
+func TestStorage_CounterZero(t *testing.T) {
+	sink := &memorySink{}
+	auditor := NewAuditor(sink)
+	db := NewStorage(storage.NewStorage(&utils.StorageConfig{StoreInterval: 1}), auditor)
+
+	_, err := db.UpdateJSONMetric(context.Background(), utils.NewCounterJSONMetric("PollCount", 0))
+	require.NoError(t, err)
+	_, err = db.UpdateJSONMetric(context.Background(), utils.NewCounterJSONMetric("PollCount", 0))
+	require.NoError(t, err)
+	auditor.Close()
+
+	// приращение 0 не меняет значение, но значение до изменения известно
+	require.Len(t, sink.records, 2)
+	assert.Nil(t, sink.records[0].OldValue)
+	require.NotNil(t, sink.records[1].OldValue)
+	assert.Equal(t, "0", *sink.records[1].OldValue)
+}
+
+func TestStorage_ReplaceMetrics(t *testing.T) {
+	sink := &memorySink{}
+	auditor := NewAuditor(sink)
+	db := NewStorage(storage.NewStorage(&utils.StorageConfig{StoreInterval: 1}), auditor)
+	ctx := context.Background()
+
+	_, err := db.UpdateJSONMetrics(ctx, []utils.JSONMetric{
+		utils.NewGaugeJSONMetric("Alloc", 1.5),
+		utils.NewCounterJSONMetric("PollCount", 5),
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.ReplaceMetrics(ctx, []utils.JSONMetric{
+		utils.NewCounterJSONMetric("PollCount", 2),
+		utils.NewGaugeJSONMetric("Custom", 3),
+	}))
+	auditor.Close()
+
+	require.Len(t, sink.records, 5)
+	records := make(map[string]Record)
+	for _, r := range sink.records[2:] {
+		records[r.MType+":"+r.ID] = r
+	}
+	require.Len(t, records, 3)
+	require.NotNil(t, records["counter:PollCount"].OldValue)
+	assert.Equal(t, "5", *records["counter:PollCount"].OldValue)
+	assert.Equal(t, "2", records["counter:PollCount"].NewValue)
+	assert.Nil(t, records["gauge:Custom"].OldValue)
+	assert.Equal(t, "3", records["gauge:Custom"].NewValue)
+	// метрика, которой нет в новом списке, записывается как удаленная
+	require.NotNil(t, records["gauge:Alloc"].OldValue)
+	assert.Equal(t, "1.5", *records["gauge:Alloc"].OldValue)
+	assert.Empty(t, records["gauge:Alloc"].NewValue)
+}
+
+func TestStorage_ConcurrentGauge(t *testing.T) {
+	sink := &memorySink{}
+	auditor := NewAuditor(sink)
+	db := NewStorage(storage.NewStorage(&utils.StorageConfig{StoreInterval: 1}), auditor)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := db.UpdateJSONMetric(context.Background(), utils.NewGaugeJSONMetric("Alloc", float64(i)))
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+	require.NoError(t, db.DeleteMetric(context.Background(), "Alloc", "gauge"))
+	auditor.Close()
+
+	// значения до изменения образуют цепочку: каждое новое значение является старым ровно для одной записи
+	require.Len(t, sink.records, 51)
+	olds := make(map[string]int)
+	initial := 0
+	for _, r := range sink.records {
+		if r.OldValue == nil {
+			initial++
+			continue
+		}
+		olds[*r.OldValue]++
+	}
+	assert.Equal(t, 1, initial)
+	for _, r := range sink.records[:50] {
+		assert.Equal(t, 1, olds[r.NewValue], r.NewValue)
+	}
+	assert.Empty(t, sink.records[50].NewValue)
+}
+
+func TestAuditor_LogQueueFull(t *testing.T) {
+	enqueueTimeout = 10 * time.Millisecond
+	defer func() { enqueueTimeout = time.Second }()
+	sink := &blockingSink{started: make(chan struct{}, 1), release: make(chan struct{})}
+	auditor := NewAuditor(sink)
+	dropped := telemetry.AuditDropped.With().Value()
+
+	// приемник занят, очередь заполняется, после ожидания записи отбрасываются и учитываются
+	auditor.Log(testRecords(1))
+	<-sink.started
+	for i := 0; i < queueSize+1; i++ {
+		auditor.Log(testRecords(2))
+	}
+	assert.Equal(t, dropped+2, telemetry.AuditDropped.With().Value())
+	close(sink.release)
+	auditor.Close()
+}
+
+func TestAuditor_LogAfterClose(t *testing.T) {
+	sink := &memorySink{}
+	auditor := NewAuditor(sink)
+	auditor.Close()
+	auditor.Log(testRecords(1))
+	auditor.Close()
+	assert.Empty(t, sink.records)
+}
+
+func TestNewAuditorFromConfig(t *testing.T) {
+	auditor, err := NewAuditorFromConfig(utils.AuditConfig{})
+	assert.Nil(t, err)
+	assert.Nil(t, auditor)
+
+	auditor, err = NewAuditorFromConfig(utils.AuditConfig{AuditStdout: true, AuditURL: "http://localhost"})
+	require.NoError(t, err)
+	assert.Len(t, auditor.sinks, 2)
+	auditor.Close()
+}
@@ -0,0 +1,160 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+func writeLines(w io.Writer, records []Record) error {
+	encoder := json.NewEncoder(w)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriterSink - приемник, записывающий журнал в формате JSON lines в io.Writer.
+type WriterSink struct {
+	w     io.Writer
+	mutex sync.Mutex
+}
+
+// NewStdoutSink - метод создания приемника, записывающего журнал в stdout.
+func NewStdoutSink() *WriterSink {
+	return &WriterSink{w: os.Stdout}
+}
+
+// Write - метод записи пачки записей.
+func (s *WriterSink) Write(records []Record) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return writeLines(s.w, records)
+}
+
+// Close - метод закрытия приемника.
+func (s *WriterSink) Close() error {
+	return nil
+}
+
+// FileSink - приемник, записывающий журнал в файл в формате JSON lines с ротацией по размеру.
+type FileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+	mutex      sync.Mutex
+}
+
+// NewFileSink - метод создания файлового приемника.
+// maxSize - размер файла в байтах, после которого выполняется ротация, 0 - без ротации.
+// maxBackups - количество хранимых файлов path.1 ... path.N.
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	if s.maxBackups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxBackups))
+		for i := s.maxBackups - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+		}
+		if err := os.Rename(s.path, s.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(s.path); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+// Write - метод записи пачки записей.
+func (s *FileSink) Write(records []Record) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var buf bytes.Buffer
+	if err := writeLines(&buf, records); err != nil {
+		return err
+	}
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(buf.Len()) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(buf.Bytes())
+	s.size += int64(n)
+	return err
+}
+
+// Close - метод закрытия файла журнала.
+func (s *FileSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.file.Close()
+}
+
+// WebhookSink - приемник, отправляющий пачки записей POST запросом в формате JSON.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink - метод создания приемника для отправки журнала на HTTP webhook.
+func NewWebhookSink(url string, timeout time.Duration) *WebhookSink {
+	return &WebhookSink{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+// Write - метод отправки пачки записей.
+func (s *WebhookSink) Write(records []Record) error {
+	body, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("audit webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// Close - метод закрытия приемника.
+func (s *WebhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,91 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRecords(n int) []Record {
+	records := make([]Record, n)
+	for i := range records {
+		records[i] = Record{Timestamp: time.Unix(1700000000, 0).UTC(), Client: "10.0.0.1", Transport: TransportHTTP, ID: "Alloc", MType: "gauge", NewValue: "1"}
+	}
+	return records
+}
+
+func countLines(t *testing.T, path string) int {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		lines++
+	}
+	return lines
+}
+
+func TestWriterSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := &WriterSink{w: &buf}
+	require.NoError(t, sink.Write(testRecords(1)))
+	assert.Equal(t,
+		`{"ts":"2023-11-14T22:13:20Z","client":"10.0.0.1","transport":"http","id":"Alloc","type":"gauge","new_value":"1"}`+"\n",
+		buf.String())
+}
+
+func TestFileSink_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	line, _ := json.Marshal(testRecords(1)[0])
+	sink, err := NewFileSink(path, int64(3*(len(line)+1)), 2)
+	require.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, sink.Write(testRecords(2)))
+	}
+	require.NoError(t, sink.Close())
+
+	assert.Equal(t, 2, countLines(t, path))
+	assert.Equal(t, 2, countLines(t, path+".1"))
+	assert.Equal(t, 2, countLines(t, path+".2"))
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestWebhookSink(t *testing.T) {
+	received := make([]Record, 0)
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var records []Record
+		require.NoError(t, json.Unmarshal(body, &records))
+		received = append(received, records...)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer svr.Close()
+
+	sink := NewWebhookSink(svr.URL, time.Second)
+	require.NoError(t, sink.Write(testRecords(3)))
+	assert.Len(t, received, 3)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	assert.NotNil(t, NewWebhookSink(failing.URL, time.Second).Write(testRecords(1)))
+}
@@ -0,0 +1,135 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// Storage - обертка над storage.Storage, записывающая успешные изменения метрик в журнал.
+// источник изменения берется из контекста запроса, см. WithSource.
+type Storage struct {
+	storage.Storage
+	auditor *Auditor
+}
+
+// NewStorage - метод создания хранилища с журналом изменений.
+func NewStorage(db storage.Storage, auditor *Auditor) *Storage {
+	return &Storage{Storage: db, auditor: auditor}
+}
+
+func metricKey(m utils.JSONMetric) string {
+	return m.MType + ":" + m.ID
+}
+
+// records - метод создания записей журнала по результату изменения.
+// значение до изменения берется из prev, который хранилище заполняет под той же блокировкой или в той же транзакции,
+// что и изменение. для метрики, измененной в списке повторно, значение до изменения - результат предыдущего изменения.
+func (s *Storage) records(ctx context.Context, prev *storage.Previous, out []utils.JSONMetric) []Record {
+	source := SourceFromContext(ctx)
+	// значения метрик, измененных ранее в том же списке
+	before := make(map[string]utils.JSONMetric)
+	now := time.Now()
+	records := make([]Record, 0, len(out))
+	for _, metric := range out {
+		record := Record{
+			Timestamp: now,
+			Client:    source.Client,
+			Transport: source.Transport,
+			ID:        metric.ID,
+			MType:     metric.MType,
+			NewValue:  metric.ValueString(),
+		}
+		old, ok := before[metricKey(metric)]
+		if !ok {
+			old, ok = prev.Get(metric.MType, metric.ID)
+		}
+		if ok {
+			value := old.ValueString()
+			record.OldValue = &value
+		}
+		before[metricKey(metric)] = metric
+		records = append(records, record)
+	}
+	return records
+}
+
+// deleted - метод создания записи журнала об удалении метрики, у записи пустое новое значение.
+// значение до удаления берется из prev.
+func deleted(ctx context.Context, prev *storage.Previous, mType, id string) Record {
+	source := SourceFromContext(ctx)
+	record := Record{
+		Timestamp: time.Now(),
+		Client:    source.Client,
+		Transport: source.Transport,
+		ID:        id,
+		MType:     mType,
+	}
+	if old, ok := prev.Get(mType, id); ok {
+		value := old.ValueString()
+		record.OldValue = &value
+	}
+	return record
+}
+
+// UpdateJSONMetric - метод обновления одной метрики с записью в журнал.
+func (s *Storage) UpdateJSONMetric(ctx context.Context, metric utils.JSONMetric) (utils.JSONMetric, error) {
+	ctx, prev := storage.WithPrevious(ctx)
+	out, err := s.Storage.UpdateJSONMetric(ctx, metric)
+	if err != nil {
+		return out, err
+	}
+	s.auditor.Log(s.records(ctx, prev, []utils.JSONMetric{out}))
+	return out, nil
+}
+
+// UpdateJSONMetrics - метод обновления списка метрик с записью в журнал.
+func (s *Storage) UpdateJSONMetrics(ctx context.Context, metrics []utils.JSONMetric) ([]utils.JSONMetric, error) {
+	ctx, prev := storage.WithPrevious(ctx)
+	out, err := s.Storage.UpdateJSONMetrics(ctx, metrics)
+	if err != nil {
+		return out, err
+	}
+	s.auditor.Log(s.records(ctx, prev, out))
+	return out, nil
+}
+
+// ReplaceMetrics - метод замены всех метрик с записью итоговых значений в журнал.
+// метрики, которых нет в новом списке, записываются в журнал как удаленные.
+func (s *Storage) ReplaceMetrics(ctx context.Context, metrics []utils.JSONMetric) error {
+	ctx, prev := storage.WithPrevious(ctx)
+	if err := s.Storage.ReplaceMetrics(ctx, metrics); err != nil {
+		return err
+	}
+	if all, err := s.Storage.GetAllMetrics(ctx); err == nil {
+		s.auditor.Log(s.replaceRecords(ctx, prev, all))
+	}
+	return nil
+}
+
+// replaceRecords - метод создания записей журнала по результату замены всех метрик на all.
+func (s *Storage) replaceRecords(ctx context.Context, prev *storage.Previous, all []utils.JSONMetric) []Record {
+	records := s.records(ctx, prev, all)
+	kept := make(map[string]bool, len(all))
+	for _, metric := range all {
+		kept[metricKey(metric)] = true
+	}
+	for _, old := range prev.All() {
+		if !kept[metricKey(old)] {
+			records = append(records, deleted(ctx, prev, old.MType, old.ID))
+		}
+	}
+	return records
+}
+
+// DeleteMetric - метод удаления метрики с записью в журнал.
+func (s *Storage) DeleteMetric(ctx context.Context, mName, mType string) error {
+	ctx, prev := storage.WithPrevious(ctx)
+	if err := s.Storage.DeleteMetric(ctx, mName, mType); err != nil {
+		return err
+	}
+	s.auditor.Log([]Record{deleted(ctx, prev, mType, mName)})
+	return nil
+}
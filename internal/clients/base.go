@@ -4,24 +4,32 @@ package clients
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/tiraill/go_collect_metrics/internal/tracing"
 	"github.com/tiraill/go_collect_metrics/internal/utils"
 )
 
 // Request - структура описывает API запрос.
 type Request struct {
-	Method       string            // метод запроса
-	URL          string            // URL запроса
-	Headers      map[string]string // заголовки запроса
-	Body         []byte            // тело запроса
-	OkStatusCode int               // ожидаемый код ответа
+	Method        string            // метод запроса
+	URL           string            // URL запроса
+	Headers       map[string]string // заголовки запроса
+	Body          []byte            // тело запроса
+	Payload       []byte            // подписываемые данные запроса без тела, например utils.DeletePayload
+	OkStatusCode  int               // ожидаемый код ответа
+	AltStatusCode int               // другой допустимый код ответа, 0 - не используется
 }
 
 // Response - структура описывает API ответ.
@@ -31,32 +39,78 @@ type Response struct {
 	Headers    http.Header // заголовки ответа
 }
 
+// ErrResponseHash ошибка невалидной подписи тела ответа.
+// запрос при этом выполнен сервером, см. DoRequestContext.
+var ErrResponseHash = errors.New("invalid response body hash")
+
 // BaseClient - структура описывает базового клиента.
 type BaseClient struct {
 	baseURL   string
 	client    *http.Client
 	rateLimit int
 	publicKey *utils.PublicKey
+	hashKey   string
 	xRealIP   string
+	agentID   string
 }
 
-func getXRealIP() (string, error) {
+// getXRealIP - метод определения адреса агента для заголовка X-Real-IP.
+// в первую очередь используется адрес интерфейса, через который идет маршрут до сервера,
+// иначе первый не loopback адрес, IPv4 предпочтительнее IPv6.
+func getXRealIP(baseURL string) (string, error) {
+	if addr, err := utils.LocalAddrFor(baseURL); err == nil && !addr.IsUnspecified() {
+		return addr.String(), nil
+	}
 	addrs, err := net.InterfaceAddrs()
 	if err != nil {
 		return "", err
 	}
+	var fallback string
 	for _, address := range addrs {
-		if ipnet, ok := address.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
-			if ipnet.IP.To4() != nil {
-				return ipnet.IP.String(), nil
-			}
+		ipnet, ok := address.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || !ipnet.IP.IsGlobalUnicast() {
+			continue
+		}
+		if ipnet.IP.To4() != nil {
+			return ipnet.IP.String(), nil
 		}
+		if fallback == "" {
+			fallback = ipnet.IP.String()
+		}
+	}
+	if fallback != "" {
+		return fallback, nil
 	}
 	return "", fmt.Errorf("can't get x-real-ip")
 }
 
+// readResponseBody - метод чтения тела ответа.
+// поддержка сжатия данных gzip.
+func readResponseBody(resp *http.Response) ([]byte, error) {
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		return io.ReadAll(resp.Body)
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return io.ReadAll(gz)
+}
+
+// responseHash - метод получения подписи тела ответа из заголовка или трейлера.
+// трейлер доступен только после чтения тела до конца.
+func responseHash(resp *http.Response) string {
+	if hash := resp.Header.Get(utils.BodyHashHeader); hash != "" {
+		return hash
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.Trailer.Get(utils.BodyHashHeader)
+}
+
 // NewBaseClient - метод для создания базового клиента.
-func NewBaseClient(baseURL string, timeout time.Duration, rateLimit int, publicKeyPath string) (*BaseClient, error) {
+// hashKey используется для подписи запроса, защищающей от повторной отправки, и идентификатора агента.
+func NewBaseClient(baseURL string, timeout time.Duration, rateLimit int, publicKeyPath, hashKey string) (*BaseClient, error) {
 	if !strings.HasPrefix(baseURL, "http") {
 		baseURL = "http://" + baseURL
 	}
@@ -64,19 +118,35 @@ func NewBaseClient(baseURL string, timeout time.Duration, rateLimit int, publicK
 	if err != nil {
 		return nil, err
 	}
-	xRealIP, err := getXRealIP()
+	xRealIP, err := getXRealIP(baseURL)
 	if err != nil {
 		return nil, err
 	}
 	return &BaseClient{
 		baseURL:   baseURL,
-		client:    &http.Client{Timeout: timeout},
+		client:    &http.Client{Timeout: timeout, Transport: otelhttp.NewTransport(http.DefaultTransport)},
 		rateLimit: rateLimit,
 		publicKey: publicKey,
+		hashKey:   hashKey,
 		xRealIP:   xRealIP,
+		agentID:   utils.AgentID(),
 	}, nil
 }
 
+// gzipBody - метод сжатия тела запроса.
+func gzipBody(ctx context.Context, w *bytes.Buffer, body []byte) (err error) {
+	_, span := tracing.Start(ctx, "gzip", attribute.Int("size", len(body)))
+	defer func() {
+		span.SetAttributes(attribute.Int("compressed_size", w.Len()))
+		tracing.End(span, err)
+	}()
+	gz := gzip.NewWriter(w)
+	if _, err = gz.Write(body); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
 // MakeURL - метод формирует url для запроса.
 func (c *BaseClient) MakeURL(url string) string {
 	baseURL := strings.TrimRight(c.baseURL, "/")
@@ -86,25 +156,46 @@ func (c *BaseClient) MakeURL(url string) string {
 
 // DoRequest - метод выполняет API запрос.
 func (c *BaseClient) DoRequest(r *Request) (Response, error) {
-	client := &http.Client{}
+	return c.DoRequestContext(context.Background(), r)
+}
+
+// DoRequestContext - метод выполняет API запрос в контексте ctx.
+// шифрование, сжатие и отправка запроса трассируются, контекст трассировки передается серверу в заголовке traceparent.
+func (c *BaseClient) DoRequestContext(ctx context.Context, r *Request) (Response, error) {
 	var requestBody bytes.Buffer
 
-	if c.publicKey != nil {
+	signed := r.Body
+	if r.Payload != nil {
+		signed = r.Payload
+	}
+	stamp := utils.NewRequestStamp(signed, c.agentID, c.hashKey)
+	if stamp != nil {
+		r.Headers[utils.TimestampHeader] = strconv.FormatInt(stamp.Timestamp, 10)
+		r.Headers[utils.NonceHeader] = stamp.Nonce
+		r.Headers[utils.SignatureHeader] = stamp.Signature
+		if stamp.AgentID != "" {
+			r.Headers[utils.AgentIDHeader] = stamp.AgentID
+		}
+	}
+
+	if c.hashKey != "" {
+		r.Headers[utils.BodyHashHeader] = *utils.CalcHash(string(signed), c.hashKey)
+	}
+
+	// пустое тело не шифруется, чтобы GET и DELETE запросы оставались без тела
+	if c.publicKey != nil && len(r.Body) > 0 {
+		_, span := tracing.Start(ctx, "encrypt", attribute.Int("size", len(r.Body)))
 		encryptedBody, err := c.publicKey.Encrypt(r.Body)
+		tracing.End(span, err)
 		if err != nil {
-			log.Println("Failed to encrypt body:", err)
-			return Response{}, err
+			return Response{}, fmt.Errorf("failed to encrypt body: %w", err)
 		}
 		r.Body = encryptedBody
 	}
 
 	_, ok := r.Headers["Content-Encoding"]
 	if ok {
-		gz := gzip.NewWriter(&requestBody)
-		if _, err := gz.Write(r.Body); err != nil {
-			return Response{}, err
-		}
-		if err := gz.Close(); err != nil {
+		if err := gzipBody(ctx, &requestBody, r.Body); err != nil {
 			return Response{}, err
 		}
 	} else {
@@ -112,7 +203,7 @@ func (c *BaseClient) DoRequest(r *Request) (Response, error) {
 	}
 	r.Headers["X-Real-IP"] = c.xRealIP
 
-	req, err := http.NewRequest(r.Method, r.URL, &requestBody)
+	req, err := http.NewRequestWithContext(ctx, r.Method, r.URL, &requestBody)
 	if err != nil {
 		return Response{}, err
 	}
@@ -120,21 +211,28 @@ func (c *BaseClient) DoRequest(r *Request) (Response, error) {
 	for key, value := range r.Headers {
 		req.Header.Set(key, value)
 	}
-	resp, err := client.Do(req)
+	resp, err := c.client.Do(req)
 	if err != nil {
 		return Response{}, err
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := readResponseBody(resp)
 	if err != nil {
 		return Response{}, err
 	}
 
-	if resp.StatusCode != r.OkStatusCode {
+	if resp.StatusCode != r.OkStatusCode && (r.AltStatusCode == 0 || resp.StatusCode != r.AltStatusCode) {
 		return Response{}, fmt.Errorf("error: %s details: %s", resp.Status, body)
 	}
 
+	// при заданном ключе ответ без подписи не принимается, иначе подпись можно удалить вместе с подменой тела.
+	// код ответа уже подтвердил выполнение запроса, поэтому вместе с ErrResponseHash возвращается код ответа без тела:
+	// запрос на запись не нужно отправлять повторно, но тело ответа не используется.
+	if c.hashKey != "" && !utils.IsValidBodyHash(body, responseHash(resp), c.hashKey) {
+		return Response{StatusCode: resp.StatusCode, Headers: resp.Header}, ErrResponseHash
+	}
+
 	return Response{
 		Body:       body,
 		StatusCode: resp.StatusCode,
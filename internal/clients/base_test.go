@@ -5,8 +5,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tiraill/go_collect_metrics/internal/utils"
 )
 
 func TestBaseClient_MakeURL(t *testing.T) {
@@ -71,3 +75,76 @@ func TestBaseClient_DoRequest_Failed(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Equal(t, "error: 400 Bad Request details: {\"msg\": \"Something went wrong\"}", err.Error())
 }
+
+func TestBaseClient_DoRequest_Timeout(t *testing.T) {
+	done := make(chan struct{})
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer svr.Close()
+	defer close(done)
+	baseClient, err := NewBaseClient(svr.URL, 50*time.Millisecond, 1, "", "")
+	require.NoError(t, err)
+	request := Request{Method: http.MethodGet, URL: baseClient.MakeURL("endpoint/"), Headers: map[string]string{}, OkStatusCode: http.StatusOK}
+	_, err = baseClient.DoRequest(&request)
+	assert.Error(t, err)
+}
+
+func TestBaseClient_DoRequest_BodyHash(t *testing.T) {
+	responseHash := ""
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.Nil(t, err)
+		assert.True(t, utils.IsValidBodyHash(body, r.Header.Get(utils.BodyHashHeader), "key"))
+		w.Header().Set(utils.BodyHashHeader, responseHash)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("pong"))
+	}))
+	defer svr.Close()
+	baseClient := BaseClient{baseURL: svr.URL, client: &http.Client{}, hashKey: "key"}
+	newRequest := func() *Request {
+		return &Request{
+			Method:       http.MethodPost,
+			URL:          baseClient.MakeURL("endpoint/"),
+			Headers:      map[string]string{"Content-Type": "application/json"},
+			Body:         []byte(`{"msg": "ping"}`),
+			OkStatusCode: http.StatusOK,
+		}
+	}
+
+	responseHash = *utils.CalcHash("pong", "key")
+	resp, err := baseClient.DoRequest(newRequest())
+	assert.Nil(t, err)
+	assert.Equal(t, "pong", string(resp.Body))
+
+	responseHash = "bad"
+	_, err = baseClient.DoRequest(newRequest())
+	assert.Equal(t, ErrResponseHash, err)
+
+	// ответ без подписи не принимается, но код ответа возвращается
+	responseHash = ""
+	resp, err = baseClient.DoRequest(newRequest())
+	assert.Equal(t, ErrResponseHash, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Body)
+}
+
+func TestBaseClient_DoRequest_TrailerHash(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", utils.BodyHashHeader)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("pong"))
+		w.Header().Set(utils.BodyHashHeader, *utils.CalcHash("pong", "key"))
+	}))
+	defer svr.Close()
+	baseClient := BaseClient{baseURL: svr.URL, client: &http.Client{}, hashKey: "key"}
+
+	resp, err := baseClient.DoRequest(&Request{
+		Method:       http.MethodGet,
+		URL:          baseClient.MakeURL("endpoint/"),
+		Headers:      map[string]string{},
+		OkStatusCode: http.StatusOK,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "pong", string(resp.Body))
+}
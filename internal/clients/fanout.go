@@ -0,0 +1,340 @@
+package clients
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+
+	"github.com/tiraill/go_collect_metrics/internal/logger"
+	"github.com/tiraill/go_collect_metrics/internal/telemetry"
+	"github.com/tiraill/go_collect_metrics/internal/tracing"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// Режимы отправки отчетов на несколько серверов.
+const (
+	FanoutFailover  = "failover"  // отчет принимает первый здоровый сервер списка
+	FanoutReplicate = "replicate" // отчет отправляется на каждый сервер
+)
+
+// DefaultHealthInterval - период проверки готовности серверов по умолчанию.
+const DefaultHealthInterval = 5 * time.Second
+
+// maxRetryDelay - наибольшая пауза перед повторной отправкой на сервер в режиме replicate.
+const maxRetryDelay = time.Minute
+
+// Delivery - результат отправки отчета на один сервер.
+type Delivery struct {
+	Server    string              // адрес сервера
+	PollCount int64               // отправленное значение PollCount
+	Response  utils.BatchResponse // результат каждой метрики
+	Err       error               // ошибка отправки
+	Skipped   bool                // отправка отложена до истечения паузы после ошибки
+}
+
+// destination - сервер и состояние отправки на него.
+type destination struct {
+	server   string
+	client   *MetricClient
+	healthy  bool
+	failures int       // ошибок отправки подряд
+	retryAt  time.Time // replicate: время следующей попытки после ошибки
+	pending  int64     // replicate: значение PollCount, еще не принятое сервером
+}
+
+// Fanout - отправка отчетов агента на несколько серверов.
+// в режиме failover отчет принимает первый здоровый сервер списка, при ошибке используется следующий,
+// а после успешной проверки готовности отчеты возвращаются на сервер с большим приоритетом.
+// в режиме replicate отчет отправляется на каждый сервер, у каждого сервера свои пауза после ошибок,
+// значение PollCount и карантин метрик, поэтому недоступный сервер не влияет на остальные.
+type Fanout struct {
+	mode         string
+	interval     time.Duration
+	timeout      time.Duration
+	mutex        sync.Mutex
+	destinations []*destination
+	active       *destination // failover: сервер, принявший последний отчет
+	pending      int64        // failover: значение PollCount, еще не принятое серверами
+	now          func() time.Time
+}
+
+// NewFanout - метод создания Fanout для клиентов серверов в порядке приоритета.
+// interval - период проверки готовности серверов, timeout - время на отправку отчета или проверку одного сервера.
+func NewFanout(mode string, interval, timeout time.Duration, clients ...*MetricClient) *Fanout {
+	f := &Fanout{mode: mode, interval: interval, timeout: timeout, now: time.Now}
+	for _, client := range clients {
+		if client.Quarantine == nil {
+			client.Quarantine = NewQuarantine(DefaultQuarantineTTL)
+		}
+		d := &destination{server: strings.TrimPrefix(client.baseURL, "http://"), client: client, healthy: true}
+		telemetry.AgentServerUp.With(d.server).Set(1)
+		f.destinations = append(f.destinations, d)
+	}
+	return f
+}
+
+// SetClients - метод замены клиентов серверов, например после перезагрузки ключей.
+// клиенты передаются в том же порядке, что и в NewFanout, карантин метрик и состояние серверов сохраняются.
+func (f *Fanout) SetClients(clients ...*MetricClient) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for i, client := range clients {
+		if i >= len(f.destinations) {
+			break
+		}
+		client.Quarantine = f.destinations[i].client.Quarantine
+		f.destinations[i].client = client
+	}
+}
+
+// Send - метод отправки отчета.
+// delta - значение PollCount, собранное после предыдущего отчета, оно отправляется, пока сервер его не примет.
+func (f *Fanout) Send(ctx context.Context, statistic *utils.Statistic, delta int64) []Delivery {
+	if f.mode == FanoutReplicate {
+		return f.replicate(ctx, statistic, delta, false)
+	}
+	return f.failover(ctx, statistic, delta)
+}
+
+// Flush - метод отправки последнего отчета перед остановкой, серверы отправляются без учета паузы после ошибок.
+func (f *Fanout) Flush(ctx context.Context, statistic *utils.Statistic, delta int64) []Delivery {
+	if f.mode == FanoutReplicate {
+		return f.replicate(ctx, statistic, delta, true)
+	}
+	return f.failover(ctx, statistic, delta)
+}
+
+// failover - метод отправки отчета на первый сервер, который его примет.
+func (f *Fanout) failover(ctx context.Context, statistic *utils.Statistic, delta int64) []Delivery {
+	f.mutex.Lock()
+	f.pending += delta
+	pollCount := f.pending
+	// серверы с ошибками тоже пробуются, если здоровые не приняли отчет
+	order := make([]*destination, 0, len(f.destinations))
+	for _, healthy := range []bool{true, false} {
+		for _, d := range f.destinations {
+			if d.healthy == healthy {
+				order = append(order, d)
+			}
+		}
+	}
+	f.mutex.Unlock()
+
+	deliveries := make([]Delivery, 0, 1)
+	for _, d := range order {
+		delivery := f.deliver(ctx, d, statistic, pollCount)
+		deliveries = append(deliveries, delivery)
+		if ctx.Err() != nil {
+			break
+		}
+		if delivery.Err != nil {
+			continue
+		}
+		f.mutex.Lock()
+		if pollCountApplied(delivery.Response) {
+			f.pending -= pollCount
+		}
+		f.activate(d)
+		f.mutex.Unlock()
+		break
+	}
+	return deliveries
+}
+
+// replicate - метод отправки отчета на каждый сервер, force - без учета паузы после ошибок.
+func (f *Fanout) replicate(ctx context.Context, statistic *utils.Statistic, delta int64, force bool) []Delivery {
+	f.mutex.Lock()
+	now := f.now()
+	deliveries := make([]Delivery, len(f.destinations))
+	for i, d := range f.destinations {
+		d.pending += delta
+		deliveries[i] = Delivery{Server: d.server, PollCount: d.pending, Skipped: !force && now.Before(d.retryAt)}
+		if deliveries[i].Skipped {
+			telemetry.AgentReports.With(d.server, "skipped").Inc()
+		}
+	}
+	f.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	for i, d := range f.destinations {
+		if deliveries[i].Skipped {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, d *destination) {
+			defer wg.Done()
+			pollCount := deliveries[i].PollCount
+			deliveries[i] = f.deliver(ctx, d, statistic, pollCount)
+			if deliveries[i].Err == nil && pollCountApplied(deliveries[i].Response) {
+				f.mutex.Lock()
+				d.pending -= pollCount
+				f.mutex.Unlock()
+			}
+		}(i, d)
+	}
+	wg.Wait()
+	return deliveries
+}
+
+// deliver - метод отправки отчета на сервер d со значением PollCount pollCount.
+// отмена ctx, например при остановке агента, не считается ошибкой сервера.
+func (f *Fanout) deliver(ctx context.Context, d *destination, statistic *utils.Statistic, pollCount int64) Delivery {
+	f.mutex.Lock()
+	client := d.client
+	f.mutex.Unlock()
+
+	parent := ctx
+	ctx, span := tracing.Start(ctx, "deliver", attribute.String("server", d.server))
+	_, buildSpan := tracing.Start(ctx, "build report")
+	stat := statistic.Copy()
+	stat.Counter = pollCount
+	// тело запроса подписывается целиком, поэтому хеш-суммы отдельных метрик не нужны
+	report := utils.NewJSONReport(stat, "")
+	buildSpan.SetAttributes(attribute.Int64("poll_count", pollCount), attribute.Int("metrics", len(report.Metrics)))
+	buildSpan.End()
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+	start := time.Now()
+	response, err := client.SendReport(ctx, report)
+	telemetry.AgentReportDuration.With(d.server).Observe(telemetry.Since(start))
+	tracing.End(span, err)
+	delivery := Delivery{Server: d.server, PollCount: pollCount, Response: response, Err: err}
+	if err != nil && parent.Err() != nil {
+		return delivery
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if err != nil {
+		telemetry.AgentReports.With(d.server, "error").Inc()
+		d.failures++
+		d.retryAt = f.now().Add(f.retryDelay(d.failures))
+		f.setHealthy(d, false, err)
+	} else {
+		telemetry.AgentReports.With(d.server, "ok").Inc()
+		d.failures = 0
+		d.retryAt = time.Time{}
+		f.setHealthy(d, true, nil)
+	}
+	return delivery
+}
+
+// retryDelay - метод получения паузы после failures ошибок подряд: период проверки, удваивающийся до maxRetryDelay.
+func (f *Fanout) retryDelay(failures int) time.Duration {
+	delay := f.interval
+	for i := 1; i < failures && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// setHealthy - метод изменения состояния сервера, вызывается под f.mutex.
+func (f *Fanout) setHealthy(d *destination, healthy bool, err error) {
+	if d.healthy == healthy {
+		return
+	}
+	d.healthy = healthy
+	if healthy {
+		telemetry.AgentServerUp.With(d.server).Set(1)
+		logger.L("agent").Info("server is healthy", zap.String("server", d.server))
+		return
+	}
+	telemetry.AgentServerUp.With(d.server).Set(0)
+	logger.L("agent").Warn("server is unhealthy", zap.String("server", d.server), zap.Error(err))
+}
+
+// activate - метод переключения отчетов режима failover на сервер d, вызывается под f.mutex.
+func (f *Fanout) activate(d *destination) {
+	previous := f.active
+	if previous == d {
+		return
+	}
+	f.active = d
+	telemetry.AgentServerActive.With(d.server).Set(1)
+	if previous == nil {
+		return
+	}
+	telemetry.AgentServerActive.With(previous.server).Set(0)
+	if f.index(d) < f.index(previous) {
+		logger.L("agent").Info("reports switched back to server", zap.String("server", d.server), zap.String("previous", previous.server))
+	} else {
+		logger.L("agent").Warn("reports switched to server", zap.String("server", d.server), zap.String("previous", previous.server))
+	}
+}
+
+func (f *Fanout) index(d *destination) int {
+	for i, item := range f.destinations {
+		if item == d {
+			return i
+		}
+	}
+	return -1
+}
+
+// Probe - метод проверки готовности всех серверов.
+// сервер, прошедший проверку, снова получает отчеты: в режиме failover - если у него больший приоритет,
+// в режиме replicate - без ожидания окончания паузы после ошибок.
+func (f *Fanout) Probe(ctx context.Context) {
+	f.mutex.Lock()
+	destinations := make(map[*destination]*MetricClient, len(f.destinations))
+	for _, d := range f.destinations {
+		destinations[d] = d.client
+	}
+	f.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	for d, client := range destinations {
+		wg.Add(1)
+		go func(d *destination, client *MetricClient) {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, f.timeout)
+			defer cancel()
+			err := client.Ready(probeCtx)
+			if ctx.Err() != nil {
+				return
+			}
+			f.mutex.Lock()
+			defer f.mutex.Unlock()
+			f.setHealthy(d, err == nil, err)
+			if err == nil {
+				d.retryAt = time.Time{}
+			}
+		}(d, client)
+	}
+	wg.Wait()
+}
+
+// Run - метод периодической проверки готовности серверов до отмены контекста.
+// с одним сервером проверки не выполняются: отчеты все равно отправляются только на него.
+func (f *Fanout) Run(ctx context.Context) {
+	if len(f.destinations) < 2 {
+		return
+	}
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f.Probe(ctx)
+		}
+	}
+}
+
+// pollCountApplied - метод проверки, что сервер принял значение PollCount.
+func pollCountApplied(response utils.BatchResponse) bool {
+	for _, result := range response.Results {
+		if result.ID == "PollCount" && result.Status == utils.BatchStatusOK {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+package clients
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tiraill/go_collect_metrics/internal/telemetry"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// fakeServer - сервер метрик, который можно остановить и запустить снова.
+type fakeServer struct {
+	*httptest.Server
+	mutex      sync.Mutex
+	down       bool
+	pollCounts []int64 // принятые значения PollCount
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	s := &fakeServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == readyPath {
+			return
+		}
+		reader, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		var metrics []utils.JSONMetric
+		require.NoError(t, json.NewDecoder(reader).Decode(&metrics))
+		for _, metric := range metrics {
+			if metric.ID == "PollCount" {
+				s.pollCounts = append(s.pollCounts, *metric.Delta)
+			}
+		}
+		if r.URL.Query().Get(utils.PartialParam) == "" {
+			return
+		}
+		valid, response := utils.NewBatchResponse(metrics, nil)
+		response.SetStored(valid, "")
+		w.WriteHeader(http.StatusMultiStatus)
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fakeServer) setDown(down bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.down = down
+}
+
+// received - метод получения и сброса принятых значений PollCount.
+func (s *fakeServer) received() []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	result := s.pollCounts
+	s.pollCounts = nil
+	return result
+}
+
+func (s *fakeServer) name() string {
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+func newTestFanout(t *testing.T, mode string, servers ...*fakeServer) *Fanout {
+	metricClients := make([]*MetricClient, 0, len(servers))
+	for _, s := range servers {
+		client, err := NewMetricClient(s.URL, time.Second, 1, "", "")
+		require.NoError(t, err)
+		metricClients = append(metricClients, client)
+	}
+	return NewFanout(mode, time.Minute, time.Second, metricClients...)
+}
+
+func TestFanout_Failover(t *testing.T) {
+	primary, backup := newFakeServer(t), newFakeServer(t)
+	f := newTestFanout(t, FanoutFailover, primary, backup)
+	stat := utils.NewStatistic()
+
+	// при ошибке основного сервера отчет принимает резервный
+	primary.setDown(true)
+	deliveries := f.Send(context.Background(), stat, 3)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, primary.name(), deliveries[0].Server)
+	assert.Error(t, deliveries[0].Err)
+	assert.NoError(t, deliveries[1].Err)
+	assert.Equal(t, []int64{3}, backup.received())
+	assert.Equal(t, float64(0), telemetry.AgentServerUp.With(primary.name()).Value())
+
+	// пока основной сервер не прошел проверку, отчеты идут на резервный
+	primary.setDown(false)
+	deliveries = f.Send(context.Background(), stat, 2)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, backup.name(), deliveries[0].Server)
+	assert.Equal(t, []int64{2}, backup.received())
+
+	// после проверки отчеты возвращаются на основной сервер
+	f.Probe(context.Background())
+	deliveries = f.Send(context.Background(), stat, 1)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, primary.name(), deliveries[0].Server)
+	assert.Equal(t, []int64{1}, primary.received())
+	assert.Equal(t, float64(1), telemetry.AgentServerActive.With(primary.name()).Value())
+	assert.Equal(t, float64(0), telemetry.AgentServerActive.With(backup.name()).Value())
+}
+
+func TestFanout_FailoverAllDown(t *testing.T) {
+	primary, backup := newFakeServer(t), newFakeServer(t)
+	f := newTestFanout(t, FanoutFailover, primary, backup)
+	stat := utils.NewStatistic()
+
+	primary.setDown(true)
+	backup.setDown(true)
+	deliveries := f.Send(context.Background(), stat, 2)
+	require.Len(t, deliveries, 2)
+	for _, delivery := range deliveries {
+		assert.Error(t, delivery.Err)
+	}
+
+	// непринятое значение PollCount отправляется со следующим отчетом
+	backup.setDown(false)
+	f.Send(context.Background(), stat, 1)
+	assert.Equal(t, []int64{3}, backup.received())
+	assert.Empty(t, primary.received())
+}
+
+func TestFanout_Replicate(t *testing.T) {
+	first, second := newFakeServer(t), newFakeServer(t)
+	f := newTestFanout(t, FanoutReplicate, first, second)
+	stat := utils.NewStatistic()
+	failed := telemetry.AgentReports.With(second.name(), "error")
+	skipped := telemetry.AgentReports.With(second.name(), "skipped")
+
+	second.setDown(true)
+	deliveries := f.Send(context.Background(), stat, 2)
+	require.Len(t, deliveries, 2)
+	assert.NoError(t, deliveries[0].Err)
+	assert.Error(t, deliveries[1].Err)
+	assert.Equal(t, []int64{2}, first.received())
+	assert.Equal(t, float64(1), failed.Value())
+
+	// после ошибки сервер пропускается до окончания паузы, остальные получают отчеты
+	deliveries = f.Send(context.Background(), stat, 1)
+	assert.True(t, deliveries[1].Skipped)
+	assert.Equal(t, int64(3), deliveries[1].PollCount)
+	assert.Equal(t, []int64{1}, first.received())
+	assert.Equal(t, float64(1), skipped.Value())
+
+	// после проверки сервер получает накопленное значение PollCount
+	second.setDown(false)
+	f.Probe(context.Background())
+	f.Send(context.Background(), stat, 1)
+	assert.Equal(t, []int64{1}, first.received())
+	assert.Equal(t, []int64{4}, second.received())
+}
+
+func TestFanout_SetClients(t *testing.T) {
+	s := newFakeServer(t)
+	f := newTestFanout(t, FanoutFailover, s)
+	quarantine := f.destinations[0].client.Quarantine
+	client, err := NewMetricClient(s.URL, time.Second, 1, "", "secret")
+	require.NoError(t, err)
+
+	f.SetClients(client)
+	assert.Same(t, client, f.destinations[0].client)
+	assert.Same(t, quarantine, client.Quarantine)
+}
+
+func TestFanout_RetryDelay(t *testing.T) {
+	f := &Fanout{interval: 5 * time.Second}
+	assert.Equal(t, 5*time.Second, f.retryDelay(1))
+	assert.Equal(t, 10*time.Second, f.retryDelay(2))
+	assert.Equal(t, 40*time.Second, f.retryDelay(4))
+	assert.Equal(t, maxRetryDelay, f.retryDelay(10))
+}
+
+func TestFanout_Flush(t *testing.T) {
+	first, second := newFakeServer(t), newFakeServer(t)
+	f := newTestFanout(t, FanoutReplicate, first, second)
+	stat := utils.NewStatistic()
+
+	second.setDown(true)
+	f.Send(context.Background(), stat, 1)
+	second.setDown(false)
+
+	// последний отчет отправляется и на сервер, у которого не закончилась пауза после ошибки
+	deliveries := f.Flush(context.Background(), stat, 1)
+	require.Len(t, deliveries, 2)
+	assert.False(t, deliveries[1].Skipped)
+	assert.NoError(t, deliveries[1].Err)
+	assert.Equal(t, []int64{2}, second.received())
+
+	// отмена контекста не считается ошибкой сервера, значение PollCount отправляется со следующим отчетом
+	first.received()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	deliveries = f.Send(ctx, stat, 1)
+	assert.Error(t, deliveries[0].Err)
+	deliveries = f.Send(context.Background(), stat, 0)
+	assert.False(t, deliveries[0].Skipped)
+	assert.Equal(t, []int64{1}, first.received())
+}
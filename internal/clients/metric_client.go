@@ -7,19 +7,28 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/tiraill/go_collect_metrics/internal/logger"
+	"github.com/tiraill/go_collect_metrics/internal/tracing"
 	"github.com/tiraill/go_collect_metrics/internal/utils"
 )
 
+// readyPath - путь проверки готовности сервера.
+const readyPath = "/readyz"
+
 // MetricClient - структура описывает клиента для отправки метрик
 type MetricClient struct {
 	*BaseClient
+	Quarantine *Quarantine // метрики, отклоненные сервером при частичной загрузке, nil - не используется
+	Partial    bool        // отправка отчетов SendReport в режиме частичной загрузки
 }
 
 // NewMetricClient - метод для создания клиента отправки метрик
-func NewMetricClient(baseURL string, timeout time.Duration, rateLimit int, publicKeyPath string) (*MetricClient, error) {
-	baseClient, err := NewBaseClient(baseURL, timeout, rateLimit, publicKeyPath)
+func NewMetricClient(baseURL string, timeout time.Duration, rateLimit int, publicKeyPath, hashKey string) (*MetricClient, error) {
+	baseClient, err := NewBaseClient(baseURL, timeout, rateLimit, publicKeyPath, hashKey)
 	if err != nil {
 		return nil, err
 	}
@@ -81,6 +90,98 @@ func (mc MetricClient) SendBatchJSONReport(report *utils.JSONReport) error {
 	return mc.postBody(body, "updates/", true)
 }
 
+// SendReport - метод отправки отчета одним API запросом.
+// в режиме Partial используется частичная загрузка, иначе сервер принимает или отклоняет отчет целиком,
+// и в ответе все метрики отчета считаются записанными.
+func (mc MetricClient) SendReport(ctx context.Context, report *utils.JSONReport) (utils.BatchResponse, error) {
+	if mc.Partial {
+		return mc.SendPartialBatchJSONReport(ctx, report)
+	}
+	ctx, span := tracing.Start(ctx, "send", attribute.Int("metrics", len(report.Metrics)))
+	body, err := json.Marshal(report.Metrics)
+	if err != nil {
+		tracing.End(span, err)
+		return utils.BatchResponse{}, errors.Wrap(err, "unable to make json")
+	}
+	_, err = mc.post(ctx, body, "updates/", true, http.StatusOK)
+	tracing.End(span, err)
+	if err != nil {
+		return utils.BatchResponse{}, err
+	}
+	return acceptedResponse(report.Metrics), nil
+}
+
+// acceptedResponse - метод получения ответа, в котором все метрики записаны.
+func acceptedResponse(metrics []utils.JSONMetric) utils.BatchResponse {
+	response := utils.BatchResponse{Applied: len(metrics), Results: make([]utils.BatchResult, len(metrics))}
+	for i, metric := range metrics {
+		response.Results[i] = utils.BatchResult{Index: i, ID: metric.ID, MType: metric.MType, Status: utils.BatchStatusOK}
+	}
+	return response
+}
+
+// SendPartialBatchJSONReport - метод для отправки отчета в режиме частичной загрузки
+// сервер сохраняет валидные метрики и возвращает результат каждой метрики,
+// отклоненные метрики помещаются в Quarantine и не отправляются до истечения срока.
+// сервер без частичной загрузки отвечает 200 и записывает отчет целиком, тогда все метрики считаются записанными.
+func (mc MetricClient) SendPartialBatchJSONReport(ctx context.Context, report *utils.JSONReport) (response utils.BatchResponse, err error) {
+	ctx, span := tracing.Start(ctx, "send", attribute.Int("metrics", len(report.Metrics)))
+	defer func() {
+		span.SetAttributes(attribute.Int("applied", response.Applied), attribute.Int("rejected", response.Failed))
+		tracing.End(span, err)
+	}()
+	metrics := report.Metrics
+	if mc.Quarantine != nil {
+		metrics = mc.Quarantine.Filter(metrics)
+	}
+	body, err := json.Marshal(metrics)
+	if err != nil {
+		return utils.BatchResponse{}, errors.Wrap(err, "unable to make json")
+	}
+	request := Request{
+		Method:        http.MethodPost,
+		URL:           mc.MakeURL("updates/?" + utils.PartialParam + "=true"),
+		Headers:       mc.getHeaders(true),
+		Body:          body,
+		OkStatusCode:  http.StatusMultiStatus,
+		AltStatusCode: http.StatusOK,
+	}
+	resp, err := mc.DoRequestContext(ctx, &request)
+	if errors.Is(err, ErrResponseHash) {
+		// результаты метрик без подписи нельзя использовать для карантина, но отчет уже записан
+		logUnsignedResponse(request.URL)
+		return acceptedResponse(metrics), nil
+	}
+	if err != nil {
+		return utils.BatchResponse{}, errors.Wrap(err, "unable to complete update metric request")
+	}
+	if resp.StatusCode == http.StatusOK {
+		return acceptedResponse(metrics), nil
+	}
+	response, err = utils.LoadBatchResponse(resp.Body)
+	if err != nil {
+		return response, errors.Wrap(err, "unable to parse batch response")
+	}
+	if mc.Quarantine != nil {
+		for _, result := range response.Rejected() {
+			mc.Quarantine.Add(result)
+		}
+	}
+	return response, nil
+}
+
+// Ready - метод проверки готовности сервера принимать метрики.
+func (mc MetricClient) Ready(ctx context.Context) error {
+	request := Request{
+		Method:       http.MethodGet,
+		URL:          mc.MakeURL(readyPath),
+		Headers:      make(map[string]string),
+		OkStatusCode: http.StatusOK,
+	}
+	_, err := mc.DoRequestContext(ctx, &request)
+	return err
+}
+
 func (mc MetricClient) getHeaders(compress bool) map[string]string {
 	headers := make(map[string]string)
 	headers["Content-Type"] = "application/json"
@@ -92,16 +193,31 @@ func (mc MetricClient) getHeaders(compress bool) map[string]string {
 }
 
 func (mc MetricClient) postBody(body []byte, url string, compress bool) error {
+	_, err := mc.post(context.Background(), body, url, compress, http.StatusOK)
+	return err
+}
+
+func (mc MetricClient) post(ctx context.Context, body []byte, url string, compress bool, okStatusCode int) (Response, error) {
 	request := Request{
 		Method:       http.MethodPost,
 		URL:          mc.MakeURL(url),
 		Headers:      mc.getHeaders(compress),
 		Body:         body,
-		OkStatusCode: http.StatusOK,
+		OkStatusCode: okStatusCode,
+	}
+	resp, err := mc.DoRequestContext(ctx, &request)
+	if errors.Is(err, ErrResponseHash) {
+		logUnsignedResponse(request.URL)
+		return resp, nil
 	}
-	_, err := mc.DoRequest(&request)
 	if err != nil {
-		return errors.Wrap(err, "unable to complete update metric request")
+		return resp, errors.Wrap(err, "unable to complete update metric request")
 	}
-	return nil
+	return resp, nil
+}
+
+// logUnsignedResponse - метод записи в журнал ответа без верной подписи на записанный сервером отчет.
+// отчет считается доставленным: повторная отправка увеличила бы значения счетчиков второй раз.
+func logUnsignedResponse(url string) {
+	logger.L("agent").Warn("report stored, but response signature is invalid", zap.String("url", url), zap.Error(ErrResponseHash))
 }
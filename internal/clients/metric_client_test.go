@@ -2,6 +2,7 @@ package clients
 
 import (
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"io"
 	"log"
@@ -17,12 +18,15 @@ import (
 )
 
 func TestNewMetricClient(t *testing.T) {
-	baseClient, err := NewBaseClient("localhost:8080", 1*time.Second, 1, "")
+	baseClient, err := NewBaseClient("localhost:8080", 1*time.Second, 1, "", "")
 	assert.Nil(t, err)
 	expected := MetricClient{BaseClient: baseClient}
 	assert.Nil(t, err)
-	result, err := NewMetricClient("localhost:8080", 1*time.Second, 1, "")
+	result, err := NewMetricClient("localhost:8080", 1*time.Second, 1, "", "")
 	assert.Nil(t, err)
+	assert.Equal(t, 1*time.Second, result.client.Timeout)
+	// у каждого клиента свой транспорт с трассировкой
+	result.client = baseClient.client
 	assert.Equal(t, *result, expected)
 }
 
@@ -60,7 +64,7 @@ func TestMetricClient_postMetric(t *testing.T) {
 				w.WriteHeader(http.StatusOK)
 			}))
 			defer svr.Close()
-			mc, err := NewMetricClient(svr.URL, 1*time.Second, 1, "")
+			mc, err := NewMetricClient(svr.URL, 1*time.Second, 1, "", "")
 			assert.Nil(t, err)
 			tt.metric.Hash = utils.CalcHash(tt.metric.String(), tt.hashKey)
 			body, err := json.Marshal(tt.metric)
@@ -84,7 +88,7 @@ func TestMetricClient_SendJSONReport(t *testing.T) {
 		w.WriteHeader(http.StatusOK)
 	}))
 	defer svr.Close()
-	mc, err := NewMetricClient(svr.URL, 1*time.Second, 1, "")
+	mc, err := NewMetricClient(svr.URL, 1*time.Second, 1, "", "")
 	assert.Nil(t, err)
 	err = mc.SendJSONReport(report)
 	assert.Nil(t, err)
@@ -113,7 +117,7 @@ func TestMetricClient_SendBatchJSONReport(t *testing.T) {
 		w.WriteHeader(http.StatusOK)
 	}))
 	defer svr.Close()
-	mc, err := NewMetricClient(svr.URL, 1*time.Second, 1, "")
+	mc, err := NewMetricClient(svr.URL, 1*time.Second, 1, "", "")
 	assert.Nil(t, err)
 	err = mc.SendBatchJSONReport(report)
 	assert.Nil(t, err)
@@ -131,7 +135,7 @@ func BenchmarkSendReport(b *testing.B) {
 		w.WriteHeader(http.StatusOK)
 	}))
 	defer svr.Close()
-	mc, _ := NewMetricClient(svr.URL, 1*time.Second, 1, "")
+	mc, _ := NewMetricClient(svr.URL, 1*time.Second, 1, "", "")
 	b.Run("by_one", func(b *testing.B) {
 		for i := 0; i < triesN; i++ {
 			_ = mc.SendJSONReport(report)
@@ -151,7 +155,7 @@ func ExampleMetricClient_SendBatchJSONReport() {
 	requestPerSecond := 10
 	hashKey := "secret"
 
-	metricClient, _ := NewMetricClient(metricServerHost, requestTimeout, requestPerSecond, "")
+	metricClient, _ := NewMetricClient(metricServerHost, requestTimeout, requestPerSecond, "", hashKey)
 	statistic := utils.NewStatistic()
 	report := utils.NewJSONReport(statistic, hashKey)
 
@@ -162,3 +166,123 @@ func ExampleMetricClient_SendBatchJSONReport() {
 		log.Println("Send report successfully")
 	}
 }
+
+func TestMetricClient_SendPartialBatchJSONReport(t *testing.T) {
+	report := &utils.JSONReport{Metrics: []utils.JSONMetric{
+		utils.NewCounterJSONMetric("PollCount", 1),
+		utils.NewGaugeJSONMetric("Custom", 1),
+	}}
+	requests := 0
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/updates/", r.URL.Path)
+		assert.Equal(t, "true", r.URL.Query().Get(utils.PartialParam))
+		reader, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		var metrics []utils.JSONMetric
+		require.NoError(t, json.NewDecoder(reader).Decode(&metrics))
+
+		errs := make(map[int]error)
+		for i, metric := range metrics {
+			if metric.ID == "Custom" {
+				errs[i] = utils.ErrMetricValue
+			}
+		}
+		valid, response := utils.NewBatchResponse(metrics, errs)
+		response.SetStored(valid, "")
+		w.WriteHeader(http.StatusMultiStatus)
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer svr.Close()
+	mc, err := NewMetricClient(svr.URL, 1*time.Second, 1, "", "")
+	require.NoError(t, err)
+	mc.Quarantine = NewQuarantine(time.Minute)
+
+	response, err := mc.SendPartialBatchJSONReport(context.Background(), report)
+	require.NoError(t, err)
+	assert.Equal(t, 1, response.Applied)
+	require.Len(t, response.Rejected(), 1)
+	assert.Equal(t, utils.MetricCodeValue, response.Rejected()[0].Code)
+	assert.Equal(t, 1, mc.Quarantine.Len())
+
+	// метрика в карантине больше не отправляется
+	response, err = mc.SendPartialBatchJSONReport(context.Background(), report)
+	require.NoError(t, err)
+	assert.Equal(t, 1, response.Applied)
+	assert.Zero(t, response.Failed)
+	assert.Equal(t, 2, requests)
+}
+
+func TestMetricClient_SendReport(t *testing.T) {
+	report := &utils.JSONReport{Metrics: []utils.JSONMetric{
+		utils.NewCounterJSONMetric("PollCount", 1),
+		utils.NewGaugeJSONMetric("Custom", 1),
+	}}
+	var partial []string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/updates/", r.URL.Path)
+		partial = append(partial, r.URL.Query().Get(utils.PartialParam))
+		// сервер без частичной загрузки записывает отчет целиком и отвечает 200
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer svr.Close()
+	mc, err := NewMetricClient(svr.URL, 1*time.Second, 1, "", "")
+	require.NoError(t, err)
+
+	response, err := mc.SendReport(context.Background(), report)
+	require.NoError(t, err)
+	assert.Equal(t, 2, response.Applied)
+	assert.Empty(t, response.Rejected())
+
+	mc.Partial = true
+	response, err = mc.SendReport(context.Background(), report)
+	require.NoError(t, err)
+	assert.Equal(t, 2, response.Applied)
+	assert.Empty(t, response.Rejected())
+	assert.Equal(t, []string{"", "true"}, partial)
+}
+
+func TestMetricClient_SendReport_UnsignedResponse(t *testing.T) {
+	report := &utils.JSONReport{Metrics: []utils.JSONMetric{utils.NewCounterJSONMetric("PollCount", 1)}}
+	requests := 0
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// сервер записал отчет, но ответ пришел без подписи
+		if r.URL.Query().Get(utils.PartialParam) == "" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write([]byte(`{"applied":0,"failed":1,"results":[{"index":0,"id":"PollCount","type":"counter","status":"rejected"}]}`))
+	}))
+	defer svr.Close()
+	mc, err := NewMetricClient(svr.URL, 1*time.Second, 1, "", "key")
+	require.NoError(t, err)
+	mc.Quarantine = NewQuarantine(time.Minute)
+
+	// отчет считается доставленным, чтобы не отправлять его повторно
+	response, err := mc.SendReport(context.Background(), report)
+	require.NoError(t, err)
+	assert.Equal(t, 1, response.Applied)
+
+	// результаты из ответа без подписи не попадают в карантин
+	mc.Partial = true
+	response, err = mc.SendReport(context.Background(), report)
+	require.NoError(t, err)
+	assert.Equal(t, 1, response.Applied)
+	assert.Zero(t, mc.Quarantine.Len())
+	assert.Equal(t, 2, requests)
+}
+
+func TestQuarantine(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	q := NewQuarantine(time.Minute)
+	q.now = func() time.Time { return now }
+	metrics := []utils.JSONMetric{utils.NewGaugeJSONMetric("Alloc", 1), utils.NewCounterJSONMetric("Alloc", 1)}
+
+	q.Add(utils.BatchResult{ID: "Alloc", MType: "gauge"})
+	assert.Equal(t, metrics[1:], q.Filter(metrics))
+	now = now.Add(time.Minute)
+	assert.Equal(t, metrics, q.Filter(metrics))
+	assert.Zero(t, q.Len())
+}
@@ -0,0 +1,65 @@
+package clients
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// DefaultQuarantineTTL - время, на которое метрика, отклоненная сервером, исключается из отчетов.
+const DefaultQuarantineTTL = 10 * time.Minute
+
+// Quarantine - метрики, отклоненные сервером при частичной загрузке.
+// такие метрики не отправляются до истечения срока, чтобы не повторять заведомо ошибочные данные.
+type Quarantine struct {
+	ttl   time.Duration
+	mutex sync.Mutex
+	until map[string]time.Time
+	now   func() time.Time
+}
+
+// NewQuarantine - метод создания объекта Quarantine.
+func NewQuarantine(ttl time.Duration) *Quarantine {
+	if ttl <= 0 {
+		ttl = DefaultQuarantineTTL
+	}
+	return &Quarantine{ttl: ttl, until: make(map[string]time.Time), now: time.Now}
+}
+
+func quarantineKey(mType, id string) string {
+	return mType + "/" + id
+}
+
+// Add - метод помещения в карантин метрики, отклоненной сервером.
+func (q *Quarantine) Add(result utils.BatchResult) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.until[quarantineKey(result.MType, result.ID)] = q.now().Add(q.ttl)
+}
+
+// Filter - метод исключения из списка метрик, находящихся в карантине.
+func (q *Quarantine) Filter(metrics []utils.JSONMetric) []utils.JSONMetric {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	now := q.now()
+	filtered := make([]utils.JSONMetric, 0, len(metrics))
+	for _, metric := range metrics {
+		key := quarantineKey(metric.MType, metric.ID)
+		if until, ok := q.until[key]; ok {
+			if now.Before(until) {
+				continue
+			}
+			delete(q.until, key)
+		}
+		filtered = append(filtered, metric)
+	}
+	return filtered
+}
+
+// Len - метод возвращает количество метрик в карантине.
+func (q *Quarantine) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.until)
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tiraill/go_collect_metrics/internal/agent"
+	"github.com/tiraill/go_collect_metrics/internal/clients"
+	"github.com/tiraill/go_collect_metrics/internal/logger"
+	"github.com/tiraill/go_collect_metrics/internal/tracing"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// NewAgentLoader - метод создания загрузчика конфигурации агента.
+// адрес по умолчанию у HTTP и gRPC агентов различается.
+// без перезапуска применяются интервалы, ключи и количество одновременных запросов.
+func NewAgentLoader(name, defaultAddress string) *Loader[utils.AgentConfig] {
+	options := []Option[utils.AgentConfig]{
+		{Key: "address", Env: "ADDRESS", Flags: []string{"a", "address"}, Default: defaultAddress,
+			Usage: "server address, comma separated list for several servers", Field: func(c *utils.AgentConfig) any { return &c.Address }},
+		{Key: "fanout_mode", Env: "FANOUT_MODE", Flags: []string{"fanout-mode"}, Default: clients.FanoutFailover,
+			Usage: "several servers mode: failover or replicate", Field: func(c *utils.AgentConfig) any { return &c.FanoutMode }},
+		{Key: "health_interval", Env: "HEALTH_INTERVAL", Flags: []string{"health-interval"}, Default: clients.DefaultHealthInterval,
+			Usage: "servers readiness check interval", Field: func(c *utils.AgentConfig) any { return &c.HealthInterval }},
+		{Key: "diag_address", Env: "DIAG_ADDRESS", Flags: []string{"diag-address"},
+			Usage: "diagnostics server address with internal metrics, loopback if the host is empty", Field: func(c *utils.AgentConfig) any { return &c.DiagAddress }},
+		{Key: "diag_pprof", Env: "DIAG_PPROF", Flags: []string{"diag-pprof"},
+			Usage: "serve pprof profiles on the diagnostics server without access control", Field: func(c *utils.AgentConfig) any { return &c.DiagPprof }},
+		{Key: "partial_batch", Env: "PARTIAL_BATCH", Flags: []string{"partial-batch"},
+			Usage: "send reports in partial mode, the server stores valid metrics and rejects the rest", Field: func(c *utils.AgentConfig) any { return &c.PartialBatch }},
+		{Key: "report_interval", Reload: true, Env: "REPORT_INTERVAL", Flags: []string{"r", "report-interval"}, Default: 10 * time.Second,
+			Usage: "report interval", Field: func(c *utils.AgentConfig) any { return &c.ReportInterval }},
+		{Key: "poll_interval", Reload: true, Env: "POLL_INTERVAL", Flags: []string{"p", "poll-interval"}, Default: 2 * time.Second,
+			Usage: "poll interval", Field: func(c *utils.AgentConfig) any { return &c.PollInterval }},
+		{Key: "hash_key", Reload: true, Env: "KEY", Flags: []string{"k", "key"}, Secret: true,
+			Usage: "hash key", Field: func(c *utils.AgentConfig) any { return &c.HashKey }},
+		{Key: "crypto_key", Reload: true, Env: "CRYPTO_KEY", Flags: []string{"crypto-key"},
+			Usage: "public crypto key file", Field: func(c *utils.AgentConfig) any { return &c.CryptoKey }},
+		{Key: "rate_limit", Reload: true, Env: "RATE_LIMIT", Flags: []string{"l", "rate-limit"}, Default: 10,
+			Usage: "max number of concurrent requests to the server", Field: func(c *utils.AgentConfig) any { return &c.RateLimit }},
+		{Key: "collect_timeout", Env: "COLLECT_TIMEOUT", Flags: []string{"collect-timeout"}, Default: agent.DefaultCollectTimeout,
+			Usage: "metrics collection timeout", Field: func(c *utils.AgentConfig) any { return &c.CollectTimeout }},
+		{Key: "send_timeout", Env: "SEND_TIMEOUT", Flags: []string{"send-timeout"}, Default: agent.DefaultSendTimeout,
+			Usage: "report send timeout for one server", Field: func(c *utils.AgentConfig) any { return &c.SendTimeout }},
+		{Key: "shutdown_timeout", Env: "SHUTDOWN_TIMEOUT", Flags: []string{"shutdown-timeout"}, Default: agent.DefaultShutdownTimeout,
+			Usage: "final collect and report deadline on shutdown", Field: func(c *utils.AgentConfig) any { return &c.ShutdownTimeout }},
+		{Key: "spool_size", Env: "SPOOL_SIZE", Flags: []string{"spool-size"}, Default: 0,
+			Usage: "reports queued while a send is in progress, 0 - no queue", Field: func(c *utils.AgentConfig) any { return &c.SpoolSize }},
+	}
+	options = append(options, logOptions(func(c *utils.AgentConfig) *utils.LogConfig { return &c.Log })...)
+	options = append(options, traceOptions(func(c *utils.AgentConfig) *utils.TraceConfig { return &c.Trace })...)
+	return NewLoader(name, options,
+		func(c *utils.AgentConfig) error { return logger.Check(c.Log) },
+		func(c *utils.AgentConfig) error { return tracing.Check(c.Trace) },
+		checkAgent)
+}
+
+func checkAgent(c *utils.AgentConfig) error {
+	servers := c.Servers()
+	if len(servers) == 0 {
+		return fmt.Errorf("address must not be empty")
+	}
+	seen := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		if err := checkAddress("address", server); err != nil {
+			return err
+		}
+		if seen[server] {
+			return fmt.Errorf("address %q is listed twice", server)
+		}
+		seen[server] = true
+	}
+	if c.FanoutMode != clients.FanoutFailover && c.FanoutMode != clients.FanoutReplicate {
+		return fmt.Errorf("fanout_mode %q must be failover or replicate", c.FanoutMode)
+	}
+	if c.HealthInterval <= 0 {
+		return fmt.Errorf("health_interval must be positive")
+	}
+	if c.DiagAddress != "" {
+		if err := checkAddress("diag_address", c.DiagAddress); err != nil {
+			return err
+		}
+	}
+	if c.CollectTimeout <= 0 || c.SendTimeout <= 0 || c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("collect_timeout, send_timeout and shutdown_timeout must be positive")
+	}
+	if c.SpoolSize < 0 {
+		return fmt.Errorf("spool_size must not be negative")
+	}
+	if c.ReportInterval <= 0 || c.PollInterval <= 0 {
+		return fmt.Errorf("report_interval and poll_interval must be positive")
+	}
+	if c.PollInterval > c.ReportInterval {
+		return fmt.Errorf("poll_interval (%s) must not exceed report_interval (%s), collected values would be reported late",
+			c.PollInterval, c.ReportInterval)
+	}
+	if c.RateLimit < 1 {
+		return fmt.Errorf("rate_limit must be at least 1")
+	}
+	return nil
+}
@@ -0,0 +1,386 @@
+// Package config - загрузка конфигурации из значений по умолчанию, файла, окружения и флагов.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Источники значений параметров в порядке возрастания приоритета.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// redacted - значение секретного параметра при выводе конфигурации.
+const redacted = "******"
+
+// ErrConfig ошибка невалидной конфигурации.
+var ErrConfig = errors.New("invalid config")
+
+// Option - описание параметра конфигурации.
+// Field возвращает указатель на поле: *string, *int, *bool, *float64, *time.Duration
+// или указатель на составное значение, которое задается в формате JSON.
+type Option[T any] struct {
+	Key     string       // ключ в файле конфигурации
+	Env     string       // переменная окружения, пустая - значение не читается из окружения
+	Flags   []string     // имена флагов, пустой список - значение не задается флагом
+	Usage   string       // описание для справки
+	Default any          // значение по умолчанию того же типа, что и поле
+	Secret  bool         // значение скрывается при выводе конфигурации
+	Reload  bool         // значение применяется при перезагрузке конфигурации без перезапуска
+	Field   func(*T) any // указатель на поле конфигурации
+}
+
+// Loader - загрузчик конфигурации.
+// значения применяются по возрастанию приоритета: по умолчанию, файл, окружение, явно переданные флаги.
+type Loader[T any] struct {
+	name      string
+	options   []Option[T]
+	checks    []func(*T) error
+	lookupEnv func(string) (string, bool)
+}
+
+// NewLoader - метод создания загрузчика конфигурации.
+// checks выполняются после загрузки всех значений и проверяют связи между параметрами.
+func NewLoader[T any](name string, options []Option[T], checks ...func(*T) error) *Loader[T] {
+	return &Loader[T]{name: name, options: options, checks: checks, lookupEnv: os.LookupEnv}
+}
+
+// Effective - загруженная конфигурация с источниками значений.
+type Effective[T any] struct {
+	Config      T
+	File        string   // файл конфигурации, пустой - не задан
+	Args        []string // аргументы после флагов, например подкоманда
+	PrintConfig bool     // запрошен вывод конфигурации
+	argv        []string // исходные аргументы для перезагрузки конфигурации
+	sources     map[string]string
+	options     []Option[T]
+}
+
+// Source - метод получения источника значения параметра, например "env KEY" или "flag -k".
+func (e *Effective[T]) Source(key string) string {
+	return e.sources[key]
+}
+
+// passedFlag - значение явно переданного флага и имя, под которым он передан.
+type passedFlag struct {
+	value string
+	name  string
+}
+
+// flagValue - флаг, запоминающий переданное значение для применения после файла и окружения.
+type flagValue struct {
+	key    string
+	name   string
+	def    string
+	isBool bool
+	passed map[string]passedFlag
+}
+
+func (f *flagValue) String() string {
+	return f.def
+}
+
+func (f *flagValue) Set(value string) error {
+	f.passed[f.key] = passedFlag{value: value, name: f.name}
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// Load - метод загрузки конфигурации.
+// при ошибке проверки связей между параметрами вместе с ошибкой возвращается загруженная конфигурация,
+// чтобы ее можно было вывести для диагностики.
+func (l *Loader[T]) Load(args []string) (*Effective[T], error) {
+	eff := &Effective[T]{argv: args, sources: make(map[string]string), options: l.options}
+	byKey := make(map[string]Option[T], len(l.options))
+	for _, opt := range l.options {
+		byKey[opt.Key] = opt
+		if err := setDefault(opt.Field(&eff.Config), opt.Default); err != nil {
+			return nil, fmt.Errorf("%s: %w", opt.Key, err)
+		}
+		eff.sources[opt.Key] = SourceDefault
+	}
+
+	fs := flag.NewFlagSet(l.name, flag.ContinueOnError)
+	configFile := fs.String("config", "", "config file, json or yaml by extension")
+	printConfig := fs.Bool("print-config", false, "print effective config with value sources and exit")
+	passed := make(map[string]passedFlag)
+	for _, opt := range l.options {
+		_, isBool := opt.Field(&eff.Config).(*bool)
+		for _, name := range opt.Flags {
+			value := &flagValue{key: opt.Key, name: name, def: formatValue(opt.Field(&eff.Config)), isBool: isBool, passed: passed}
+			fs.Var(value, name, opt.Usage)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	eff.Args = fs.Args()
+	eff.PrintConfig = *printConfig
+
+	eff.File = *configFile
+	if eff.File == "" {
+		eff.File, _ = l.lookupEnv("CONFIG")
+	}
+	if eff.File != "" {
+		values, err := readFile(eff.File)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			opt, ok := byKey[key]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s: unknown key %q", ErrConfig, eff.File, key)
+			}
+			if values[key] == nil {
+				continue
+			}
+			if err := setFileValue(opt.Field(&eff.Config), values[key]); err != nil {
+				return nil, fmt.Errorf("%w: %s: %s: %v", ErrConfig, eff.File, key, err)
+			}
+			eff.sources[key] = SourceFile
+		}
+	}
+
+	for _, opt := range l.options {
+		if opt.Env == "" {
+			continue
+		}
+		value, ok := l.lookupEnv(opt.Env)
+		if !ok {
+			continue
+		}
+		if err := setString(opt.Field(&eff.Config), value); err != nil {
+			return nil, fmt.Errorf("%w: %s: env %s: %v", ErrConfig, opt.Key, opt.Env, err)
+		}
+		eff.sources[opt.Key] = SourceEnv + " " + opt.Env
+	}
+
+	for _, opt := range l.options {
+		value, ok := passed[opt.Key]
+		if !ok {
+			continue
+		}
+		if err := setString(opt.Field(&eff.Config), value.value); err != nil {
+			return nil, fmt.Errorf("%w: %s: flag -%s: %v", ErrConfig, opt.Key, value.name, err)
+		}
+		eff.sources[opt.Key] = SourceFlag + " -" + value.name
+	}
+
+	problems := make([]string, 0)
+	for _, check := range l.checks {
+		if err := check(&eff.Config); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return eff, fmt.Errorf("%w: %s", ErrConfig, strings.Join(problems, "; "))
+	}
+	return eff, nil
+}
+
+// MustLoad - метод загрузки конфигурации при запуске приложения.
+// при ошибке работа завершается, при -print-config конфигурация выводится и работа завершается.
+func (l *Loader[T]) MustLoad(args []string) *Effective[T] {
+	eff, err := l.Load(args)
+	if eff != nil && eff.PrintConfig {
+		eff.Print(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if eff.PrintConfig {
+		os.Exit(0)
+	}
+	return eff
+}
+
+// Print - метод вывода конфигурации с источниками значений, секретные значения скрываются.
+func (e *Effective[T]) Print(w io.Writer) {
+	if e.File != "" {
+		fmt.Fprintf(w, "# config file: %s\n", e.File)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+	for _, opt := range e.options {
+		value := formatValue(opt.Field(&e.Config))
+		if opt.Secret && value != "" {
+			value = redacted
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", opt.Key, value, e.sources[opt.Key])
+	}
+	tw.Flush()
+}
+
+// isYAML - метод определения формата файла по расширению, по умолчанию JSON.
+func isYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// readFile - метод чтения файла конфигурации в набор значений верхнего уровня.
+func readFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]any)
+	if isYAML(path) {
+		err = yaml.Unmarshal(data, &values)
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&values)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrConfig, path, err)
+	}
+	return values, nil
+}
+
+// DecodeFile - метод строгого разбора файла JSON или YAML в v, неизвестные поля считаются ошибкой.
+func DecodeFile(path string, v any) error {
+	values, err := readFile(path)
+	if err != nil {
+		return err
+	}
+	if err = decodeStrict(values, v); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrConfig, path, err)
+	}
+	return nil
+}
+
+// decodeStrict - метод преобразования разобранного значения в v через JSON.
+func decodeStrict(value any, v any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+func setDefault(field any, value any) error {
+	if value == nil {
+		return nil
+	}
+	switch ptr := field.(type) {
+	case *string:
+		*ptr = value.(string)
+	case *int:
+		*ptr = value.(int)
+	case *bool:
+		*ptr = value.(bool)
+	case *float64:
+		*ptr = value.(float64)
+	case *time.Duration:
+		*ptr = value.(time.Duration)
+	default:
+		return decodeStrict(value, field)
+	}
+	return nil
+}
+
+// setFileValue - метод установки значения из файла.
+// скалярные значения разбираются так же, как значения из окружения и флагов.
+// целое число в JSON для длительности - наносекунды, как в файлах конфигурации прежнего формата.
+func setFileValue(field any, value any) error {
+	if ptr, ok := field.(*time.Duration); ok {
+		if number, ok := value.(json.Number); ok {
+			nanoseconds, err := number.Int64()
+			if err != nil {
+				return fmt.Errorf("invalid duration %s, expected nanoseconds or a value like 30s or 5m", number)
+			}
+			*ptr = time.Duration(nanoseconds)
+			return nil
+		}
+	}
+	switch field.(type) {
+	case *string, *int, *bool, *float64, *time.Duration:
+		switch v := value.(type) {
+		case string:
+			return setString(field, v)
+		case json.Number, int, float64, bool:
+			return setString(field, fmt.Sprint(v))
+		default:
+			return fmt.Errorf("expected scalar value, got %T", value)
+		}
+	default:
+		return decodeStrict(value, field)
+	}
+}
+
+func setString(field any, value string) error {
+	var err error
+	switch ptr := field.(type) {
+	case *string:
+		*ptr = value
+	case *int:
+		if *ptr, err = strconv.Atoi(value); err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+	case *bool:
+		if *ptr, err = strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+	case *float64:
+		if *ptr, err = strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+	case *time.Duration:
+		if *ptr, err = time.ParseDuration(value); err != nil {
+			return fmt.Errorf("invalid duration %q, expected a value like 30s or 5m", value)
+		}
+	default:
+		decoder := json.NewDecoder(strings.NewReader(value))
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(field); err != nil {
+			return fmt.Errorf("invalid json value: %v", err)
+		}
+	}
+	return nil
+}
+
+func formatValue(field any) string {
+	switch ptr := field.(type) {
+	case *string:
+		return *ptr
+	case *int:
+		return strconv.Itoa(*ptr)
+	case *bool:
+		return strconv.FormatBool(*ptr)
+	case *float64:
+		return strconv.FormatFloat(*ptr, 'g', -1, 64)
+	case *time.Duration:
+		return ptr.String()
+	default:
+		data, _ := json.Marshal(field)
+		return string(data)
+	}
+}
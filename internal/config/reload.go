@@ -0,0 +1,139 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/tiraill/go_collect_metrics/internal/logger"
+)
+
+// reloadDelay - задержка перед перезагрузкой после изменения файла,
+// редакторы часто записывают файл в несколько операций.
+const reloadDelay = 200 * time.Millisecond
+
+// ErrRestartRequired ошибка изменения параметров, которые применяются только при перезапуске.
+var ErrRestartRequired = errors.New("restart required")
+
+// Changed - метод получения ключей параметров, значения которых отличаются от other.
+func (e *Effective[T]) Changed(other *Effective[T]) []string {
+	changed := make([]string, 0)
+	for _, opt := range e.options {
+		if formatValue(opt.Field(&e.Config)) != formatValue(opt.Field(&other.Config)) {
+			changed = append(changed, opt.Key)
+		}
+	}
+	return changed
+}
+
+// Reload - метод повторной загрузки конфигурации с исходными аргументами.
+// возвращает новую конфигурацию и ключи измененных параметров,
+// если изменены параметры без признака Reload, возвращается ErrRestartRequired и текущая конфигурация не меняется.
+func (l *Loader[T]) Reload(current *Effective[T]) (*Effective[T], []string, error) {
+	next, err := l.Load(current.argv)
+	if err != nil {
+		return nil, nil, err
+	}
+	changed := current.Changed(next)
+	restart := make([]string, 0)
+	for _, opt := range l.options {
+		if !opt.Reload && contains(changed, opt.Key) {
+			restart = append(restart, opt.Key)
+		}
+	}
+	if len(restart) > 0 {
+		return nil, changed, fmt.Errorf("%w to change %s", ErrRestartRequired, strings.Join(restart, ", "))
+	}
+	return next, changed, nil
+}
+
+// Watch - метод перезагрузки конфигурации по сигналу SIGHUP и при изменении файла конфигурации.
+// apply вызывается с новой конфигурацией и ключами измененных параметров,
+// при ошибке apply или загрузки конфигурации продолжает действовать текущая конфигурация.
+// работает до отмены ctx.
+func (l *Loader[T]) Watch(ctx context.Context, current *Effective[T], apply func(*Effective[T], []string) error) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var events chan fsnotify.Event
+	var errs chan error
+	if current.File != "" {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			logger.L("config").Warn("config file watch is disabled", zap.Error(err))
+		} else {
+			defer watcher.Close()
+			// отслеживается каталог, так как редакторы заменяют файл переименованием
+			if err := watcher.Add(filepath.Dir(current.File)); err != nil {
+				logger.L("config").Warn("config file watch is disabled", zap.Error(err))
+			}
+			// ошибки читаются, иначе fsnotify блокируется и перестает доставлять события
+			events, errs = watcher.Events, watcher.Errors
+		}
+	}
+	name := filepath.Clean(current.File)
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			logger.L("config").Info("config reload requested by SIGHUP")
+			current = l.reload(current, apply)
+		case event := <-events:
+			if filepath.Clean(event.Name) == name && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				timer.Reset(reloadDelay)
+			}
+		case err := <-errs:
+			logger.L("config").Warn("config file watch error", zap.Error(err))
+			// при переполнении очереди событие изменения файла могло потеряться
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				timer.Reset(reloadDelay)
+			}
+		case <-timer.C:
+			logger.L("config").Info("config reload requested by file change", zap.String("file", current.File))
+			current = l.reload(current, apply)
+		}
+	}
+}
+
+// reload - метод перезагрузки конфигурации, возвращает действующую после перезагрузки конфигурацию.
+func (l *Loader[T]) reload(current *Effective[T], apply func(*Effective[T], []string) error) *Effective[T] {
+	next, changed, err := l.Reload(current)
+	if err != nil {
+		logger.L("config").Error("config reload rejected", zap.Error(err))
+		return current
+	}
+	if len(changed) == 0 {
+		logger.L("config").Info("config reload: nothing changed")
+		return current
+	}
+	if err := apply(next, changed); err != nil {
+		logger.L("config").Error("config reload rejected", zap.Error(err))
+		return current
+	}
+	logger.L("config").Info("config reloaded", zap.Strings("changed", changed))
+	return next
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
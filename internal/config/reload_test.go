@@ -0,0 +1,70 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+func TestLoader_Reload(t *testing.T) {
+	path := writeFile(t, "agent.json", `{"address":"localhost:8080","report_interval":"10s"}`)
+	loader := NewAgentLoader("agent", "127.0.0.1:8080")
+	loader.lookupEnv = withEnv(nil)
+	current, err := loader.Load([]string{"-config", path})
+	require.Nil(t, err)
+
+	next, changed, err := loader.Reload(current)
+	require.Nil(t, err)
+	assert.Empty(t, changed)
+	assert.Equal(t, current.Config, next.Config)
+
+	require.Nil(t, os.WriteFile(path, []byte(`{"address":"localhost:8080","report_interval":"20s","hash_key":"new"}`), 0o600))
+	next, changed, err = loader.Reload(current)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"report_interval", "hash_key"}, changed)
+	assert.Equal(t, 20*time.Second, next.Config.ReportInterval)
+	assert.Equal(t, "new", next.Config.HashKey)
+
+	require.Nil(t, os.WriteFile(path, []byte(`{"address":"localhost:9090","report_interval":"20s"}`), 0o600))
+	_, _, err = loader.Reload(current)
+	require.NotNil(t, err)
+	assert.True(t, errors.Is(err, ErrRestartRequired))
+	assert.Contains(t, err.Error(), "address")
+
+	require.Nil(t, os.WriteFile(path, []byte(`{"report_interval":"-1s"}`), 0o600))
+	_, _, err = loader.Reload(current)
+	assert.True(t, errors.Is(err, ErrConfig))
+}
+
+func TestLoader_Watch(t *testing.T) {
+	path := writeFile(t, "agent.yaml", "report_interval: 10s\n")
+	loader := NewAgentLoader("agent", "127.0.0.1:8080")
+	loader.lookupEnv = withEnv(nil)
+	current, err := loader.Load([]string{"-config", path})
+	require.Nil(t, err)
+
+	applied := make(chan utils.AgentConfig, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go loader.Watch(ctx, current, func(next *Effective[utils.AgentConfig], _ []string) error {
+		applied <- next.Config
+		return nil
+	})
+	// наблюдение за файлом начинается асинхронно
+	time.Sleep(50 * time.Millisecond)
+
+	require.Nil(t, os.WriteFile(path, []byte("report_interval: 30s\n"), 0o600))
+	select {
+	case config := <-applied:
+		assert.Equal(t, 30*time.Second, config.ReportInterval)
+	case <-time.After(5 * time.Second):
+		t.Fatal("config was not reloaded after file change")
+	}
+}
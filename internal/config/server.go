@@ -0,0 +1,235 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/tiraill/go_collect_metrics/internal/logger"
+	"github.com/tiraill/go_collect_metrics/internal/tracing"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// Server - конфигурация сервера.
+type Server struct {
+	Server  utils.ServerConfig
+	Storage utils.StorageConfig
+	Audit   utils.AuditConfig
+	Alert   utils.AlertConfig
+	Log     utils.LogConfig
+	Trace   utils.TraceConfig
+}
+
+// NewServerLoader - метод создания загрузчика конфигурации сервера.
+// адрес по умолчанию у HTTP и gRPC серверов различается.
+// без перезапуска применяются подсети, ключи, токены, защита от повтора и ограничения запросов.
+func NewServerLoader(name, defaultAddress string) *Loader[Server] {
+	options := []Option[Server]{
+		{Key: "address", Env: "ADDRESS", Flags: []string{"a", "address"}, Default: defaultAddress,
+			Usage: "server address", Field: func(c *Server) any { return &c.Server.Address }},
+		{Key: "grpc_address", Env: "GRPC_ADDRESS", Flags: []string{"grpc-address"},
+			Usage: "gRPC server address, equal to address serves both protocols on one port", Field: func(c *Server) any { return &c.Server.GRPCAddress }},
+		{Key: "hash_key", Reload: true, Env: "KEY", Flags: []string{"k", "key"}, Secret: true,
+			Usage: "hash key", Field: func(c *Server) any { return &c.Server.HashKey }},
+		{Key: "crypto_key", Reload: true, Env: "CRYPTO_KEY", Flags: []string{"crypto-key"},
+			Usage: "private crypto key file", Field: func(c *Server) any { return &c.Server.CryptoKey }},
+		{Key: "trusted_subnet", Reload: true, Env: "TRUSTED_SUBNET", Flags: []string{"t", "trusted-subnet"},
+			Usage: "trusted subnets for metric updates, comma separated", Field: func(c *Server) any { return &c.Server.TrustedSubnet }},
+		{Key: "trusted_read_subnet", Reload: true, Env: "TRUSTED_READ_SUBNET", Flags: []string{"trusted-read-subnet"},
+			Usage: "trusted subnets for metric reads, comma separated", Field: func(c *Server) any { return &c.Server.TrustedRead }},
+		{Key: "trusted_proxies", Reload: true, Env: "TRUSTED_PROXIES", Flags: []string{"trusted-proxies"},
+			Usage: "trusted proxy subnets whose forwarded headers are honoured", Field: func(c *Server) any { return &c.Server.TrustedProxies }},
+		{Key: "metrics_subnet", Reload: true, Env: "METRICS_SUBNET", Flags: []string{"metrics-subnet"},
+			Usage: "subnets allowed to scrape /metrics, comma separated, defaults to trusted read subnets", Field: func(c *Server) any { return &c.Server.MetricsSubnet }},
+		{Key: "metrics_token", Reload: true, Env: "METRICS_TOKEN", Flags: []string{"metrics-token"}, Secret: true,
+			Usage: "bearer token required to scrape /metrics", Field: func(c *Server) any { return &c.Server.MetricsToken }},
+		{Key: "diag_address", Env: "DIAG_ADDRESS", Flags: []string{"diag-address"},
+			Usage: "diagnostics server address with internal metrics, loopback if the host is empty", Field: func(c *Server) any { return &c.Server.DiagAddress }},
+		{Key: "diag_pprof", Env: "DIAG_PPROF", Flags: []string{"diag-pprof"},
+			Usage: "serve pprof profiles on the diagnostics server without access control", Field: func(c *Server) any { return &c.Server.DiagPprof }},
+		{Key: "admin_token", Reload: true, Env: "ADMIN_TOKEN", Flags: []string{"admin-token"}, Secret: true,
+			Usage: "bearer token required for admin export and import api, empty disables it", Field: func(c *Server) any { return &c.Server.AdminToken }},
+		{Key: "replay_window", Reload: true, Env: "REPLAY_WINDOW", Flags: []string{"replay-window"},
+			Usage: "allowed clock skew for signed requests, 0 disables replay protection of writes (deletes are checked with a 5m window whenever hash_key is set)", Field: func(c *Server) any { return &c.Server.ReplayWindow }},
+		{Key: "nonce_cache_size", Reload: true, Env: "NONCE_CACHE_SIZE", Flags: []string{"nonce-cache-size"}, Default: utils.DefaultNonceCacheSize,
+			Usage: "size of recently seen nonce cache", Field: func(c *Server) any { return &c.Server.NonceCacheSize }},
+		{Key: "client_rate_limit", Reload: true, Env: "CLIENT_RATE_LIMIT", Flags: []string{"rate-limit"},
+			Usage: "requests per second allowed from one client (agent id from a verified request stamp or address), 0 disables rate limiting", Field: func(c *Server) any { return &c.Server.Limits.RateLimit }},
+		{Key: "client_rate_burst", Reload: true, Env: "CLIENT_RATE_BURST", Flags: []string{"rate-burst"},
+			Usage: "max burst of requests from one client", Field: func(c *Server) any { return &c.Server.Limits.RateBurst }},
+		{Key: "max_body_size", Reload: true, Env: "MAX_BODY_SIZE", Flags: []string{"max-body-size"}, Default: 1 << 20,
+			Usage: "max request body size in bytes", Field: func(c *Server) any { return &c.Server.Limits.MaxBodySize }},
+		{Key: "max_decompressed_size", Reload: true, Env: "MAX_DECOMPRESSED_SIZE", Flags: []string{"max-decompressed-size"}, Default: 10 << 20,
+			Usage: "max decompressed request body size in bytes", Field: func(c *Server) any { return &c.Server.Limits.MaxDecompressedSize }},
+		{Key: "max_import_size", Reload: true, Env: "MAX_IMPORT_SIZE", Flags: []string{"max-import-size"}, Default: 1 << 30,
+			Usage: "max admin import body size in bytes, compressed and decompressed", Field: func(c *Server) any { return &c.Server.Limits.MaxImportSize }},
+		{Key: "max_batch_size", Reload: true, Env: "MAX_BATCH_SIZE", Flags: []string{"max-batch-size"}, Default: 10000,
+			Usage: "max number of metrics in one request", Field: func(c *Server) any { return &c.Server.Limits.MaxBatchSize }},
+		{Key: "restore", Env: "RESTORE", Flags: []string{"r", "restore"}, Default: true,
+			Usage: "restore metrics from the store file on start", Field: func(c *Server) any { return &c.Storage.Restore }},
+		{Key: "store_interval", Env: "STORE_INTERVAL", Flags: []string{"i", "store-interval"}, Default: 30 * time.Second,
+			Usage: "store file flush interval, 0 saves on every update", Field: func(c *Server) any { return &c.Storage.StoreInterval }},
+		{Key: "store_file", Env: "STORE_FILE", Flags: []string{"f", "store-file"}, Default: "/tmp/devops-metrics-db.json",
+			Usage: "store file", Field: func(c *Server) any { return &c.Storage.StoreFile }},
+		{Key: "database_dsn", Env: "DATABASE_DSN", Flags: []string{"d", "database-dsn"}, Secret: true,
+			Usage: "database connection string", Field: func(c *Server) any { return &c.Storage.DatabaseDSN }},
+		{Key: "audit_file", Env: "AUDIT_FILE", Flags: []string{"audit-file"},
+			Usage: "audit log file", Field: func(c *Server) any { return &c.Audit.AuditFile }},
+		{Key: "audit_max_size", Env: "AUDIT_MAX_SIZE", Flags: []string{"audit-max-size"}, Default: 10 << 20,
+			Usage: "audit log file size in bytes before rotation", Field: func(c *Server) any { return &c.Audit.AuditMaxSize }},
+		{Key: "audit_max_backups", Env: "AUDIT_MAX_BACKUPS", Flags: []string{"audit-max-backups"}, Default: 5,
+			Usage: "number of rotated audit log files to keep", Field: func(c *Server) any { return &c.Audit.AuditMaxBackups }},
+		{Key: "audit_stdout", Env: "AUDIT_STDOUT", Flags: []string{"audit-stdout"},
+			Usage: "write audit log to stdout", Field: func(c *Server) any { return &c.Audit.AuditStdout }},
+		{Key: "audit_url", Env: "AUDIT_URL", Flags: []string{"audit-url"},
+			Usage: "audit webhook url", Field: func(c *Server) any { return &c.Audit.AuditURL }},
+		{Key: "audit_timeout", Env: "AUDIT_TIMEOUT", Flags: []string{"audit-timeout"}, Default: 5 * time.Second,
+			Usage: "audit webhook request timeout", Field: func(c *Server) any { return &c.Audit.AuditTimeout }},
+		{Key: "alert_rules",
+			Usage: "alert rules", Field: func(c *Server) any { return &c.Alert.AlertRules }},
+		{Key: "alert_rules_file", Env: "ALERT_RULES", Flags: []string{"alert-rules"},
+			Usage: "alert rules file, replaces alert_rules", Field: func(c *Server) any { return &c.Alert.AlertRulesFile }},
+		{Key: "alert_url", Env: "ALERT_URL", Flags: []string{"alert-url"},
+			Usage: "alert webhook url", Field: func(c *Server) any { return &c.Alert.AlertURL }},
+		{Key: "alert_interval", Env: "ALERT_INTERVAL", Flags: []string{"alert-interval"}, Default: 10 * time.Second,
+			Usage: "alert rules evaluation interval", Field: func(c *Server) any { return &c.Alert.AlertInterval }},
+		{Key: "alert_repeat_interval", Env: "ALERT_REPEAT_INTERVAL", Flags: []string{"alert-repeat-interval"}, Default: time.Hour,
+			Usage: "repeat interval of firing alert notifications, 0 disables repeats", Field: func(c *Server) any { return &c.Alert.AlertRepeat }},
+		{Key: "alert_timeout", Env: "ALERT_TIMEOUT", Flags: []string{"alert-timeout"}, Default: 5 * time.Second,
+			Usage: "alert webhook request timeout", Field: func(c *Server) any { return &c.Alert.AlertTimeout }},
+	}
+	options = append(options, logOptions(func(c *Server) *utils.LogConfig { return &c.Log })...)
+	options = append(options, traceOptions(func(c *Server) *utils.TraceConfig { return &c.Trace })...)
+	return NewLoader(name, options,
+		func(c *Server) error { return logger.Check(c.Log) },
+		func(c *Server) error { return tracing.Check(c.Trace) },
+		checkServer, checkLimits, checkStorage, checkAudit, loadAlertRules, checkAlert)
+}
+
+// logOptions - параметры журнала, общие для сервера и агента, применяются без перезапуска.
+func logOptions[T any](log func(*T) *utils.LogConfig) []Option[T] {
+	return []Option[T]{
+		{Key: "log_level", Reload: true, Env: "LOG_LEVEL", Flags: []string{"log-level"}, Default: logger.DefaultLevel,
+			Usage: "log level: debug, info, warn or error", Field: func(c *T) any { return &log(c).Level }},
+		{Key: "log_levels", Reload: true, Env: "LOG_LEVELS", Flags: []string{"log-levels"},
+			Usage: "log levels of components, e.g. http=debug,storage=warn", Field: func(c *T) any { return &log(c).Levels }},
+		{Key: "log_format", Reload: true, Env: "LOG_FORMAT", Flags: []string{"log-format"}, Default: logger.DefaultFormat,
+			Usage: "log format: json or console", Field: func(c *T) any { return &log(c).Format }},
+		{Key: "log_sampling", Reload: true, Env: "LOG_SAMPLING", Flags: []string{"log-sampling"}, Default: logger.DefaultSampling,
+			Usage: "identical log entries per second before sampling, 0 disables sampling", Field: func(c *T) any { return &log(c).Sampling }},
+	}
+}
+
+// traceOptions - параметры трассировки, общие для сервера и агента, применяются при запуске.
+func traceOptions[T any](trace func(*T) *utils.TraceConfig) []Option[T] {
+	return []Option[T]{
+		{Key: "trace_exporter", Env: "TRACE_EXPORTER", Flags: []string{"trace-exporter"}, Default: tracing.ExporterNone,
+			Usage: "trace exporter: none, stdout or otlp", Field: func(c *T) any { return &trace(c).Exporter }},
+		{Key: "trace_endpoint", Env: "TRACE_ENDPOINT", Flags: []string{"trace-endpoint"}, Default: tracing.DefaultEndpoint,
+			Usage: "OTLP/HTTP collector endpoint", Field: func(c *T) any { return &trace(c).Endpoint }},
+		{Key: "trace_sample_ratio", Env: "TRACE_SAMPLE_RATIO", Flags: []string{"trace-sample-ratio"}, Default: 1.0,
+			Usage: "fraction of traces sampled when there is no parent span", Field: func(c *T) any { return &trace(c).SampleRatio }},
+	}
+}
+
+// checkAddress - метод проверки адреса в формате host:port.
+func checkAddress(key, address string) error {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return fmt.Errorf("%s %q must be host:port", key, address)
+	}
+	return nil
+}
+
+func checkServer(c *Server) error {
+	if err := checkAddress("address", c.Server.Address); err != nil {
+		return err
+	}
+	if c.Server.GRPCAddress != "" {
+		if err := checkAddress("grpc_address", c.Server.GRPCAddress); err != nil {
+			return err
+		}
+	}
+	if c.Server.DiagAddress != "" {
+		if err := checkAddress("diag_address", c.Server.DiagAddress); err != nil {
+			return err
+		}
+	}
+	if err := c.Server.ParseSubnets(); err != nil {
+		return err
+	}
+	if c.Server.ReplayWindow < 0 {
+		return fmt.Errorf("replay_window must not be negative")
+	}
+	if c.Server.ReplayWindow > 0 && c.Server.HashKey == "" {
+		return fmt.Errorf("replay_window requires hash_key, requests can not be signed without it")
+	}
+	if c.Server.IsReplayProtected() && c.Server.NonceCacheSize < 1 {
+		return fmt.Errorf("nonce_cache_size must be positive when replay_window is set")
+	}
+	return nil
+}
+
+func checkLimits(c *Server) error {
+	limits := c.Server.Limits
+	if limits.RateLimit < 0 || limits.RateBurst < 0 {
+		return fmt.Errorf("client_rate_limit and client_rate_burst must not be negative")
+	}
+	if limits.RateBurst > 0 && limits.RateLimit == 0 {
+		return fmt.Errorf("client_rate_burst is set but client_rate_limit is 0, rate limiting is disabled")
+	}
+	if limits.MaxBodySize < 0 || limits.MaxDecompressedSize < 0 || limits.MaxBatchSize < 0 || limits.MaxImportSize < 0 {
+		return fmt.Errorf("max_body_size, max_decompressed_size, max_batch_size and max_import_size must not be negative")
+	}
+	if limits.MaxBodySize > 0 && limits.MaxDecompressedSize > 0 && limits.MaxDecompressedSize < limits.MaxBodySize {
+		return fmt.Errorf("max_decompressed_size (%d) must not be less than max_body_size (%d)",
+			limits.MaxDecompressedSize, limits.MaxBodySize)
+	}
+	return nil
+}
+
+// checkStorage - метод проверки настроек хранилища.
+// restore без store_file и database_dsn не является ошибкой: восстанавливать нечего, и хранилище запускается пустым.
+func checkStorage(c *Server) error {
+	if c.Storage.StoreInterval < 0 {
+		return fmt.Errorf("store_interval must not be negative")
+	}
+	return nil
+}
+
+func checkAudit(c *Server) error {
+	if c.Audit.AuditMaxSize < 0 || c.Audit.AuditMaxBackups < 0 {
+		return fmt.Errorf("audit_max_size and audit_max_backups must not be negative")
+	}
+	if c.Audit.AuditURL != "" && c.Audit.AuditTimeout <= 0 {
+		return fmt.Errorf("audit_timeout must be positive when audit_url is set")
+	}
+	return nil
+}
+
+// loadAlertRules - метод чтения правил оповещений из отдельного файла.
+func loadAlertRules(c *Server) error {
+	if c.Alert.AlertRulesFile == "" {
+		return nil
+	}
+	rules := struct {
+		AlertRules []utils.AlertRule `json:"alert_rules"`
+	}{}
+	if err := DecodeFile(c.Alert.AlertRulesFile, &rules); err != nil {
+		return fmt.Errorf("alert_rules_file: %v", err)
+	}
+	c.Alert.AlertRules = rules.AlertRules
+	return nil
+}
+
+func checkAlert(c *Server) error {
+	if c.Alert.AlertInterval < 0 || c.Alert.AlertRepeat < 0 {
+		return fmt.Errorf("alert_interval and alert_repeat_interval must not be negative")
+	}
+	if c.Alert.AlertURL != "" && len(c.Alert.AlertRules) == 0 {
+		return fmt.Errorf("alert_url is set but no alert_rules are configured")
+	}
+	if c.Alert.AlertURL != "" && c.Alert.AlertTimeout <= 0 {
+		return fmt.Errorf("alert_timeout must be positive when alert_url is set")
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package grpcserver
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/tiraill/go_collect_metrics/internal/health"
+
+	pb "github.com/tiraill/go_collect_metrics/cmd/proto"
+)
+
+// healthInterval - период обновления состояния службы grpc.health.v1 по готовности сервера.
+const healthInterval = 5 * time.Second
+
+// isHealthMethod - метод службы grpc.health.v1, доступный из любых подсетей и без ограничения частоты.
+func isHealthMethod(method string) bool {
+	return strings.HasPrefix(method, "/"+healthpb.Health_ServiceDesc.ServiceName+"/")
+}
+
+// HealthService - стандартная служба grpc.health.v1 с состоянием по готовности сервера.
+type HealthService struct {
+	server  *grpchealth.Server
+	checker *health.Checker
+}
+
+// RegisterHealth - метод регистрации службы grpc.health.v1, до вызова Run все службы в NOT_SERVING.
+func RegisterHealth(srv *grpc.Server, checker *health.Checker) *HealthService {
+	h := &HealthService{server: grpchealth.NewServer(), checker: checker}
+	h.set(healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(srv, h.server)
+	return h
+}
+
+// set - метод установки состояния сервера ("") и службы метрик.
+func (h *HealthService) set(status healthpb.HealthCheckResponse_ServingStatus) {
+	h.server.SetServingStatus("", status)
+	h.server.SetServingStatus(pb.Metrics_ServiceDesc.ServiceName, status)
+}
+
+// Run - метод обновления состояния по готовности сервера до отмены ctx,
+// после отмены все службы переводятся в NOT_SERVING.
+func (h *HealthService) Run(ctx context.Context) {
+	ticker := time.NewTicker(healthInterval)
+	defer ticker.Stop()
+	for {
+		status := healthpb.HealthCheckResponse_NOT_SERVING
+		if h.checker.Ready(ctx).Ready {
+			status = healthpb.HealthCheckResponse_SERVING
+		}
+		h.set(status)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			h.server.Shutdown()
+			return
+		}
+	}
+}
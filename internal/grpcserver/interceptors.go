@@ -0,0 +1,323 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/tiraill/go_collect_metrics/internal/audit"
+	"github.com/tiraill/go_collect_metrics/internal/logger"
+	"github.com/tiraill/go_collect_metrics/internal/telemetry"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// writeMethods - методы, изменяющие метрики.
+var writeMethods = map[string]bool{
+	"/main.Metrics/SaveMetric":       true,
+	"/main.Metrics/SaveBatchMetrics": true,
+	"/main.Metrics/StreamMetrics":    true,
+	deleteMethod:                     true,
+}
+
+// deleteMethod - метод удаления метрики, подпись которого проверяется при любом заданном ключе сервера.
+const deleteMethod = "/main.Metrics/DeleteMetric"
+
+// isStampRequired - метод проверяет, нужна ли вызову подпись для защиты от повторной отправки.
+// удаление метрики проверяется при любом заданном ключе, остальные изменяющие методы - при включенной защите.
+func isStampRequired(config utils.ServerConfig, method string) bool {
+	if method == deleteMethod {
+		return config.HashKey != ""
+	}
+	return config.IsReplayProtected() && writeMethods[method]
+}
+
+func metadataValue(md metadata.MD, key string) string {
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// instrumentInterceptor - interceptor для сбора внутренних метрик gRPC вызовов.
+func instrumentInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	inFlight := telemetry.GRPCInFlight.With()
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	telemetry.GRPCRequests.With(info.FullMethod, status.Code(err).String()).Inc()
+	telemetry.GRPCDuration.With(info.FullMethod).Observe(telemetry.Since(start))
+	logCall(ctx, info.FullMethod, start, err)
+	return resp, err
+}
+
+// instrumentStreamInterceptor - interceptor для сбора внутренних метрик потоковых gRPC вызовов.
+// длительность считается от открытия до завершения потока.
+func instrumentStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	inFlight := telemetry.GRPCInFlight.With()
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	start := time.Now()
+	err := handler(srv, ss)
+	telemetry.GRPCRequests.With(info.FullMethod, status.Code(err).String()).Inc()
+	telemetry.GRPCDuration.With(info.FullMethod).Observe(telemetry.Since(start))
+	logCall(ss.Context(), info.FullMethod, start, err)
+	return err
+}
+
+// logCall - метод записи вызова в журнал компонента grpc.
+// вызовы, завершенные с внутренней ошибкой сервера, записываются на уровне error, остальные - на уровне info.
+func logCall(ctx context.Context, method string, start time.Time, err error) {
+	code := status.Code(err)
+	l := logger.Ctx(ctx, "grpc")
+	log := l.Info
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+		log = l.Error
+	}
+	fields := []zap.Field{
+		zap.String("method", method),
+		zap.String("code", code.String()),
+		zap.Duration("duration", time.Since(start)),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		fields = append(fields, zap.String("remote", p.Addr.String()))
+	}
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+	log("call", fields...)
+}
+
+// requestIDContext - метод сохранения в контексте идентификатора запроса из метаданных x-request-id
+// или нового, если метаданные не заданы или невалидны. идентификатор возвращается клиенту в заголовке ответа.
+func requestIDContext(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	id := logger.EnsureRequestID(metadataValue(md, logger.RequestIDHeader))
+	grpc.SetHeader(ctx, metadata.Pairs(logger.RequestIDHeader, id))
+	return logger.WithRequestID(ctx, id)
+}
+
+// requestIDInterceptor - interceptor сохраняет в контексте идентификатор запроса.
+func requestIDInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	return handler(requestIDContext(ctx), req)
+}
+
+// requestIDStreamInterceptor - interceptor сохраняет в контексте потока идентификатор запроса.
+func requestIDStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &contextStream{ServerStream: ss, ctx: requestIDContext(ss.Context())})
+}
+
+// replayInterceptor - interceptor для защиты от повторной отправки запросов, если она включена.
+// подпись вычисляется от детерминированно сериализованного сообщения запроса.
+func (s *MetricsServer) replayInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	current := s.current()
+	if current.guard == nil || !isStampRequired(current.config, info.FullMethod) {
+		return handler(ctx, req)
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	stamp, err := utils.ParseRequestStamp(
+		metadataValue(md, utils.TimestampMetadataKey),
+		metadataValue(md, utils.NonceMetadataKey),
+		metadataValue(md, utils.AgentIDMetadataKey),
+		metadataValue(md, utils.SignatureMetadataKey),
+	)
+	code := codes.Unauthenticated
+	if err == nil {
+		var payload []byte
+		payload, err = proto.MarshalOptions{Deterministic: true}.Marshal(req.(proto.Message))
+		if err != nil {
+			code = codes.InvalidArgument
+		} else if err = current.guard.Check(stamp, payload, current.config.HashKey); err != nil {
+			code = stampErrorCode(err)
+		}
+	}
+	// отложенное rateLimitInterceptor ограничение: по идентификатору агента только после проверки подписи
+	if current.limiter != nil && isStampedAgentRequest(ctx, info.FullMethod) {
+		key := "agent:" + stamp.AgentID
+		if err != nil {
+			var keyErr error
+			if key, keyErr = clientKey(ctx, current.config.ProxyPrefixes); keyErr != nil {
+				return nil, keyErr
+			}
+		}
+		if limitErr := checkRateLimit(ctx, current.limiter, key); limitErr != nil {
+			return nil, limitErr
+		}
+	}
+	if err != nil {
+		return nil, status.Error(code, err.Error())
+	}
+	return handler(ctx, req)
+}
+
+// stampErrorCode - метод получения кода gRPC для ошибки проверки подписи запроса.
+func stampErrorCode(err error) codes.Code {
+	if errors.Is(err, utils.ErrReplayCacheFull) {
+		return codes.Unavailable
+	}
+	return codes.Unauthenticated
+}
+
+// clientIP - метод определения адреса клиента gRPC с учетом доверенных прокси.
+func clientIP(ctx context.Context, proxies []netip.Prefix) (netip.Addr, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return netip.Addr{}, status.Error(codes.PermissionDenied, "unknown peer")
+	}
+	remote, err := utils.ParseRemoteAddr(p.Addr.String())
+	if err != nil {
+		return netip.Addr{}, status.Error(codes.PermissionDenied, err.Error())
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	return utils.ResolveClientIP(remote, metadataValue(md, "x-forwarded-for"), metadataValue(md, "x-real-ip"), proxies), nil
+}
+
+// checkTrustedSubnet - метод проверки подсети клиента.
+// для изменяющих методов используются подсети записи, для остальных - подсети чтения.
+// метаданные x-forwarded-for и x-real-ip учитываются только для запросов от доверенных прокси.
+// проверки здоровья доступны из любых подсетей.
+func checkTrustedSubnet(ctx context.Context, method string, config utils.ServerConfig) error {
+	if isHealthMethod(method) {
+		return nil
+	}
+	allowed := config.ReadPrefixes
+	if writeMethods[method] {
+		allowed = config.WritePrefixes
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	ip, err := clientIP(ctx, config.ProxyPrefixes)
+	if err != nil {
+		return err
+	}
+	if !utils.ContainsAddr(allowed, ip) {
+		return status.Error(codes.PermissionDenied, "forbidden")
+	}
+	return nil
+}
+
+// trustedSubnetInterceptor - interceptor для проверки подсети клиента.
+func (s *MetricsServer) trustedSubnetInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := checkTrustedSubnet(ctx, info.FullMethod, s.current().config); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// trustedSubnetStreamInterceptor - interceptor для проверки подсети клиента при открытии потока.
+func (s *MetricsServer) trustedSubnetStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := checkTrustedSubnet(ss.Context(), info.FullMethod, s.current().config); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// clientKey - метод определения клиента для ограничения частоты запросов по адресу с учетом доверенных прокси.
+func clientKey(ctx context.Context, proxies []netip.Prefix) (string, error) {
+	ip, err := clientIP(ctx, proxies)
+	if err != nil {
+		return "", err
+	}
+	return ip.String(), nil
+}
+
+// isStampedAgentRequest - метод проверки, что частота unary запроса агента ограничивается в replayInterceptor
+// после проверки подписи, в которую входит идентификатор агента.
+func isStampedAgentRequest(ctx context.Context, method string) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return writeMethods[method] && metadataValue(md, utils.AgentIDMetadataKey) != ""
+}
+
+// checkRateLimit - метод проверки частоты запросов клиента key.
+// при превышении лимита возвращается ResourceExhausted с RetryInfo и метаданными retry-after.
+func checkRateLimit(ctx context.Context, limiter *utils.RateLimiter, key string) error {
+	ok, wait := limiter.Allow(key)
+	if ok {
+		return nil
+	}
+	grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(utils.RetryAfterSeconds(wait))))
+	st := status.New(codes.ResourceExhausted, "too many requests")
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(wait)}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// checkClientRateLimit - метод проверки частоты запросов клиента, определенного по адресу.
+func checkClientRateLimit(ctx context.Context, limiter *utils.RateLimiter, proxies []netip.Prefix) error {
+	key, err := clientKey(ctx, proxies)
+	if err != nil {
+		return err
+	}
+	return checkRateLimit(ctx, limiter, key)
+}
+
+// rateLimitInterceptor - interceptor для ограничения частоты запросов от одного клиента, если оно включено.
+// для подписанных запросов агента ограничение выполняет replayInterceptor после проверки подписи.
+func (s *MetricsServer) rateLimitInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	current := s.current()
+	if current.limiter != nil && !isHealthMethod(info.FullMethod) && (!isStampRequired(current.config, info.FullMethod) || !isStampedAgentRequest(ctx, info.FullMethod)) {
+		if err := checkClientRateLimit(ctx, current.limiter, current.config.ProxyPrefixes); err != nil {
+			return nil, err
+		}
+	}
+	return handler(ctx, req)
+}
+
+// rateLimitStreamInterceptor - interceptor для ограничения частоты открытия потоков от одного клиента.
+// сообщения внутри открытого потока не ограничиваются, их скорость регулирует flow control gRPC.
+func (s *MetricsServer) rateLimitStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if current := s.current(); current.limiter != nil && !isHealthMethod(info.FullMethod) {
+		if err := checkClientRateLimit(ss.Context(), current.limiter, current.config.ProxyPrefixes); err != nil {
+			return err
+		}
+	}
+	return handler(srv, ss)
+}
+
+// auditContext - метод сохранения в контексте источника изменения метрик для журнала.
+func auditContext(ctx context.Context, proxies []netip.Prefix) context.Context {
+	source := audit.Source{Transport: audit.TransportGRPC}
+	if ip, err := clientIP(ctx, proxies); err == nil {
+		source.Client = ip.String()
+	}
+	return audit.WithSource(ctx, source)
+}
+
+// auditSourceInterceptor - interceptor сохраняет в контексте источник изменения метрик для журнала.
+func (s *MetricsServer) auditSourceInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	return handler(auditContext(ctx, s.current().config.ProxyPrefixes), req)
+}
+
+// contextStream - поток с замененным контекстом.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// auditSourceStreamInterceptor - interceptor сохраняет в контексте потока источник изменения метрик для журнала.
+func (s *MetricsServer) auditSourceStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx := auditContext(ss.Context(), s.current().config.ProxyPrefixes)
+	return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+}
@@ -0,0 +1,269 @@
+// Package grpcserver - gRPC сервер метрик над общим с HTTP слоем service.
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+
+	"github.com/tiraill/go_collect_metrics/internal/service"
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/stream"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+
+	// импортируем пакет со сгенерированными protobuf-файлами
+	pb "github.com/tiraill/go_collect_metrics/cmd/proto"
+)
+
+var (
+	// serverKeepalive - проверка соединения без активности, чтобы обнаруживать оборванные потоки агентов.
+	serverKeepalive = keepalive.ServerParameters{Time: time.Minute, Timeout: 20 * time.Second}
+	// keepalivePolicy - клиентам разрешено отправлять ping не чаще раза в 10 секунд, в том числе без активных вызовов.
+	keepalivePolicy = keepalive.EnforcementPolicy{MinTime: 10 * time.Second, PermitWithoutStream: true}
+)
+
+// MetricsServer поддерживает все необходимые методы сервера.
+type MetricsServer struct {
+	// нужно встраивать тип pb.Unimplemented<TypeName>
+	// для совместимости с будущими версиями
+	pb.UnimplementedMetricsServer
+	mu       sync.Mutex
+	settings atomic.Pointer[settings]
+	svc      *service.Service
+	broker   *stream.Broker
+	stopping chan struct{}
+}
+
+// settings - настройки сервера, заменяемые без перезапуска.
+type settings struct {
+	config  utils.ServerConfig
+	svc     *service.Service
+	guard   *utils.ReplayGuard
+	limiter *utils.RateLimiter
+}
+
+// NewMetricsServer - метод создания объекта MetricsServer над слоем svc.
+// WatchMetrics получает события из Broker слоя svc.
+func NewMetricsServer(config utils.ServerConfig, svc *service.Service) *MetricsServer {
+	s := &MetricsServer{
+		svc:      svc,
+		broker:   svc.Broker(),
+		stopping: make(chan struct{}),
+	}
+	s.Reload(config)
+	return s
+}
+
+// NewServer - метод создания gRPC сервера с зарегистрированной службой метрик, трассировкой,
+// проверками подсетей, ограничением частоты и защитой от повтора запросов.
+// размер сообщения задается при создании и не меняется при Reload.
+func NewServer(config utils.ServerConfig, svc *service.Service) (*grpc.Server, *MetricsServer) {
+	metricServer := NewMetricsServer(config, svc)
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			otelgrpc.UnaryServerInterceptor(),
+			requestIDInterceptor,
+			instrumentInterceptor,
+			metricServer.trustedSubnetInterceptor,
+			metricServer.auditSourceInterceptor,
+			metricServer.rateLimitInterceptor,
+			metricServer.replayInterceptor,
+		),
+		grpc.ChainStreamInterceptor(
+			otelgrpc.StreamServerInterceptor(),
+			requestIDStreamInterceptor,
+			instrumentStreamInterceptor,
+			metricServer.trustedSubnetStreamInterceptor,
+			metricServer.auditSourceStreamInterceptor,
+			metricServer.rateLimitStreamInterceptor,
+		),
+		grpc.KeepaliveParams(serverKeepalive),
+		grpc.KeepaliveEnforcementPolicy(keepalivePolicy),
+	}
+	if size := config.Limits.MaxDecompressedSize; size > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(size))
+	}
+	srv := grpc.NewServer(opts...)
+	pb.RegisterMetricsServer(srv, metricServer)
+	return srv, metricServer
+}
+
+// Reload - метод замены настроек: подсетей, ключа, защиты от повтора и ограничения частоты.
+// защита от повтора и ограничитель запросов сохраняются, если их настройки не изменились.
+func (s *MetricsServer) Reload(config utils.ServerConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := &settings{config: config, svc: s.svc.WithHashKey(config.HashKey)}
+	var prev utils.ServerConfig
+	if current := s.settings.Load(); current != nil {
+		next.guard, next.limiter, prev = current.guard, current.limiter, current.config
+	}
+	switch {
+	case config.HashKey == "":
+		next.guard = nil
+	case next.guard == nil || config.StampWindow() != prev.StampWindow() || config.NonceCacheSize != prev.NonceCacheSize:
+		next.guard = utils.NewReplayGuard(config.StampWindow(), config.NonceCacheSize)
+	}
+	switch {
+	case config.Limits.RateLimit <= 0:
+		next.limiter = nil
+	case next.limiter == nil || config.Limits.RateLimit != prev.Limits.RateLimit || config.Limits.RateBurst != prev.Limits.RateBurst:
+		next.limiter = utils.NewRateLimiter(config.Limits.RateLimit, config.Limits.RateBurst)
+	}
+	s.settings.Store(next)
+}
+
+// current - текущие настройки, запрос обрабатывается с настройками на момент обращения.
+func (s *MetricsServer) current() *settings {
+	return s.settings.Load()
+}
+
+// statusError - метод преобразования ошибки слоя service в статус gRPC.
+func statusError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidArgument):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrUnauthenticated):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, service.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func pbMetricToJSONMetric(m *pb.Metric) utils.JSONMetric {
+	return utils.JSONMetric{
+		ID:    m.Id,
+		MType: m.Type,
+		Delta: &m.Delta,
+		Value: &m.Value,
+		Hash:  &m.Hash,
+	}
+}
+
+func pbMetricsToJSONMetrics(in []*pb.Metric) []utils.JSONMetric {
+	metrics := make([]utils.JSONMetric, len(in))
+	for i, metric := range in {
+		metrics[i] = pbMetricToJSONMetric(metric)
+	}
+	return metrics
+}
+
+func jsonMetricsToPbMetrics(in []utils.JSONMetric) []*pb.Metric {
+	metrics := make([]*pb.Metric, 0, len(in))
+	for i := range in {
+		metrics = append(metrics, utils.JSONMetricToPbMetric(&in[i]))
+	}
+	return metrics
+}
+
+// checkBatchSize - метод проверки количества метрик в одном запросе.
+func (s *MetricsServer) checkBatchSize(n int) error {
+	if maxBatch := s.current().config.Limits.MaxBatchSize; maxBatch > 0 && n > maxBatch {
+		return status.Errorf(codes.ResourceExhausted, "too many metrics in request: %d > %d", n, maxBatch)
+	}
+	return nil
+}
+
+func (s *MetricsServer) SaveMetric(ctx context.Context, in *pb.SaveMetricRequest) (*pb.SaveMetricResponse, error) {
+	metric, err := s.current().svc.Save(ctx, pbMetricToJSONMetric(in.Metric), true)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.SaveMetricResponse{Metric: utils.JSONMetricToPbMetric(&metric)}, nil
+}
+
+func (s *MetricsServer) SaveBatchMetrics(ctx context.Context, in *pb.SaveBatchMetricRequest) (*pb.SaveBatchMetricResponse, error) {
+	if err := s.checkBatchSize(len(in.Metrics)); err != nil {
+		return nil, err
+	}
+	if in.Partial {
+		return s.savePartialBatch(ctx, in)
+	}
+	metrics, err := s.current().svc.SaveBatch(ctx, pbMetricsToJSONMetrics(in.Metrics), true)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.SaveBatchMetricResponse{Metrics: jsonMetricsToPbMetrics(metrics)}, nil
+}
+
+// savePartialBatch - метод частичной загрузки списка метрик.
+// в ответе результат каждой метрики в порядке запроса.
+func (s *MetricsServer) savePartialBatch(ctx context.Context, in *pb.SaveBatchMetricRequest) (*pb.SaveBatchMetricResponse, error) {
+	batch, err := s.current().svc.SavePartial(ctx, pbMetricsToJSONMetrics(in.Metrics), true)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	var response pb.SaveBatchMetricResponse
+	for _, result := range batch.Results {
+		if result.Metric != nil {
+			response.Metrics = append(response.Metrics, utils.JSONMetricToPbMetric(result.Metric))
+		}
+		response.Results = append(response.Results, &pb.MetricResult{
+			Index:   uint32(result.Index),
+			Id:      result.ID,
+			Type:    result.MType,
+			Status:  result.Status,
+			Code:    result.Code,
+			Message: result.Message,
+		})
+	}
+	return &response, nil
+}
+
+func (s *MetricsServer) GetMetric(ctx context.Context, in *pb.GetMetricRequest) (*pb.GetMetricResponse, error) {
+	metric, err := s.current().svc.Get(ctx, in.Metric.GetId(), in.Metric.GetType())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.GetMetricResponse{Metric: utils.JSONMetricToPbMetric(&metric)}, nil
+}
+
+func (s *MetricsServer) GetListMetrics(ctx context.Context, _ *pb.ListMetricRequest) (*pb.ListMetricResponse, error) {
+	metrics, err := s.current().svc.List(ctx)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.ListMetricResponse{Metrics: jsonMetricsToPbMetrics(metrics)}, nil
+}
+
+func (s *MetricsServer) SearchMetrics(ctx context.Context, in *pb.SearchMetricsRequest) (*pb.SearchMetricsResponse, error) {
+	page, err := s.current().svc.Search(ctx, storage.ListQuery{
+		Type:   in.Type,
+		Prefix: in.Prefix,
+		Glob:   in.Glob,
+		Regex:  in.Regex,
+		Sort:   in.Sort,
+		Limit:  int(in.Limit),
+		Cursor: in.Cursor,
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.SearchMetricsResponse{Metrics: jsonMetricsToPbMetrics(page.Metrics), NextCursor: page.NextCursor}, nil
+}
+
+// DeleteMetric - метод удаления метрики.
+// при заданном ключе сервера запрос должен содержать HMAC строки utils.DeletePayload.
+func (s *MetricsServer) DeleteMetric(ctx context.Context, in *pb.DeleteMetricRequest) (*pb.DeleteMetricResponse, error) {
+	if err := s.current().svc.Delete(ctx, in.Id, in.Type, in.Hash); err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.DeleteMetricResponse{}, nil
+}
+
+func (s *MetricsServer) Ping(ctx context.Context, _ *pb.PingRequest) (*pb.PingResponse, error) {
+	if !s.svc.Ping(ctx) {
+		return nil, status.Error(codes.Unavailable, "storage is unavailable")
+	}
+	return &pb.PingResponse{}, nil
+}
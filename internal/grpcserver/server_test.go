@@ -0,0 +1,261 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/tiraill/go_collect_metrics/internal/logger"
+	"github.com/tiraill/go_collect_metrics/internal/service"
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+
+	pb "github.com/tiraill/go_collect_metrics/cmd/proto"
+)
+
+func startServer(t *testing.T, config utils.ServerConfig) (pb.MetricsClient, *MetricsServer) {
+	listener := bufconn.Listen(1 << 20)
+	metricServer := NewMetricsServer(config, service.New(storage.NewStorage(&utils.StorageConfig{}), config.HashKey))
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(requestIDInterceptor, instrumentInterceptor),
+		grpc.ChainStreamInterceptor(requestIDStreamInterceptor, instrumentStreamInterceptor),
+	)
+	pb.RegisterMetricsServer(srv, metricServer)
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewMetricsClient(conn), metricServer
+}
+
+func counterBatch(sequence uint64, name string, delta int64) *pb.StreamMetricsRequest {
+	return &pb.StreamMetricsRequest{Sequence: sequence, Metrics: []*pb.Metric{{Id: name, Type: "counter", Delta: delta}}}
+}
+
+func TestStreamMetrics(t *testing.T) {
+	client, _ := startServer(t, utils.ServerConfig{})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s, err := client.StreamMetrics(ctx)
+	require.NoError(t, err)
+	require.NoError(t, s.Send(counterBatch(1, "PollCount", 2)))
+	ack, err := s.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), ack.Sequence)
+	assert.Equal(t, uint32(1), ack.Accepted)
+	assert.Empty(t, ack.Error)
+
+	// ошибка пачки не закрывает поток
+	require.NoError(t, s.Send(&pb.StreamMetricsRequest{Sequence: 2, Metrics: []*pb.Metric{{Id: "Bad", Type: "histogram"}}}))
+	ack, err = s.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), ack.Sequence)
+	assert.Zero(t, ack.Accepted)
+	assert.NotEmpty(t, ack.Error)
+
+	require.NoError(t, s.Send(counterBatch(3, "PollCount", 3)))
+	ack, err = s.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), ack.Accepted)
+	require.NoError(t, s.CloseSend())
+
+	resp, err := client.GetMetric(ctx, &pb.GetMetricRequest{Metric: &pb.Metric{Id: "PollCount", Type: "counter"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), resp.Metric.Delta)
+}
+
+func TestStreamMetrics_Replay(t *testing.T) {
+	client, _ := startServer(t, utils.ServerConfig{HashKey: "key", ReplayWindow: time.Minute, NonceCacheSize: 10})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s, err := client.StreamMetrics(ctx)
+	require.NoError(t, err)
+	request := counterBatch(1, "PollCount", 2)
+	request.Metrics[0].Hash = *utils.CalcHash("PollCount:counter:2", "key")
+	require.NoError(t, s.Send(request))
+	ack, err := s.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, utils.ErrRequestStamp.Error(), ack.Error)
+
+	require.NoError(t, utils.SignStreamBatch(request, "key"))
+	for _, expected := range []string{"", utils.ErrRequestReplay.Error()} {
+		require.NoError(t, s.Send(request))
+		ack, err = s.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, expected, ack.Error)
+	}
+}
+
+func TestWatchMetrics(t *testing.T) {
+	client, metricServer := startServer(t, utils.ServerConfig{HashKey: "key"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	invalid, err := client.WatchMetrics(ctx, &pb.WatchMetricsRequest{Type: "histogram"})
+	require.NoError(t, err)
+	_, err = invalid.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	for _, metric := range []*pb.Metric{
+		{Id: "Other", Type: "counter", Delta: 1, Hash: *utils.CalcHash("Other:counter:1", "key")},
+		{Id: "PollCount", Type: "gauge", Value: 1, Hash: *utils.CalcHash("PollCount:gauge:1.000000", "key")},
+		{Id: "PollCount", Type: "counter", Delta: 2, Hash: *utils.CalcHash("PollCount:counter:2", "key")},
+	} {
+		_, err = client.SaveMetric(ctx, &pb.SaveMetricRequest{Metric: metric})
+		require.NoError(t, err)
+	}
+
+	// возобновление после первого события получает из истории только подходящие под фильтр
+	epoch := metricServer.broker.Epoch()
+	watch, err := client.WatchMetrics(ctx, &pb.WatchMetricsRequest{Type: "counter", Names: []string{"PollCount"}, Epoch: epoch, LastId: 1})
+	require.NoError(t, err)
+	event, err := watch.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, epoch, event.Epoch)
+	assert.Equal(t, uint64(3), event.Id)
+	assert.Equal(t, "PollCount", event.Metric.Id)
+	assert.Equal(t, int64(2), event.Metric.Delta)
+	assert.Equal(t, *utils.CalcHash("PollCount:counter:2", "key"), event.Metric.Hash)
+
+	// номер события другого экземпляра сервера
+	foreign, err := client.WatchMetrics(ctx, &pb.WatchMetricsRequest{Epoch: epoch + 1, LastId: 1})
+	require.NoError(t, err)
+	resync, err := foreign.Recv()
+	require.NoError(t, err)
+	assert.True(t, resync.Resync)
+	assert.Nil(t, resync.Metric)
+
+	metricServer.Stop()
+	_, err = watch.Recv()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestSaveBatchMetrics_Partial(t *testing.T) {
+	client, _ := startServer(t, utils.ServerConfig{})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	response, err := client.SaveBatchMetrics(ctx, &pb.SaveBatchMetricRequest{Partial: true, Metrics: []*pb.Metric{
+		{Id: "PollCount", Type: "counter", Delta: 2},
+		{Id: "Custom", Type: "histogram"},
+	}})
+	require.NoError(t, err)
+	require.Len(t, response.Metrics, 1)
+	assert.Equal(t, int64(2), response.Metrics[0].Delta)
+	require.Len(t, response.Results, 2)
+	assert.Equal(t, utils.BatchStatusOK, response.Results[0].Status)
+	assert.Equal(t, utils.BatchStatusError, response.Results[1].Status)
+	assert.Equal(t, utils.MetricCodeType, response.Results[1].Code)
+
+	_, err = client.SaveBatchMetrics(ctx, &pb.SaveBatchMetricRequest{Metrics: []*pb.Metric{{Id: "Custom", Type: "histogram"}}})
+	assert.Error(t, err)
+}
+
+func TestDeleteMetric(t *testing.T) {
+	client, _ := startServer(t, utils.ServerConfig{HashKey: "key"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	metric := utils.NewGaugeJSONMetric("Alloc", 1.5)
+	metric.Hash = utils.CalcHash(metric.String(), "key")
+	_, err := client.SaveMetric(ctx, &pb.SaveMetricRequest{Metric: utils.JSONMetricToPbMetric(&metric)})
+	require.NoError(t, err)
+
+	_, err = client.DeleteMetric(ctx, &pb.DeleteMetricRequest{Id: "Alloc", Type: "gauge"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	hash := *utils.CalcHash(string(utils.DeletePayload("gauge", "Alloc")), "key")
+	_, err = client.DeleteMetric(ctx, &pb.DeleteMetricRequest{Id: "Alloc", Type: "gauge", Hash: hash})
+	require.NoError(t, err)
+
+	_, err = client.DeleteMetric(ctx, &pb.DeleteMetricRequest{Id: "Alloc", Type: "gauge", Hash: hash})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.DeleteMetric(ctx, &pb.DeleteMetricRequest{Id: "Alloc", Type: "histogram"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestRequestID(t *testing.T) {
+	client, _ := startServer(t, utils.ServerConfig{})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var header metadata.MD
+	_, err := client.Ping(metadata.AppendToOutgoingContext(ctx, logger.RequestIDHeader, "client-id"), &pb.PingRequest{}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"client-id"}, header.Get(logger.RequestIDHeader))
+
+	// без метаданных создается новый идентификатор
+	_, err = client.Ping(ctx, &pb.PingRequest{}, grpc.Header(&header))
+	require.NoError(t, err)
+	require.Len(t, header.Get(logger.RequestIDHeader), 1)
+	assert.NotEqual(t, "client-id", header.Get(logger.RequestIDHeader)[0])
+}
+
+func TestRateLimit_AgentID(t *testing.T) {
+	config := utils.ServerConfig{HashKey: "key", ReplayWindow: time.Minute, Limits: utils.LimitsConfig{RateLimit: 0.1, RateBurst: 1}}
+	s := NewMetricsServer(config, service.New(storage.NewStorage(&utils.StorageConfig{}), config.HashKey))
+	info := &grpc.UnaryServerInfo{FullMethod: "/main.Metrics/SaveMetric"}
+	handler := func(ctx context.Context, req any) (any, error) { return nil, nil }
+	call := func(agentID, hashKey string) codes.Code {
+		request := &pb.SaveMetricRequest{Metric: &pb.Metric{Id: "a", Type: "gauge", Value: 1}}
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000}})
+		signed, err := utils.SignContext(ctx, request, agentID, hashKey)
+		require.NoError(t, err)
+		md, _ := metadata.FromOutgoingContext(signed)
+		if agentID != "" && hashKey == "" {
+			md = metadata.Pairs(utils.AgentIDMetadataKey, agentID)
+		}
+		_, err = s.rateLimitInterceptor(metadata.NewIncomingContext(ctx, md), request, info, func(ctx context.Context, req any) (any, error) {
+			return s.replayInterceptor(ctx, req, info, handler)
+		})
+		return status.Code(err)
+	}
+	// агенты за одним адресом с проверенной подписью ограничиваются отдельно
+	assert.Equal(t, codes.OK, call("host-1", "key"))
+	assert.Equal(t, codes.OK, call("host-2", "key"))
+	assert.Equal(t, codes.ResourceExhausted, call("host-1", "key"))
+	// идентификатор без подписи или с неверной подписью не учитывается, запрос ограничивается по адресу
+	assert.Equal(t, codes.Unauthenticated, call("host-3", "other"))
+	assert.Equal(t, codes.ResourceExhausted, call("host-4", ""))
+	assert.Equal(t, codes.ResourceExhausted, call("", "key"))
+}
+
+func TestReplayInterceptor_Delete(t *testing.T) {
+	config := utils.ServerConfig{HashKey: "key"}
+	s := NewMetricsServer(config, service.New(storage.NewStorage(&utils.StorageConfig{}), config.HashKey))
+	handler := func(ctx context.Context, req any) (any, error) { return nil, nil }
+	call := func(ctx context.Context, method string, request proto.Message) codes.Code {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		_, err := s.replayInterceptor(metadata.NewIncomingContext(context.Background(), md), request, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return status.Code(err)
+	}
+	deleteRequest := &pb.DeleteMetricRequest{Id: "Alloc", Type: "gauge"}
+	signed, err := utils.SignContext(context.Background(), deleteRequest, "", "key")
+	require.NoError(t, err)
+
+	// удаление проверяется на повтор, даже если защита запросов на запись выключена
+	assert.Equal(t, codes.Unauthenticated, call(context.Background(), deleteMethod, deleteRequest))
+	assert.Equal(t, codes.OK, call(signed, deleteMethod, deleteRequest))
+	assert.Equal(t, codes.Unauthenticated, call(signed, deleteMethod, deleteRequest))
+	assert.Equal(t, codes.OK, call(context.Background(), "/main.Metrics/SaveMetric", &pb.SaveMetricRequest{}))
+}
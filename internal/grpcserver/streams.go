@@ -0,0 +1,134 @@
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/tiraill/go_collect_metrics/internal/stream"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+
+	pb "github.com/tiraill/go_collect_metrics/cmd/proto"
+)
+
+// StreamMetrics - метод приема потока пачек метрик от агента.
+// каждая пачка записывается целиком и подтверждается отдельным сообщением с ее номером.
+// ошибка обработки пачки передается в подтверждении и не завершает поток.
+// при остановке сервера поток завершается с Unavailable, неподтвержденные пачки агент отправляет повторно.
+func (s *MetricsServer) StreamMetrics(srv pb.Metrics_StreamMetricsServer) error {
+	ctx := srv.Context()
+	requests := make(chan *pb.StreamMetricsRequest)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			in, err := srv.Recv()
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case requests <- in:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-s.stopping:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case err := <-errs:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case in := <-requests:
+			ack := &pb.StreamMetricsAck{Sequence: in.Sequence}
+			if err := s.saveStreamBatch(ctx, in); err != nil {
+				ack.Error = err.Error()
+			} else {
+				ack.Accepted = uint32(len(in.Metrics))
+			}
+			if err := srv.Send(ack); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *MetricsServer) saveStreamBatch(ctx context.Context, in *pb.StreamMetricsRequest) error {
+	current := s.current()
+	if current.config.IsReplayProtected() {
+		if err := current.guard.CheckStreamBatch(in, current.config.HashKey); err != nil {
+			return err
+		}
+	}
+	if maxBatch := current.config.Limits.MaxBatchSize; maxBatch > 0 && len(in.Metrics) > maxBatch {
+		return fmt.Errorf("too many metrics in request: %d > %d", len(in.Metrics), maxBatch)
+	}
+	_, err := current.svc.SaveBatch(ctx, pbMetricsToJSONMetrics(in.Metrics), true)
+	return err
+}
+
+// Stop - метод завершения потоковых вызовов перед остановкой сервера.
+// без этого GracefulStop ждал бы закрытия потоков клиентами.
+func (s *MetricsServer) Stop() {
+	close(s.stopping)
+	s.broker.Close()
+}
+
+// WatchMetrics - метод получения потока изменений метрик с фильтром по типу и именам.
+// если клиент читает медленнее, чем меняются метрики, лишние события отбрасываются,
+// а их количество передается в поле dropped следующего события.
+// для возобновления после переподключения клиент передает epoch и last_id последнего полученного события,
+// если события с того момента недоступны, первым приходит событие с resync.
+func (s *MetricsServer) WatchMetrics(in *pb.WatchMetricsRequest, srv pb.Metrics_WatchMetricsServer) error {
+	filter := stream.Filter{Type: in.Type, Names: make(map[string]bool, len(in.Names))}
+	if filter.Type != "" && filter.Type != "gauge" && filter.Type != "counter" {
+		return status.Error(codes.InvalidArgument, utils.ErrMetricType.Error())
+	}
+	for _, name := range in.Names {
+		filter.Names[name] = true
+	}
+	epoch := s.broker.Epoch()
+	var lastID uint64
+	resync := false
+	if in.LastId > 0 {
+		lastID = in.LastId
+		if in.Epoch != epoch {
+			lastID, resync = 0, true
+		}
+	}
+
+	sub := s.broker.Subscribe(filter, lastID)
+	defer sub.Close()
+	if resync || sub.Missed() > 0 {
+		if err := srv.Send(&pb.WatchMetricsEvent{Epoch: epoch, Resync: true, Missed: sub.Missed()}); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-srv.Context().Done():
+			return nil
+		case e, ok := <-sub.Events():
+			if !ok {
+				return status.Error(codes.Unavailable, "server is shutting down")
+			}
+			metric := e.Metric
+			s.current().svc.Sign(&metric)
+			event := &pb.WatchMetricsEvent{
+				Epoch:   epoch,
+				Id:      e.ID,
+				Metric:  utils.JSONMetricToPbMetric(&metric),
+				Dropped: sub.TakeDropped(),
+			}
+			if err := srv.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
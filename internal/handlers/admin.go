@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/tiraill/go_collect_metrics/internal/logger"
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// adminImportPath - путь загрузки метрик, тело запроса которого не ограничивается LimitRequest.
+const adminImportPath = APIPrefix + "/admin/import"
+
+// adminExportPath - путь выгрузки метрик, ответ которой подписывается трейлером без буферизации.
+const adminExportPath = APIPrefix + "/admin/export"
+
+// ImportResponse - ответ на загрузку метрик.
+type ImportResponse struct {
+	Imported int    `json:"imported"` // количество загруженных метрик
+	Mode     string `json:"mode"`     // режим загрузки merge или replace
+}
+
+// adminRoutes - метод регистрирует роуты администрирования хранилища.
+func adminRoutes(db storage.Storage, config utils.ServerConfig) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Use(CheckTrustedSubnet(config.WritePrefixes, config.ProxyPrefixes))
+		r.Use(CheckAdminToken(config.AdminToken))
+		r.Group(func(r chi.Router) {
+			if config.HashKey != "" {
+				r.Use(SignResponseTrailer(config.HashKey))
+			}
+			r.Get("/export", AdminExportHandler(db))
+		})
+		r.Post("/import", AdminImportHandler(db, config.Limits.MaxImportSize))
+	}
+}
+
+// CheckAdminToken - middleware для проверки токена администратора в заголовке Authorization.
+// если токен не задан, методы администрирования отключены.
+func CheckAdminToken(token string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				writeError(w, r, http.StatusForbidden, CodeForbidden, "admin api is disabled")
+				return
+			}
+			actual := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(actual), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Unauthorized")
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// transferFormat - метод получения формата выгрузки из параметров запроса, по умолчанию ndjson.
+func transferFormat(r *http.Request) (string, error) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		return storage.FormatNDJSON, nil
+	}
+	if !storage.IsValidFormat(format) {
+		return "", storage.ErrTransferFormat
+	}
+	return format, nil
+}
+
+// AdminExportHandler - метод выгрузки всех метрик хранилища.
+// GET /api/v1/admin/export?format=ndjson|csv.
+func AdminExportHandler(db storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, err := transferFormat(r)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, APIError{Code: CodeInvalidQuery, Message: err.Error()})
+			return
+		}
+		contentType := "application/x-ndjson"
+		if format == storage.FormatCSV {
+			contentType = "text/csv"
+		}
+		w.Header().Set("content-type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="metrics.%s"`, format))
+		// метрики пишутся в ответ по мере чтения снимка хранилища, поэтому ошибка хранилища возвращается клиенту,
+		// только если ответ еще не начат, иначе ответ обрывается, чтобы выгрузка не выглядела полной
+		out := &startedWriter{w: w}
+		if _, err = storage.Export(r.Context(), db, out, format); err != nil {
+			if out.started {
+				logger.Ctx(r.Context(), "http").Error("admin export aborted", zap.Error(err))
+				panic(http.ErrAbortHandler)
+			}
+			w.Header().Del("Content-Disposition")
+			writeAPIError(w, http.StatusInternalServerError, APIError{Code: CodeStorageError, Message: err.Error()})
+		}
+	}
+}
+
+// AdminImportHandler - метод загрузки метрик в хранилище.
+// POST /api/v1/admin/import?format=ndjson|csv&mode=merge|replace.
+// тело запроса читается потоком и может быть сжато gzip.
+// если maxSize больше 0, размер тела до и после распаковки ограничивается maxSize байт.
+func AdminImportHandler(db storage.Storage, maxSize int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, err := transferFormat(r)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, APIError{Code: CodeInvalidQuery, Message: err.Error()})
+			return
+		}
+		mode := r.URL.Query().Get("mode")
+		if mode == "" {
+			mode = storage.ImportMerge
+		}
+		if mode != storage.ImportMerge && mode != storage.ImportReplace {
+			writeAPIError(w, http.StatusBadRequest, APIError{Code: CodeInvalidQuery, Message: storage.ErrImportMode.Error()})
+			return
+		}
+		if maxSize > 0 {
+			if r.ContentLength > int64(maxSize) {
+				writeAPIError(w, http.StatusRequestEntityTooLarge, APIError{Code: CodeBodyTooLarge, Message: ErrBodyTooLarge.Error()})
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, int64(maxSize))
+		}
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gzipReader, err := gzip.NewReader(r.Body)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, APIError{Code: CodeBadRequest, Message: err.Error()})
+				return
+			}
+			defer gzipReader.Close()
+			body = gzipReader
+			if maxSize > 0 {
+				body = &limitedReader{r: gzipReader, n: int64(maxSize)}
+			}
+		}
+		imported, err := storage.Import(r.Context(), db, body, format, mode)
+		if bodyErrorStatus(err) == http.StatusRequestEntityTooLarge {
+			writeAPIError(w, http.StatusRequestEntityTooLarge, APIError{Code: CodeBodyTooLarge, Message: ErrBodyTooLarge.Error()})
+			return
+		}
+		var recordErr *storage.RecordError
+		if errors.As(err, &recordErr) {
+			writeAPIError(w, http.StatusBadRequest, APIError{Code: CodeBadRequest, Message: err.Error()})
+			return
+		}
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, APIError{Code: CodeStorageError, Message: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, ImportResponse{Imported: imported, Mode: mode})
+	}
+}
+
+// limitedReader - чтение не больше n байт, при превышении возвращается ErrBodyTooLarge.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read - метод чтения, читается на один байт больше лимита, чтобы обнаружить его превышение.
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n - 1, ErrBodyTooLarge
+	}
+	return n, err
+}
+
+// startedWriter - запись ответа с признаком, что ответ уже начат.
+type startedWriter struct {
+	w       io.Writer
+	started bool
+}
+
+// Write - метод записи в ответ.
+func (s *startedWriter) Write(p []byte) (int, error) {
+	s.started = true
+	return s.w.Write(p)
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+func TestAdminHandlers_Auth(t *testing.T) {
+	spec := loadOpenAPI(t)
+	tests := []struct {
+		name       string
+		token      string
+		header     string
+		statusCode int
+	}{
+		{name: "disabled", token: "", header: "Bearer secret", statusCode: http.StatusForbidden},
+		{name: "missing token", token: "secret", header: "", statusCode: http.StatusUnauthorized},
+		{name: "wrong token", token: "secret", header: "Bearer other", statusCode: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := GetRouter(storage.NewStorage(&utils.StorageConfig{}), utils.ServerConfig{AdminToken: tt.token}, nil, nil)
+			request := httptest.NewRequest(http.MethodGet, APIPrefix+"/admin/export", nil)
+			request.Header.Set("Authorization", tt.header)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, request)
+			assert.Equal(t, tt.statusCode, w.Code)
+			checkAgainstOpenAPI(t, spec, request, w)
+		})
+	}
+}
+
+func TestAdminHandlers_ExportImport(t *testing.T) {
+	spec := loadOpenAPI(t)
+	src := storage.NewStorage(&utils.StorageConfig{})
+	_, _ = src.UpdateJSONMetrics(context.Background(), []utils.JSONMetric{
+		utils.NewGaugeJSONMetric("Alloc", 1.5),
+		utils.NewCounterJSONMetric("PollCount", 3),
+	})
+	config := utils.ServerConfig{AdminToken: "secret"}
+	config.Limits.MaxBodySize = 16
+	srcRouter := GetRouter(src, config, nil, nil)
+
+	request := httptest.NewRequest(http.MethodGet, APIPrefix+"/admin/export?format=csv", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	srcRouter.ServeHTTP(w, request)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv", w.Header().Get("content-type"))
+	assert.Equal(t, `attachment; filename="metrics.csv"`, w.Header().Get("Content-Disposition"))
+	exported := w.Body.String()
+	assert.Equal(t, "id,type,value\nAlloc,gauge,1.5\nPollCount,counter,3\n", exported)
+
+	dst := storage.NewStorage(&utils.StorageConfig{})
+	_, _ = dst.UpdateJSONMetrics(context.Background(), []utils.JSONMetric{
+		utils.NewCounterJSONMetric("PollCount", 10),
+		utils.NewGaugeJSONMetric("Sys", 7),
+	})
+	dstRouter := GetRouter(dst, config, nil, nil)
+
+	importCSV := func(t *testing.T, mode string, body []byte, gzipped bool) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, APIPrefix+"/admin/import?format=csv&mode="+mode, bytes.NewReader(body))
+		request.Header.Set("Authorization", "Bearer secret")
+		if gzipped {
+			request.Header.Set("Content-Encoding", "gzip")
+		}
+		w := httptest.NewRecorder()
+		dstRouter.ServeHTTP(w, request)
+		checkAgainstOpenAPI(t, spec, request, w)
+		return w
+	}
+	getValue := func(mType, mName string) string {
+		m, err := dst.GetJSONMetric(context.Background(), mName, mType)
+		if err != nil {
+			return ""
+		}
+		return m.ValueString()
+	}
+
+	t.Run("merge", func(t *testing.T) {
+		w := importCSV(t, "merge", []byte(exported), false)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp ImportResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, ImportResponse{Imported: 2, Mode: storage.ImportMerge}, resp)
+		assert.Equal(t, "13", getValue("counter", "PollCount"))
+		assert.Equal(t, "1.5", getValue("gauge", "Alloc"))
+		assert.Equal(t, "7", getValue("gauge", "Sys"))
+	})
+	t.Run("invalid record", func(t *testing.T) {
+		w := importCSV(t, "replace", []byte(exported+"Sys,gauge,x\n"), false)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "record 3")
+		assert.Equal(t, "7", getValue("gauge", "Sys"))
+	})
+	t.Run("replace gzip", func(t *testing.T) {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write([]byte(exported))
+		require.NoError(t, zw.Close())
+		w := importCSV(t, "replace", buf.Bytes(), true)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "3", getValue("counter", "PollCount"))
+		assert.Equal(t, "", getValue("gauge", "Sys"))
+	})
+	t.Run("invalid mode", func(t *testing.T) {
+		w := importCSV(t, "append", []byte(exported), false)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.True(t, strings.Contains(w.Body.String(), CodeInvalidQuery))
+	})
+}
+
+func TestAdminHandlers_ExportSigned(t *testing.T) {
+	db := storage.NewStorage(&utils.StorageConfig{})
+	_, _ = db.UpdateJSONMetrics(context.Background(), []utils.JSONMetric{utils.NewGaugeJSONMetric("Alloc", 1.5)})
+	ts := httptest.NewServer(GetRouter(db, utils.ServerConfig{AdminToken: "secret", HashKey: "key"}, nil, nil))
+	defer ts.Close()
+
+	request, _ := http.NewRequest(http.MethodGet, ts.URL+APIPrefix+"/admin/export", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	result, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	require.NoError(t, result.Body.Close())
+
+	// выгрузка не буферизуется для подписи заголовком, подпись передается трейлером
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Empty(t, result.Header.Get(utils.BodyHashHeader))
+	assert.True(t, utils.IsValidBodyHash(body, result.Trailer.Get(utils.BodyHashHeader), "key"))
+}
+
+func TestAdminHandlers_ImportLimit(t *testing.T) {
+	spec := loadOpenAPI(t)
+	db := storage.NewStorage(&utils.StorageConfig{})
+	config := utils.ServerConfig{AdminToken: "secret"}
+	config.Limits.MaxImportSize = 64
+	router := GetRouter(db, config, nil, nil)
+
+	data := "id,type,value\n" + strings.Repeat("Alloc,gauge,1.5\n", 100)
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, _ = zw.Write([]byte(data))
+	require.NoError(t, zw.Close())
+	// сжатое тело меньше лимита, распакованное - больше
+	require.Less(t, compressed.Len(), 64)
+
+	tests := []struct {
+		name    string
+		body    []byte
+		gzipped bool
+	}{
+		{name: "plain", body: []byte(data)},
+		{name: "gzip", body: compressed.Bytes(), gzipped: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, APIPrefix+"/admin/import?format=csv", bytes.NewReader(tt.body))
+			request.Header.Set("Authorization", "Bearer secret")
+			if tt.gzipped {
+				request.Header.Set("Content-Encoding", "gzip")
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, request)
+			assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+			checkAgainstOpenAPI(t, spec, request, w)
+		})
+	}
+}
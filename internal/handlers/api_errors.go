@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/tiraill/go_collect_metrics/internal/service"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// APIPrefix - префикс версионированного API.
+const APIPrefix = "/api/v1"
+
+// Коды ошибок версионированного API.
+const (
+	CodeBadRequest    = "bad_request"
+	CodeInvalidQuery  = "invalid_query"
+	CodeInvalidMetric = utils.MetricCodeInvalid
+	CodeInvalidHash   = utils.MetricCodeHash
+	CodeInvalidType   = utils.MetricCodeType
+	CodeInvalidValue  = utils.MetricCodeValue
+	CodeNotFound      = "not_found"
+	CodeNotAllowed    = "method_not_allowed"
+	CodeBodyTooLarge  = "body_too_large"
+	CodeBatchTooLarge = "batch_too_large"
+	CodeUnauthorized  = "unauthorized"
+	CodeForbidden     = "forbidden"
+	CodeRateLimited   = "rate_limited"
+	CodeStorageError  = "storage_error"
+	CodeUnavailable   = "unavailable"
+)
+
+// APIErrorDetail - описание ошибки отдельной метрики в запросе.
+type APIErrorDetail struct {
+	Index   int    `json:"index"`        // позиция метрики в запросе
+	ID      string `json:"id,omitempty"` // имя метрики
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// APIError - структура ошибки версионированного API.
+type APIError struct {
+	Code    string           `json:"code"`              // машиночитаемый код ошибки
+	Message string           `json:"message"`           // описание ошибки
+	Details []APIErrorDetail `json:"details,omitempty"` // ошибки отдельных метрик
+}
+
+// APIErrorResponse - конверт ответа с ошибкой.
+type APIErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// isAPIRequest - метод проверяет, относится ли запрос к версионированному API.
+func isAPIRequest(r *http.Request) bool {
+	return r.URL.Path == APIPrefix || strings.HasPrefix(r.URL.Path, APIPrefix+"/")
+}
+
+// writeJSON - метод записи ответа в формате JSON.
+func writeJSON(w http.ResponseWriter, statusCode int, v any) {
+	body, _ := json.Marshal(v)
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+// writeAPIError - метод записи ошибки версионированного API.
+func writeAPIError(w http.ResponseWriter, statusCode int, apiErr APIError) {
+	writeJSON(w, statusCode, APIErrorResponse{Error: apiErr})
+}
+
+// writeError - метод записи ошибки для общих middleware.
+// для запросов к версионированному API ошибка возвращается в конверте JSON, для остальных - текстом.
+func writeError(w http.ResponseWriter, r *http.Request, statusCode int, code, message string) {
+	if isAPIRequest(r) {
+		writeAPIError(w, statusCode, APIError{Code: code, Message: message})
+		return
+	}
+	http.Error(w, message, statusCode)
+}
+
+// bodyAPIError - метод преобразования ошибки чтения тела запроса в ошибку API.
+func bodyAPIError(err error) (int, APIError) {
+	switch {
+	case errors.Is(err, ErrBodyHash):
+		return http.StatusUnauthorized, APIError{Code: CodeUnauthorized, Message: err.Error()}
+	case bodyErrorStatus(err) == http.StatusRequestEntityTooLarge:
+		return http.StatusRequestEntityTooLarge, APIError{Code: CodeBodyTooLarge, Message: ErrBodyTooLarge.Error()}
+	default:
+		return http.StatusBadRequest, APIError{Code: CodeBadRequest, Message: err.Error()}
+	}
+}
+
+// writeStampError - метод записи ошибки проверки подписи запроса.
+func writeStampError(w http.ResponseWriter, err error) {
+	statusCode := stampErrorStatus(err)
+	code := CodeUnauthorized
+	switch statusCode {
+	case http.StatusTooManyRequests:
+		code = CodeRateLimited
+	case http.StatusServiceUnavailable:
+		code = CodeUnavailable
+	}
+	writeAPIError(w, statusCode, APIError{Code: code, Message: err.Error()})
+}
+
+// serviceAPIError - метод преобразования ошибки слоя service в ошибку API.
+func serviceAPIError(err error) (int, APIError) {
+	var invalid *service.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		details := make([]APIErrorDetail, 0, len(invalid.Errors))
+		for _, e := range invalid.Errors {
+			details = append(details, APIErrorDetail{Index: e.Index, ID: e.ID, Code: utils.MetricErrorCode(e.Err), Message: e.Err.Error()})
+		}
+		return http.StatusBadRequest, APIError{Code: CodeInvalidMetric, Message: invalid.Error(), Details: details}
+	case errors.Is(err, utils.ErrMetricType):
+		return http.StatusBadRequest, APIError{Code: CodeInvalidType, Message: err.Error()}
+	case errors.Is(err, service.ErrInvalidArgument):
+		return http.StatusBadRequest, APIError{Code: CodeInvalidQuery, Message: err.Error()}
+	case errors.Is(err, service.ErrUnauthenticated):
+		return http.StatusUnauthorized, APIError{Code: CodeUnauthorized, Message: err.Error()}
+	case errors.Is(err, service.ErrNotFound):
+		return http.StatusNotFound, APIError{Code: CodeNotFound, Message: "metric not found"}
+	default:
+		return http.StatusInternalServerError, APIError{Code: CodeStorageError, Message: err.Error()}
+	}
+}
+
+// writeServiceError - метод записи ошибки слоя service в формате API.
+func writeServiceError(w http.ResponseWriter, err error) {
+	statusCode, apiErr := serviceAPIError(err)
+	writeAPIError(w, statusCode, apiErr)
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/tiraill/go_collect_metrics/internal/alert"
+	"github.com/tiraill/go_collect_metrics/internal/service"
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// PingResponse - ответ проверки доступности хранилища.
+type PingResponse struct {
+	Status string `json:"status"`
+}
+
+// apiRoutes - метод регистрирует роуты версионированного API.
+// ограничения подсетей совпадают с ограничениями соответствующих legacy роутов.
+// guard проверяет подпись запросов на запись, deleteGuard - запросов на удаление.
+func apiRoutes(
+	svc *service.Service, config utils.ServerConfig, privateKey *utils.PrivateKey, guard, deleteGuard *utils.ReplayGuard, alerts *alert.Engine,
+) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+			writeAPIError(w, http.StatusNotFound, APIError{Code: CodeNotFound, Message: "route not found"})
+		})
+		r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+			writeAPIError(w, http.StatusMethodNotAllowed, APIError{Code: CodeNotAllowed, Message: "method not allowed"})
+		})
+		r.Get("/openapi.json", OpenAPIHandler())
+		r.Group(func(r chi.Router) {
+			r.Use(CheckTrustedSubnet(config.ReadPrefixes, config.ProxyPrefixes))
+			r.Get("/ping", APIPingHandler(svc))
+			r.Get("/dashboard", APIDashboardHandler(svc))
+			r.Get("/metrics", APIListMetricsHandler(svc))
+			r.Get("/metrics/search", APISearchMetricsHandler(svc))
+			r.Get("/metrics/{mType}/{mName}", APIGetMetricHandler(svc))
+			r.Get("/alerts", APIAlertsHandler(alerts))
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(CheckTrustedSubnet(config.WritePrefixes, config.ProxyPrefixes))
+			r.Post("/metrics", APISaveMetricHandler(svc, privateKey, guard))
+			r.Post("/metrics/batch", APISaveBatchMetricHandler(svc, privateKey, guard))
+			r.Delete("/metrics/{mType}/{mName}", APIDeleteMetricHandler(svc, deleteGuard))
+		})
+		r.Route("/admin", adminRoutes(svc.Storage(), config))
+	}
+}
+
+// APIPingHandler - метод проверки доступности хранилища.
+// GET /api/v1/ping.
+func APIPingHandler(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !svc.Ping(r.Context()) {
+			writeAPIError(w, http.StatusServiceUnavailable, APIError{Code: CodeUnavailable, Message: "storage is unavailable"})
+			return
+		}
+		writeJSON(w, http.StatusOK, PingResponse{Status: "ok"})
+	}
+}
+
+// APIAlertsHandler - метод получения активных оповещений в состояниях pending и firing.
+// GET /api/v1/alerts.
+func APIAlertsHandler(alerts *alert.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		active := make([]alert.Alert, 0)
+		if alerts != nil {
+			active = alerts.Alerts()
+		}
+		writeJSON(w, http.StatusOK, active)
+	}
+}
+
+// APIListMetricsHandler - метод получения всех метрик.
+// GET /api/v1/metrics.
+func APIListMetricsHandler(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metrics, err := svc.List(r.Context())
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, metrics)
+	}
+}
+
+// APISearchMetricsHandler - метод поиска метрик с фильтрацией, сортировкой и пагинацией.
+// GET /api/v1/metrics/search?type=&prefix=&glob=&regex=&sort=&limit=&cursor=.
+func APISearchMetricsHandler(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		q := storage.ListQuery{
+			Type:   params.Get("type"),
+			Prefix: params.Get("prefix"),
+			Glob:   params.Get("glob"),
+			Regex:  params.Get("regex"),
+			Sort:   params.Get("sort"),
+			Cursor: params.Get("cursor"),
+		}
+		if limit := params.Get("limit"); limit != "" {
+			var err error
+			if q.Limit, err = strconv.Atoi(limit); err != nil {
+				writeAPIError(w, http.StatusBadRequest, APIError{Code: CodeInvalidQuery, Message: "limit must be an integer"})
+				return
+			}
+		}
+		page, err := svc.Search(r.Context(), q)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, page)
+	}
+}
+
+// APIGetMetricHandler - метод получения одной метрики.
+// GET /api/v1/metrics/{mType}/{mName}.
+func APIGetMetricHandler(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metric, err := svc.Get(r.Context(), chi.URLParam(r, "mName"), chi.URLParam(r, "mType"))
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, metric)
+	}
+}
+
+// readAPIBody - метод чтения и проверки тела запроса на изменение метрик.
+// при ошибке ответ уже записан и возвращается false.
+func readAPIBody(w http.ResponseWriter, r *http.Request, hashKey string, privateKey *utils.PrivateKey, guard *utils.ReplayGuard) ([]byte, bool) {
+	body, err := ReadEncryptedBody(r, privateKey, hashKey)
+	if err != nil {
+		statusCode, apiErr := bodyAPIError(err)
+		writeAPIError(w, statusCode, apiErr)
+		return nil, false
+	}
+	if err = CheckRequestStamp(r, body, guard, hashKey); err != nil {
+		writeStampError(w, err)
+		return nil, false
+	}
+	return body, true
+}
+
+// APISaveMetricHandler - метод для загрузки одной метрики.
+// POST /api/v1/metrics.
+func APISaveMetricHandler(svc *service.Service, privateKey *utils.PrivateKey, guard *utils.ReplayGuard) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, ok := readAPIBody(w, r, svc.HashKey(), privateKey, guard)
+		if !ok {
+			return
+		}
+		metric, err := utils.LoadJSONMetric(body)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, APIError{Code: CodeBadRequest, Message: err.Error()})
+			return
+		}
+		metric, err = svc.Save(r.Context(), metric, !IsSignedRequest(r, svc.HashKey()))
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, metric)
+	}
+}
+
+// APISaveBatchMetricHandler - метод для загрузки списка метрик.
+// список сохраняется, только если валидны все метрики.
+// с параметром partial=true валидные метрики сохраняются, а ответ 207 содержит результат каждой метрики.
+// POST /api/v1/metrics/batch.
+func APISaveBatchMetricHandler(svc *service.Service, privateKey *utils.PrivateKey, guard *utils.ReplayGuard) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, ok := readAPIBody(w, r, svc.HashKey(), privateKey, guard)
+		if !ok {
+			return
+		}
+		metrics, err := utils.LoadButchJSONMetric(body)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, APIError{Code: CodeBadRequest, Message: err.Error()})
+			return
+		}
+		if maxBatch := requestLimits(r).MaxBatchSize; maxBatch > 0 && len(metrics) > maxBatch {
+			writeAPIError(w, http.StatusRequestEntityTooLarge, APIError{
+				Code:    CodeBatchTooLarge,
+				Message: fmt.Sprintf("%s: %d > %d", ErrBatchTooLarge, len(metrics), maxBatch),
+			})
+			return
+		}
+		checkHash := !IsSignedRequest(r, svc.HashKey())
+		if isPartialBatch(r) {
+			response, err := svc.SavePartial(r.Context(), metrics, checkHash)
+			if err != nil {
+				writeServiceError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusMultiStatus, response)
+			return
+		}
+		metrics, err = svc.SaveBatch(r.Context(), metrics, checkHash)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, metrics)
+	}
+}
+
+// APIDeleteMetricHandler - метод удаления одной метрики.
+// у запроса нет тела, при заданном ключе заголовок HashSHA256 содержит подпись utils.DeletePayload,
+// подпись для защиты от повторной отправки также вычисляется по utils.DeletePayload
+// и при заданном ключе обязательна, даже если защита запросов на запись выключена.
+// DELETE /api/v1/metrics/{mType}/{mName}.
+func APIDeleteMetricHandler(svc *service.Service, guard *utils.ReplayGuard) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mType, mName := chi.URLParam(r, "mType"), chi.URLParam(r, "mName")
+		if err := CheckRequestStamp(r, utils.DeletePayload(mType, mName), guard, svc.HashKey()); err != nil {
+			writeStampError(w, err)
+			return
+		}
+		if err := svc.Delete(r.Context(), mName, mType, r.Header.Get(utils.BodyHashHeader)); err != nil {
+			writeServiceError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tiraill/go_collect_metrics/internal/alert"
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+var pathParam = regexp.MustCompile(`\{[^}]+\}`)
+
+// loadOpenAPI - метод разбора встроенного описания API.
+func loadOpenAPI(t *testing.T) map[string]any {
+	var spec map[string]any
+	require.NoError(t, json.Unmarshal(openAPISpec, &spec))
+	return spec
+}
+
+// resolveRef - метод разрешения ссылки $ref внутри документа.
+func resolveRef(t *testing.T, spec map[string]any, node map[string]any) map[string]any {
+	ref, ok := node["$ref"].(string)
+	if !ok {
+		return node
+	}
+	var current any = spec
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		current = current.(map[string]any)[part]
+	}
+	require.NotNil(t, current, "unresolved ref %s", ref)
+	return resolveRef(t, spec, current.(map[string]any))
+}
+
+// validateSchema - упрощенная проверка значения по схеме OpenAPI:
+// type, enum, required, properties и items.
+func validateSchema(t *testing.T, spec, schema map[string]any, value any, at string) {
+	schema = resolveRef(t, spec, schema)
+	if enum, ok := schema["enum"].([]any); ok {
+		assert.Contains(t, enum, value, "%s: value not in enum", at)
+	}
+	switch schema["type"] {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !assert.True(t, ok, "%s: expected object, got %T", at, value) {
+			return
+		}
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			assert.Contains(t, obj, name, "%s: missing required property", at)
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		for name, v := range obj {
+			if prop, ok := properties[name]; ok {
+				validateSchema(t, spec, prop.(map[string]any), v, at+"."+name)
+			} else if len(properties) > 0 {
+				t.Errorf("%s: undocumented property %s", at, name)
+			}
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !assert.True(t, ok, "%s: expected array, got %T", at, value) {
+			return
+		}
+		for i, item := range items {
+			validateSchema(t, spec, schema["items"].(map[string]any), item, fmt.Sprintf("%s[%d]", at, i))
+		}
+	case "string":
+		_, ok := value.(string)
+		assert.True(t, ok, "%s: expected string, got %T", at, value)
+	case "integer":
+		n, ok := value.(float64)
+		assert.True(t, ok && n == float64(int64(n)), "%s: expected integer, got %v", at, value)
+	case "number":
+		_, ok := value.(float64)
+		assert.True(t, ok, "%s: expected number, got %T", at, value)
+	}
+}
+
+// findOperation - метод поиска операции описания по методу и пути запроса.
+func findOperation(spec map[string]any, method, path string) (map[string]any, bool) {
+	path = strings.TrimPrefix(path, APIPrefix)
+	segments := strings.Split(path, "/")
+	for template, item := range spec["paths"].(map[string]any) {
+		parts := strings.Split(template, "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+		matched := true
+		for i, part := range parts {
+			if !pathParam.MatchString(part) && part != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		op, ok := item.(map[string]any)[strings.ToLower(method)].(map[string]any)
+		return op, ok
+	}
+	return nil, false
+}
+
+// checkAgainstOpenAPI - метод проверки ответа обработчика по описанию API.
+func checkAgainstOpenAPI(t *testing.T, spec map[string]any, req *http.Request, rec *httptest.ResponseRecorder) {
+	op, ok := findOperation(spec, req.Method, req.URL.Path)
+	require.True(t, ok, "operation %s %s is not documented", req.Method, req.URL.Path)
+	responses := op["responses"].(map[string]any)
+	response, ok := responses[fmt.Sprint(rec.Code)].(map[string]any)
+	require.True(t, ok, "status %d of %s %s is not documented", rec.Code, req.Method, req.URL.Path)
+	response = resolveRef(t, spec, response)
+	content, ok := response["content"].(map[string]any)
+	if !ok {
+		return
+	}
+	media, ok := content[rec.Header().Get("content-type")].(map[string]any)
+	require.True(t, ok, "content type %q is not documented", rec.Header().Get("content-type"))
+	var body any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	validateSchema(t, spec, media["schema"].(map[string]any), body, "body")
+}
+
+func TestAPIRoutes_Documented(t *testing.T) {
+	spec := loadOpenAPI(t)
+	router := GetRouter(storage.NewStorage(&utils.StorageConfig{}), utils.ServerConfig{}, nil, nil)
+
+	registered := make(map[string]bool)
+	err := chi.Walk(router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if strings.HasPrefix(route, APIPrefix+"/") {
+			route = pathParam.ReplaceAllString(strings.TrimPrefix(route, APIPrefix), "{}")
+			registered[method+" "+route] = true
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	documented := make(map[string]bool)
+	for template, item := range spec["paths"].(map[string]any) {
+		for method := range item.(map[string]any) {
+			documented[strings.ToUpper(method)+" "+pathParam.ReplaceAllString(template, "{}")] = true
+		}
+	}
+	assert.Equal(t, documented, registered)
+}
+
+func TestAPIHandlers_OpenAPI(t *testing.T) {
+	spec := loadOpenAPI(t)
+	db := storage.NewStorage(&utils.StorageConfig{})
+	_, _ = db.UpdateJSONMetrics(context.Background(), []utils.JSONMetric{
+		utils.NewGaugeJSONMetric("Alloc", 1.5),
+		utils.NewCounterJSONMetric("PollCount", 3),
+	})
+	config := utils.ServerConfig{HashKey: "secret"}
+	config.Limits.MaxBatchSize = 3
+	router := GetRouter(db, config, nil, nil)
+
+	hash := utils.CalcHash("Alloc:gauge:2.500000", "secret")
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		statusCode int
+		errorCode  string
+		details    []APIErrorDetail
+	}{
+		{name: "openapi", method: http.MethodGet, target: "/api/v1/openapi.json", statusCode: http.StatusOK},
+		{name: "ping", method: http.MethodGet, target: "/api/v1/ping", statusCode: http.StatusOK},
+		{name: "dashboard", method: http.MethodGet, target: "/api/v1/dashboard", statusCode: http.StatusOK},
+		{name: "list", method: http.MethodGet, target: "/api/v1/metrics", statusCode: http.StatusOK},
+		{name: "get", method: http.MethodGet, target: "/api/v1/metrics/counter/PollCount", statusCode: http.StatusOK},
+		{name: "search", method: http.MethodGet, target: "/api/v1/metrics/search?type=gauge&sort=-name&limit=1", statusCode: http.StatusOK},
+		{name: "search invalid", method: http.MethodGet, target: "/api/v1/metrics/search?regex=(", statusCode: http.StatusBadRequest, errorCode: CodeInvalidQuery},
+		{name: "search bad limit", method: http.MethodGet, target: "/api/v1/metrics/search?limit=ten", statusCode: http.StatusBadRequest, errorCode: CodeInvalidQuery},
+		{name: "get not found", method: http.MethodGet, target: "/api/v1/metrics/gauge/Unknown", statusCode: http.StatusNotFound, errorCode: CodeNotFound},
+		{name: "get invalid type", method: http.MethodGet, target: "/api/v1/metrics/histogram/Alloc", statusCode: http.StatusBadRequest, errorCode: CodeInvalidType},
+		{name: "save", method: http.MethodPost, target: "/api/v1/metrics", body: `{"id":"Alloc","type":"gauge","value":2.5,"hash":"` + *hash + `"}`, statusCode: http.StatusOK},
+		{name: "save bad json", method: http.MethodPost, target: "/api/v1/metrics", body: `{"id":`, statusCode: http.StatusBadRequest, errorCode: CodeBadRequest},
+		{
+			name: "save invalid type", method: http.MethodPost, target: "/api/v1/metrics", body: `{"id":"Alloc","type":"histogram"}`,
+			statusCode: http.StatusBadRequest, errorCode: CodeInvalidMetric,
+			details: []APIErrorDetail{{Index: 0, ID: "Alloc", Code: CodeInvalidType, Message: utils.ErrMetricType.Error()}},
+		},
+		{name: "save batch", method: http.MethodPost, target: "/api/v1/metrics/batch", body: `[{"id":"PollCount","type":"counter","delta":2},{"id":"Sys","type":"gauge","value":1}]`, statusCode: http.StatusOK},
+		{
+			name: "save batch invalid", method: http.MethodPost, target: "/api/v1/metrics/batch",
+			body:       `[{"id":"Sys","type":"gauge","value":1},{"id":"PollCount","type":"counter"},{"id":"Alloc","type":"gauge","value":1,"hash":"bad"}]`,
+			statusCode: http.StatusBadRequest, errorCode: CodeInvalidMetric,
+			details: []APIErrorDetail{
+				{Index: 1, ID: "PollCount", Code: CodeInvalidValue, Message: utils.ErrMetricValue.Error()},
+				{Index: 2, ID: "Alloc", Code: CodeInvalidHash, Message: utils.ErrMetricHash.Error()},
+			},
+		},
+		{
+			name: "save batch partial", method: http.MethodPost, target: "/api/v1/metrics/batch?partial=true",
+			body: `[{"id":"Heap","type":"gauge","value":1},{"id":"PollCount","type":"counter"}]`, statusCode: http.StatusMultiStatus,
+		},
+		{name: "save batch too large", method: http.MethodPost, target: "/api/v1/metrics/batch", body: `[{},{},{},{}]`, statusCode: http.StatusRequestEntityTooLarge, errorCode: CodeBatchTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.statusCode, rec.Code, rec.Body.String())
+			checkAgainstOpenAPI(t, spec, req, rec)
+			if tt.errorCode == "" {
+				return
+			}
+			var envelope APIErrorResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &envelope))
+			assert.Equal(t, tt.errorCode, envelope.Error.Code)
+			assert.NotEmpty(t, envelope.Error.Message)
+			assert.Equal(t, tt.details, envelope.Error.Details)
+		})
+	}
+
+	metric, err := db.GetJSONMetric(context.Background(), "PollCount", "counter")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *metric.Delta)
+	_, err = db.GetJSONMetric(context.Background(), "Sys", "gauge")
+	require.NoError(t, err, "valid batch must be saved")
+	_, err = db.GetJSONMetric(context.Background(), "Heap", "gauge")
+	require.NoError(t, err, "valid metrics of partial batch must be saved")
+}
+
+func TestAPIMiddlewareErrors_OpenAPI(t *testing.T) {
+	spec := loadOpenAPI(t)
+	db := storage.NewStorage(&utils.StorageConfig{})
+	config := utils.ServerConfig{}
+	config.ReadPrefixes, _ = utils.ParsePrefixes("10.0.0.0/8")
+	config.Limits.RateLimit = 1
+	config.Limits.RateBurst = 1
+	router := GetRouter(db, config, nil, nil)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		statusCode int
+		errorCode  string
+	}{
+		{name: "forbidden", remoteAddr: "192.168.1.1:1234", statusCode: http.StatusForbidden, errorCode: CodeForbidden},
+		{name: "allowed", remoteAddr: "10.0.0.1:1234", statusCode: http.StatusOK},
+		{name: "rate limited", remoteAddr: "10.0.0.1:1234", statusCode: http.StatusTooManyRequests, errorCode: CodeRateLimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/metrics", nil)
+			req.RemoteAddr = tt.remoteAddr
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.statusCode, rec.Code)
+			checkAgainstOpenAPI(t, spec, req, rec)
+			if tt.errorCode != "" {
+				var envelope APIErrorResponse
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &envelope))
+				assert.Equal(t, tt.errorCode, envelope.Error.Code)
+			}
+		})
+	}
+
+	// legacy роуты по-прежнему возвращают ошибки текстом
+	req := httptest.NewRequest(http.MethodGet, "/value/gauge/Alloc", nil)
+	req.RemoteAddr = "192.168.1.2:1234"
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, "Forbidden\n", rec.Body.String())
+}
+
+func TestAPIAlertsHandler(t *testing.T) {
+	spec := loadOpenAPI(t)
+	rules, err := alert.NewRules([]utils.AlertRule{{Name: "high_alloc", Metric: "Alloc", Op: ">", Threshold: 1, For: "1h"}})
+	require.NoError(t, err)
+	engine := alert.NewEngine(rules, nil, 0)
+	defer engine.Close()
+	db := alert.NewStorage(storage.NewStorage(&utils.StorageConfig{}), engine)
+	router := GetRouter(db, utils.ServerConfig{}, nil, engine)
+
+	listAlerts := func() []alert.Alert {
+		request := httptest.NewRequest(http.MethodGet, APIPrefix+"/alerts", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		require.Equal(t, http.StatusOK, w.Code)
+		checkAgainstOpenAPI(t, spec, request, w)
+		var alerts []alert.Alert
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &alerts))
+		return alerts
+	}
+	assert.Empty(t, listAlerts())
+
+	request := httptest.NewRequest(http.MethodPost, APIPrefix+"/metrics", strings.NewReader(`{"id":"Alloc","type":"gauge","value":2}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	alerts := listAlerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "high_alloc/gauge:Alloc", alerts[0].Fingerprint)
+	assert.Equal(t, alert.StatePending, alerts[0].State)
+}
+
+func TestAPINotFound(t *testing.T) {
+	router := GetRouter(storage.NewStorage(&utils.StorageConfig{}), utils.ServerConfig{}, nil, nil)
+	for _, tt := range []struct {
+		method, target, code string
+		statusCode           int
+	}{
+		{http.MethodGet, "/api/v1/unknown", CodeNotFound, http.StatusNotFound},
+		{http.MethodDelete, "/api/v1/metrics", CodeNotAllowed, http.StatusMethodNotAllowed},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+		assert.Equal(t, tt.statusCode, rec.Code)
+		var envelope APIErrorResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &envelope))
+		assert.Equal(t, tt.code, envelope.Error.Code)
+	}
+}
+
+func TestAPISearchMetricsHandler(t *testing.T) {
+	db := storage.NewStorage(&utils.StorageConfig{})
+	_, _ = db.UpdateJSONMetrics(context.Background(), []utils.JSONMetric{
+		utils.NewGaugeJSONMetric("HeapAlloc", 1),
+		utils.NewGaugeJSONMetric("HeapSys", 2),
+		utils.NewGaugeJSONMetric("Alloc", 3),
+	})
+	router := GetRouter(db, utils.ServerConfig{}, nil, nil)
+
+	names := make([]string, 0)
+	target := "/api/v1/metrics/search?prefix=Heap&limit=1"
+	for pages := 0; pages < 3; pages++ {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var page storage.ListPage
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+		for _, m := range page.Metrics {
+			names = append(names, m.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		target = "/api/v1/metrics/search?prefix=Heap&limit=1&cursor=" + page.NextCursor
+	}
+	assert.Equal(t, []string{"HeapAlloc", "HeapSys"}, names)
+}
+
+func TestAPIDeleteMetricHandler(t *testing.T) {
+	spec := loadOpenAPI(t)
+	db := storage.NewStorage(&utils.StorageConfig{})
+	_, _ = db.UpdateJSONMetrics(context.Background(), []utils.JSONMetric{utils.NewGaugeJSONMetric("Alloc", 1.5)})
+	router := GetRouter(db, utils.ServerConfig{HashKey: "secret"}, nil, nil)
+
+	deleteMetric := func(url, hash string, stamp *utils.RequestStamp) int {
+		request := httptest.NewRequest(http.MethodDelete, APIPrefix+url, nil)
+		if hash != "" {
+			request.Header.Set(utils.BodyHashHeader, hash)
+		}
+		if stamp != nil {
+			request.Header.Set(utils.TimestampHeader, strconv.FormatInt(stamp.Timestamp, 10))
+			request.Header.Set(utils.NonceHeader, stamp.Nonce)
+			request.Header.Set(utils.SignatureHeader, stamp.Signature)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		checkAgainstOpenAPI(t, spec, request, w)
+		return w.Code
+	}
+	newStamp := func(mType, id string) *utils.RequestStamp {
+		return utils.NewRequestStamp(utils.DeletePayload(mType, id), "", "secret")
+	}
+	signed := *utils.CalcHash(string(utils.DeletePayload("gauge", "Alloc")), "secret")
+	other := *utils.CalcHash(string(utils.DeletePayload("gauge", "Other")), "secret")
+
+	assert.Equal(t, http.StatusUnauthorized, deleteMetric("/metrics/gauge/Alloc", "", newStamp("gauge", "Alloc")))
+	assert.Equal(t, http.StatusUnauthorized, deleteMetric("/metrics/gauge/Alloc", other, newStamp("gauge", "Alloc")))
+	assert.Equal(t, http.StatusBadRequest, deleteMetric("/metrics/histogram/Alloc", signed, newStamp("histogram", "Alloc")))
+	// удаление проверяется на повтор, даже если защита запросов на запись выключена
+	assert.Equal(t, http.StatusUnauthorized, deleteMetric("/metrics/gauge/Alloc", signed, nil))
+	assert.Equal(t, http.StatusUnauthorized, deleteMetric("/metrics/gauge/Alloc", signed, newStamp("gauge", "Other")))
+	stamp := newStamp("gauge", "Alloc")
+	assert.Equal(t, http.StatusNoContent, deleteMetric("/metrics/gauge/Alloc", signed, stamp))
+	_, _ = db.UpdateJSONMetrics(context.Background(), []utils.JSONMetric{utils.NewGaugeJSONMetric("Alloc", 2)})
+	assert.Equal(t, http.StatusUnauthorized, deleteMetric("/metrics/gauge/Alloc", signed, stamp))
+	assert.Equal(t, http.StatusNoContent, deleteMetric("/metrics/gauge/Alloc", signed, newStamp("gauge", "Alloc")))
+	assert.Equal(t, http.StatusNotFound, deleteMetric("/metrics/gauge/Alloc", signed, newStamp("gauge", "Alloc")))
+
+	_, err := db.GetJSONMetric(context.Background(), "Alloc", "gauge")
+	assert.Error(t, err)
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"net/http"
+	"net/netip"
+
+	"github.com/tiraill/go_collect_metrics/internal/audit"
+)
+
+// AuditSource - middleware сохраняет в контексте запроса источник изменения метрик для журнала.
+func AuditSource(proxies []netip.Prefix) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			client := r.RemoteAddr
+			if ip, err := ClientIP(r, proxies); err == nil {
+				client = ip.String()
+			}
+			ctx := audit.WithSource(r.Context(), audit.Source{Client: client, Transport: audit.TransportHTTP})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
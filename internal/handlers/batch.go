@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/tiraill/go_collect_metrics/internal/service"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// isPartialBatch - метод проверки, включен ли параметром partial режим частичной загрузки списка метрик.
+func isPartialBatch(r *http.Request) bool {
+	partial, _ := strconv.ParseBool(r.URL.Query().Get(utils.PartialParam))
+	return partial
+}
+
+// legacyErrorStatus - метод выбора кода ответа legacy роутов по ошибке слоя service.
+// коды совпадают с прежними: неизвестный тип метрики - 501, остальные ошибки метрик - 400,
+// ошибка хранилища - storageStatus. коды ошибок API /api/v1 задает serviceAPIError.
+func legacyErrorStatus(err error, storageStatus int) int {
+	switch {
+	case errors.Is(err, utils.ErrMetricType):
+		return http.StatusNotImplemented
+	case errors.Is(err, service.ErrStorage):
+		return storageStatus
+	default:
+		return http.StatusBadRequest
+	}
+}
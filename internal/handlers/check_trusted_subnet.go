@@ -1,24 +1,39 @@
 package handlers
 
 import (
-	"fmt"
 	"net/http"
 	"net/netip"
+
+	"github.com/tiraill/go_collect_metrics/internal/utils"
 )
 
+// ClientIP - метод определения адреса клиента.
+// заголовки X-Forwarded-For и X-Real-IP учитываются только для запросов от доверенных прокси.
+func ClientIP(r *http.Request, proxies []netip.Prefix) (netip.Addr, error) {
+	remote, err := utils.ParseRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return utils.ResolveClientIP(remote, r.Header.Get("X-Forwarded-For"), r.Header.Get("X-Real-IP"), proxies), nil
+}
+
 // CheckTrustedSubnet - middleware для проверки подсети.
-func CheckTrustedSubnet(subnet *netip.Prefix) func(next http.Handler) http.Handler {
+// если список подсетей пуст, проверка не выполняется.
+func CheckTrustedSubnet(allowed, proxies []netip.Prefix) func(next http.Handler) http.Handler {
 
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
-			fmt.Println("Real IP:", r.RemoteAddr)
-			ip, err := netip.ParseAddr(r.RemoteAddr)
+			if len(allowed) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ip, err := ClientIP(r, proxies)
 			if err != nil {
-				http.Error(w, "Forbidden", http.StatusForbidden)
+				writeError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
 				return
 			}
-			if !subnet.Contains(ip) {
-				http.Error(w, "Forbidden", http.StatusForbidden)
+			if !utils.ContainsAddr(allowed, ip) {
+				writeError(w, r, http.StatusForbidden, CodeForbidden, "Forbidden")
 				return
 			}
 			next.ServeHTTP(w, r)
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+func TestCheckTrustedSubnet(t *testing.T) {
+	config := utils.ServerConfig{
+		TrustedSubnet:  "192.168.1.0/24,2001:db8::/32",
+		TrustedRead:    "0.0.0.0/0",
+		TrustedProxies: "10.0.0.1",
+	}
+	config.WritePrefixes, _ = utils.ParsePrefixes(config.TrustedSubnet)
+	config.ReadPrefixes, _ = utils.ParsePrefixes(config.TrustedRead)
+	config.ProxyPrefixes, _ = utils.ParsePrefixes(config.TrustedProxies)
+	router := GetRouter(storage.NewStorage(&utils.StorageConfig{}), config, nil, nil)
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		remoteAddr string
+		headers    map[string]string
+		statusCode int
+	}{
+		{name: "write from trusted subnet", method: http.MethodPost, url: "/update/gauge/a/1", remoteAddr: "192.168.1.5:1234", statusCode: http.StatusOK},
+		{name: "write from trusted ipv6 subnet", method: http.MethodPost, url: "/update/gauge/a/1", remoteAddr: "[2001:db8::5]:1234", statusCode: http.StatusOK},
+		{name: "write from untrusted subnet", method: http.MethodPost, url: "/update/gauge/a/1", remoteAddr: "172.16.0.1:1234", statusCode: http.StatusForbidden},
+		{
+			name: "spoofed header from untrusted client", method: http.MethodPost, url: "/update/gauge/a/1", remoteAddr: "172.16.0.1:1234",
+			headers: map[string]string{"X-Real-IP": "192.168.1.5", "X-Forwarded-For": "192.168.1.5"}, statusCode: http.StatusForbidden,
+		},
+		{
+			name: "forwarded header from trusted proxy", method: http.MethodPost, url: "/update/gauge/a/1", remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-For": "192.168.1.5"}, statusCode: http.StatusOK,
+		},
+		{name: "read from any subnet", method: http.MethodGet, url: "/value/gauge/a", remoteAddr: "172.16.0.1:1234", statusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.url, nil)
+			request.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				request.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, request)
+			assert.Equal(t, tt.statusCode, w.Code)
+		})
+	}
+}
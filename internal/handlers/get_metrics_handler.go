@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// acceptsOpenMetrics - метод проверяет, запрошен ли формат OpenMetrics в заголовке Accept.
+func acceptsOpenMetrics(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if mediaType == "application/openmetrics-text" {
+			return true
+		}
+	}
+	return false
+}
+
+// PrometheusHandler - метод экспорта всех метрик в формате Prometheus
+// или OpenMetrics, если он запрошен в заголовке Accept.
+// GET /metrics.
+func PrometheusHandler(db storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		metrics, err := db.GetAllMetrics(ctx)
+		if err != nil {
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		openMetrics := acceptsOpenMetrics(r)
+		var buf bytes.Buffer
+		if err = utils.WritePrometheus(&buf, metrics, openMetrics); err != nil {
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		if openMetrics {
+			w.Header().Set("content-type", utils.OpenMetricsContentType)
+		} else {
+			w.Header().Set("content-type", utils.PrometheusContentType)
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf.Bytes())
+	}
+}
+
+// CheckBearerToken - middleware для проверки токена в заголовке Authorization.
+// если токен не задан, проверка не выполняется.
+func CheckBearerToken(token string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			actual := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(actual), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
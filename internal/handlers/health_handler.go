@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/tiraill/go_collect_metrics/internal/health"
+)
+
+// Пути проверок живости и готовности, они доступны из любых подсетей и не ограничиваются по частоте.
+const (
+	healthzPath = "/healthz"
+	readyzPath  = "/readyz"
+)
+
+// HealthzHandler - метод проверки живости процесса, хранилище не проверяется
+// GET /healthz.
+func HealthzHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	}
+}
+
+// ReadyzHandler - метод проверки готовности: сервер запущен и критичные компоненты работают,
+// хранилище инициализировано, восстановлено из файла и схема базы данных создана
+// GET /readyz.
+func ReadyzHandler(checker *health.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := checker.Ready(r.Context())
+		statusCode := http.StatusOK
+		if !report.Ready {
+			statusCode = http.StatusServiceUnavailable
+		}
+		writeJSON(w, statusCode, report)
+	}
+}
+
+// HealthHandler - метод получения подробного отчета о здоровье всех компонентов
+// GET /health.
+func HealthHandler(checker *health.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := checker.Report(r.Context())
+		statusCode := http.StatusOK
+		if report.Status == health.StatusDown {
+			statusCode = http.StatusServiceUnavailable
+		}
+		writeJSON(w, statusCode, report)
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tiraill/go_collect_metrics/internal/health"
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+func TestHealthHandlers(t *testing.T) {
+	db := storage.NewStorage(&utils.StorageConfig{})
+	// пробы доступны из любых подсетей, подробный отчет - только из подсетей чтения
+	config := utils.ServerConfig{TrustedRead: "10.0.0.0/8"}
+	require.NoError(t, config.ParseSubnets())
+	r := GetRouter(db, config, nil, nil)
+
+	get := func(path string) (*httptest.ResponseRecorder, health.Report) {
+		return getFrom(t, r, path, "192.168.1.1:1234")
+	}
+
+	w, _ := get("/healthz")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", w.Body.String())
+
+	// хранилище еще не инициализировано
+	w, report := get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.False(t, report.Ready)
+
+	require.Error(t, db.Init(context.Background()))
+	w, report = get("/readyz")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, report.Ready)
+	require.Len(t, report.Components, 1)
+	assert.Equal(t, "storage", report.Components[0].Name)
+
+	w, _ = get("/health")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w, report = getFrom(t, r, "/health", "10.1.1.1:1234")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, health.StatusOK, report.Status)
+	require.Len(t, report.Components, 1)
+	assert.Equal(t, "memory", report.Components[0].Details.(map[string]any)["backend"])
+}
+
+func getFrom(t *testing.T, r http.Handler, path, remoteAddr string) (*httptest.ResponseRecorder, health.Report) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = remoteAddr
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var report health.Report
+	if w.Header().Get("content-type") == "application/json" {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	}
+	return w, report
+}
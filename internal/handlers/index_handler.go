@@ -1,69 +1,73 @@
 package handlers
 
 import (
-	"html/template"
+	"embed"
+	"io/fs"
 	"net/http"
+	"time"
 
-	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/service"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
 )
 
-var pageTemp = `<!DOCTYPE html>
-<html>
-  <head>
-    <title>Metrics</title>
-  </head>
-  <body>
-    <p>
-      List of metrics.
-    </p>
-    <table>
-      	<tr>
-          <td>Name</td>
-          <td>Value</td>
-    	</tr>
-      	{{ with .Metrics }}
-			{{ range . }}
-      			<tr>
-              		<td>{{ .Name }}</td>
-              		<td>{{ .Value }}</td>
-      			</tr>
-			{{ end }} 
-      	{{ end }}
-    </table>
-  </body>
-</html>`
+// uiFiles - статические файлы панели метрик.
+//
+//go:embed ui
+var uiFiles embed.FS
 
-// MetricData - структура для данных метрики
-type MetricData struct {
-	Name  string
-	Value string
+// indexPage - главная страница панели метрик.
+var indexPage, _ = uiFiles.ReadFile("ui/index.html")
+
+// IndexHandler - метод для получения HTML страницы панели метрик.
+// данные страница загружает из GET /api/v1/dashboard.
+// GET /.
+func IndexHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		w.Write(indexPage)
+	}
 }
 
-// TemplateData - структура для шаблона данных с метриками
-type TemplateData struct {
-	Metrics []MetricData
+// UIHandler - метод для получения статических файлов панели метрик.
+// GET /ui/*.
+func UIHandler() http.Handler {
+	static, _ := fs.Sub(uiFiles, "ui")
+	return http.StripPrefix("/ui/", http.FileServer(http.FS(static)))
 }
 
-// IndexHandler - метод для получения HTML страницы со списком всех метрик
-// GET /.
-func IndexHandler(db storage.Storage) http.HandlerFunc {
+// DashboardMetric - метрика с временем последнего изменения.
+type DashboardMetric struct {
+	utils.JSONMetric
+	UpdatedAt *time.Time `json:"updated_at,omitempty"` // отсутствует, если метрика не менялась с момента запуска сервера
+}
+
+// DashboardResponse - данные панели метрик.
+type DashboardResponse struct {
+	GeneratedAt time.Time         `json:"generated_at"` // время сервера, относительно которого считается давность изменения
+	Metrics     []DashboardMetric `json:"metrics"`
+}
+
+// APIDashboardHandler - метод получения данных панели метрик.
+// GET /api/v1/dashboard.
+func APIDashboardHandler(svc *service.Service) http.HandlerFunc {
+	db := svc.Storage()
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		data := TemplateData{Metrics: make([]MetricData, 0)}
-		metrics, err := db.GetAllMetrics(ctx)
+		metrics, err := svc.List(r.Context())
 		if err != nil {
-			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			writeServiceError(w, err)
 			return
 		}
+		response := DashboardResponse{GeneratedAt: time.Now().UTC(), Metrics: make([]DashboardMetric, 0, len(metrics))}
 		for _, metric := range metrics {
-			data.Metrics = append(data.Metrics, MetricData{Name: metric.ID, Value: metric.ValueString()})
-		}
-		w.Header().Set("content-type", "text/html")
-		fpT, _ := template.New("metrics").Parse(pageTemp)
-		err = fpT.Execute(w, data)
-		if err != nil {
-			http.Error(w, "Something went wrong", http.StatusInternalServerError)
-			return
+			item := DashboardMetric{JSONMetric: metric}
+			if updated, ok := db.UpdatedAt(metric.MType, metric.ID); ok {
+				updated = updated.UTC()
+				item.UpdatedAt = &updated
+			}
+			response.Metrics = append(response.Metrics, item)
 		}
+		writeJSON(w, http.StatusOK, response)
 	}
 }
@@ -3,9 +3,11 @@ package handlers
 import (
 	"compress/gzip"
 	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -15,145 +17,107 @@ import (
 	"github.com/tiraill/go_collect_metrics/internal/utils"
 )
 
-var emptyPage = `<!DOCTYPE html>
-<html>
-  <head>
-    <title>Metrics</title>
-  </head>
-  <body>
-    <p>
-      List of metrics.
-    </p>
-    <table>
-      	<tr>
-          <td>Name</td>
-          <td>Value</td>
-    	</tr>
-      	
-    </table>
-  </body>
-</html>`
-
-var fillPage = `<!DOCTYPE html>
-<html>
-  <head>
-    <title>Metrics</title>
-  </head>
-  <body>
-    <p>
-      List of metrics.
-    </p>
-    <table>
-      	<tr>
-          <td>Name</td>
-          <td>Value</td>
-    	</tr>
-      	
-			
-      			<tr>
-              		<td>Alloc</td>
-              		<td>111.222</td>
-      			</tr>
-			
-      			<tr>
-              		<td>PollCount</td>
-              		<td>333</td>
-      			</tr>
-			 
-      	
-    </table>
-  </body>
-</html>`
-
 func TestGetIndexMetricHandler(t *testing.T) {
-	type want struct {
-		statusCode int
-		message    string
-	}
-	testStorage := storage.NewStorage(&utils.StorageConfig{})
-	_, _ = testStorage.UpdateJSONMetrics(context.Background(), []utils.JSONMetric{
-		utils.NewGaugeJSONMetric("Alloc", 111.222),
-		utils.NewCounterJSONMetric("PollCount", 333),
-	})
+	r := GetRouter(storage.NewStorage(&utils.StorageConfig{}), utils.ServerConfig{Address: "adr", HashKey: "key"}, nil, nil)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
 
-	tests := []struct {
-		name string
-		db   storage.Storage
-		want want
-	}{
-		{
-			name: "check 200 empty metrics",
-			db:   storage.NewStorage(&utils.StorageConfig{}),
-			want: want{
-				statusCode: 200,
-				message:    emptyPage,
-			},
-		},
-		{
-			name: "check 200 fill some metrics",
-			db:   testStorage,
-			want: want{
-				statusCode: 200,
-				message:    fillPage,
-			},
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			r := GetRouter(tt.db, utils.ServerConfig{Address: "adr", HashKey: "key"}, nil)
-			ts := httptest.NewServer(r)
-			defer ts.Close()
+	result, err := http.Get(ts.URL)
+	require.NoError(t, err)
+	assert.Equal(t, 200, result.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", result.Header.Get("Content-Type"))
+
+	resBody, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	require.NoError(t, result.Body.Close())
 
-			client := &http.Client{}
+	assert.Equal(t, string(indexPage), string(resBody))
+	assert.Contains(t, string(resBody), `<script src="/ui/app.js"></script>`)
+}
 
-			result, err := client.Get(ts.URL)
-			require.NoError(t, err)
-			assert.Equal(t, tt.want.statusCode, result.StatusCode)
+func TestGetCompressedPage(t *testing.T) {
+	r := GetRouter(storage.NewStorage(&utils.StorageConfig{}), utils.ServerConfig{}, nil, nil)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
 
-			resBody, err := io.ReadAll(result.Body)
+	static := map[string]string{
+		"/":             "text/html; charset=utf-8",
+		"/ui/app.js":    "text/javascript; charset=utf-8",
+		"/ui/style.css": "text/css; charset=utf-8",
+	}
+	for target, contentType := range static {
+		t.Run(target, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, ts.URL+target, nil)
 			require.NoError(t, err)
+			req.Header.Set("Accept-Encoding", "gzip")
 
-			err = result.Body.Close()
+			result, err := http.DefaultClient.Do(req)
 			require.NoError(t, err)
+			assert.Equal(t, 200, result.StatusCode)
+			assert.Equal(t, "gzip", result.Header.Get("Content-Encoding"))
+			assert.Equal(t, contentType, result.Header.Get("Content-Type"))
 
-			assert.Equal(t, tt.want.message, string(resBody))
+			gzipReader, err := gzip.NewReader(result.Body)
+			require.NoError(t, err)
+			resBody, err := io.ReadAll(gzipReader)
+			require.NoError(t, err)
+			require.NoError(t, result.Body.Close())
+			require.NoError(t, gzipReader.Close())
+
+			name := strings.TrimPrefix(target, "/ui/")
+			if target == "/" {
+				name = "index.html"
+			}
+			expected, err := uiFiles.ReadFile("ui/" + name)
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), string(resBody))
 		})
 	}
 }
 
-func TestGetCompressedPage(t *testing.T) {
+func TestIndexTrustedSubnet(t *testing.T) {
+	config := utils.ServerConfig{}
+	config.ReadPrefixes, _ = utils.ParsePrefixes("10.0.0.0/8")
+	r := GetRouter(storage.NewStorage(&utils.StorageConfig{}), config, nil, nil)
+
+	for _, target := range []string{"/", "/ui/app.js", "/api/v1/dashboard"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.RemoteAddr = "192.168.0.1:1234"
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusForbidden, rec.Code, target)
+
+		req.RemoteAddr = "10.1.2.3:1234"
+		rec = httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code, target)
+	}
+}
 
-	testStorage := storage.NewStorage(&utils.StorageConfig{})
-	_, _ = testStorage.UpdateJSONMetrics(context.Background(), []utils.JSONMetric{
+func TestAPIDashboardHandler(t *testing.T) {
+	db := storage.NewStorage(&utils.StorageConfig{})
+	_, _ = db.UpdateJSONMetrics(context.Background(), []utils.JSONMetric{
 		utils.NewGaugeJSONMetric("Alloc", 111.222),
-		utils.NewCounterJSONMetric("PollCount", 333),
 	})
-
-	r := GetRouter(testStorage, utils.ServerConfig{}, nil)
-	ts := httptest.NewServer(r)
-	defer ts.Close()
-
-	client := &http.Client{}
-	req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
-	require.NoError(t, err)
-	req.Header.Set("Accept-Encoding", "gzip")
-
-	result, err := client.Do(req)
-	require.NoError(t, err)
-	assert.Equal(t, 200, result.StatusCode)
-	assert.Equal(t, "gzip", result.Header.Get("Content-Encoding"))
-	assert.Equal(t, "225", result.Header.Get("Content-Length"))
-
-	gzipReader, err := gzip.NewReader(result.Body)
-	require.NoError(t, err)
-
-	resBody, err := io.ReadAll(gzipReader)
-	require.NoError(t, err)
-
-	err = result.Body.Close()
-	require.NoError(t, err)
-	err = gzipReader.Close()
-	require.NoError(t, err)
-
-	assert.Equal(t, fillPage, string(resBody))
+	r := GetRouter(db, utils.ServerConfig{}, nil, nil)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/update/counter/PollCount/3", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/dashboard", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var data DashboardResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &data))
+	assert.False(t, data.GeneratedAt.IsZero())
+	require.Len(t, data.Metrics, 2)
+
+	assert.Equal(t, "Alloc", data.Metrics[0].ID)
+	assert.Nil(t, data.Metrics[0].UpdatedAt, "metric updated before start has no known update time")
+	assert.Equal(t, "PollCount", data.Metrics[1].ID)
+	assert.Equal(t, int64(3), *data.Metrics[1].Delta)
+	require.NotNil(t, data.Metrics[1].UpdatedAt)
+	assert.False(t, data.Metrics[1].UpdatedAt.After(data.GeneratedAt))
 }
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/tiraill/go_collect_metrics/internal/telemetry"
+)
+
+// Instrument - middleware для сбора внутренних метрик HTTP запросов.
+// запросы группируются по шаблону роута chi, чтобы значения параметров не порождали новые серии.
+func Instrument(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		inFlight := telemetry.HTTPInFlight.With()
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		code := ww.Status()
+		if code == 0 {
+			code = http.StatusOK
+		}
+		telemetry.HTTPRequests.With(route, r.Method, strconv.Itoa(code)).Inc()
+		telemetry.HTTPDuration.With(route, r.Method).Observe(telemetry.Since(start))
+	}
+
+	return http.HandlerFunc(fn)
+}
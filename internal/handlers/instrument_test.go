@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/telemetry"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+func TestInstrument(t *testing.T) {
+	db := storage.NewStorage(&utils.StorageConfig{})
+	router := GetRouter(db, utils.ServerConfig{}, nil, nil)
+
+	route := "/update/{mType}/{mName}/{mValue}"
+	ok := telemetry.HTTPRequests.With(route, http.MethodPost, "200")
+	notImplemented := telemetry.HTTPRequests.With(route, http.MethodPost, "501")
+	unmatched := telemetry.HTTPRequests.With("unmatched", http.MethodGet, "404")
+	typeErrors := telemetry.ValidationErrors.With("http", "type")
+	valueErrors := telemetry.ValidationErrors.With("http", "value")
+	okBefore, niBefore, unBefore := ok.Value(), notImplemented.Value(), unmatched.Value()
+	typeBefore, valueBefore := typeErrors.Value(), valueErrors.Value()
+	durationBefore := telemetry.HTTPDuration.With(route, http.MethodPost).Count()
+
+	for _, target := range []string{"/update/gauge/Alloc/1.5", "/update/counter/Poll/1", "/update/unknown/Alloc/1", "/update/gauge/Alloc/none"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, nil))
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing/path", nil))
+
+	assert.Equal(t, float64(2), ok.Value()-okBefore)
+	assert.Equal(t, float64(1), notImplemented.Value()-niBefore)
+	assert.Equal(t, float64(1), unmatched.Value()-unBefore)
+	assert.Equal(t, float64(1), typeErrors.Value()-typeBefore)
+	assert.Equal(t, float64(1), valueErrors.Value()-valueBefore)
+	assert.Equal(t, uint64(4), telemetry.HTTPDuration.With(route, http.MethodPost).Count()-durationBefore)
+	assert.Equal(t, float64(0), telemetry.HTTPInFlight.With().Value())
+}
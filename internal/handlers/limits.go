@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// ErrBodyTooLarge ошибка превышения допустимого размера тела запроса.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// ErrBatchTooLarge ошибка превышения допустимого количества метрик в запросе.
+var ErrBatchTooLarge = errors.New("too many metrics in request")
+
+type limitsKey struct{}
+
+// requestLimits - метод получения ограничений запроса из контекста.
+func requestLimits(r *http.Request) utils.LimitsConfig {
+	limits, _ := r.Context().Value(limitsKey{}).(utils.LimitsConfig)
+	return limits
+}
+
+// LimitRequest - middleware для ограничения размера тела запроса.
+// размер сжатого тела ограничивается сразу, ограничения на распакованное тело
+// и количество метрик передаются обработчикам через контекст.
+func LimitRequest(limits utils.LimitsConfig) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if limits.MaxBodySize > 0 {
+				if r.ContentLength > int64(limits.MaxBodySize) {
+					writeError(w, r, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, ErrBodyTooLarge.Error())
+					return
+				}
+				r.Body = http.MaxBytesReader(w, r.Body, int64(limits.MaxBodySize))
+			}
+			ctx := context.WithValue(r.Context(), limitsKey{}, limits)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// ErrRateLimited ошибка превышения частоты запросов клиента.
+var ErrRateLimited = errors.New("too many requests")
+
+// clientKey - метод определения клиента по адресу с учетом доверенных прокси.
+func clientKey(r *http.Request, proxies []netip.Prefix) string {
+	if ip, err := ClientIP(r, proxies); err == nil {
+		return ip.String()
+	}
+	return r.RemoteAddr
+}
+
+// isStampedRequest - метод проверки, что запрос агента направлен обработчику, который проверяет подпись CheckRequestStamp.
+func isStampedRequest(r *http.Request) bool {
+	if r.Header.Get(utils.AgentIDHeader) == "" {
+		return false
+	}
+	switch r.Method {
+	case http.MethodPost:
+		switch r.URL.Path {
+		case "/update/", "/updates/", APIPrefix + "/metrics", APIPrefix + "/metrics/batch":
+			return true
+		}
+	case http.MethodDelete:
+		return strings.HasPrefix(r.URL.Path, APIPrefix+"/metrics/")
+	}
+	return false
+}
+
+type rateLimitGateKey struct{}
+
+// rateLimitGate - ограничение частоты запроса агента, отложенное до проверки подписи.
+type rateLimitGate struct {
+	limiter *utils.RateLimiter
+	w       http.ResponseWriter
+	ip      string // клиент по адресу
+	done    bool
+}
+
+// allow - метод учета запроса клиента key, при превышении лимита записывает заголовок Retry-After.
+func (g *rateLimitGate) allow(key string) bool {
+	g.done = true
+	ok, wait := g.limiter.Allow(key)
+	if !ok {
+		g.w.Header().Set("Retry-After", strconv.Itoa(utils.RetryAfterSeconds(wait)))
+	}
+	return ok
+}
+
+// allowStamped - метод учета запроса после проверки подписи, если ограничение частоты было отложено.
+// агент, подпись которого прошла проверку, получает свой bucket, даже если за одним адресом несколько агентов,
+// иначе запрос учитывается по адресу.
+func allowStamped(r *http.Request, stamp utils.RequestStamp, verified bool) bool {
+	gate, ok := r.Context().Value(rateLimitGateKey{}).(*rateLimitGate)
+	if !ok || gate.done {
+		return true
+	}
+	if verified && stamp.AgentID != "" {
+		return gate.allow("agent:" + stamp.AgentID)
+	}
+	return gate.allow(gate.ip)
+}
+
+// RateLimit - middleware для ограничения частоты запросов от одного клиента.
+// клиент определяется по адресу с учетом доверенных прокси. если stamped, для запросов агента
+// к обработчикам, проверяющим подпись, ограничение откладывается до CheckRequestStamp, чтобы учитывать
+// идентификатор агента только из проверенной подписи. запрос, не дошедший до проверки подписи, учитывается по адресу.
+func RateLimit(limiter *utils.RateLimiter, proxies []netip.Prefix, stamped bool) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			key := clientKey(r, proxies)
+			if stamped && isStampedRequest(r) {
+				gate := &rateLimitGate{limiter: limiter, w: w, ip: key}
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), rateLimitGateKey{}, gate)))
+				if !gate.done {
+					limiter.Allow(key)
+				}
+				return
+			}
+			ok, wait := limiter.Allow(key)
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(utils.RetryAfterSeconds(wait)))
+				writeError(w, r, http.StatusTooManyRequests, CodeRateLimited, "Too Many Requests")
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// bodyErrorStatus - метод определения статус кода для ошибки чтения тела запроса.
+func bodyErrorStatus(err error) int {
+	var maxBytesError *http.MaxBytesError
+	if errors.Is(err, ErrBodyTooLarge) || errors.As(err, &maxBytesError) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+func gzipBody(data []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(data)
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestLimitRequest(t *testing.T) {
+	config := utils.ServerConfig{Limits: utils.LimitsConfig{MaxBodySize: 1024, MaxDecompressedSize: 2048, MaxBatchSize: 2}}
+	router := GetRouter(storage.NewStorage(&utils.StorageConfig{}), config, nil, nil)
+	metric := `{"id":"a","type":"gauge","value":1}`
+
+	tests := []struct {
+		name       string
+		body       []byte
+		gzip       bool
+		statusCode int
+	}{
+		{name: "small batch", body: []byte("[" + metric + "]"), statusCode: http.StatusOK},
+		{name: "too many metrics", body: []byte("[" + strings.Repeat(metric+",", 2) + metric + "]"), statusCode: http.StatusRequestEntityTooLarge},
+		{name: "body too large", body: bytes.Repeat([]byte(" "), 2048), statusCode: http.StatusRequestEntityTooLarge},
+		{name: "decompression bomb", body: gzipBody(bytes.Repeat([]byte(" "), 1<<20)), gzip: true, statusCode: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewBuffer(tt.body))
+			if tt.gzip {
+				request.Header.Set("Content-Encoding", "gzip")
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, request)
+			assert.Equal(t, tt.statusCode, w.Code)
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	config := utils.ServerConfig{Limits: utils.LimitsConfig{RateLimit: 0.1, RateBurst: 2}}
+	router := GetRouter(storage.NewStorage(&utils.StorageConfig{}), config, nil, nil)
+	send := func(remoteAddr string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/update/gauge/a/1", nil)
+		request.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w
+	}
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:1000").Code)
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:1001").Code)
+	w := send("10.0.0.1:1002")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "10", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, send("10.0.0.2:1000").Code)
+}
+
+func TestRateLimit_AgentID(t *testing.T) {
+	config := utils.ServerConfig{HashKey: "key", ReplayWindow: time.Minute, Limits: utils.LimitsConfig{RateLimit: 0.1, RateBurst: 1}}
+	router := GetRouter(storage.NewStorage(&utils.StorageConfig{}), config, nil, nil)
+	body := []byte(`[{"id":"a","type":"gauge","value":1}]`)
+	send := func(id, hashKey string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewBuffer(body))
+		request.RemoteAddr = "10.0.0.1:1000"
+		request.Header.Set(utils.BodyHashHeader, *utils.CalcHash(string(body), "key"))
+		request.Header.Set(utils.AgentIDHeader, id)
+		if stamp := utils.NewRequestStamp(body, id, hashKey); stamp != nil {
+			request.Header.Set(utils.TimestampHeader, strconv.FormatInt(stamp.Timestamp, 10))
+			request.Header.Set(utils.NonceHeader, stamp.Nonce)
+			request.Header.Set(utils.SignatureHeader, stamp.Signature)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w
+	}
+	// агенты за одним адресом с проверенной подписью ограничиваются отдельно
+	assert.Equal(t, http.StatusOK, send("host-1", "key").Code)
+	assert.Equal(t, http.StatusOK, send("host-2", "key").Code)
+	w := send("host-1", "key")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "10", w.Header().Get("Retry-After"))
+	// идентификатор без подписи или с неверной подписью не учитывается, запрос ограничивается по адресу
+	assert.Equal(t, http.StatusUnauthorized, send("host-3", "other").Code)
+	assert.Equal(t, http.StatusTooManyRequests, send("host-4", "").Code)
+	// запрос, не дошедший до проверки подписи, тоже учитывается по адресу
+	request := httptest.NewRequest(http.MethodGet, "/value/gauge/a", nil)
+	request.RemoteAddr = "10.0.0.1:1000"
+	request.Header.Set(utils.AgentIDHeader, "host-5")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec - описание версионированного API в формате OpenAPI.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// OpenAPIHandler - метод получения описания версионированного API.
+// GET /api/v1/openapi.json.
+func OpenAPIHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(openAPISpec)
+	}
+}
@@ -5,7 +5,9 @@ import (
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/tiraill/go_collect_metrics/internal/audit"
 	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/telemetry"
 	"github.com/tiraill/go_collect_metrics/internal/utils"
 )
 
@@ -19,6 +21,7 @@ func SaveMetricHandler(db storage.Storage) http.HandlerFunc {
 		mValue := chi.URLParam(r, "mValue")
 		metric, err := utils.NewJSONMetric(mType, mName, mValue)
 		if err != nil {
+			telemetry.ObserveValidationError(audit.TransportHTTP, err)
 			switch err {
 			case utils.ErrMetricType:
 				http.Error(w, err.Error(), http.StatusNotImplemented)
@@ -98,7 +98,7 @@ func TestSaveMetricHandler(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			r := GetRouter(tt.db, utils.ServerConfig{}, nil)
+			r := GetRouter(tt.db, utils.ServerConfig{}, nil, nil)
 			ts := httptest.NewServer(r)
 			defer ts.Close()
 
@@ -4,45 +4,35 @@ import (
 	"encoding/json"
 	"net/http"
 
-	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/service"
 	"github.com/tiraill/go_collect_metrics/internal/utils"
 )
 
 // SaveJSONMetricHandler - метод для загрузки метрики в формате JSON.
 // POST /update/
-func SaveJSONMetricHandler(db storage.Storage, hashKey string, privateKey *utils.PrivateKey) http.HandlerFunc {
+func SaveJSONMetricHandler(svc *service.Service, privateKey *utils.PrivateKey, guard *utils.ReplayGuard) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		body, err := ReadEncryptedBody(r, privateKey)
+		hashKey := svc.HashKey()
+		body, err := ReadEncryptedBody(r, privateKey, hashKey)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			http.Error(w, err.Error(), bodyErrorStatus(err))
 			return
 		}
-		metric, err := utils.LoadJSONMetric(body)
+		err = CheckRequestStamp(r, body, guard, hashKey)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			http.Error(w, err.Error(), stampErrorStatus(err))
 			return
 		}
-		err = metric.ValidatesAll(hashKey)
+		metric, err := utils.LoadJSONMetric(body)
 		if err != nil {
-			switch err {
-			case utils.ErrMetricHash:
-				http.Error(w, err.Error(), http.StatusBadRequest)
-			case utils.ErrMetricType:
-				http.Error(w, err.Error(), http.StatusNotImplemented)
-			case utils.ErrMetricValue:
-				http.Error(w, err.Error(), http.StatusBadRequest)
-			default:
-				http.Error(w, err.Error(), http.StatusBadRequest)
-			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		metric, err = db.UpdateJSONMetric(ctx, metric)
+		metric, err = svc.Save(r.Context(), metric, !IsSignedRequest(r, hashKey))
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), legacyErrorStatus(err, http.StatusInternalServerError))
 			return
 		}
-		metric.Hash = utils.CalcHash(metric.String(), hashKey)
 		w.Header().Set("content-type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		rest, _ := json.Marshal(metric)
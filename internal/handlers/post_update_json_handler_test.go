@@ -144,7 +144,7 @@ func TestSaveJsonMetricHandler(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			r := GetRouter(tt.db, utils.ServerConfig{Address: "adr", HashKey: "key"}, nil)
+			r := GetRouter(tt.db, utils.ServerConfig{Address: "adr", HashKey: "key"}, nil, nil)
 			ts := httptest.NewServer(r)
 			defer ts.Close()
 
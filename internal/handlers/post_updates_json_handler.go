@@ -2,61 +2,70 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 
-	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+
+	"github.com/tiraill/go_collect_metrics/internal/logger"
+	"github.com/tiraill/go_collect_metrics/internal/service"
+	"github.com/tiraill/go_collect_metrics/internal/tracing"
 	"github.com/tiraill/go_collect_metrics/internal/utils"
 )
 
 // SaveBatchJSONMetricHandler - метод для загрузки списка метрик в формате JSON.
+// с параметром partial=true валидные метрики сохраняются, а ответ 207 содержит результат каждой метрики.
 // POST /updates/
-func SaveBatchJSONMetricHandler(db storage.Storage, hashKey string, privateKey *utils.PrivateKey) http.HandlerFunc {
+func SaveBatchJSONMetricHandler(svc *service.Service, privateKey *utils.PrivateKey, guard *utils.ReplayGuard) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		body, err := ReadEncryptedBody(r, privateKey)
+		hashKey := svc.HashKey()
+		body, err := ReadEncryptedBody(r, privateKey, hashKey)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			http.Error(w, err.Error(), bodyErrorStatus(err))
+			return
+		}
+		err = CheckRequestStamp(r, body, guard, hashKey)
+		if err != nil {
+			http.Error(w, err.Error(), stampErrorStatus(err))
 			return
 		}
-		log.Printf("updates request: %s\n", string(body))
+		debugBody(r, "updates request", body)
 
+		_, span := tracing.Start(r.Context(), "decode", attribute.Int("size", len(body)))
 		metrics, err := utils.LoadButchJSONMetric(body)
+		tracing.End(span, err)
 		if err != nil {
-			log.Printf("error LoadButchJSONMetric: %s\n", err)
+			logger.Ctx(r.Context(), "http").Warn("invalid updates request", zap.Error(err))
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		for _, metric := range metrics {
-			err = metric.ValidatesAll(hashKey)
+		if maxBatch := requestLimits(r).MaxBatchSize; maxBatch > 0 && len(metrics) > maxBatch {
+			http.Error(w, ErrBatchTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		checkHash := !IsSignedRequest(r, hashKey)
+		if isPartialBatch(r) {
+			response, err := svc.SavePartial(r.Context(), metrics, checkHash)
 			if err != nil {
-				log.Printf("error Validate metric %s: %s", metric.ID, err)
-				switch err {
-				case utils.ErrMetricHash:
-					http.Error(w, err.Error(), http.StatusBadRequest)
-				case utils.ErrMetricType:
-					http.Error(w, err.Error(), http.StatusNotImplemented)
-				case utils.ErrMetricValue:
-					http.Error(w, err.Error(), http.StatusBadRequest)
-				default:
-					http.Error(w, err.Error(), http.StatusBadRequest)
-				}
+				logger.Ctx(r.Context(), "http").Warn("failed to save metrics", zap.Error(err))
+				http.Error(w, err.Error(), legacyErrorStatus(err, http.StatusBadRequest))
 				return
 			}
+			logger.Ctx(r.Context(), "http").Debug("updates partial response",
+				zap.Int("applied", response.Applied), zap.Int("failed", response.Failed))
+			writeJSON(w, http.StatusMultiStatus, response)
+			return
 		}
-		metrics, err = db.UpdateJSONMetrics(ctx, metrics)
+		metrics, err = svc.SaveBatch(r.Context(), metrics, checkHash)
 		if err != nil {
-			log.Printf("error UpdateJSONMetrics: %s", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			logger.Ctx(r.Context(), "http").Warn("failed to save metrics", zap.Error(err))
+			http.Error(w, err.Error(), legacyErrorStatus(err, http.StatusBadRequest))
 			return
 		}
-		for i, metric := range metrics {
-			metrics[i].Hash = utils.CalcHash(metric.String(), hashKey)
-		}
 		w.Header().Set("content-type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		resp, _ := json.Marshal(metrics)
-		log.Printf("updates response: %s\n", string(resp))
+		debugBody(r, "updates response", resp)
 		w.Write(resp)
 	}
 }
@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -82,7 +85,7 @@ func TestSaveBatchJSONMetricHandler(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			r := GetRouter(tt.db, utils.ServerConfig{Address: "adr", HashKey: tt.hashKey}, nil)
+			r := GetRouter(tt.db, utils.ServerConfig{Address: "adr", HashKey: tt.hashKey}, nil, nil)
 			ts := httptest.NewServer(r)
 			defer ts.Close()
 
@@ -108,3 +111,151 @@ func TestSaveBatchJSONMetricHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestSaveBatchJSONMetricHandler_Replay(t *testing.T) {
+	db := storage.NewStorage(&utils.StorageConfig{})
+	config := utils.ServerConfig{HashKey: "key", ReplayWindow: time.Minute, NonceCacheSize: 1}
+	ts := httptest.NewServer(GetRouter(db, config, nil, nil))
+	defer ts.Close()
+
+	body := []byte(`[{"id":"PollCount","type":"counter","delta":1}]`)
+	stamp := utils.NewRequestStamp(body, "", "key")
+	send := func(withStamp bool) int {
+		request, _ := http.NewRequest(http.MethodPost, ts.URL+"/updates/", bytes.NewBuffer(body))
+		if withStamp {
+			request.Header.Set(utils.TimestampHeader, strconv.FormatInt(stamp.Timestamp, 10))
+			request.Header.Set(utils.NonceHeader, stamp.Nonce)
+			request.Header.Set(utils.SignatureHeader, stamp.Signature)
+		}
+		result, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		require.NoError(t, result.Body.Close())
+		return result.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, send(false))
+	assert.Equal(t, http.StatusOK, send(true))
+	assert.Equal(t, http.StatusUnauthorized, send(true))
+	// кэш nonce заполнен действующими значениями, новый запрос не принимается
+	stamp = utils.NewRequestStamp(body, "", "key")
+	assert.Equal(t, http.StatusServiceUnavailable, send(true))
+
+	metric, err := db.GetJSONMetric(context.Background(), "PollCount", "counter")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), *metric.Delta)
+}
+
+func TestSaveBatchJSONMetricHandler_BodyHash(t *testing.T) {
+	config := utils.ServerConfig{HashKey: "key"}
+	ts := httptest.NewServer(GetRouter(storage.NewStorage(&utils.StorageConfig{}), config, nil, nil))
+	defer ts.Close()
+
+	body := []byte(`[{"id":"PollCount","type":"counter","delta":1,"hash":"bad"}]`)
+	tests := []struct {
+		name       string
+		bodyHash   string
+		statusCode int
+	}{
+		{name: "per-metric hash checked without body hash", bodyHash: "", statusCode: http.StatusBadRequest},
+		{name: "invalid body hash", bodyHash: "bad", statusCode: http.StatusBadRequest},
+		{name: "valid body hash", bodyHash: *utils.CalcHash(string(body), "key"), statusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, _ := http.NewRequest(http.MethodPost, ts.URL+"/updates/", bytes.NewBuffer(body))
+			if tt.bodyHash != "" {
+				request.Header.Set(utils.BodyHashHeader, tt.bodyHash)
+			}
+			result, err := http.DefaultClient.Do(request)
+			require.NoError(t, err)
+			resBody, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			require.NoError(t, result.Body.Close())
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			assert.True(t, utils.IsValidBodyHash(resBody, result.Header.Get(utils.BodyHashHeader), "key"))
+		})
+	}
+}
+
+func TestSaveBatchJSONMetricHandler_Partial(t *testing.T) {
+	db := storage.NewStorage(&utils.StorageConfig{})
+	ts := httptest.NewServer(GetRouter(db, utils.ServerConfig{HashKey: "key"}, nil, nil))
+	defer ts.Close()
+
+	body := `[
+		{"id":"PoolCounter","type":"counter","delta":123,"hash":"2799917354025ae1c468eb210efe049b9818c087b6ca186b87812e382952bdcf"},
+		{"id":"Custom","type":"gauge","value":1,"hash":"bad"},
+		{"id":"Other","type":"histogram"}
+	]`
+	result, err := http.Post(ts.URL+"/updates/?partial=true", "application/json", bytes.NewBufferString(body))
+	require.NoError(t, err)
+	resBody, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	require.NoError(t, result.Body.Close())
+	assert.Equal(t, http.StatusMultiStatus, result.StatusCode)
+
+	response, err := utils.LoadBatchResponse(resBody)
+	require.NoError(t, err)
+	assert.Equal(t, 1, response.Applied)
+	assert.Equal(t, 2, response.Failed)
+	require.Len(t, response.Results, 3)
+	assert.Equal(t, utils.BatchStatusOK, response.Results[0].Status)
+	require.NotNil(t, response.Results[0].Metric)
+	assert.Equal(t, int64(123), *response.Results[0].Metric.Delta)
+	assert.Equal(t, []utils.BatchResult{
+		{Index: 1, ID: "Custom", MType: "gauge", Status: utils.BatchStatusError, Code: utils.MetricCodeHash, Message: utils.ErrMetricHash.Error()},
+		{Index: 2, ID: "Other", MType: "histogram", Status: utils.BatchStatusError, Code: utils.MetricCodeType, Message: utils.ErrMetricType.Error()},
+	}, response.Rejected())
+
+	metric, err := db.GetJSONMetric(context.Background(), "PoolCounter", "counter")
+	require.NoError(t, err)
+	assert.Equal(t, int64(123), *metric.Delta)
+	_, err = db.GetJSONMetric(context.Background(), "Custom", "gauge")
+	assert.Error(t, err)
+
+	// без параметра partial список отклоняется целиком
+	result, err = http.Post(ts.URL+"/updates/", "application/json", bytes.NewBufferString(body))
+	require.NoError(t, err)
+	require.NoError(t, result.Body.Close())
+	assert.Equal(t, http.StatusBadRequest, result.StatusCode)
+	metric, err = db.GetJSONMetric(context.Background(), "PoolCounter", "counter")
+	require.NoError(t, err)
+	assert.Equal(t, int64(123), *metric.Delta)
+}
+
+// failingStorage - хранилище, запись в которое завершается ошибкой.
+type failingStorage struct {
+	storage.Storage
+}
+
+func (failingStorage) UpdateJSONMetric(context.Context, utils.JSONMetric) (utils.JSONMetric, error) {
+	return utils.JSONMetric{}, errors.New("storage is down")
+}
+
+func (failingStorage) UpdateJSONMetrics(context.Context, []utils.JSONMetric) ([]utils.JSONMetric, error) {
+	return nil, errors.New("storage is down")
+}
+
+func TestLegacyHandlers_StorageError(t *testing.T) {
+	db := failingStorage{Storage: storage.NewStorage(&utils.StorageConfig{})}
+	router := GetRouter(db, utils.ServerConfig{}, nil, nil)
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		statusCode int
+	}{
+		{name: "update", path: "/update/", body: `{"id":"a","type":"gauge","value":1}`, statusCode: http.StatusInternalServerError},
+		{name: "updates", path: "/updates/", body: `[{"id":"a","type":"gauge","value":1}]`, statusCode: http.StatusBadRequest},
+		{name: "partial updates", path: "/updates/?partial=true", body: `[{"id":"a","type":"gauge","value":1}]`, statusCode: http.StatusBadRequest},
+		{name: "unknown type", path: "/updates/", body: `[{"id":"a","type":"other","value":1}]`, statusCode: http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, bytes.NewBufferString(tt.body)))
+			assert.Equal(t, tt.statusCode, w.Code)
+		})
+	}
+}
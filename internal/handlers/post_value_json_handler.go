@@ -2,21 +2,19 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 
-	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/service"
 	"github.com/tiraill/go_collect_metrics/internal/utils"
 )
 
 // GetJSONMetricHandler - метод получения значения метрики в формате JSON
 // POST /value/
-func GetJSONMetricHandler(db storage.Storage, hashKey string, privateKey *utils.PrivateKey) http.HandlerFunc {
+func GetJSONMetricHandler(svc *service.Service, privateKey *utils.PrivateKey) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		body, err := ReadEncryptedBody(r, privateKey)
+		body, err := ReadEncryptedBody(r, privateKey, svc.HashKey())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			http.Error(w, err.Error(), bodyErrorStatus(err))
 			return
 		}
 		metric, err := utils.LoadJSONMetric(body)
@@ -28,16 +26,15 @@ func GetJSONMetricHandler(db storage.Storage, hashKey string, privateKey *utils.
 			http.Error(w, "Invalid metric type", http.StatusBadRequest)
 			return
 		}
-		metric, err = db.GetJSONMetric(ctx, metric.ID, metric.MType)
+		metric, err = svc.Get(r.Context(), metric.ID, metric.MType)
 		if err != nil {
 			http.Error(w, "Metric not found", http.StatusNotFound)
 			return
 		}
-		metric.Hash = utils.CalcHash(metric.String(), hashKey)
 		w.Header().Set("content-type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		resp, _ := json.Marshal(metric)
-		log.Printf("post values response: %s\n", string(resp))
+		debugBody(r, "value response", resp)
 		w.Write(resp)
 	}
 }
@@ -104,7 +104,7 @@ func TestSetValueJSONMetricHandler(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			r := GetRouter(tt.db, utils.ServerConfig{Address: "adr", HashKey: tt.hashKey}, nil)
+			r := GetRouter(tt.db, utils.ServerConfig{Address: "adr", HashKey: tt.hashKey}, nil, nil)
 			ts := httptest.NewServer(r)
 			defer ts.Close()
 
@@ -158,7 +158,7 @@ func TestCompressedSetValueJSONMetricHandler(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
-			r := GetRouter(testStorage, utils.ServerConfig{Address: "adr", HashKey: tt.hashKey}, nil)
+			r := GetRouter(testStorage, utils.ServerConfig{Address: "adr", HashKey: tt.hashKey}, nil, nil)
 			ts := httptest.NewServer(r)
 			defer ts.Close()
 
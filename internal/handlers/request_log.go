@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+
+	"github.com/tiraill/go_collect_metrics/internal/logger"
+)
+
+// RequestID - middleware сохраняет в контексте идентификатор запроса из заголовка X-Request-ID
+// или новый, если заголовок не задан или невалиден, и возвращает его в ответе.
+func RequestID(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		id := logger.EnsureRequestID(r.Header.Get(logger.RequestIDHeader))
+		w.Header().Set(logger.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logger.WithRequestID(r.Context(), id)))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// AccessLog - middleware журнала запросов компонента http.
+// ответы с ошибкой сервера записываются на уровне error, остальные - на уровне info.
+func AccessLog(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		code := ww.Status()
+		if code == 0 {
+			code = http.StatusOK
+		}
+		l := logger.Ctx(r.Context(), "http")
+		log := l.Info
+		if code >= http.StatusInternalServerError {
+			log = l.Error
+		}
+		log("request",
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.String("remote", r.RemoteAddr),
+			zap.Int("status", code),
+			zap.Int("bytes", ww.BytesWritten()),
+			zap.Duration("duration", time.Since(start)),
+		)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// debugBody - метод записи тела запроса или ответа на уровне debug.
+// тело может содержать значения метрик, поэтому оно записывается только при включенном уровне debug компонента http.
+func debugBody(r *http.Request, msg string, body []byte) {
+	l := logger.Ctx(r.Context(), "http").WithOptions(zap.AddCallerSkip(1))
+	if l.Core().Enabled(zap.DebugLevel) {
+		l.Debug(msg, zap.ByteString("body", body))
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tiraill/go_collect_metrics/internal/logger"
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+func TestRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	defer logger.SetOutput(&buf)()
+	r := GetRouter(storage.NewStorage(&utils.StorageConfig{}), utils.ServerConfig{}, nil, nil)
+
+	post := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/update/counter/PollCount/1", nil)
+		if id != "" {
+			req.Header.Set(logger.RequestIDHeader, id)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// идентификатор клиента возвращается в ответе и попадает в журнал запросов
+	w := post("client-id")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "client-id", w.Header().Get(logger.RequestIDHeader))
+	assert.Contains(t, buf.String(), `"request_id":"client-id"`)
+
+	// без заголовка и с невалидным заголовком создается новый идентификатор
+	for _, id := range []string{"", "bad id"} {
+		w = post(id)
+		got := w.Header().Get(logger.RequestIDHeader)
+		require.NotEmpty(t, got)
+		assert.NotEqual(t, id, got)
+	}
+}
+
+func TestSaveBatchJSONMetricHandler_BodyLogging(t *testing.T) {
+	var buf bytes.Buffer
+	defer logger.SetOutput(&buf)()
+	r := GetRouter(storage.NewStorage(&utils.StorageConfig{}), utils.ServerConfig{}, nil, nil)
+	body := `[{"id":"SecretGauge","type":"gauge","value":1.5}]`
+
+	post := func() {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	// на уровне info тело запроса не записывается
+	post()
+	assert.NotContains(t, buf.String(), "SecretGauge")
+
+	require.NoError(t, logger.Configure(utils.LogConfig{Level: "info", Levels: "http=debug"}))
+	defer logger.Configure(utils.LogConfig{Level: logger.DefaultLevel, Format: logger.DefaultFormat, Sampling: logger.DefaultSampling})
+	post()
+	assert.Contains(t, buf.String(), "updates request")
+	assert.Contains(t, buf.String(), "SecretGauge")
+}
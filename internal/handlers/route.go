@@ -2,32 +2,159 @@
 package handlers
 
 import (
+	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
+	"github.com/tiraill/go_collect_metrics/internal/alert"
+	"github.com/tiraill/go_collect_metrics/internal/health"
+	"github.com/tiraill/go_collect_metrics/internal/service"
 	"github.com/tiraill/go_collect_metrics/internal/storage"
 	"github.com/tiraill/go_collect_metrics/internal/utils"
 )
 
+// streamPath - путь потока изменений метрик.
+const streamPath = "/stream"
+
+// skipPaths - middleware применяется ко всем запросам, кроме перечисленных путей.
+// используется для потока событий, который не должен ограничиваться по времени и буферизоваться,
+// и для загрузки метрик, размер которой не ограничивается.
+func skipPaths(mw func(http.Handler) http.Handler, paths ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		wrapped := mw(next)
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			for _, path := range paths {
+				if r.URL.Path == path {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			wrapped.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// Router - обработчик запросов сервера, настройки которого заменяются без перезапуска.
+// при замене настроек роуты собираются заново и подменяются атомарно,
+// хранилище, поток событий, защита от повтора и ограничитель запросов сохраняются, если их настройки не изменились.
+type Router struct {
+	mu         sync.Mutex
+	handler    atomic.Pointer[chi.Mux]
+	svc        *service.Service
+	alerts     *alert.Engine
+	checker    *health.Checker
+	config     utils.ServerConfig
+	privateKey *utils.PrivateKey
+	guard      *utils.ReplayGuard
+	limiter    *utils.RateLimiter
+}
+
+// NewRouter - метод создания обработчика запросов сервера над хранилищем db,
+// обертки хранилища создает service.New, готовность проверяется по доступности db.
+// alerts может быть nil, если правила оповещений не заданы.
+func NewRouter(db storage.Storage, config utils.ServerConfig, privateKey *utils.PrivateKey, alerts *alert.Engine) *Router {
+	checker := health.New(health.DefaultTimeout)
+	checker.Register("storage", true, health.StorageCheck(db, db))
+	checker.SetServing(true)
+	return NewServiceRouter(service.New(db, config.HashKey), config, privateKey, alerts, checker)
+}
+
+// NewServiceRouter - метод создания обработчика запросов над общим с gRPC слоем service.
+// ключ подписи берется из config и заменяется при Reload, checker используется для проверок здоровья.
+func NewServiceRouter(svc *service.Service, config utils.ServerConfig, privateKey *utils.PrivateKey, alerts *alert.Engine, checker *health.Checker) *Router {
+	router := &Router{svc: svc, alerts: alerts, checker: checker}
+	router.Reload(config, privateKey)
+	return router
+}
+
+// ServeHTTP - метод обработки запроса текущими роутами.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.handler.Load().ServeHTTP(w, r)
+}
+
+// Reload - метод замены настроек сервера: подсетей, ключей, токенов и ограничений запросов.
+// запросы, которые уже обрабатываются, завершаются с прежними настройками.
+func (rt *Router) Reload(config utils.ServerConfig, privateKey *utils.PrivateKey) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	switch {
+	case config.HashKey == "":
+		rt.guard = nil
+	case rt.guard == nil || config.StampWindow() != rt.config.StampWindow() || config.NonceCacheSize != rt.config.NonceCacheSize:
+		rt.guard = utils.NewReplayGuard(config.StampWindow(), config.NonceCacheSize)
+	}
+	switch {
+	case config.Limits.RateLimit <= 0:
+		rt.limiter = nil
+	case rt.limiter == nil || config.Limits.RateLimit != rt.config.Limits.RateLimit || config.Limits.RateBurst != rt.config.Limits.RateBurst:
+		rt.limiter = utils.NewRateLimiter(config.Limits.RateLimit, config.Limits.RateBurst)
+	}
+	rt.config = config
+	rt.privateKey = privateKey
+	rt.handler.Store(rt.routes())
+}
+
 // GetRouter - метод регистрирует роуты для сервера.
-func GetRouter(db storage.Storage, config utils.ServerConfig, privateKey *utils.PrivateKey) *chi.Mux {
+// параметры совпадают с NewRouter, настройки роутов не заменяются.
+func GetRouter(db storage.Storage, config utils.ServerConfig, privateKey *utils.PrivateKey, alerts *alert.Engine) *chi.Mux {
+	return NewRouter(db, config, privateKey, alerts).handler.Load()
+}
+
+// routes - метод регистрации роутов с текущими настройками.
+func (rt *Router) routes() *chi.Mux {
+	config, privateKey, deleteGuard, alerts := rt.config, rt.privateKey, rt.guard, rt.alerts
+	// подпись запросов на запись проверяется при включенной защите от повтора, удаления - при любом заданном ключе
+	guard := deleteGuard
+	if !config.IsReplayProtected() {
+		guard = nil
+	}
+	svc := rt.svc.WithHashKey(config.HashKey)
+	var db storage.Storage = svc.Storage()
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
-	r.Use(middleware.Timeout(60 * time.Second))
-	r.Use(middleware.Compress(1, "application/json", "text/html", "text/plain"))
+	r.Use(Trace)
+	r.Use(Instrument)
+	r.Use(RequestID)
+	r.Use(AccessLog)
+	r.Use(skipPaths(middleware.Timeout(60*time.Second), streamPath))
+	r.Use(middleware.Compress(1, "application/json", "text/html", "text/plain", "text/css", "text/javascript"))
 	r.Use(middleware.AllowContentEncoding("gzip"))
-	if config.TrustedNetPrefix != nil {
-		r.Use(middleware.RealIP)
-		r.Use(CheckTrustedSubnet(config.TrustedNetPrefix))
+	if rt.limiter != nil {
+		r.Use(skipPaths(RateLimit(rt.limiter, config.ProxyPrefixes, guard != nil), healthzPath, readyzPath))
+	}
+	r.Use(skipPaths(LimitRequest(config.Limits), adminImportPath))
+	r.Use(AuditSource(config.ProxyPrefixes))
+	if config.HashKey != "" {
+		r.Use(skipPaths(SignResponse(config.HashKey), streamPath, adminExportPath))
 	}
-	r.Get("/", IndexHandler(db))
-	r.Get("/ping", GetPingHandler(db))
-	r.Get("/value/{mType}/{mName}", GetValueMetricHandler(db))
-	r.Post("/update/{mType}/{mName}/{mValue}", SaveMetricHandler(db))
-	r.Post("/value/", GetJSONMetricHandler(db, config.HashKey, privateKey))
-	r.Post("/update/", SaveJSONMetricHandler(db, config.HashKey, privateKey))
-	r.Post("/updates/", SaveBatchJSONMetricHandler(db, config.HashKey, privateKey))
+	r.Get(healthzPath, HealthzHandler())
+	r.Get(readyzPath, ReadyzHandler(rt.checker))
+	r.Group(func(r chi.Router) {
+		r.Use(CheckTrustedSubnet(config.ReadPrefixes, config.ProxyPrefixes))
+		r.Get("/", IndexHandler())
+		r.Handle("/ui/*", UIHandler())
+		r.Get("/ping", GetPingHandler(db))
+		r.Get("/health", HealthHandler(rt.checker))
+		r.Get("/value/{mType}/{mName}", GetValueMetricHandler(db))
+		r.Get(streamPath, StreamHandler(svc.Broker(), config.HashKey))
+		r.Post("/value/", GetJSONMetricHandler(svc, privateKey))
+	})
+	r.Route(APIPrefix, apiRoutes(svc, config, privateKey, guard, deleteGuard, alerts))
+	r.Group(func(r chi.Router) {
+		r.Use(CheckTrustedSubnet(config.MetricsPrefixes, config.ProxyPrefixes))
+		r.Use(CheckBearerToken(config.MetricsToken))
+		r.Get("/metrics", PrometheusHandler(db))
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(CheckTrustedSubnet(config.WritePrefixes, config.ProxyPrefixes))
+		r.Post("/update/{mType}/{mName}/{mValue}", SaveMetricHandler(db))
+		r.Post("/update/", SaveJSONMetricHandler(svc, privateKey, guard))
+		r.Post("/updates/", SaveBatchJSONMetricHandler(svc, privateKey, guard))
+	})
 	return r
 }
@@ -1,14 +1,123 @@
 package handlers
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/tiraill/go_collect_metrics/internal/storage"
 	"github.com/tiraill/go_collect_metrics/internal/utils"
 )
 
 func TestGetRouter(t *testing.T) {
-	router := GetRouter(nil, utils.ServerConfig{}, nil)
+	router := GetRouter(nil, utils.ServerConfig{}, nil, nil)
 	assert.NotNil(t, router)
 }
+
+func TestGetRouter_Metrics(t *testing.T) {
+	db := storage.NewStorage(&utils.StorageConfig{})
+	_, _ = db.UpdateJSONMetrics(context.Background(), []utils.JSONMetric{
+		utils.NewGaugeJSONMetric("Alloc", 1.5),
+		utils.NewCounterJSONMetric("PollCount", 3),
+	})
+	config := utils.ServerConfig{
+		TrustedSubnet: "192.168.1.0/24",
+		MetricsSubnet: "10.0.0.0/8",
+		MetricsToken:  "secret",
+	}
+	config.WritePrefixes, _ = utils.ParsePrefixes(config.TrustedSubnet)
+	config.MetricsPrefixes, _ = utils.ParsePrefixes(config.MetricsSubnet)
+	router := GetRouter(db, config, nil, nil)
+
+	tests := []struct {
+		name        string
+		remoteAddr  string
+		token       string
+		accept      string
+		statusCode  int
+		contentType string
+		body        string
+	}{
+		{name: "write subnet is not allowed to scrape", remoteAddr: "192.168.1.1:1000", token: "secret", statusCode: http.StatusForbidden},
+		{name: "missing token", remoteAddr: "10.0.0.1:1000", statusCode: http.StatusUnauthorized},
+		{
+			name: "prometheus text", remoteAddr: "10.0.0.1:1000", token: "secret", statusCode: http.StatusOK,
+			contentType: utils.PrometheusContentType,
+			body:        "# TYPE Alloc gauge\nAlloc 1.5\n# TYPE PollCount counter\nPollCount 3\n",
+		},
+		{
+			name: "openmetrics", remoteAddr: "10.0.0.1:1000", token: "secret", statusCode: http.StatusOK,
+			accept:      "application/openmetrics-text;version=1.0.0,text/plain;q=0.5",
+			contentType: utils.OpenMetricsContentType,
+			body:        "# TYPE Alloc gauge\nAlloc 1.5\n# TYPE PollCount counter\nPollCount_total 3\n# EOF\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			request.RemoteAddr = tt.remoteAddr
+			if tt.token != "" {
+				request.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.accept != "" {
+				request.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, request)
+			assert.Equal(t, tt.statusCode, w.Code)
+			if tt.statusCode == http.StatusOK {
+				assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+				assert.Equal(t, tt.body, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetRouter_MetricsReadSubnet(t *testing.T) {
+	config := utils.ServerConfig{TrustedSubnet: "192.168.1.0/24", TrustedRead: "172.16.0.0/12"}
+	assert.Nil(t, config.ParseSubnets())
+	router := GetRouter(storage.NewStorage(&utils.StorageConfig{}), config, nil, nil)
+
+	// без metrics_subnet экспорт ограничивается подсетями для чтения
+	scrape := func(remoteAddr string) int {
+		request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		request.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, scrape("172.16.0.1:1000"))
+	assert.Equal(t, http.StatusForbidden, scrape("192.168.1.1:1000"))
+	assert.Equal(t, http.StatusForbidden, scrape("10.0.0.1:1000"))
+}
+
+func TestRouter_Reload(t *testing.T) {
+	db := storage.NewStorage(&utils.StorageConfig{})
+	config := utils.ServerConfig{TrustedSubnet: "192.168.1.0/24"}
+	assert.Nil(t, config.ParseSubnets())
+	router := NewRouter(db, config, nil, nil)
+
+	update := func(remoteAddr string) int {
+		request := httptest.NewRequest(http.MethodPost, "/update/counter/PollCount/1", nil)
+		request.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, update("192.168.1.5:1000"))
+	assert.Equal(t, http.StatusForbidden, update("10.0.0.5:1000"))
+
+	config.TrustedSubnet = "10.0.0.0/8"
+	assert.Nil(t, config.ParseSubnets())
+	router.Reload(config, nil)
+	assert.Equal(t, http.StatusForbidden, update("192.168.1.5:1000"))
+	assert.Equal(t, http.StatusOK, update("10.0.0.5:1000"))
+
+	// метрики, сохраненные до перезагрузки, остаются в хранилище
+	metric, err := db.GetJSONMetric(context.Background(), "PollCount", "counter")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), *metric.Delta)
+}
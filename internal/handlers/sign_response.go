@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"net/http"
+
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// signedResponseWriter - буферизует ответ для вычисления подписи тела.
+type signedResponseWriter struct {
+	http.ResponseWriter
+	body       bytes.Buffer
+	statusCode int
+}
+
+func (w *signedResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+}
+
+func (w *signedResponseWriter) Write(data []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return w.body.Write(data)
+}
+
+// SignResponse - middleware для подписи тела ответа заголовком HashSHA256.
+// подпись вычисляется до сжатия, поэтому middleware подключается после middleware.Compress.
+func SignResponse(hashKey string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			sw := &signedResponseWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+			if sw.statusCode == 0 {
+				sw.statusCode = http.StatusOK
+			}
+			body := sw.body.Bytes()
+			w.Header().Set(utils.BodyHashHeader, *utils.CalcHash(string(body), hashKey))
+			w.WriteHeader(sw.statusCode)
+			w.Write(body)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// hashingResponseWriter - передает ответ клиенту без буферизации и вычисляет подпись тела.
+type hashingResponseWriter struct {
+	http.ResponseWriter
+	hash hash.Hash
+}
+
+func (w *hashingResponseWriter) Write(data []byte) (int, error) {
+	w.hash.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *hashingResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// SignResponseTrailer - middleware для подписи тела ответа трейлером HashSHA256.
+// используется для больших ответов, которые передаются потоком и не помещаются в буфер SignResponse.
+func SignResponseTrailer(hashKey string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Trailer", utils.BodyHashHeader)
+			hw := &hashingResponseWriter{ResponseWriter: w, hash: hmac.New(sha256.New, []byte(hashKey))}
+			next.ServeHTTP(hw, r)
+			w.Header().Set(utils.BodyHashHeader, fmt.Sprintf("%x", hw.hash.Sum(nil)))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tiraill/go_collect_metrics/internal/stream"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// streamHeartbeat - периодичность отправки комментария для поддержания соединения.
+var streamHeartbeat = 15 * time.Second
+
+// streamRetry - задержка переподключения клиента в миллисекундах.
+const streamRetry = 3000
+
+// formatEventID - метод формирования идентификатора события для Last-Event-ID.
+func formatEventID(epoch int64, id uint64) string {
+	return fmt.Sprintf("%d-%d", epoch, id)
+}
+
+// parseEventID - метод разбора идентификатора события.
+// если идентификатор выдан другим экземпляром Broker, возвращается ok=false.
+func parseEventID(value string, epoch int64) (uint64, bool) {
+	epochPart, idPart, found := strings.Cut(value, "-")
+	if !found || epochPart != strconv.FormatInt(epoch, 10) {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(idPart, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// writeEvent - метод записи события в формате Server-Sent Events.
+func writeEvent(w io.Writer, id, event string, data any) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, body)
+	return err
+}
+
+// StreamHandler - метод подписки на изменения метрик в формате Server-Sent Events.
+// фильтры: type - тип метрики, name - имена метрик через запятую или несколькими параметрами.
+// события metric содержат значение метрики после изменения,
+// dropped - количество событий, отброшенных из-за медленного чтения,
+// resync - события до переподключения потеряны и метрики нужно получить заново.
+// GET /stream.
+func StreamHandler(broker *stream.Broker, hashKey string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		params := r.URL.Query()
+		filter := stream.Filter{Type: params.Get("type"), Names: make(map[string]bool)}
+		if filter.Type != "" && filter.Type != "gauge" && filter.Type != "counter" {
+			http.Error(w, utils.ErrMetricType.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, value := range params["name"] {
+			for _, name := range strings.Split(value, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					filter.Names[name] = true
+				}
+			}
+		}
+
+		resync := false
+		var lastID uint64
+		lastEventID := r.Header.Get("Last-Event-ID")
+		if lastEventID == "" {
+			lastEventID = params.Get("last_event_id")
+		}
+		if lastEventID != "" {
+			lastID, ok = parseEventID(lastEventID, broker.Epoch())
+			resync = !ok
+		}
+
+		sub := broker.Subscribe(filter, lastID)
+		defer sub.Close()
+
+		w.Header().Set("content-type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "retry: %d\n\n", streamRetry)
+		if resync || sub.Missed() > 0 {
+			writeEvent(w, "", "resync", map[string]uint64{"missed": sub.Missed()})
+		}
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				if dropped := sub.TakeDropped(); dropped > 0 {
+					writeEvent(w, "", "dropped", map[string]uint64{"dropped": dropped})
+				}
+				if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			case e, ok := <-sub.Events():
+				if !ok {
+					return
+				}
+				if dropped := sub.TakeDropped(); dropped > 0 {
+					writeEvent(w, "", "dropped", map[string]uint64{"dropped": dropped})
+				}
+				metric := e.Metric
+				metric.Hash = utils.CalcHash(metric.String(), hashKey)
+				if err := writeEvent(w, formatEventID(broker.Epoch(), e.ID), "metric", metric); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
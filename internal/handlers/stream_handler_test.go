@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/stream"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+type sseEvent struct {
+	id, event, data string
+}
+
+// readEvents - метод чтения n событий из потока, комментарии и retry пропускаются.
+func readEvents(t *testing.T, reader *bufio.Reader, n int) []sseEvent {
+	events := make([]sseEvent, 0, n)
+	current := sseEvent{}
+	for len(events) < n {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if current.event != "" {
+				events = append(events, current)
+			}
+			current = sseEvent{}
+		case strings.HasPrefix(line, "id: "):
+			current.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			current.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	return events
+}
+
+func openStream(t *testing.T, ctx context.Context, url, lastEventID string) *bufio.Reader {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Empty(t, resp.Header.Get(utils.BodyHashHeader))
+	return bufio.NewReader(resp.Body)
+}
+
+func TestStreamHandler(t *testing.T) {
+	broker := stream.NewBroker(stream.DefaultHistorySize, stream.DefaultBufferSize)
+	db := stream.NewStorage(storage.NewStorage(&utils.StorageConfig{}), broker)
+	ts := httptest.NewServer(GetRouter(db, utils.ServerConfig{HashKey: "key"}, nil, nil))
+	defer ts.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	reader := openStream(t, ctx, ts.URL+"/stream?type=counter&name=PollCount,Other", "")
+	// подписка создается до записи первого события в ответ
+	readUntilRetry(t, reader)
+
+	for _, target := range []string{"/update/gauge/PollCount/1", "/update/counter/Skipped/1", "/update/counter/PollCount/2", "/update/counter/PollCount/3"} {
+		resp, err := http.Post(ts.URL+target, "text/plain", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	events := readEvents(t, reader, 2)
+	epoch := broker.Epoch()
+	assert.Equal(t, sseEvent{
+		id:    fmt.Sprintf("%d-3", epoch),
+		event: "metric",
+		data:  `{"id":"PollCount","type":"counter","delta":2,"hash":"` + *utils.CalcHash("PollCount:counter:2", "key") + `"}`,
+	}, events[0])
+	assert.Equal(t, fmt.Sprintf("%d-4", epoch), events[1].id)
+	assert.Contains(t, events[1].data, `"delta":5`)
+
+	// переподключение продолжает поток после последнего полученного события
+	reader = openStream(t, ctx, ts.URL+"/stream", fmt.Sprintf("%d-2", epoch))
+	events = readEvents(t, reader, 2)
+	assert.Equal(t, fmt.Sprintf("%d-3", epoch), events[0].id)
+	assert.Equal(t, fmt.Sprintf("%d-4", epoch), events[1].id)
+
+	// идентификатор от другого экземпляра сервера требует полной синхронизации
+	reader = openStream(t, ctx, ts.URL+"/stream", "1-2")
+	events = readEvents(t, reader, 1)
+	assert.Equal(t, sseEvent{event: "resync", data: `{"missed":0}`}, events[0])
+}
+
+func readUntilRetry(t *testing.T, reader *bufio.Reader) {
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(line, "retry: "), line)
+}
+
+func TestStreamHandler_InvalidType(t *testing.T) {
+	r := GetRouter(storage.NewStorage(&utils.StorageConfig{}), utils.ServerConfig{}, nil, nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stream?type=histogram", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestParseEventID(t *testing.T) {
+	id, ok := parseEventID(formatEventID(42, 7), 42)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(7), id)
+	_, ok = parseEventID("41-7", 42)
+	assert.False(t, ok)
+	_, ok = parseEventID("42-x", 42)
+	assert.False(t, ok)
+	_, ok = parseEventID("garbage", 42)
+	assert.False(t, ok)
+}
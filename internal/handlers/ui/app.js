@@ -0,0 +1,401 @@
+// Панель метрик. Данные загружаются из GET /api/v1/dashboard, значения,
+// полученные страницей, хранятся в памяти для графика на детальной панели.
+(function () {
+  "use strict";
+
+  var HISTORY_SIZE = 120;
+  var STALE_SECONDS = 300;
+  var settingsKey = "metrics-dashboard";
+
+  var state = {
+    metrics: [],
+    generatedAt: null,
+    sort: { key: "id", dir: 1 },
+    filter: "",
+    type: "",
+    group: "",
+    refresh: 5,
+    selected: null,
+    history: {}
+  };
+  var timer = null;
+
+  function $(id) {
+    return document.getElementById(id);
+  }
+
+  function el(tag, attrs, children) {
+    var node = document.createElement(tag);
+    Object.keys(attrs || {}).forEach(function (name) {
+      if (name === "text") {
+        node.textContent = attrs[name];
+      } else {
+        node.setAttribute(name, attrs[name]);
+      }
+    });
+    (children || []).forEach(function (child) {
+      node.appendChild(child);
+    });
+    return node;
+  }
+
+  function key(m) {
+    return m.type + "/" + m.id;
+  }
+
+  function value(m) {
+    return m.type === "counter" ? m.delta : m.value;
+  }
+
+  function formatValue(m) {
+    var v = value(m);
+    if (v === undefined || v === null) {
+      return "";
+    }
+    return m.type === "counter" ? v.toLocaleString("en-US") : String(v);
+  }
+
+  // prefix - первая часть имени до разделителя . _ : - или смены регистра: HeapAlloc -> Heap.
+  function prefix(id) {
+    var sep = id.split(/[._:\-]/);
+    if (sep.length > 1 && sep[0] !== "") {
+      return sep[0];
+    }
+    var match = id.match(/^[A-Z]?[a-z0-9]+|^[A-Z]+/);
+    return match ? match[0] : id;
+  }
+
+  function age(m) {
+    if (!m.updated_at || !state.generatedAt) {
+      return null;
+    }
+    return Math.max(0, (state.generatedAt - Date.parse(m.updated_at)) / 1000);
+  }
+
+  function formatAge(seconds) {
+    if (seconds === null) {
+      return "—";
+    }
+    if (seconds < 60) {
+      return Math.round(seconds) + "s ago";
+    }
+    if (seconds < 3600) {
+      return Math.round(seconds / 60) + "m ago";
+    }
+    if (seconds < 86400) {
+      return Math.round(seconds / 3600) + "h ago";
+    }
+    return Math.round(seconds / 86400) + "d ago";
+  }
+
+  function compare(a, b) {
+    var x, y;
+    switch (state.sort.key) {
+      case "value":
+        x = value(a);
+        y = value(b);
+        break;
+      case "age":
+        x = age(a);
+        y = age(b);
+        if (x === null || y === null) {
+          return (x === null) - (y === null);
+        }
+        break;
+      case "type":
+        x = a.type + "/" + a.id;
+        y = b.type + "/" + b.id;
+        break;
+      default:
+        x = a.id + "/" + a.type;
+        y = b.id + "/" + b.type;
+    }
+    if (x < y) {
+      return -state.sort.dir;
+    }
+    if (x > y) {
+      return state.sort.dir;
+    }
+    return 0;
+  }
+
+  function visible() {
+    var filter = state.filter.toLowerCase();
+    return state.metrics.filter(function (m) {
+      return (!state.type || m.type === state.type) &&
+        (!filter || m.id.toLowerCase().indexOf(filter) >= 0);
+    }).sort(compare);
+  }
+
+  function groupOf(m) {
+    if (state.group === "prefix") {
+      return prefix(m.id);
+    }
+    if (state.group === "type") {
+      return m.type;
+    }
+    return "";
+  }
+
+  function row(m) {
+    var seconds = age(m);
+    var tr = el("tr", { "class": "metric", "data-key": key(m) }, [
+      el("td", { text: m.id }),
+      el("td", {}, [el("span", { "class": "badge " + m.type, text: m.type })]),
+      el("td", { "class": "num", text: formatValue(m) }),
+      el("td", { "class": "num" + (seconds !== null && seconds > STALE_SECONDS ? " stale" : ""), text: formatAge(seconds) })
+    ]);
+    if (state.selected === key(m)) {
+      tr.classList.add("selected");
+    }
+    tr.addEventListener("click", function () {
+      select(key(m));
+    });
+    return tr;
+  }
+
+  function renderTable() {
+    var tbody = $("metrics").tBodies[0];
+    var metrics = visible();
+    var rows = [];
+    if (state.group) {
+      var groups = {};
+      var names = [];
+      metrics.forEach(function (m) {
+        var g = groupOf(m);
+        if (!groups[g]) {
+          groups[g] = [];
+          names.push(g);
+        }
+        groups[g].push(m);
+      });
+      names.sort();
+      names.forEach(function (g) {
+        rows.push(el("tr", { "class": "group" }, [
+          el("td", { colspan: "4", text: g + " (" + groups[g].length + ")" })
+        ]));
+        groups[g].forEach(function (m) {
+          rows.push(row(m));
+        });
+      });
+    } else {
+      rows = metrics.map(row);
+    }
+    tbody.replaceChildren.apply(tbody, rows);
+    $("empty").hidden = metrics.length > 0;
+
+    Array.prototype.forEach.call($("metrics").tHead.rows[0].cells, function (th) {
+      th.classList.remove("asc", "desc");
+      if (th.dataset.sort === state.sort.key) {
+        th.classList.add(state.sort.dir > 0 ? "asc" : "desc");
+      }
+    });
+  }
+
+  function chart(points) {
+    var svg = $("detail-chart");
+    svg.replaceChildren();
+    if (points.length < 2) {
+      return;
+    }
+    var min = Math.min.apply(null, points);
+    var max = Math.max.apply(null, points);
+    var span = max - min || 1;
+    var coords = points.map(function (p, i) {
+      var x = (i / (points.length - 1)) * 300;
+      var y = 76 - ((p - min) / span) * 72;
+      return x.toFixed(1) + "," + y.toFixed(1);
+    });
+    var line = document.createElementNS("http://www.w3.org/2000/svg", "polyline");
+    line.setAttribute("points", coords.join(" "));
+    svg.appendChild(line);
+  }
+
+  function renderDetail() {
+    var panel = $("detail");
+    var m = state.metrics.find(function (item) {
+      return key(item) === state.selected;
+    });
+    if (!state.selected || !m) {
+      panel.hidden = true;
+      return;
+    }
+    panel.hidden = false;
+    $("detail-name").textContent = m.id;
+    var fields = [
+      ["Type", m.type],
+      ["Value", formatValue(m)],
+      ["Prefix", prefix(m.id)],
+      ["Updated", m.updated_at ? m.updated_at + " (" + formatAge(age(m)) + ")" : "unknown since server start"],
+      ["Hash", m.hash || "—"]
+    ];
+    var dl = $("detail-fields");
+    dl.replaceChildren();
+    fields.forEach(function (f) {
+      dl.appendChild(el("dt", { text: f[0] }));
+      dl.appendChild(el("dd", { text: f[1] }));
+    });
+    chart(state.history[state.selected] || []);
+  }
+
+  function render() {
+    renderTable();
+    renderDetail();
+  }
+
+  function select(k) {
+    state.selected = k;
+    if (k) {
+      history.replaceState(null, "", "#" + encodeURIComponent(k));
+      var parts = k.split("/");
+      var type = parts.shift();
+      fetch("/api/v1/metrics/" + encodeURIComponent(type) + "/" + encodeURIComponent(parts.join("/")))
+        .then(function (resp) {
+          return resp.json();
+        })
+        .then(function (data) {
+          $("detail-json").textContent = JSON.stringify(data, null, 2);
+        })
+        .catch(function () {
+          $("detail-json").textContent = "";
+        });
+    } else {
+      history.replaceState(null, "", location.pathname);
+    }
+    render();
+  }
+
+  function remember(metrics) {
+    metrics.forEach(function (m) {
+      var points = state.history[key(m)] || (state.history[key(m)] = []);
+      var v = value(m);
+      if (typeof v === "number") {
+        points.push(v);
+        if (points.length > HISTORY_SIZE) {
+          points.shift();
+        }
+      }
+    });
+  }
+
+  function setStatus(text, isError) {
+    var status = $("status");
+    status.textContent = text;
+    status.classList.toggle("error", !!isError);
+  }
+
+  function load() {
+    return fetch("/api/v1/dashboard", { headers: { Accept: "application/json" } })
+      .then(function (resp) {
+        if (!resp.ok) {
+          return resp.json().then(function (body) {
+            throw new Error(body.error ? body.error.message : resp.statusText);
+          }, function () {
+            throw new Error(resp.status + " " + resp.statusText);
+          });
+        }
+        return resp.json();
+      })
+      .then(function (data) {
+        state.metrics = data.metrics || [];
+        state.generatedAt = Date.parse(data.generated_at);
+        remember(state.metrics);
+        setStatus(state.metrics.length + " metrics, loaded " + new Date().toLocaleTimeString());
+        render();
+      })
+      .catch(function (err) {
+        setStatus("Failed to load metrics: " + err.message, true);
+      });
+  }
+
+  function schedule() {
+    if (timer) {
+      clearInterval(timer);
+      timer = null;
+    }
+    if (state.refresh > 0) {
+      timer = setInterval(function () {
+        if (!document.hidden) {
+          load();
+        }
+      }, state.refresh * 1000);
+    }
+  }
+
+  function save() {
+    try {
+      localStorage.setItem(settingsKey, JSON.stringify({
+        sort: state.sort, type: state.type, group: state.group, refresh: state.refresh
+      }));
+    } catch (e) {
+      // localStorage недоступен, настройки не сохраняются
+    }
+  }
+
+  function restore() {
+    try {
+      var saved = JSON.parse(localStorage.getItem(settingsKey) || "{}");
+      ["sort", "type", "group", "refresh"].forEach(function (name) {
+        if (saved[name] !== undefined) {
+          state[name] = saved[name];
+        }
+      });
+    } catch (e) {
+      // игнорируем поврежденные настройки
+    }
+    if (location.hash.length > 1) {
+      state.selected = decodeURIComponent(location.hash.slice(1));
+    }
+    $("type").value = state.type;
+    $("group").value = state.group;
+    $("refresh").value = String(state.refresh);
+  }
+
+  function bind() {
+    $("filter").addEventListener("input", function (e) {
+      state.filter = e.target.value;
+      render();
+    });
+    $("type").addEventListener("change", function (e) {
+      state.type = e.target.value;
+      save();
+      render();
+    });
+    $("group").addEventListener("change", function (e) {
+      state.group = e.target.value;
+      save();
+      render();
+    });
+    $("refresh").addEventListener("change", function (e) {
+      state.refresh = Number(e.target.value);
+      save();
+      schedule();
+    });
+    $("reload").addEventListener("click", load);
+    $("close").addEventListener("click", function () {
+      select(null);
+    });
+    document.addEventListener("keydown", function (e) {
+      if (e.key === "Escape") {
+        select(null);
+      }
+    });
+    Array.prototype.forEach.call($("metrics").tHead.rows[0].cells, function (th) {
+      th.addEventListener("click", function () {
+        var k = th.dataset.sort;
+        state.sort = { key: k, dir: state.sort.key === k ? -state.sort.dir : 1 };
+        save();
+        render();
+      });
+    });
+  }
+
+  restore();
+  bind();
+  load().then(function () {
+    if (state.selected) {
+      select(state.selected);
+    }
+  });
+  schedule();
+})();
@@ -2,62 +2,138 @@ package handlers
 
 import (
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/tiraill/go_collect_metrics/internal/tracing"
 	"github.com/tiraill/go_collect_metrics/internal/utils"
 )
 
 func readAll(reader io.ReadCloser) ([]byte, error) {
 	body, err := io.ReadAll(reader)
 	if err != nil {
-		return nil, fmt.Errorf("invalid reader: %s", err)
+		return nil, fmt.Errorf("invalid reader: %w", err)
 	}
 	if err := reader.Close(); err != nil {
-		return nil, fmt.Errorf("coudn't close reader: %s", err)
+		return nil, fmt.Errorf("coudn't close reader: %w", err)
 	}
 	return body, nil
 }
 
-func readGzipBody(reader io.ReadCloser) ([]byte, error) {
+func readGzipBody(reader io.ReadCloser, limit int) ([]byte, error) {
 	gzipReader, err := gzip.NewReader(reader)
 	if err != nil {
-		return nil, fmt.Errorf("invalid gzip reader: %s", err)
+		return nil, fmt.Errorf("invalid gzip reader: %w", err)
+	}
+	var body []byte
+	if limit > 0 {
+		// читаем на один байт больше лимита, чтобы обнаружить его превышение
+		body, err = io.ReadAll(io.LimitReader(gzipReader, int64(limit)+1))
+		if err == nil && len(body) > limit {
+			err = ErrBodyTooLarge
+		}
+	} else {
+		body, err = io.ReadAll(gzipReader)
 	}
-	body, err := readAll(gzipReader)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid gzip reader: %w", err)
 	}
 	if err := reader.Close(); err != nil {
-		return nil, fmt.Errorf("coudn't close gzip reader: %s", err)
+		return nil, fmt.Errorf("coudn't close gzip reader: %w", err)
 	}
 	return body, nil
 }
 
 // ReadBody - метод чтения тела API запроса.
 // поддержка сжатия данных gzip.
+// размер распакованного тела ограничивается значением из LimitRequest.
 func ReadBody(r *http.Request) ([]byte, error) {
 	switch r.Header.Get("Content-Encoding") {
 	case "gzip":
-		log.Println("Gzip content")
-		return readGzipBody(r.Body)
+		_, span := tracing.Start(r.Context(), "gunzip")
+		body, err := readGzipBody(r.Body, requestLimits(r).MaxDecompressedSize)
+		span.SetAttributes(attribute.Int("size", len(body)))
+		tracing.End(span, err)
+		return body, err
 	default:
 		return readAll(r.Body)
 	}
 }
 
+// CheckRequestStamp - метод проверки подписи запроса для защиты от повторной отправки.
+// если ограничение частоты запроса отложено RateLimit, запрос учитывается после проверки подписи,
+// при превышении лимита возвращается ErrRateLimited.
+// если guard не задан, проверка не выполняется.
+func CheckRequestStamp(r *http.Request, body []byte, guard *utils.ReplayGuard, hashKey string) error {
+	if guard == nil {
+		return nil
+	}
+	stamp, err := utils.ParseRequestStamp(
+		r.Header.Get(utils.TimestampHeader),
+		r.Header.Get(utils.NonceHeader),
+		r.Header.Get(utils.AgentIDHeader),
+		r.Header.Get(utils.SignatureHeader),
+	)
+	if err == nil {
+		err = guard.Check(stamp, body, hashKey)
+	}
+	if !allowStamped(r, stamp, err == nil) {
+		return ErrRateLimited
+	}
+	return err
+}
+
+// stampErrorStatus - метод получения кода ответа для ошибки проверки подписи запроса.
+func stampErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, utils.ErrReplayCacheFull):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusUnauthorized
+}
+
+// ErrBodyHash ошибка невалидной подписи тела запроса.
+var ErrBodyHash = errors.New("invalid request body hash")
+
+// IsSignedRequest - метод проверяет, подписано ли тело запроса целиком.
+// для подписанного запроса хеш-суммы отдельных метрик не обязательны.
+func IsSignedRequest(r *http.Request, hashKey string) bool {
+	return hashKey != "" && r.Header.Get(utils.BodyHashHeader) != ""
+}
+
+// metricHashKey - ключ для проверки хеш-сумм отдельных метрик.
+// если тело запроса подписано целиком, хеш-суммы метрик не проверяются.
+func metricHashKey(r *http.Request, hashKey string) string {
+	if IsSignedRequest(r, hashKey) {
+		return ""
+	}
+	return hashKey
+}
+
 // ReadEncryptedBody - метод чтения тела если запрос зашифрован.
 // поддержка сжатия данных gzip.
-func ReadEncryptedBody(r *http.Request, privateKey *utils.PrivateKey) ([]byte, error) {
+// если передан заголовок HashSHA256, подпись тела проверяется до разбора JSON.
+func ReadEncryptedBody(r *http.Request, privateKey *utils.PrivateKey, hashKey string) ([]byte, error) {
 	body, err := ReadBody(r)
 	if err != nil {
 		return nil, err
 	}
 	if privateKey != nil {
-		return privateKey.Decrypt(body)
-	} else {
-		return body, nil
+		_, span := tracing.Start(r.Context(), "decrypt", attribute.Int("size", len(body)))
+		body, err = privateKey.Decrypt(body)
+		tracing.End(span, err)
+		if err != nil {
+			return nil, err
+		}
 	}
+	if IsSignedRequest(r, hashKey) && !utils.IsValidBodyHash(body, r.Header.Get(utils.BodyHashHeader), hashKey) {
+		return nil, ErrBodyHash
+	}
+	return body, nil
 }
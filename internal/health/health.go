@@ -0,0 +1,204 @@
+// Package health - проверки живости, готовности и подробный отчет о здоровье сервера.
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tiraill/go_collect_metrics/internal/alert"
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+)
+
+// Status - состояние компонента или сервера.
+type Status string
+
+// Состояния компонента.
+const (
+	StatusOK       Status = "ok"
+	StatusDegraded Status = "degraded" // компонент работает, но с ошибками, например не сохраняется файл
+	StatusDown     Status = "down"
+)
+
+// DefaultTimeout - время на проверку одного компонента.
+const DefaultTimeout = 2 * time.Second
+
+// Result - результат проверки компонента.
+type Result struct {
+	Status  Status
+	Error   string
+	Details any
+}
+
+// Check - проверка компонента, должна завершаться при отмене контекста.
+type Check func(ctx context.Context) Result
+
+// Component - состояние компонента в отчете.
+type Component struct {
+	Name     string  `json:"name"`
+	Status   Status  `json:"status"`
+	Critical bool    `json:"critical"` // без компонента сервер не готов обслуживать запросы
+	Latency  float64 `json:"latency_ms"`
+	Error    string  `json:"error,omitempty"`
+	Details  any     `json:"details,omitempty"`
+}
+
+// Report - отчет о здоровье сервера.
+type Report struct {
+	Status     Status      `json:"status"`
+	Ready      bool        `json:"ready"`
+	StartedAt  time.Time   `json:"started_at"`
+	Uptime     string      `json:"uptime"`
+	Components []Component `json:"components"`
+}
+
+type component struct {
+	name     string
+	critical bool
+	check    Check
+}
+
+// Checker - набор проверок компонентов сервера.
+// сервер готов, если он запущен, не останавливается и ни один критичный компонент не в состоянии down.
+type Checker struct {
+	mutex      sync.RWMutex
+	components []component
+	started    time.Time
+	timeout    time.Duration
+	serving    atomic.Bool
+}
+
+// New - метод создания набора проверок с временем на проверку одного компонента timeout.
+// до вызова SetServing(true) сервер не готов.
+func New(timeout time.Duration) *Checker {
+	return &Checker{started: time.Now(), timeout: timeout}
+}
+
+// Register - метод добавления проверки компонента.
+func (c *Checker) Register(name string, critical bool, check Check) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.components = append(c.components, component{name: name, critical: critical, check: check})
+}
+
+// SetServing - метод отметки запуска и начала остановки сервера.
+// при остановке сервер перестает быть готовым, чтобы балансировщик не направлял новые запросы.
+func (c *Checker) SetServing(serving bool) {
+	c.serving.Store(serving)
+}
+
+// Ready - метод проверки готовности по критичным компонентам.
+func (c *Checker) Ready(ctx context.Context) Report {
+	return c.report(ctx, true)
+}
+
+// Report - метод проверки всех компонентов.
+func (c *Checker) Report(ctx context.Context) Report {
+	return c.report(ctx, false)
+}
+
+// report - метод параллельной проверки компонентов, каждая проверка ограничена timeout.
+func (c *Checker) report(ctx context.Context, criticalOnly bool) Report {
+	c.mutex.RLock()
+	components := make([]component, 0, len(c.components))
+	for _, comp := range c.components {
+		if comp.critical || !criticalOnly {
+			components = append(components, comp)
+		}
+	}
+	c.mutex.RUnlock()
+
+	results := make([]Component, len(components))
+	var wg sync.WaitGroup
+	for i, comp := range components {
+		wg.Add(1)
+		go func(i int, comp component) {
+			defer wg.Done()
+			results[i] = c.run(ctx, comp)
+		}(i, comp)
+	}
+	wg.Wait()
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+
+	report := Report{
+		Status:     StatusOK,
+		Ready:      c.serving.Load(),
+		StartedAt:  c.started,
+		Uptime:     time.Since(c.started).Round(time.Second).String(),
+		Components: results,
+	}
+	for _, result := range results {
+		switch {
+		case result.Status == StatusDown && result.Critical:
+			report.Status, report.Ready = StatusDown, false
+		case result.Status != StatusOK && report.Status == StatusOK:
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, comp component) Component {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	start := time.Now()
+	done := make(chan Result, 1)
+	go func() { done <- comp.check(ctx) }()
+	var result Result
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		result = Result{Status: StatusDown, Error: "check timed out"}
+	}
+	return Component{
+		Name:     comp.name,
+		Status:   result.Status,
+		Critical: comp.critical,
+		Latency:  float64(time.Since(start).Microseconds()) / 1000,
+		Error:    result.Error,
+		Details:  result.Details,
+	}
+}
+
+// StorageCheck - проверка хранилища: инициализации, восстановления, миграций и доступности.
+// состояние берется из base, если оно реализует storage.HealthReporter, доступность - из db.Ping.
+func StorageCheck(db, base storage.Storage) Check {
+	return func(ctx context.Context) Result {
+		result := Result{Status: StatusOK}
+		reporter, ok := base.(storage.HealthReporter)
+		if ok {
+			h := reporter.Health()
+			result.Details = h
+			switch {
+			case !h.Ready:
+				result.Status, result.Error = StatusDown, "storage is not initialized"
+				if h.Error != "" {
+					result.Error = h.Error
+				}
+				return result
+			case h.RestoreError != "":
+				result.Status, result.Error = StatusDegraded, "restore failed: "+h.RestoreError
+			case h.FlushError != "":
+				result.Status, result.Error = StatusDegraded, "flush failed: "+h.FlushError
+			}
+		}
+		if !db.Ping(ctx) {
+			result.Status, result.Error = StatusDown, "storage ping failed"
+		}
+		return result
+	}
+}
+
+// AlertCheck - проверка оповещений: ошибка последней отправки переводит компонент в degraded.
+func AlertCheck(engine *alert.Engine) Check {
+	return func(ctx context.Context) Result {
+		status := engine.Status()
+		result := Result{Status: StatusOK, Details: status}
+		if status.LastError != "" {
+			result.Status, result.Error = StatusDegraded, "notification failed: "+status.LastError
+		}
+		return result
+	}
+}
@@ -0,0 +1,90 @@
+package health
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+func static(status Status) Check {
+	return func(context.Context) Result { return Result{Status: status} }
+}
+
+func TestChecker_Report(t *testing.T) {
+	tests := []struct {
+		name     string
+		critical Status
+		optional Status
+		serving  bool
+		status   Status
+		ready    bool
+	}{
+		{name: "ok", critical: StatusOK, optional: StatusOK, serving: true, status: StatusOK, ready: true},
+		{name: "optional down", critical: StatusOK, optional: StatusDown, serving: true, status: StatusDegraded, ready: true},
+		{name: "critical degraded", critical: StatusDegraded, optional: StatusOK, serving: true, status: StatusDegraded, ready: true},
+		{name: "critical down", critical: StatusDown, optional: StatusOK, serving: true, status: StatusDown, ready: false},
+		{name: "not serving", critical: StatusOK, optional: StatusOK, serving: false, status: StatusOK, ready: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := New(time.Second)
+			checker.Register("storage", true, static(tt.critical))
+			checker.Register("alerts", false, static(tt.optional))
+			checker.SetServing(tt.serving)
+
+			report := checker.Report(context.Background())
+			assert.Equal(t, tt.status, report.Status)
+			assert.Equal(t, tt.ready, report.Ready)
+			require.Len(t, report.Components, 2)
+			assert.Equal(t, "alerts", report.Components[0].Name)
+
+			ready := checker.Ready(context.Background())
+			assert.Equal(t, tt.ready, ready.Ready)
+			require.Len(t, ready.Components, 1)
+			assert.Equal(t, "storage", ready.Components[0].Name)
+		})
+	}
+}
+
+func TestChecker_Timeout(t *testing.T) {
+	checker := New(10 * time.Millisecond)
+	checker.Register("slow", true, func(ctx context.Context) Result {
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond)
+		return Result{Status: StatusOK}
+	})
+	checker.SetServing(true)
+
+	report := checker.Ready(context.Background())
+	assert.False(t, report.Ready)
+	assert.Equal(t, StatusDown, report.Components[0].Status)
+	assert.Equal(t, "check timed out", report.Components[0].Error)
+}
+
+func TestStorageCheck(t *testing.T) {
+	db := storage.NewStorage(&utils.StorageConfig{})
+	check := StorageCheck(db, db)
+
+	// до инициализации хранилище не готово
+	assert.Equal(t, StatusDown, check(context.Background()).Status)
+
+	db.Init(context.Background())
+	result := check(context.Background())
+	assert.Equal(t, StatusOK, result.Status)
+	require.IsType(t, storage.Health{}, result.Details)
+	assert.Equal(t, storage.RestoreDisabled, result.Details.(storage.Health).Restore)
+
+	// файл не задан, поэтому сохранение после изменения завершается ошибкой
+	db.Close(context.Background())
+	_, err := db.UpdateJSONMetric(context.Background(), utils.NewCounterJSONMetric("PollCount", 1))
+	require.NoError(t, err)
+	result = check(context.Background())
+	assert.Equal(t, StatusDegraded, result.Status)
+	assert.Contains(t, result.Error, "flush failed")
+}
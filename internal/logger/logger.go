@@ -0,0 +1,211 @@
+// Package logger - структурированный журнал с уровнями по компонентам.
+// журнал компонента запрашивается при каждой записи, поэтому новая конфигурация
+// применяется без перезапуска ко всем компонентам.
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// Значения конфигурации по умолчанию.
+const (
+	DefaultLevel    = "info"
+	DefaultFormat   = "json"
+	DefaultSampling = 100
+)
+
+// Ключи идентификаторов запроса и трассировки в полях журнала.
+const (
+	RequestIDKey = "request_id"
+	TraceIDKey   = "trace_id"
+)
+
+type state struct {
+	mutex   sync.RWMutex
+	config  utils.LogConfig
+	levels  map[string]zapcore.Level
+	level   zapcore.Level
+	output  zapcore.WriteSyncer
+	loggers map[string]*zap.Logger
+	restore func()
+}
+
+var global = newState(zapcore.Lock(os.Stderr))
+
+func newState(output zapcore.WriteSyncer) *state {
+	s := &state{output: output}
+	if err := s.configure(utils.LogConfig{Level: DefaultLevel, Format: DefaultFormat, Sampling: DefaultSampling}); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Configure - метод замены конфигурации журнала.
+// стандартный пакет log перенаправляется в компонент std на уровне info.
+func Configure(config utils.LogConfig) error {
+	return global.configure(config)
+}
+
+// Check - метод проверки конфигурации журнала.
+func Check(config utils.LogConfig) error {
+	_, _, err := parseConfig(config)
+	return err
+}
+
+func parseLevel(value string) (zapcore.Level, error) {
+	if value == "" {
+		return zapcore.InfoLevel, nil
+	}
+	return zapcore.ParseLevel(value)
+}
+
+func parseConfig(config utils.LogConfig) (zapcore.Level, map[string]zapcore.Level, error) {
+	level, err := parseLevel(config.Level)
+	if err != nil {
+		return level, nil, fmt.Errorf("log_level: %w", err)
+	}
+	levels := make(map[string]zapcore.Level)
+	for _, item := range strings.Split(config.Levels, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		component, value, ok := strings.Cut(item, "=")
+		if !ok || component == "" {
+			return level, nil, fmt.Errorf("log_levels: %q must be component=level", item)
+		}
+		if levels[component], err = parseLevel(value); err != nil {
+			return level, nil, fmt.Errorf("log_levels: %s: %w", component, err)
+		}
+	}
+	switch config.Format {
+	case "", "json", "console":
+	default:
+		return level, nil, fmt.Errorf("log_format %q must be json or console", config.Format)
+	}
+	if config.Sampling < 0 {
+		return level, nil, fmt.Errorf("log_sampling must not be negative")
+	}
+	return level, levels, nil
+}
+
+func (s *state) configure(config utils.LogConfig) error {
+	level, levels, err := parseConfig(config)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	s.config, s.level, s.levels = config, level, levels
+	s.loggers = make(map[string]*zap.Logger)
+	if s.restore != nil {
+		s.restore()
+	}
+	s.mutex.Unlock()
+
+	restore, err := zap.RedirectStdLogAt(s.get("std"), zapcore.InfoLevel)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	s.restore = restore
+	s.mutex.Unlock()
+	return nil
+}
+
+// build - метод создания журнала компонента, вызывается под блокировкой mutex.
+func (s *state) build(component string) *zap.Logger {
+	level, ok := s.levels[component]
+	if !ok {
+		level = s.level
+	}
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	encoder := zapcore.NewJSONEncoder(encoderConfig)
+	if s.config.Format == "console" {
+		encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	}
+	core := zapcore.NewCore(encoder, s.output, level)
+	// одинаковые сообщения сверх Sampling в секунду записываются через одно из Sampling,
+	// поэтому частые записи, например журнал запросов, не вытесняют остальные
+	if s.config.Sampling > 0 {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, s.config.Sampling, s.config.Sampling)
+	}
+	return zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.DPanicLevel)).Named(component)
+}
+
+func (s *state) get(component string) *zap.Logger {
+	s.mutex.RLock()
+	l, ok := s.loggers[component]
+	s.mutex.RUnlock()
+	if ok {
+		return l
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if l, ok = s.loggers[component]; !ok {
+		l = s.build(component)
+		s.loggers[component] = l
+	}
+	return l
+}
+
+// L - журнал компонента.
+func L(component string) *zap.Logger {
+	return global.get(component)
+}
+
+// Ctx - журнал компонента с идентификаторами запроса и трассировки из ctx.
+func Ctx(ctx context.Context, component string) *zap.Logger {
+	l := global.get(component)
+	var fields []zap.Field
+	if id := RequestID(ctx); id != "" {
+		fields = append(fields, zap.String(RequestIDKey, id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		fields = append(fields, zap.String(TraceIDKey, sc.TraceID().String()))
+	}
+	if len(fields) == 0 {
+		return l
+	}
+	return l.With(fields...)
+}
+
+// Sync - метод записи буферизованных записей, вызывается перед завершением процесса.
+func Sync() {
+	global.mutex.RLock()
+	defer global.mutex.RUnlock()
+	for _, l := range global.loggers {
+		l.Sync()
+	}
+}
+
+// SetOutput - метод замены вывода журнала, используется в тестах.
+// возвращает метод восстановления прежнего вывода.
+func SetOutput(w io.Writer) func() {
+	global.mutex.Lock()
+	prev := global.output
+	global.output = zapcore.Lock(zapcore.AddSync(w))
+	config := global.config
+	global.mutex.Unlock()
+	global.configure(config)
+	return func() {
+		global.mutex.Lock()
+		global.output = prev
+		config := global.config
+		global.mutex.Unlock()
+		global.configure(config)
+	}
+}
@@ -0,0 +1,126 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// capture - метод замены вывода и конфигурации журнала на время теста.
+func capture(t *testing.T, config utils.LogConfig) *bytes.Buffer {
+	var buf bytes.Buffer
+	restore := SetOutput(&buf)
+	require.NoError(t, Configure(config))
+	t.Cleanup(func() {
+		Configure(utils.LogConfig{Level: DefaultLevel, Format: DefaultFormat, Sampling: DefaultSampling})
+		restore()
+	})
+	return &buf
+}
+
+func entries(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var result []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		result = append(result, entry)
+	}
+	return result
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  utils.LogConfig
+		wantErr bool
+	}{
+		{name: "default", config: utils.LogConfig{}},
+		{name: "levels", config: utils.LogConfig{Level: "warn", Levels: "http=debug, storage=error", Format: "console"}},
+		{name: "invalid level", config: utils.LogConfig{Level: "verbose"}, wantErr: true},
+		{name: "invalid component", config: utils.LogConfig{Levels: "http"}, wantErr: true},
+		{name: "invalid component level", config: utils.LogConfig{Levels: "http=loud"}, wantErr: true},
+		{name: "invalid format", config: utils.LogConfig{Format: "xml"}, wantErr: true},
+		{name: "negative sampling", config: utils.LogConfig{Sampling: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(tt.config)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestComponentLevels(t *testing.T) {
+	buf := capture(t, utils.LogConfig{Level: "warn", Levels: "http=debug"})
+
+	L("http").Debug("http debug")
+	L("storage").Info("storage info")
+	L("storage").Warn("storage warn")
+
+	got := entries(t, buf)
+	require.Len(t, got, 2)
+	assert.Equal(t, "http debug", got[0]["msg"])
+	assert.Equal(t, "http", got[0]["logger"])
+	assert.Equal(t, "storage warn", got[1]["msg"])
+
+	// новая конфигурация применяется к уже полученным компонентам
+	buf.Reset()
+	require.NoError(t, Configure(utils.LogConfig{Level: "info"}))
+	L("http").Debug("http debug")
+	L("storage").Info("storage info")
+	got = entries(t, buf)
+	require.Len(t, got, 1)
+	assert.Equal(t, "storage info", got[0]["msg"])
+}
+
+func TestSampling(t *testing.T) {
+	buf := capture(t, utils.LogConfig{Level: "info", Sampling: 2})
+
+	for i := 0; i < 10; i++ {
+		L("http").Info("request")
+	}
+	L("http").Info("other")
+	// первые 2 одинаковые записи в секунду, затем каждая вторая
+	assert.Len(t, entries(t, buf), 2+4+1)
+}
+
+func TestCtx(t *testing.T) {
+	buf := capture(t, utils.LogConfig{Level: "info"})
+
+	Ctx(context.Background(), "grpc").Info("without id")
+	Ctx(WithRequestID(context.Background(), "abc"), "grpc").Info("with id")
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1}})
+	Ctx(trace.ContextWithSpanContext(context.Background(), sc), "grpc").Info("with trace")
+
+	got := entries(t, buf)
+	require.Len(t, got, 3)
+	assert.NotContains(t, got[0], RequestIDKey)
+	assert.NotContains(t, got[0], TraceIDKey)
+	assert.Equal(t, "abc", got[1][RequestIDKey])
+	assert.Equal(t, sc.TraceID().String(), got[2][TraceIDKey])
+}
+
+func TestEnsureRequestID(t *testing.T) {
+	assert.Equal(t, "req-1", EnsureRequestID("req-1"))
+	for _, id := range []string{"", "with space", "line\nbreak", strings.Repeat("a", maxRequestIDLength+1)} {
+		got := EnsureRequestID(id)
+		assert.NotEqual(t, id, got)
+		assert.Len(t, got, 32)
+	}
+	assert.NotEqual(t, NewRequestID(), NewRequestID())
+}
@@ -0,0 +1,48 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// RequestIDHeader - заголовок HTTP и ключ метаданных gRPC с идентификатором запроса.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength - максимальная длина идентификатора запроса, полученного от клиента.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// WithRequestID - метод сохранения идентификатора запроса в контексте.
+// идентификатор передается дальше в service и хранилище и добавляется в записи журнала Ctx.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID - метод получения идентификатора запроса из контекста.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID - метод создания случайного идентификатора запроса.
+func NewRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// EnsureRequestID - метод получения идентификатора запроса: полученного от клиента,
+// если он не длиннее maxRequestIDLength и состоит из печатных символов ASCII, иначе нового.
+func EnsureRequestID(id string) string {
+	if id == "" || len(id) > maxRequestIDLength {
+		return NewRequestID()
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return NewRequestID()
+		}
+	}
+	return id
+}
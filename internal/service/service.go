@@ -0,0 +1,271 @@
+// Package service - общий для HTTP и gRPC слой работы с метриками.
+// валидация, проверка и вычисление подписей и обращения к хранилищу выполняются здесь,
+// а транспорт только разбирает запрос и преобразует ошибки в свои коды ответа.
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/tiraill/go_collect_metrics/internal/audit"
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/stream"
+	"github.com/tiraill/go_collect_metrics/internal/telemetry"
+	"github.com/tiraill/go_collect_metrics/internal/tracing"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// Виды ошибок, по которым транспорт выбирает код ответа.
+var (
+	ErrInvalidArgument = errors.New("invalid argument")
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrNotFound        = storage.ErrMetricNotFound
+	ErrStorage         = errors.New("storage error")
+)
+
+// Error - ошибка с видом Kind, текст ошибки совпадает с текстом Err.
+type Error struct {
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// MetricError - ошибка валидации метрики с номером в запросе.
+type MetricError struct {
+	Index int
+	ID    string
+	Err   error
+}
+
+// ValidationError - ошибки валидации всех невалидных метрик запроса, а не только первой.
+// errors.Is сравнивает с ErrInvalidArgument и с ошибкой первой метрики, например utils.ErrMetricType.
+type ValidationError struct {
+	Total  int
+	Errors []MetricError
+}
+
+func (e *ValidationError) Error() string {
+	if e.Total == 1 {
+		return e.Errors[0].Err.Error()
+	}
+	return fmt.Sprintf("%d of %d metrics are invalid", len(e.Errors), e.Total)
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidArgument
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Errors[0].Err
+}
+
+// Service - операции над метриками с общими для всех транспортов правилами.
+// хранилище оборачивается в TrackedStorage для отображения времени изменения метрик на панели,
+// поэтому изменения через любой транспорт видны на панели и в потоке событий.
+type Service struct {
+	db      *storage.TrackedStorage
+	broker  *stream.Broker
+	hashKey string
+}
+
+// New - метод создания слоя работы с метриками.
+// если хранилище уже обернуто в stream.Storage, поток событий использует его Broker,
+// иначе создается собственный Broker.
+func New(db storage.Storage, hashKey string) *Service {
+	streamDB, ok := db.(*stream.Storage)
+	if !ok {
+		streamDB = stream.NewStorage(db, stream.NewBroker(stream.DefaultHistorySize, stream.DefaultBufferSize))
+	}
+	return &Service{db: storage.NewTrackedStorage(streamDB), broker: streamDB.Broker(), hashKey: hashKey}
+}
+
+// WithHashKey - метод получения слоя с другим ключом подписи над тем же хранилищем.
+// используется при замене настроек без перезапуска.
+func (s *Service) WithHashKey(hashKey string) *Service {
+	return &Service{db: s.db, broker: s.broker, hashKey: hashKey}
+}
+
+// HashKey - ключ подписи метрик.
+func (s *Service) HashKey() string {
+	return s.hashKey
+}
+
+// Storage - хранилище с учетом времени изменения метрик.
+func (s *Service) Storage() *storage.TrackedStorage {
+	return s.db
+}
+
+// Broker - рассылка изменений метрик подписчикам.
+func (s *Service) Broker() *stream.Broker {
+	return s.broker
+}
+
+// Sign - метод подписи метрики ответа ключом сервера.
+func (s *Service) Sign(metric *utils.JSONMetric) {
+	metric.Hash = utils.CalcHash(metric.String(), s.hashKey)
+}
+
+func (s *Service) signAll(metrics []utils.JSONMetric) {
+	for i := range metrics {
+		s.Sign(&metrics[i])
+	}
+}
+
+// transport - транспорт запроса для внутренних метрик, сохраненный в контексте для журнала изменений.
+func transport(ctx context.Context) string {
+	if t := audit.SourceFromContext(ctx).Transport; t != "" {
+		return t
+	}
+	return "unknown"
+}
+
+// Validate - метод валидации списка метрик.
+// checkHash - проверять подписи метрик, не нужно, если тело запроса подписано целиком.
+func (s *Service) Validate(ctx context.Context, metrics []utils.JSONMetric, checkHash bool) *ValidationError {
+	_, span := tracing.Start(ctx, "validate", attribute.Int("metrics", len(metrics)), attribute.Bool("check_hash", checkHash))
+	defer span.End()
+	hashKey := s.hashKey
+	if !checkHash {
+		hashKey = ""
+	}
+	var errs []MetricError
+	for i, metric := range metrics {
+		if err := metric.ValidatesAll(hashKey); err != nil {
+			telemetry.ObserveValidationError(transport(ctx), err)
+			errs = append(errs, MetricError{Index: i, ID: metric.ID, Err: err})
+		}
+	}
+	span.SetAttributes(attribute.Int("invalid", len(errs)))
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Total: len(metrics), Errors: errs}
+}
+
+// Save - метод сохранения метрики, возвращает подписанное значение после изменения.
+func (s *Service) Save(ctx context.Context, metric utils.JSONMetric, checkHash bool) (utils.JSONMetric, error) {
+	if err := s.Validate(ctx, []utils.JSONMetric{metric}, checkHash); err != nil {
+		return metric, err
+	}
+	metric, err := s.db.UpdateJSONMetric(ctx, metric)
+	if err != nil {
+		return metric, &Error{Kind: ErrStorage, Err: err}
+	}
+	s.Sign(&metric)
+	return metric, nil
+}
+
+// SaveBatch - метод сохранения списка метрик, список сохраняется, только если валидны все метрики.
+func (s *Service) SaveBatch(ctx context.Context, metrics []utils.JSONMetric, checkHash bool) ([]utils.JSONMetric, error) {
+	if err := s.Validate(ctx, metrics, checkHash); err != nil {
+		return nil, err
+	}
+	stored, err := s.db.UpdateJSONMetrics(ctx, metrics)
+	if err != nil {
+		return nil, &Error{Kind: ErrStorage, Err: err}
+	}
+	s.signAll(stored)
+	return stored, nil
+}
+
+// SavePartial - метод частичной загрузки списка метрик.
+// невалидные метрики отклоняются, валидные записываются одним вызовом хранилища,
+// то есть либо все, либо ни одной при ошибке хранилища.
+func (s *Service) SavePartial(ctx context.Context, metrics []utils.JSONMetric, checkHash bool) (utils.BatchResponse, error) {
+	errs := make(map[int]error)
+	if invalid := s.Validate(ctx, metrics, checkHash); invalid != nil {
+		for _, e := range invalid.Errors {
+			errs[e.Index] = e.Err
+		}
+	}
+	valid, response := utils.NewBatchResponse(metrics, errs)
+	if len(valid) == 0 {
+		return response, nil
+	}
+	stored, err := s.db.UpdateJSONMetrics(ctx, valid)
+	if err != nil {
+		return response, &Error{Kind: ErrStorage, Err: err}
+	}
+	response.SetStored(stored, s.hashKey)
+	return response, nil
+}
+
+// Get - метод получения подписанной метрики.
+func (s *Service) Get(ctx context.Context, id, mType string) (utils.JSONMetric, error) {
+	metric := utils.JSONMetric{ID: id, MType: mType}
+	if !metric.IsValidType() {
+		return metric, &Error{Kind: ErrInvalidArgument, Err: utils.ErrMetricType}
+	}
+	metric, err := s.db.GetJSONMetric(ctx, id, mType)
+	if err != nil {
+		return metric, &Error{Kind: ErrNotFound, Err: err}
+	}
+	s.Sign(&metric)
+	return metric, nil
+}
+
+// List - метод получения всех подписанных метрик, пустой список не nil.
+func (s *Service) List(ctx context.Context) ([]utils.JSONMetric, error) {
+	metrics, err := s.db.GetAllMetrics(ctx)
+	if err != nil {
+		return nil, &Error{Kind: ErrStorage, Err: err}
+	}
+	if metrics == nil {
+		metrics = make([]utils.JSONMetric, 0)
+	}
+	s.signAll(metrics)
+	return metrics, nil
+}
+
+// Search - метод поиска метрик с фильтрацией, сортировкой и пагинацией.
+func (s *Service) Search(ctx context.Context, q storage.ListQuery) (storage.ListPage, error) {
+	if err := q.Normalize(); err != nil {
+		return storage.ListPage{}, &Error{Kind: ErrInvalidArgument, Err: err}
+	}
+	page, err := s.db.ListMetrics(ctx, q)
+	if err != nil {
+		return page, &Error{Kind: ErrStorage, Err: err}
+	}
+	s.signAll(page.Metrics)
+	return page, nil
+}
+
+// Delete - метод удаления метрики.
+// при заданном ключе сервера hash должен быть HMAC строки utils.DeletePayload.
+// hash не меняется между запросами, поэтому HTTP и gRPC обработчики до вызова проверяют подпись запроса utils.RequestStamp.
+func (s *Service) Delete(ctx context.Context, id, mType, hash string) error {
+	metric := utils.JSONMetric{ID: id, MType: mType}
+	if !metric.IsValidType() {
+		return &Error{Kind: ErrInvalidArgument, Err: utils.ErrMetricType}
+	}
+	if s.hashKey != "" && !utils.IsValidBodyHash(utils.DeletePayload(mType, id), hash, s.hashKey) {
+		return &Error{Kind: ErrUnauthenticated, Err: utils.ErrMetricHash}
+	}
+	err := s.db.DeleteMetric(ctx, id, mType)
+	if errors.Is(err, storage.ErrMetricNotFound) {
+		return &Error{Kind: ErrNotFound, Err: err}
+	}
+	if err != nil {
+		return &Error{Kind: ErrStorage, Err: err}
+	}
+	return nil
+}
+
+// Ping - метод проверки доступности хранилища.
+func (s *Service) Ping(ctx context.Context) bool {
+	return s.db.Ping(ctx)
+}
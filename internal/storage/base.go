@@ -3,6 +3,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 
 	"github.com/tiraill/go_collect_metrics/internal/utils"
 )
@@ -23,8 +24,19 @@ type Storage interface {
 	GetJSONMetric(context.Context, string, string) (utils.JSONMetric, error)
 	// GetAllMetrics получение всех метрик
 	GetAllMetrics(context.Context) ([]utils.JSONMetric, error)
+	// ListMetrics получение страницы метрик с фильтрацией и сортировкой
+	ListMetrics(context.Context, ListQuery) (ListPage, error)
+	// ReplaceMetrics замена всех метрик хранилища списком метрик
+	ReplaceMetrics(context.Context, []utils.JSONMetric) error
+	// DeleteMetric удаление одной метрики по имени и типу
+	DeleteMetric(context.Context, string, string) error
+	// Snapshot чтение всех метрик на один момент времени с вызовом функции для каждой метрики по имени и типу
+	Snapshot(context.Context, func(utils.JSONMetric) error) error
 }
 
+// ErrMetricNotFound ошибка удаления метрики, которой нет в хранилище.
+var ErrMetricNotFound = errors.New("metric not found")
+
 // NewStorage - метод для создания объекта Storage
 func NewStorage(config *utils.StorageConfig) Storage {
 	if config.DatabaseDSN != "" {
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// Результат восстановления метрик из файла при инициализации MemStorage.
+const (
+	RestoreDisabled = "disabled" // восстановление отключено или файл не задан
+	RestoreSkipped  = "skipped"  // файла еще нет, хранилище запущено пустым
+	RestoreDone     = "restored"
+	RestoreFailed   = "failed"
+)
+
+// Health - состояние хранилища для проверок готовности и отчета о здоровье сервера.
+type Health struct {
+	Backend      string     `json:"backend"`
+	Ready        bool       `json:"ready"`                   // инициализация, восстановление и миграции завершены
+	Error        string     `json:"error,omitempty"`         // ошибка инициализации
+	Restore      string     `json:"restore,omitempty"`       // результат восстановления из файла
+	RestoreError string     `json:"restore_error,omitempty"` // ошибка восстановления из файла
+	LastFlush    *time.Time `json:"last_flush,omitempty"`    // последнее успешное сохранение в файл
+	FlushError   string     `json:"flush_error,omitempty"`   // ошибка последнего сохранения, пустая после успешного
+	Migrated     bool       `json:"migrated,omitempty"`      // схема базы данных создана
+	Pool         *PoolStats `json:"pool,omitempty"`          // пул соединений с базой данных
+}
+
+// PoolStats - статистика пула соединений с базой данных.
+type PoolStats struct {
+	MaxConns          int32  `json:"max_conns"`
+	TotalConns        int32  `json:"total_conns"`
+	IdleConns         int32  `json:"idle_conns"`
+	AcquiredConns     int32  `json:"acquired_conns"`
+	AcquireCount      int64  `json:"acquire_count"`
+	EmptyAcquireCount int64  `json:"empty_acquire_count"` // ожидания свободного соединения
+	AcquireDuration   string `json:"acquire_duration"`    // суммарное время ожидания соединений
+}
+
+// HealthReporter - хранилище, сообщающее свое состояние.
+// обертки над Storage его не реализуют, поэтому состояние запрашивается у исходного хранилища.
+type HealthReporter interface {
+	Health() Health
+}
+
+// healthState - состояние хранилища, изменяемое при инициализации и сохранении в файл.
+type healthState struct {
+	mutex  sync.RWMutex
+	health Health
+}
+
+func (s *healthState) update(fn func(*Health)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	fn(&s.health)
+}
+
+func (s *healthState) get() Health {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.health
+}
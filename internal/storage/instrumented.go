@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/tiraill/go_collect_metrics/internal/logger"
+	"github.com/tiraill/go_collect_metrics/internal/telemetry"
+	"github.com/tiraill/go_collect_metrics/internal/tracing"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// InstrumentedStorage - обертка над Storage, собирающая длительность и ошибки операций.
+type InstrumentedStorage struct {
+	Storage
+	backend string
+}
+
+// NewInstrumentedStorage - метод создания обертки над Storage с внутренними метриками.
+func NewInstrumentedStorage(db Storage) *InstrumentedStorage {
+	return &InstrumentedStorage{Storage: db, backend: Backend(db)}
+}
+
+// Backend - метод получения названия типа хранилища.
+func Backend(db Storage) string {
+	switch db.(type) {
+	case *MemStorage:
+		return "memory"
+	case *PgStorage:
+		return "postgres"
+	default:
+		return "other"
+	}
+}
+
+// errPing - ошибка проверки доступности хранилища для журнала.
+var errPing = errors.New("ping failed")
+
+// start - метод создания span операции хранилища.
+// span создается только внутри трассируемого запроса, фоновые операции, например проверки здоровья, не трассируются.
+func (s *InstrumentedStorage) start(ctx context.Context, operation string) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	return tracing.Start(ctx, "storage."+operation, attribute.String("db.system", s.backend), attribute.String("db.operation", operation))
+}
+
+// observe - метод учета длительности и результата операции и завершения span.
+// ошибки хранилища записываются в журнал компонента storage с идентификатором запроса из ctx.
+func (s *InstrumentedStorage) observe(ctx context.Context, span trace.Span, operation string, start time.Time, err error) {
+	defer tracing.End(span, err)
+	duration := time.Since(start)
+	telemetry.StorageDuration.With(s.backend, operation).Observe(duration.Seconds())
+	if err == nil {
+		logger.Ctx(ctx, "storage").Debug("operation",
+			zap.String("backend", s.backend), zap.String("operation", operation), zap.Duration("duration", duration))
+		return
+	}
+	telemetry.StorageErrors.With(s.backend, operation).Inc()
+	l := logger.Ctx(ctx, "storage")
+	log := l.Warn
+	if operation == "get" || errors.Is(err, ErrMetricNotFound) || errors.Is(err, ErrInvalidQuery) {
+		// отсутствие метрики и невалидный запрос клиента не говорят о проблемах хранилища
+		log = l.Debug
+	}
+	log("operation failed",
+		zap.String("backend", s.backend), zap.String("operation", operation), zap.Duration("duration", duration), zap.Error(err))
+}
+
+func (s *InstrumentedStorage) Ping(ctx context.Context) bool {
+	ctx, span := s.start(ctx, "ping")
+	start := time.Now()
+	ok := s.Storage.Ping(ctx)
+	var err error
+	if !ok {
+		err = errPing
+	}
+	s.observe(ctx, span, "ping", start, err)
+	return ok
+}
+
+func (s *InstrumentedStorage) UpdateJSONMetric(ctx context.Context, metric utils.JSONMetric) (utils.JSONMetric, error) {
+	ctx, span := s.start(ctx, "update")
+	start := time.Now()
+	result, err := s.Storage.UpdateJSONMetric(ctx, metric)
+	s.observe(ctx, span, "update", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStorage) UpdateJSONMetrics(ctx context.Context, metrics []utils.JSONMetric) ([]utils.JSONMetric, error) {
+	ctx, span := s.start(ctx, "update_batch")
+	start := time.Now()
+	result, err := s.Storage.UpdateJSONMetrics(ctx, metrics)
+	s.observe(ctx, span, "update_batch", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStorage) ReplaceMetrics(ctx context.Context, metrics []utils.JSONMetric) error {
+	ctx, span := s.start(ctx, "replace")
+	start := time.Now()
+	err := s.Storage.ReplaceMetrics(ctx, metrics)
+	s.observe(ctx, span, "replace", start, err)
+	return err
+}
+
+func (s *InstrumentedStorage) DeleteMetric(ctx context.Context, mName, mType string) error {
+	ctx, span := s.start(ctx, "delete")
+	start := time.Now()
+	err := s.Storage.DeleteMetric(ctx, mName, mType)
+	s.observe(ctx, span, "delete", start, err)
+	return err
+}
+
+func (s *InstrumentedStorage) GetJSONMetric(ctx context.Context, mName, mType string) (utils.JSONMetric, error) {
+	ctx, span := s.start(ctx, "get")
+	start := time.Now()
+	result, err := s.Storage.GetJSONMetric(ctx, mName, mType)
+	s.observe(ctx, span, "get", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStorage) ListMetrics(ctx context.Context, q ListQuery) (ListPage, error) {
+	ctx, span := s.start(ctx, "list")
+	start := time.Now()
+	result, err := s.Storage.ListMetrics(ctx, q)
+	s.observe(ctx, span, "list", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStorage) GetAllMetrics(ctx context.Context) ([]utils.JSONMetric, error) {
+	ctx, span := s.start(ctx, "get_all")
+	start := time.Now()
+	result, err := s.Storage.GetAllMetrics(ctx)
+	s.observe(ctx, span, "get_all", start, err)
+	return result, err
+}
+
+func (s *InstrumentedStorage) Snapshot(ctx context.Context, fn func(utils.JSONMetric) error) error {
+	ctx, span := s.start(ctx, "snapshot")
+	start := time.Now()
+	err := s.Storage.Snapshot(ctx, fn)
+	s.observe(ctx, span, "snapshot", start, err)
+	return err
+}
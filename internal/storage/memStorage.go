@@ -3,12 +3,17 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"os"
+	"sort"
 	"sync"
 	"time"
 
+	"go.uber.org/zap"
+
+	"github.com/tiraill/go_collect_metrics/internal/logger"
+	"github.com/tiraill/go_collect_metrics/internal/telemetry"
 	"github.com/tiraill/go_collect_metrics/internal/utils"
 )
 
@@ -19,6 +24,7 @@ type MemStorage struct {
 	Mutex          sync.RWMutex         `json:"-"`
 	Config         *utils.StorageConfig `json:"-"`
 	WG             sync.WaitGroup       `json:"-"`
+	state          healthState
 }
 
 func flushBackground(ctx context.Context, m *MemStorage, interval time.Duration) {
@@ -36,7 +42,27 @@ func flushBackground(ctx context.Context, m *MemStorage, interval time.Duration)
 	}
 }
 
+// Init - метод запуска сохранения в файл и восстановления метрик из файла.
+// результат восстановления доступен в Health.
 func (m *MemStorage) Init(ctx context.Context) error {
+	err := m.init(ctx)
+	m.state.update(func(h *Health) {
+		h.Ready = true
+		switch {
+		case !m.Config.Restore || m.Config.StoreFile == "":
+			h.Restore = RestoreDisabled
+		case errors.Is(err, os.ErrNotExist):
+			h.Restore = RestoreSkipped
+		case err != nil:
+			h.Restore, h.RestoreError = RestoreFailed, err.Error()
+		default:
+			h.Restore = RestoreDone
+		}
+	})
+	return err
+}
+
+func (m *MemStorage) init(ctx context.Context) error {
 	if m.Config.StoreInterval != 0 {
 		go flushBackground(ctx, m, m.Config.StoreInterval)
 		m.WG.Add(1)
@@ -70,27 +96,42 @@ func (m *MemStorage) Ping(ctx context.Context) bool {
 }
 
 func (m *MemStorage) UpdateJSONMetric(ctx context.Context, metricIn utils.JSONMetric) (utils.JSONMetric, error) {
-	metricOut := m.updateJSONMetric(metricIn)
+	metricOut := m.updateJSONMetric(metricIn, previousFromContext(ctx))
 	if m.Config.StoreInterval == 0 {
 		m.saveToFile()
 	}
 	return metricOut, nil
 }
 
-func (m *MemStorage) updateJSONMetric(metricIn utils.JSONMetric) utils.JSONMetric {
+func (m *MemStorage) updateJSONMetric(metricIn utils.JSONMetric, prev *Previous) utils.JSONMetric {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+	return m.applyJSONMetric(metricIn, prev)
+}
+
+// applyJSONMetric - изменение метрики, вызывается под блокировкой Mutex.
+// если prev не nil, в него записывается значение метрики до изменения.
+func (m *MemStorage) applyJSONMetric(metricIn utils.JSONMetric, prev *Previous) utils.JSONMetric {
 	metricOut := utils.JSONMetric{
 		ID:    metricIn.ID,
 		MType: metricIn.MType,
 	}
-	m.Mutex.Lock()
-	defer m.Mutex.Unlock()
-
 	switch metricIn.MType {
 	case "gauge":
+		if old, ok := m.GaugeMetrics[metricIn.ID]; ok {
+			prev.record(utils.NewGaugeJSONMetric(metricIn.ID, old))
+		} else {
+			prev.recordMissing(metricIn.MType, metricIn.ID)
+		}
 		val := *metricIn.Value
 		m.GaugeMetrics[metricIn.ID] = val
 		metricOut.Value = &val
 	case "counter":
+		if old, ok := m.CounterMetrics[metricIn.ID]; ok {
+			prev.record(utils.NewCounterJSONMetric(metricIn.ID, old))
+		} else {
+			prev.recordMissing(metricIn.MType, metricIn.ID)
+		}
 		val := *metricIn.Delta + m.CounterMetrics[metricIn.ID]
 		m.CounterMetrics[metricIn.ID] = val
 		metricOut.Delta = &val
@@ -99,17 +140,78 @@ func (m *MemStorage) updateJSONMetric(metricIn utils.JSONMetric) utils.JSONMetri
 }
 
 func (m *MemStorage) UpdateJSONMetrics(ctx context.Context, metricsIn []utils.JSONMetric) ([]utils.JSONMetric, error) {
-	metricsOut := make([]utils.JSONMetric, 0)
+	metricsOut := make([]utils.JSONMetric, 0, len(metricsIn))
+	prev := previousFromContext(ctx)
+	// список применяется под одной блокировкой, чтобы читатели не видели его частично
+	m.Mutex.Lock()
 	for _, metricIn := range metricsIn {
-		metricOut := m.updateJSONMetric(metricIn)
-		metricsOut = append(metricsOut, metricOut)
+		metricsOut = append(metricsOut, m.applyJSONMetric(metricIn, prev))
 	}
+	m.Mutex.Unlock()
 	if m.Config.StoreInterval == 0 {
 		m.saveToFile()
 	}
 	return metricsOut, nil
 }
 
+// ReplaceMetrics - замена всех метрик под одной блокировкой.
+// хранилище очищается, затем список применяется как при обычном обновлении.
+// значения до замены записываются в Previous из контекста.
+func (m *MemStorage) ReplaceMetrics(ctx context.Context, metrics []utils.JSONMetric) error {
+	prev := previousFromContext(ctx)
+	m.Mutex.Lock()
+	if prev != nil {
+		for id, value := range m.GaugeMetrics {
+			prev.record(utils.NewGaugeJSONMetric(id, value))
+		}
+		for id, value := range m.CounterMetrics {
+			prev.record(utils.NewCounterJSONMetric(id, value))
+		}
+	}
+	m.GaugeMetrics = make(map[string]float64)
+	m.CounterMetrics = make(map[string]int64)
+	for _, metric := range metrics {
+		m.applyJSONMetric(metric, nil)
+	}
+	m.Mutex.Unlock()
+	if m.Config.StoreInterval == 0 {
+		m.saveToFile()
+	}
+	return nil
+}
+
+// DeleteMetric - удаление одной метрики, если метрики нет, возвращается ErrMetricNotFound.
+func (m *MemStorage) DeleteMetric(ctx context.Context, mName, mType string) error {
+	prev := previousFromContext(ctx)
+	m.Mutex.Lock()
+	switch mType {
+	case "gauge":
+		old, ok := m.GaugeMetrics[mName]
+		if !ok {
+			m.Mutex.Unlock()
+			return ErrMetricNotFound
+		}
+		prev.record(utils.NewGaugeJSONMetric(mName, old))
+		delete(m.GaugeMetrics, mName)
+	case "counter":
+		old, ok := m.CounterMetrics[mName]
+		if !ok {
+			m.Mutex.Unlock()
+			return ErrMetricNotFound
+		}
+		prev.record(utils.NewCounterJSONMetric(mName, old))
+		delete(m.CounterMetrics, mName)
+	default:
+		m.Mutex.Unlock()
+		return utils.ErrMetricType
+	}
+	m.Mutex.Unlock()
+	if m.Config.StoreInterval == 0 {
+		m.saveToFile()
+	}
+	return nil
+}
+
 func (m *MemStorage) GetJSONMetric(ctx context.Context, mName, mType string) (utils.JSONMetric, error) {
 	metric := utils.JSONMetric{
 		ID:    mName,
@@ -138,39 +240,86 @@ func (m *MemStorage) GetJSONMetric(ctx context.Context, mName, mType string) (ut
 }
 
 func (m *MemStorage) GetAllMetrics(ctx context.Context) ([]utils.JSONMetric, error) {
-	metrics := make([]utils.JSONMetric, 0)
+	m.Mutex.RLock()
+	defer m.Mutex.RUnlock()
+	metrics := make([]utils.JSONMetric, 0, len(m.GaugeMetrics)+len(m.CounterMetrics))
 	for name, val := range m.GaugeMetrics {
 		metrics = append(metrics, utils.NewGaugeJSONMetric(name, val))
 	}
 	for name, val := range m.CounterMetrics {
 		metrics = append(metrics, utils.NewCounterJSONMetric(name, val))
 	}
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].ID != metrics[j].ID {
+			return metrics[i].ID < metrics[j].ID
+		}
+		return metrics[i].MType < metrics[j].MType
+	})
 	return metrics, nil
 }
 
-func (m *MemStorage) saveToFile() {
-	if m.Config.StoreFile == "" {
-		log.Print("Failed save to file: filename is empty")
+func (m *MemStorage) ListMetrics(ctx context.Context, q ListQuery) (ListPage, error) {
+	if err := q.Normalize(); err != nil {
+		return ListPage{}, err
 	}
-	m.Mutex.RLock()
-	defer m.Mutex.RUnlock()
-
-	file, err := os.Create(m.Config.StoreFile)
-
+	metrics, err := m.GetAllMetrics(ctx)
 	if err != nil {
-		log.Print("Failed save to file", err)
+		return ListPage{}, err
 	}
-	data, err := json.Marshal(m)
+	return filterPage(metrics, q)
+}
+
+// Snapshot - метод чтения всех метрик на момент вызова.
+// метрики копируются под блокировкой, а fn вызывается для копии, поэтому медленный fn не задерживает запись.
+func (m *MemStorage) Snapshot(ctx context.Context, fn func(utils.JSONMetric) error) error {
+	metrics, err := m.GetAllMetrics(ctx)
 	if err != nil {
-		log.Print("Failed save to file", err)
+		return err
 	}
-	_, err = file.Write(data)
+	for _, metric := range metrics {
+		if err = fn(metric); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Health - метод получения состояния хранилища: результата восстановления и последнего сохранения в файл.
+func (m *MemStorage) Health() Health {
+	h := m.state.get()
+	h.Backend = "memory"
+	return h
+}
+
+func (m *MemStorage) saveToFile() {
+	start := time.Now()
+	err := m.writeFile()
+	telemetry.FlushDuration.With().Observe(telemetry.Since(start))
 	if err != nil {
-		log.Print("Failed save to file", err)
+		telemetry.FlushErrors.With().Inc()
+		logger.L("storage").Error("failed to save storage to file", zap.String("file", m.Config.StoreFile), zap.Error(err))
+	} else {
+		logger.L("storage").Debug("storage saved to file", zap.String("file", m.Config.StoreFile))
+	}
+	m.state.update(func(h *Health) {
+		if err != nil {
+			h.FlushError = err.Error()
+			return
+		}
+		now := time.Now()
+		h.LastFlush, h.FlushError = &now, ""
+	})
+}
+
+func (m *MemStorage) writeFile() error {
+	if m.Config.StoreFile == "" {
+		return errors.New("filename is empty")
 	}
-	err = file.Close()
+	m.Mutex.RLock()
+	defer m.Mutex.RUnlock()
+	data, err := json.Marshal(m)
 	if err != nil {
-		log.Print("Failed save to file", err)
+		return err
 	}
-	log.Print("Save storage to file")
+	return os.WriteFile(m.Config.StoreFile, data, 0666)
 }
@@ -2,9 +2,12 @@ package storage
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/tiraill/go_collect_metrics/internal/utils"
 )
@@ -125,3 +128,74 @@ func TestMemStorage_GetJSONMetric(t *testing.T) {
 	assert.Equal(t, 123.4, *gaugeMetric.Value)
 	assert.Equal(t, int64(123), *counterMetric.Delta)
 }
+
+func TestMemStorage_DeleteMetric(t *testing.T) {
+	m := MemStorage{
+		GaugeMetrics:   map[string]float64{"name": 123.4},
+		CounterMetrics: map[string]int64{"name": 123},
+		Config:         &utils.StorageConfig{StoreInterval: 1},
+	}
+	assert.Nil(t, m.DeleteMetric(context.Background(), "name", "gauge"))
+	assert.ErrorIs(t, m.DeleteMetric(context.Background(), "name", "gauge"), ErrMetricNotFound)
+	assert.ErrorIs(t, m.DeleteMetric(context.Background(), "name", "histogram"), utils.ErrMetricType)
+	_, err := m.GetJSONMetric(context.Background(), "name", "counter")
+	assert.Nil(t, err)
+}
+
+func TestMemStorage_Snapshot(t *testing.T) {
+	m := &MemStorage{
+		GaugeMetrics:   map[string]float64{"a": 1, "b": 2},
+		CounterMetrics: map[string]int64{},
+		Config:         &utils.StorageConfig{StoreInterval: 1},
+	}
+	var ids []string
+	var values []float64
+	err := m.Snapshot(context.Background(), func(metric utils.JSONMetric) error {
+		if len(ids) == 0 {
+			// запись во время чтения не ждет его окончания и не попадает в снимок
+			_, err := m.UpdateJSONMetrics(context.Background(), []utils.JSONMetric{
+				utils.NewGaugeJSONMetric("b", 3),
+				utils.NewGaugeJSONMetric("c", 4),
+			})
+			require.NoError(t, err)
+		}
+		ids = append(ids, metric.ID)
+		values = append(values, *metric.Value)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, ids)
+	assert.Equal(t, []float64{1, 2}, values)
+	assert.Equal(t, 3.0, m.GaugeMetrics["b"])
+}
+
+func TestMemStorage_Health(t *testing.T) {
+	ctx := context.Background()
+	config := &utils.StorageConfig{StoreFile: filepath.Join(t.TempDir(), "metrics.json"), Restore: true}
+	m := NewStorage(config).(*MemStorage)
+	assert.False(t, m.Health().Ready)
+
+	// файла еще нет, хранилище запускается пустым
+	assert.Error(t, m.Init(ctx))
+	h := m.Health()
+	assert.True(t, h.Ready)
+	assert.Equal(t, RestoreSkipped, h.Restore)
+	assert.Nil(t, h.LastFlush)
+
+	_, err := m.UpdateJSONMetric(ctx, utils.NewCounterJSONMetric("PollCount", 1))
+	require.NoError(t, err)
+	h = m.Health()
+	assert.NotNil(t, h.LastFlush)
+	assert.Empty(t, h.FlushError)
+
+	restored := NewStorage(config).(*MemStorage)
+	require.NoError(t, restored.Init(ctx))
+	assert.Equal(t, RestoreDone, restored.Health().Restore)
+
+	require.NoError(t, os.WriteFile(config.StoreFile, []byte("{"), 0600))
+	broken := NewStorage(config).(*MemStorage)
+	assert.Error(t, broken.Init(ctx))
+	h = broken.Health()
+	assert.Equal(t, RestoreFailed, h.Restore)
+	assert.NotEmpty(t, h.RestoreError)
+}
@@ -2,11 +2,14 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
 
+	"github.com/tiraill/go_collect_metrics/internal/logger"
 	"github.com/tiraill/go_collect_metrics/internal/utils"
 )
 
@@ -20,18 +23,60 @@ var gaugeStmt = `INSERT INTO metric(name, type, gauge_value, counter_value) VALU
 		    gauge_value = excluded.gauge_value
 		RETURNING name, type, gauge_value, counter_value;`
 
+// gaugeUpdateStmt - изменение существующей gauge с возвратом значения до изменения, строка блокируется подзапросом.
+var gaugeUpdateStmt = `UPDATE metric SET gauge_value = $2
+		FROM (SELECT name, type, gauge_value, counter_value FROM metric WHERE name = $1 AND type = 'gauge' FOR UPDATE) AS old
+		WHERE metric.name = old.name AND metric.type = old.type
+		RETURNING metric.name, metric.type, metric.gauge_value, metric.counter_value, old.gauge_value, old.counter_value;`
+
+// gaugeInsertStmt - добавление новой gauge, если строку уже добавил параллельный запрос, ничего не возвращается.
+var gaugeInsertStmt = `INSERT INTO metric(name, type, gauge_value, counter_value) VALUES ($1, 'gauge', $2, null)
+		ON CONFLICT (name, type) DO NOTHING
+		RETURNING name, type, gauge_value, counter_value;`
+
+// counterUpdateStmt - изменение существующего counter с возвратом значения до изменения, строка блокируется подзапросом.
+var counterUpdateStmt = `UPDATE metric SET counter_value = metric.counter_value + $2
+		FROM (SELECT name, type, gauge_value, counter_value FROM metric WHERE name = $1 AND type = 'counter' FOR UPDATE) AS old
+		WHERE metric.name = old.name AND metric.type = old.type
+		RETURNING metric.name, metric.type, metric.gauge_value, metric.counter_value, old.gauge_value, old.counter_value;`
+
+// counterInsertStmt - добавление нового counter, если строку уже добавил параллельный запрос, ничего не возвращается.
+var counterInsertStmt = `INSERT INTO metric(name, type, gauge_value, counter_value) VALUES ($1, 'counter', null, $2)
+		ON CONFLICT (name, type) DO NOTHING
+		RETURNING name, type, gauge_value, counter_value;`
+
 // PgStorage - структура для работы с бд Postgres
 type PgStorage struct {
-	Conn   *pgx.Conn
+	Pool   *pgxpool.Pool
 	Config *utils.StorageConfig
+	state  healthState
 }
 
+// Init - метод создания пула соединений и схемы базы данных.
+// ошибка инициализации доступна в Health, хранилище без схемы не готово к работе.
 func (p *PgStorage) Init(ctx context.Context) error {
-	conn, err := pgx.Connect(ctx, p.Config.DatabaseDSN)
+	err := p.init(ctx)
+	p.state.update(func(h *Health) {
+		if err != nil {
+			h.Error = err.Error()
+			return
+		}
+		h.Ready, h.Migrated = true, true
+	})
+	return err
+}
+
+func (p *PgStorage) init(ctx context.Context) error {
+	config, err := pgxpool.ParseConfig(p.Config.DatabaseDSN)
 	if err != nil {
 		return fmt.Errorf("unable to connect to database: %v", err)
 	}
-	p.Conn = conn
+	config.ConnConfig.Tracer = queryTracer{}
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return fmt.Errorf("unable to connect to database: %v", err)
+	}
+	p.Pool = pool
 	err = p.createTable(ctx)
 	if err != nil {
 		return fmt.Errorf("unable to crate table: %v", err)
@@ -40,25 +85,64 @@ func (p *PgStorage) Init(ctx context.Context) error {
 }
 
 func (p *PgStorage) Close(ctx context.Context) {
-	err := p.Conn.Close(ctx)
-	if err != nil {
-		return
+	if p.Pool != nil {
+		p.Pool.Close()
 	}
 }
 
 func (p *PgStorage) Ping(ctx context.Context) bool {
-	err := p.Conn.Ping(ctx)
+	if p.Pool == nil {
+		return false
+	}
+	err := p.Pool.Ping(ctx)
 	return err == nil
 }
 
+// Health - метод получения состояния хранилища: результата инициализации и статистики пула соединений.
+func (p *PgStorage) Health() Health {
+	h := p.state.get()
+	h.Backend = "postgres"
+	if p.Pool != nil {
+		stat := p.Pool.Stat()
+		h.Pool = &PoolStats{
+			MaxConns:          stat.MaxConns(),
+			TotalConns:        stat.TotalConns(),
+			IdleConns:         stat.IdleConns(),
+			AcquiredConns:     stat.AcquiredConns(),
+			AcquireCount:      stat.AcquireCount(),
+			EmptyAcquireCount: stat.EmptyAcquireCount(),
+			AcquireDuration:   stat.AcquireDuration().String(),
+		}
+	}
+	return h
+}
+
+// queryRower - соединение или транзакция, в которых выполняется изменение метрики.
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 func (p *PgStorage) UpdateJSONMetric(ctx context.Context, metricIn utils.JSONMetric) (utils.JSONMetric, error) {
+	return updateJSONMetric(ctx, p.Pool, metricIn)
+}
+
+func updateJSONMetric(ctx context.Context, q queryRower, metricIn utils.JSONMetric) (utils.JSONMetric, error) {
 	metricOut := utils.JSONMetric{}
 	var row pgx.Row
+	prev := previousFromContext(ctx)
 	switch metricIn.MType {
 	case "counter":
-		row = p.Conn.QueryRow(ctx, counterStmt, metricIn.ID, *metricIn.Delta)
+		if prev != nil {
+			return updateWithPrevious(ctx, q, metricIn, counterUpdateStmt, counterInsertStmt, *metricIn.Delta, prev)
+		}
+		row = q.QueryRow(ctx, counterStmt, metricIn.ID, *metricIn.Delta)
 	case "gauge":
-		row = p.Conn.QueryRow(ctx, gaugeStmt, metricIn.ID, *metricIn.Value)
+		if prev != nil {
+			return updateWithPrevious(ctx, q, metricIn, gaugeUpdateStmt, gaugeInsertStmt, *metricIn.Value, prev)
+		}
+		row = q.QueryRow(ctx, gaugeStmt, metricIn.ID, *metricIn.Value)
+	default:
+		return metricOut, utils.ErrMetricType
 	}
 	err := row.Scan(&metricOut.ID, &metricOut.MType, &metricOut.Value, &metricOut.Delta)
 	if err != nil {
@@ -67,33 +151,121 @@ func (p *PgStorage) UpdateJSONMetric(ctx context.Context, metricIn utils.JSONMet
 	return metricOut, nil
 }
 
+// updateWithPrevious - изменение метрики с записью значения до изменения в prev.
+// значение читается в том же запросе, что и изменение, под блокировкой строки.
+// updateStmt изменяет существующую строку, insertStmt добавляет новую, value - значение или приращение метрики.
+func updateWithPrevious(
+	ctx context.Context, q queryRower, metricIn utils.JSONMetric, updateStmt, insertStmt string, value any, prev *Previous,
+) (utils.JSONMetric, error) {
+	for {
+		metricOut := utils.JSONMetric{}
+		old := utils.JSONMetric{ID: metricIn.ID, MType: metricIn.MType}
+		err := q.QueryRow(ctx, updateStmt, metricIn.ID, value).
+			Scan(&metricOut.ID, &metricOut.MType, &metricOut.Value, &metricOut.Delta, &old.Value, &old.Delta)
+		if err == nil {
+			prev.record(old)
+			return metricOut, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return metricOut, err
+		}
+		err = q.QueryRow(ctx, insertStmt, metricIn.ID, value).
+			Scan(&metricOut.ID, &metricOut.MType, &metricOut.Value, &metricOut.Delta)
+		if err == nil {
+			prev.recordMissing(metricIn.MType, metricIn.ID)
+			return metricOut, nil
+		}
+		// если строку добавил параллельный запрос, она изменяется повторно
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return metricOut, err
+		}
+	}
+}
+
+// UpdateJSONMetrics - изменение списка метрик в одной транзакции: либо все, либо ни одной.
 func (p *PgStorage) UpdateJSONMetrics(ctx context.Context, metricsIn []utils.JSONMetric) ([]utils.JSONMetric, error) {
-	metricsOut := make([]utils.JSONMetric, 0)
-	tx, err := p.Conn.BeginTx(ctx, pgx.TxOptions{})
+	metricsOut := make([]utils.JSONMetric, 0, len(metricsIn))
+	tx, err := p.Pool.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		return metricsOut, err
 	}
-	defer func() {
-		if err != nil {
-			tx.Rollback(ctx)
-		} else {
-			tx.Commit(ctx)
-		}
-	}()
+	defer tx.Rollback(ctx)
 	for _, metric := range metricsIn {
-		out, err := p.UpdateJSONMetric(ctx, metric)
+		out, err := updateJSONMetric(ctx, tx, metric)
 		if err != nil {
-			return metricsOut, err
+			return nil, err
 		}
 		metricsOut = append(metricsOut, out)
 	}
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
 	return metricsOut, nil
 }
 
+// ReplaceMetrics - замена всех метрик в одной транзакции.
+// таблица очищается, затем список применяется как при обычном обновлении.
+// удаленные значения возвращаются тем же запросом и записываются в Previous из контекста.
+func (p *PgStorage) ReplaceMetrics(ctx context.Context, metrics []utils.JSONMetric) error {
+	tx, err := p.Pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err = deleteAll(ctx, tx, previousFromContext(ctx)); err != nil {
+		return err
+	}
+	// значения до замены уже записаны, промежуточные значения списка не записываются
+	apply := context.WithValue(ctx, previousKey{}, (*Previous)(nil))
+	for _, metric := range metrics {
+		if _, err = updateJSONMetric(apply, tx, metric); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// deleteAll - удаление всех метрик в транзакции tx с записью удаленных значений в prev.
+func deleteAll(ctx context.Context, tx pgx.Tx, prev *Previous) error {
+	if prev == nil {
+		_, err := tx.Exec(ctx, "DELETE FROM metric;")
+		return err
+	}
+	rows, err := tx.Query(ctx, "DELETE FROM metric RETURNING name, type, gauge_value, counter_value;")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		old := utils.JSONMetric{}
+		if err = rows.Scan(&old.ID, &old.MType, &old.Value, &old.Delta); err != nil {
+			return err
+		}
+		prev.record(old)
+	}
+	return rows.Err()
+}
+
+// DeleteMetric - удаление одной метрики, если метрики нет, возвращается ErrMetricNotFound.
+// удаленное значение возвращается тем же запросом и записывается в Previous из контекста.
+func (p *PgStorage) DeleteMetric(ctx context.Context, mName, mType string) error {
+	old := utils.JSONMetric{}
+	err := p.Pool.QueryRow(ctx, "DELETE FROM metric WHERE name=$1 AND type=$2 RETURNING name, type, gauge_value, counter_value;", mName, mType).
+		Scan(&old.ID, &old.MType, &old.Value, &old.Delta)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrMetricNotFound
+	}
+	if err != nil {
+		return err
+	}
+	previousFromContext(ctx).record(old)
+	return nil
+}
+
 func (p *PgStorage) GetJSONMetric(ctx context.Context, mName, mType string) (utils.JSONMetric, error) {
 	metric := utils.JSONMetric{}
 	query := fmt.Sprintf("SELECT name, type, gauge_value, counter_value FROM metric WHERE name='%s' and type='%s';", mName, mType)
-	row := p.Conn.QueryRow(ctx, query)
+	row := p.Pool.QueryRow(ctx, query)
 	err := row.Scan(&metric.ID, &metric.MType, &metric.Value, &metric.Delta)
 	if err != nil {
 		return metric, err
@@ -104,10 +276,12 @@ func (p *PgStorage) GetJSONMetric(ctx context.Context, mName, mType string) (uti
 func (p *PgStorage) GetAllMetrics(ctx context.Context) ([]utils.JSONMetric, error) {
 	metrics := make([]utils.JSONMetric, 0)
 	query := "SELECT name, type, gauge_value, counter_value FROM metric;"
-	rows, err := p.Conn.Query(ctx, query)
+	rows, err := p.Pool.Query(ctx, query)
 	if err != nil {
 		return metrics, err
 	}
+	// незакрытые rows не возвращают соединение в пул
+	defer rows.Close()
 	for rows.Next() {
 		metric := utils.JSONMetric{}
 		err = rows.Scan(&metric.ID, &metric.MType, &metric.Value, &metric.Delta)
@@ -119,6 +293,62 @@ func (p *PgStorage) GetAllMetrics(ctx context.Context) ([]utils.JSONMetric, erro
 	return metrics, nil
 }
 
+// Snapshot - метод чтения всех метрик в одной транзакции REPEATABLE READ.
+// все строки читаются на момент первого запроса транзакции, изменения во время чтения в результат не попадают.
+func (p *PgStorage) Snapshot(ctx context.Context, fn func(utils.JSONMetric) error) error {
+	tx, err := p.Pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	rows, err := tx.Query(ctx, "SELECT name, type, gauge_value, counter_value FROM metric ORDER BY name, type;")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		metric := utils.JSONMetric{}
+		if err = rows.Scan(&metric.ID, &metric.MType, &metric.Value, &metric.Delta); err != nil {
+			return err
+		}
+		if err = fn(metric); err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	return tx.Commit(ctx)
+}
+
+// ListMetrics - метод получения страницы метрик.
+// фильтрация, сортировка и пагинация выполняются на стороне базы данных.
+func (p *PgStorage) ListMetrics(ctx context.Context, q ListQuery) (ListPage, error) {
+	if err := q.Normalize(); err != nil {
+		return ListPage{}, err
+	}
+	query, args := buildListSQL(q)
+	rows, err := p.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return ListPage{}, err
+	}
+	defer rows.Close()
+	metrics := make([]utils.JSONMetric, 0, q.Limit+1)
+	for rows.Next() {
+		metric := utils.JSONMetric{}
+		err = rows.Scan(&metric.ID, &metric.MType, &metric.Value, &metric.Delta)
+		if err != nil {
+			return ListPage{}, err
+		}
+		metrics = append(metrics, metric)
+	}
+	if err = rows.Err(); err != nil {
+		return ListPage{}, err
+	}
+	return makePage(metrics, q.Limit), nil
+}
+
 func (p *PgStorage) createTable(ctx context.Context) error {
 	query := `
 		CREATE TABLE IF NOT EXISTS metric(
@@ -130,10 +360,10 @@ func (p *PgStorage) createTable(ctx context.Context) error {
 		    UNIQUE (name, type)
 		);
 	`
-	returnVal, err := p.Conn.Exec(ctx, query)
+	returnVal, err := p.Pool.Exec(ctx, query)
 	if err != nil {
 		return err
 	}
-	log.Printf("create table: %s", returnVal)
+	logger.L("storage").Info("table created", zap.String("result", returnVal.String()))
 	return nil
 }
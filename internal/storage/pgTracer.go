@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/tiraill/go_collect_metrics/internal/tracing"
+)
+
+// queryTracer - трассировка запросов к Postgres: каждый запрос внутри трассируемой операции
+// получает дочерний span с текстом запроса без значений параметров.
+type queryTracer struct{}
+
+func (queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	ctx, _ = tracing.Start(ctx, "postgres.query", semconv.DBSystemPostgreSQL, semconv.DBStatement(strings.Join(strings.Fields(data.SQL), " ")))
+	return ctx
+}
+
+func (queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	if !span.SpanContext().IsValid() {
+		return
+	}
+	tracing.End(span, data.Err)
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// Previous - значения метрик до изменения.
+// хранилище записывает их под той же блокировкой или в той же транзакции, что и изменение,
+// поэтому параллельные изменения не искажают значение до изменения.
+// записываются значения изменяемых, удаляемых и заменяемых при ReplaceMetrics метрик.
+type Previous struct {
+	mutex  sync.Mutex
+	values map[string]*utils.JSONMetric // nil - метрики до изменения не было
+}
+
+type previousKey struct{}
+
+// WithPrevious - метод запроса значений метрик до изменения: хранилище заполняет Previous при изменениях в контексте ctx.
+func WithPrevious(ctx context.Context) (context.Context, *Previous) {
+	p := &Previous{values: make(map[string]*utils.JSONMetric)}
+	return context.WithValue(ctx, previousKey{}, p), p
+}
+
+func previousFromContext(ctx context.Context) *Previous {
+	p, _ := ctx.Value(previousKey{}).(*Previous)
+	return p
+}
+
+// record - метод сохранения значения метрики до изменения.
+// сохраняется первое значение, для списка метрик это значение до применения списка.
+func (p *Previous) record(metric utils.JSONMetric) {
+	p.store(metric.MType, metric.ID, &metric)
+}
+
+// recordMissing - метод сохранения отсутствия метрики до изменения,
+// чтобы повторное изменение той же метрики в списке не записало промежуточное значение.
+func (p *Previous) recordMissing(mType, id string) {
+	p.store(mType, id, nil)
+}
+
+func (p *Previous) store(mType, id string, metric *utils.JSONMetric) {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	key := mType + ":" + id
+	if _, ok := p.values[key]; !ok {
+		p.values[key] = metric
+	}
+}
+
+// All - метод получения всех записанных значений метрик до изменения, упорядоченных по типу и имени.
+func (p *Previous) All() []utils.JSONMetric {
+	if p == nil {
+		return nil
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	metrics := make([]utils.JSONMetric, 0, len(p.values))
+	for _, metric := range p.values {
+		if metric != nil {
+			metrics = append(metrics, *metric)
+		}
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].MType != metrics[j].MType {
+			return metrics[i].MType < metrics[j].MType
+		}
+		return metrics[i].ID < metrics[j].ID
+	})
+	return metrics
+}
+
+// Get - метод получения значения метрики до изменения, false - метрики не было.
+func (p *Previous) Get(mType, id string) (utils.JSONMetric, bool) {
+	if p == nil {
+		return utils.JSONMetric{}, false
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	metric := p.values[mType+":"+id]
+	if metric == nil {
+		return utils.JSONMetric{}, false
+	}
+	return *metric, true
+}
@@ -0,0 +1,312 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// Порядок сортировки списка метрик.
+const (
+	SortByName     = "name"  // по имени, затем по типу
+	SortByNameDesc = "-name" // по имени в обратном порядке
+	SortByType     = "type"  // по типу, затем по имени
+	SortByTypeDesc = "-type" // по типу в обратном порядке
+)
+
+// DefaultListLimit - размер страницы списка метрик по умолчанию.
+const DefaultListLimit = 100
+
+// MaxListLimit - максимальный размер страницы списка метрик.
+const MaxListLimit = 1000
+
+// ErrInvalidQuery ошибка невалидных параметров запроса списка метрик.
+var ErrInvalidQuery = errors.New("invalid list query")
+
+// ListQuery - параметры запроса списка метрик.
+type ListQuery struct {
+	Type   string // тип метрики
+	Prefix string // префикс имени
+	Glob   string // шаблон имени, например cpu_*
+	Regex  string // регулярное выражение для имени, см. CheckRegex
+	Sort   string // порядок сортировки, по умолчанию SortByName
+	Limit  int    // размер страницы, по умолчанию DefaultListLimit
+	Cursor string // курсор следующей страницы из ListPage.NextCursor
+}
+
+// ListPage - страница списка метрик.
+type ListPage struct {
+	Metrics    []utils.JSONMetric `json:"metrics"`
+	NextCursor string             `json:"next_cursor,omitempty"` // пустой, если страница последняя
+}
+
+// listCursor - позиция последней метрики страницы.
+type listCursor struct {
+	ID    string `json:"id"`
+	MType string `json:"type"`
+}
+
+func encodeCursor(m utils.JSONMetric) string {
+	data, _ := json.Marshal(listCursor{ID: m.ID, MType: m.MType})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (*listCursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	c := &listCursor{}
+	if err = json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Normalize - метод проверки параметров запроса и заполнения значений по умолчанию.
+func (q *ListQuery) Normalize() error {
+	if q.Type != "" && q.Type != "gauge" && q.Type != "counter" {
+		return errors.Wrapf(ErrInvalidQuery, "unknown metric type %q", q.Type)
+	}
+	if q.Glob != "" {
+		if _, err := path.Match(q.Glob, ""); err != nil {
+			return errors.Wrapf(ErrInvalidQuery, "glob %q: %s", q.Glob, err)
+		}
+	}
+	if q.Regex != "" {
+		if err := CheckRegex(q.Regex); err != nil {
+			return errors.Wrapf(ErrInvalidQuery, "regex %q: %s", q.Regex, err)
+		}
+	}
+	switch q.Sort {
+	case "":
+		q.Sort = SortByName
+	case SortByName, SortByNameDesc, SortByType, SortByTypeDesc:
+	default:
+		return errors.Wrapf(ErrInvalidQuery, "unknown sort order %q", q.Sort)
+	}
+	switch {
+	case q.Limit == 0:
+		q.Limit = DefaultListLimit
+	case q.Limit < 0 || q.Limit > MaxListLimit:
+		return errors.Wrapf(ErrInvalidQuery, "limit must be between 1 and %d", MaxListLimit)
+	}
+	if _, err := decodeCursor(q.Cursor); err != nil {
+		return errors.Wrap(ErrInvalidQuery, "malformed cursor")
+	}
+	return nil
+}
+
+// maxRegexRepeat - максимальное число повторений {m,n} в регулярных выражениях Postgres.
+const maxRegexRepeat = 255
+
+// CheckRegex - метод проверки регулярного выражения для имени.
+// MemStorage выполняет выражение по правилам RE2, PgStorage - оператором ~ по правилам POSIX ARE,
+// поэтому принимается только общая часть синтаксиса, которая выбирает одинаковые имена в обоих хранилищах:
+// символы, ., классы [...] и [[:alpha:]], ^, $, группы (...) и (?:...), |, *, +, ?, {m,n} до 255
+// и экранирование знаков пунктуации. Экранирование букв (\d, \w, \b), флаги (?i), ленивые квантификаторы
+// и именованные группы имеют разный смысл или не поддерживаются и отклоняются.
+func CheckRegex(expr string) error {
+	for i := 0; i < len(expr); i++ {
+		switch {
+		case expr[i] == '\\' && i+1 < len(expr):
+			i++
+			if c := expr[i]; c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+				return fmt.Errorf("escape \\%c is not supported", c)
+			}
+		case strings.HasPrefix(expr[i:], "(?") && !strings.HasPrefix(expr[i:], "(?:"):
+			return fmt.Errorf("group flags are not supported")
+		}
+	}
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return err
+	}
+	return checkRegexNode(re)
+}
+
+func checkRegexNode(re *syntax.Regexp) error {
+	switch re.Op {
+	case syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return fmt.Errorf("word boundary is not supported")
+	case syntax.OpRepeat:
+		if re.Min > maxRegexRepeat || re.Max > maxRegexRepeat {
+			return fmt.Errorf("repeat count exceeds %d", maxRegexRepeat)
+		}
+	}
+	if re.Flags&syntax.NonGreedy != 0 {
+		return fmt.Errorf("non-greedy quantifiers are not supported")
+	}
+	for _, sub := range re.Sub {
+		if err := checkRegexNode(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GlobToRegex - метод преобразования шаблона имени в регулярное выражение.
+// поддерживаются *, ? и классы символов [...], синтаксис совместим с RE2 и Postgres.
+func GlobToRegex(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			}
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// sortKey - ключ метрики для сортировки и курсора.
+func (q ListQuery) sortKey(id, mType string) [2]string {
+	if q.Sort == SortByType || q.Sort == SortByTypeDesc {
+		return [2]string{mType, id}
+	}
+	return [2]string{id, mType}
+}
+
+func (q ListQuery) descending() bool {
+	return strings.HasPrefix(q.Sort, "-")
+}
+
+func lessKey(a, b [2]string) bool {
+	if a[0] != b[0] {
+		return a[0] < b[0]
+	}
+	return a[1] < b[1]
+}
+
+// filterPage - метод выборки страницы метрик в памяти процесса.
+// запрос должен быть предварительно нормализован.
+func filterPage(metrics []utils.JSONMetric, q ListQuery) (ListPage, error) {
+	var globRe, nameRe *regexp.Regexp
+	var err error
+	if q.Glob != "" {
+		if globRe, err = regexp.Compile(GlobToRegex(q.Glob)); err != nil {
+			return ListPage{}, errors.Wrap(ErrInvalidQuery, err.Error())
+		}
+	}
+	if q.Regex != "" {
+		if nameRe, err = regexp.Compile(q.Regex); err != nil {
+			return ListPage{}, errors.Wrap(ErrInvalidQuery, err.Error())
+		}
+	}
+	cursor, _ := decodeCursor(q.Cursor)
+	selected := make([]utils.JSONMetric, 0)
+	for _, m := range metrics {
+		switch {
+		case q.Type != "" && m.MType != q.Type:
+			continue
+		case q.Prefix != "" && !strings.HasPrefix(m.ID, q.Prefix):
+			continue
+		case globRe != nil && !globRe.MatchString(m.ID):
+			continue
+		case nameRe != nil && !nameRe.MatchString(m.ID):
+			continue
+		}
+		if cursor != nil {
+			key, after := q.sortKey(m.ID, m.MType), q.sortKey(cursor.ID, cursor.MType)
+			if q.descending() && !lessKey(key, after) || !q.descending() && !lessKey(after, key) {
+				continue
+			}
+		}
+		selected = append(selected, m)
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		a := q.sortKey(selected[i].ID, selected[i].MType)
+		b := q.sortKey(selected[j].ID, selected[j].MType)
+		if q.descending() {
+			return lessKey(b, a)
+		}
+		return lessKey(a, b)
+	})
+	return makePage(selected, q.Limit), nil
+}
+
+// makePage - метод формирования страницы из выборки, содержащей не более limit+1 метрик.
+func makePage(metrics []utils.JSONMetric, limit int) ListPage {
+	page := ListPage{Metrics: metrics}
+	if len(metrics) > limit {
+		page.Metrics = metrics[:limit]
+		page.NextCursor = encodeCursor(page.Metrics[limit-1])
+	}
+	return page
+}
+
+// buildListSQL - метод построения SQL запроса страницы метрик.
+// сравнение строк выполняется с COLLATE "C", чтобы порядок совпадал с MemStorage.
+func buildListSQL(q ListQuery) (string, []any) {
+	var where []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if q.Type != "" {
+		where = append(where, "type = "+arg(q.Type))
+	}
+	if q.Prefix != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(q.Prefix)
+		where = append(where, "name LIKE "+arg(escaped+"%")+` ESCAPE '\'`)
+	}
+	if q.Glob != "" {
+		where = append(where, "name ~ "+arg(GlobToRegex(q.Glob)))
+	}
+	if q.Regex != "" {
+		where = append(where, "name ~ "+arg(q.Regex))
+	}
+	columns := [2]string{`name COLLATE "C"`, `type COLLATE "C"`}
+	if q.Sort == SortByType || q.Sort == SortByTypeDesc {
+		columns = [2]string{`type COLLATE "C"`, `name COLLATE "C"`}
+	}
+	direction, op := "ASC", ">"
+	if q.descending() {
+		direction, op = "DESC", "<"
+	}
+	if cursor, _ := decodeCursor(q.Cursor); cursor != nil {
+		key := q.sortKey(cursor.ID, cursor.MType)
+		where = append(where, fmt.Sprintf("(%s, %s) %s (%s, %s)", columns[0], columns[1], op, arg(key[0]), arg(key[1])))
+	}
+	query := "SELECT name, type, gauge_value, counter_value FROM metric"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, %s %s LIMIT %s;", columns[0], direction, columns[1], direction, arg(q.Limit+1))
+	return query, args
+}
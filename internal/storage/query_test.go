@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+func TestListQuery_Normalize(t *testing.T) {
+	q := ListQuery{}
+	require.NoError(t, q.Normalize())
+	assert.Equal(t, SortByName, q.Sort)
+	assert.Equal(t, DefaultListLimit, q.Limit)
+
+	tests := []struct {
+		name  string
+		query ListQuery
+	}{
+		{name: "type", query: ListQuery{Type: "histogram"}},
+		{name: "glob", query: ListQuery{Glob: "cpu[1"}},
+		{name: "regex", query: ListQuery{Regex: "cpu("}},
+		{name: "regex escape", query: ListQuery{Regex: `cpu\d`}},
+		{name: "regex flags", query: ListQuery{Regex: `(?i)cpu`}},
+		{name: "sort", query: ListQuery{Sort: "value"}},
+		{name: "limit", query: ListQuery{Limit: MaxListLimit + 1}},
+		{name: "negative limit", query: ListQuery{Limit: -1}},
+		{name: "cursor", query: ListQuery{Cursor: "!!!"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, tt.query.Normalize(), ErrInvalidQuery)
+		})
+	}
+}
+
+func TestCheckRegex(t *testing.T) {
+	for _, expr := range []string{`^cpu[0-9]+$`, `^(Heap|Stack)(?:Alloc|Sys)$`, `[[:digit:]]{2,4}`, `a\.b|c?`} {
+		assert.NoError(t, CheckRegex(expr), expr)
+	}
+	// выражения, которые RE2 и Postgres выполняют по-разному
+	for _, expr := range []string{`\d+`, `\bcpu`, `\w`, `(?i)cpu`, `(?P<name>cpu)`, `cpu.*?`, `a{300}`, `cpu(`} {
+		assert.Error(t, CheckRegex(expr), expr)
+	}
+}
+
+func TestGlobToRegex(t *testing.T) {
+	assert.Equal(t, `^cpu_.*$`, GlobToRegex("cpu_*"))
+	assert.Equal(t, `^Heap.\.x$`, GlobToRegex("Heap?.x"))
+	assert.Equal(t, `^[^ab]1\*$`, GlobToRegex(`[!ab]1\*`))
+	assert.Equal(t, `^\[x$`, GlobToRegex("[x"))
+}
+
+func TestMemStorage_ListMetrics(t *testing.T) {
+	db := NewStorage(&utils.StorageConfig{})
+	_, err := db.UpdateJSONMetrics(context.Background(), []utils.JSONMetric{
+		utils.NewGaugeJSONMetric("HeapAlloc", 1),
+		utils.NewGaugeJSONMetric("HeapSys", 2),
+		utils.NewGaugeJSONMetric("Alloc", 3),
+		utils.NewCounterJSONMetric("PollCount", 4),
+		utils.NewCounterJSONMetric("HeapAlloc", 5),
+	})
+	require.NoError(t, err)
+
+	collect := func(q ListQuery) [][2]string {
+		keys := make([][2]string, 0)
+		for {
+			page, err := db.ListMetrics(context.Background(), q)
+			require.NoError(t, err)
+			for _, m := range page.Metrics {
+				keys = append(keys, [2]string{m.MType, m.ID})
+			}
+			if page.NextCursor == "" {
+				return keys
+			}
+			q.Cursor = page.NextCursor
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query ListQuery
+		want  [][2]string
+	}{
+		{
+			name:  "by name pages of two",
+			query: ListQuery{Limit: 2},
+			want: [][2]string{
+				{"gauge", "Alloc"}, {"counter", "HeapAlloc"}, {"gauge", "HeapAlloc"}, {"gauge", "HeapSys"}, {"counter", "PollCount"},
+			},
+		},
+		{
+			name:  "by name desc",
+			query: ListQuery{Sort: SortByNameDesc, Limit: 3},
+			want: [][2]string{
+				{"counter", "PollCount"}, {"gauge", "HeapSys"}, {"gauge", "HeapAlloc"}, {"counter", "HeapAlloc"}, {"gauge", "Alloc"},
+			},
+		},
+		{
+			name:  "by type",
+			query: ListQuery{Sort: SortByType, Limit: 1},
+			want: [][2]string{
+				{"counter", "HeapAlloc"}, {"counter", "PollCount"}, {"gauge", "Alloc"}, {"gauge", "HeapAlloc"}, {"gauge", "HeapSys"},
+			},
+		},
+		{name: "type filter", query: ListQuery{Type: "counter"}, want: [][2]string{{"counter", "HeapAlloc"}, {"counter", "PollCount"}}},
+		{name: "prefix", query: ListQuery{Prefix: "Heap", Type: "gauge"}, want: [][2]string{{"gauge", "HeapAlloc"}, {"gauge", "HeapSys"}}},
+		{name: "glob", query: ListQuery{Glob: "*Alloc"}, want: [][2]string{{"gauge", "Alloc"}, {"counter", "HeapAlloc"}, {"gauge", "HeapAlloc"}}},
+		{name: "regex", query: ListQuery{Regex: "^(Alloc|PollCount)$"}, want: [][2]string{{"gauge", "Alloc"}, {"counter", "PollCount"}}},
+		{name: "nothing", query: ListQuery{Prefix: "Missing"}, want: [][2]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, collect(tt.query))
+		})
+	}
+}
+
+func TestBuildListSQL(t *testing.T) {
+	q := ListQuery{Type: "gauge", Prefix: "cpu_50%", Glob: "cpu*", Regex: "[0-9]$", Sort: SortByTypeDesc, Limit: 10}
+	q.Cursor = encodeCursor(utils.NewGaugeJSONMetric("cpu_1", 1))
+	query, args := buildListSQL(q)
+	assert.Equal(t, `SELECT name, type, gauge_value, counter_value FROM metric`+
+		` WHERE type = $1 AND name LIKE $2 ESCAPE '\' AND name ~ $3 AND name ~ $4`+
+		` AND (type COLLATE "C", name COLLATE "C") < ($5, $6)`+
+		` ORDER BY type COLLATE "C" DESC, name COLLATE "C" DESC LIMIT $7;`, query)
+	assert.Equal(t, []any{"gauge", `cpu\_50\%%`, "^cpu.*$", "[0-9]$", "gauge", "cpu_1", 11}, args)
+
+	query, args = buildListSQL(ListQuery{Sort: SortByName, Limit: 5})
+	assert.Equal(t, `SELECT name, type, gauge_value, counter_value FROM metric`+
+		` ORDER BY name COLLATE "C" ASC, type COLLATE "C" ASC LIMIT $1;`, query)
+	assert.Equal(t, []any{6}, args)
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// TrackedStorage - обертка над Storage, запоминающая время последнего изменения метрик.
+// время хранится в памяти процесса и после перезапуска неизвестно до следующего изменения.
+type TrackedStorage struct {
+	Storage
+	mutex   sync.RWMutex
+	updated map[string]time.Time
+	now     func() time.Time
+}
+
+// NewTrackedStorage - метод создания обертки над Storage с учетом времени изменения метрик.
+func NewTrackedStorage(db Storage) *TrackedStorage {
+	return &TrackedStorage{Storage: db, updated: make(map[string]time.Time), now: time.Now}
+}
+
+func trackKey(mType, id string) string {
+	return mType + ":" + id
+}
+
+func (s *TrackedStorage) touch(metrics ...utils.JSONMetric) {
+	now := s.now()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, m := range metrics {
+		s.updated[trackKey(m.MType, m.ID)] = now
+	}
+}
+
+// UpdatedAt - метод получения времени последнего изменения метрики.
+func (s *TrackedStorage) UpdatedAt(mType, id string) (time.Time, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	t, ok := s.updated[trackKey(mType, id)]
+	return t, ok
+}
+
+func (s *TrackedStorage) UpdateJSONMetric(ctx context.Context, metric utils.JSONMetric) (utils.JSONMetric, error) {
+	result, err := s.Storage.UpdateJSONMetric(ctx, metric)
+	if err == nil {
+		s.touch(metric)
+	}
+	return result, err
+}
+
+func (s *TrackedStorage) ReplaceMetrics(ctx context.Context, metrics []utils.JSONMetric) error {
+	err := s.Storage.ReplaceMetrics(ctx, metrics)
+	if err == nil {
+		s.mutex.Lock()
+		s.updated = make(map[string]time.Time)
+		s.mutex.Unlock()
+		s.touch(metrics...)
+	}
+	return err
+}
+
+func (s *TrackedStorage) DeleteMetric(ctx context.Context, mName, mType string) error {
+	err := s.Storage.DeleteMetric(ctx, mName, mType)
+	if err == nil {
+		s.mutex.Lock()
+		delete(s.updated, trackKey(mType, mName))
+		s.mutex.Unlock()
+	}
+	return err
+}
+
+func (s *TrackedStorage) UpdateJSONMetrics(ctx context.Context, metrics []utils.JSONMetric) ([]utils.JSONMetric, error) {
+	result, err := s.Storage.UpdateJSONMetrics(ctx, metrics)
+	if err == nil {
+		s.touch(metrics...)
+	}
+	return result, err
+}
@@ -0,0 +1,281 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// Форматы выгрузки и загрузки метрик.
+const (
+	FormatNDJSON = "ndjson" // по одной метрике JSON в строке
+	FormatCSV    = "csv"    // заголовок id,type,value и по одной метрике в строке
+)
+
+// Режимы загрузки метрик.
+const (
+	ImportMerge   = "merge"   // counter суммируются с текущими значениями, gauge перезаписываются
+	ImportReplace = "replace" // все метрики хранилища заменяются загружаемыми
+)
+
+// exportFlushSize - количество метрик, после записи которых выгрузка сбрасывается в w.
+const exportFlushSize = 1000
+
+// importBatchSize - количество метрик в одном обновлении хранилища при загрузке в режиме merge.
+const importBatchSize = 1000
+
+// ErrTransferFormat ошибка неподдерживаемого формата выгрузки.
+var ErrTransferFormat = errors.New("unsupported format, expected ndjson or csv")
+
+// ErrImportMode ошибка неподдерживаемого режима загрузки.
+var ErrImportMode = errors.New("unsupported import mode, expected merge or replace")
+
+// ErrMetricID ошибка пустого имени метрики при загрузке.
+var ErrMetricID = errors.New("empty metric id")
+
+// RecordError - ошибка разбора записи загружаемых данных.
+type RecordError struct {
+	Record int   // номер записи начиная с 1, заголовок csv считается частью первой записи
+	Err    error // причина ошибки
+}
+
+// Error - метод приведения ошибки к строке.
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("record %d: %v", e.Record, e.Err)
+}
+
+// Unwrap - метод получения причины ошибки.
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+var csvHeader = []string{"id", "type", "value"}
+
+// IsValidFormat - метод проверки формата выгрузки.
+func IsValidFormat(format string) bool {
+	return format == FormatNDJSON || format == FormatCSV
+}
+
+// Export - метод выгрузки всех метрик хранилища в w.
+// метрики читаются Snapshot на один момент времени и пишутся в w по мере чтения пачками по exportFlushSize,
+// до успешного начала чтения в w ничего не пишется.
+// возвращает количество выгруженных метрик.
+func Export(ctx context.Context, db Storage, w io.Writer, format string) (int, error) {
+	writer, err := newMetricWriter(w, format)
+	if err != nil {
+		return 0, err
+	}
+	exported := 0
+	err = db.Snapshot(ctx, func(metric utils.JSONMetric) error {
+		if err := writer.Write(metric); err != nil {
+			return err
+		}
+		exported++
+		if exported%exportFlushSize == 0 {
+			return writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return exported, err
+	}
+	return exported, writer.Flush()
+}
+
+// WriteMetrics - метод записи списка метрик в w в формате выгрузки.
+// хеш-суммы метрик в csv не записываются.
+func WriteMetrics(w io.Writer, metrics []utils.JSONMetric, format string) error {
+	writer, err := newMetricWriter(w, format)
+	if err != nil {
+		return err
+	}
+	for _, metric := range metrics {
+		if err = writer.Write(metric); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// metricWriter - последовательная запись метрик в формате выгрузки.
+// заголовок csv записывается вместе с первым вызовом Flush.
+type metricWriter struct {
+	buf     *bufio.Writer
+	encoder *json.Encoder
+	csv     *csv.Writer
+}
+
+func newMetricWriter(w io.Writer, format string) (*metricWriter, error) {
+	buf := bufio.NewWriter(w)
+	switch format {
+	case FormatNDJSON:
+		return &metricWriter{buf: buf, encoder: json.NewEncoder(buf)}, nil
+	case FormatCSV:
+		writer := csv.NewWriter(buf)
+		if err := writer.Write(csvHeader); err != nil {
+			return nil, err
+		}
+		return &metricWriter{buf: buf, csv: writer}, nil
+	default:
+		return nil, ErrTransferFormat
+	}
+}
+
+// Write - метод записи одной метрики в буфер.
+func (m *metricWriter) Write(metric utils.JSONMetric) error {
+	if m.csv != nil {
+		return m.csv.Write([]string{metric.ID, metric.MType, metric.ValueString()})
+	}
+	return m.encoder.Encode(metric)
+}
+
+// Flush - метод записи буфера в w.
+func (m *metricWriter) Flush() error {
+	if m.csv != nil {
+		m.csv.Flush()
+		if err := m.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return m.buf.Flush()
+}
+
+// metricReader - последовательное чтение метрик, в конце возвращает io.EOF.
+type metricReader func() (utils.JSONMetric, error)
+
+func newNDJSONReader(r io.Reader) metricReader {
+	decoder := json.NewDecoder(r)
+	return func() (utils.JSONMetric, error) {
+		var metric utils.JSONMetric
+		err := decoder.Decode(&metric)
+		return metric, err
+	}
+}
+
+func newCSVReader(r io.Reader) metricReader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(csvHeader)
+	header := true
+	return func() (utils.JSONMetric, error) {
+		record, err := reader.Read()
+		if err != nil {
+			return utils.JSONMetric{}, err
+		}
+		if header {
+			header = false
+			if record[0] != csvHeader[0] || record[1] != csvHeader[1] || record[2] != csvHeader[2] {
+				return utils.JSONMetric{}, errors.New("csv header must be id,type,value")
+			}
+			if record, err = reader.Read(); err != nil {
+				return utils.JSONMetric{}, err
+			}
+		}
+		return utils.NewJSONMetric(record[1], record[0], record[2])
+	}
+}
+
+func newMetricReader(r io.Reader, format string) (metricReader, error) {
+	switch format {
+	case FormatNDJSON:
+		return newNDJSONReader(r), nil
+	case FormatCSV:
+		return newCSVReader(r), nil
+	default:
+		return nil, ErrTransferFormat
+	}
+}
+
+func validateRecord(metric utils.JSONMetric) error {
+	if metric.ID == "" {
+		return ErrMetricID
+	}
+	if !metric.IsValidType() {
+		return utils.ErrMetricType
+	}
+	if !metric.IsValidValue() {
+		return utils.ErrMetricValue
+	}
+	return nil
+}
+
+// Import - метод загрузки метрик из r в хранилище.
+// в режиме merge метрики применяются пачками как обычные обновления,
+// при ошибке в середине данных уже примененные пачки остаются в хранилище.
+// в режиме replace данные сначала читаются целиком и при ошибке хранилище не меняется.
+// возвращает количество загруженных метрик.
+func Import(ctx context.Context, db Storage, r io.Reader, format, mode string) (int, error) {
+	next, err := newMetricReader(r, format)
+	if err != nil {
+		return 0, err
+	}
+	if mode != ImportMerge && mode != ImportReplace {
+		return 0, ErrImportMode
+	}
+	imported := 0
+	batch := make([]utils.JSONMetric, 0, importBatchSize)
+	for record := 1; ; record++ {
+		metric, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			err = validateRecord(metric)
+		}
+		if err != nil {
+			return imported, &RecordError{Record: record, Err: err}
+		}
+		metric.Hash = nil
+		batch = append(batch, metric)
+		if mode == ImportMerge && len(batch) == importBatchSize {
+			if _, err = db.UpdateJSONMetrics(ctx, batch); err != nil {
+				return imported, err
+			}
+			imported += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if mode == ImportReplace {
+		if err := db.ReplaceMetrics(ctx, batch); err != nil {
+			return 0, err
+		}
+		return len(batch), nil
+	}
+	if len(batch) > 0 {
+		if _, err := db.UpdateJSONMetrics(ctx, batch); err != nil {
+			return imported, err
+		}
+		imported += len(batch)
+	}
+	return imported, nil
+}
+
+// ReadMetrics - метод чтения всех метрик из r в формате выгрузки с проверкой каждой записи.
+// хеш-суммы записей отбрасываются, при ошибке записи возвращается RecordError.
+func ReadMetrics(r io.Reader, format string) ([]utils.JSONMetric, error) {
+	next, err := newMetricReader(r, format)
+	if err != nil {
+		return nil, err
+	}
+	metrics := make([]utils.JSONMetric, 0)
+	for record := 1; ; record++ {
+		metric, err := next()
+		if err == io.EOF {
+			return metrics, nil
+		}
+		if err == nil {
+			err = validateRecord(metric)
+		}
+		if err != nil {
+			return nil, &RecordError{Record: record, Err: err}
+		}
+		metric.Hash = nil
+		metrics = append(metrics, metric)
+	}
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+func newTransferStorage(gauges map[string]float64, counters map[string]int64) *MemStorage {
+	return &MemStorage{
+		GaugeMetrics:   gauges,
+		CounterMetrics: counters,
+		Config:         &utils.StorageConfig{StoreInterval: 1},
+	}
+}
+
+func TestExportImport_RoundTrip(t *testing.T) {
+	for _, format := range []string{FormatNDJSON, FormatCSV} {
+		t.Run(format, func(t *testing.T) {
+			src := newTransferStorage(
+				map[string]float64{"Alloc": 123.456, "Tiny": 1e-300},
+				map[string]int64{"PollCount": 42},
+			)
+			var buf bytes.Buffer
+			n, err := Export(context.Background(), src, &buf, format)
+			require.NoError(t, err)
+			assert.Equal(t, 3, n)
+
+			dst := newTransferStorage(map[string]float64{}, map[string]int64{})
+			n, err = Import(context.Background(), dst, &buf, format, ImportReplace)
+			require.NoError(t, err)
+			assert.Equal(t, 3, n)
+			assert.Equal(t, src.GaugeMetrics, dst.GaugeMetrics)
+			assert.Equal(t, src.CounterMetrics, dst.CounterMetrics)
+		})
+	}
+}
+
+func TestExport_Large(t *testing.T) {
+	gauges := make(map[string]float64, exportFlushSize+10)
+	for i := 0; i < exportFlushSize+10; i++ {
+		gauges[fmt.Sprintf("g%05d", i)] = float64(i)
+	}
+	var buf bytes.Buffer
+	n, err := Export(context.Background(), newTransferStorage(gauges, map[string]int64{}), &buf, FormatNDJSON)
+	require.NoError(t, err)
+	assert.Equal(t, exportFlushSize+10, n)
+
+	metrics, err := ReadMetrics(&buf, FormatNDJSON)
+	require.NoError(t, err)
+	require.Len(t, metrics, exportFlushSize+10)
+	assert.Equal(t, "g00000", metrics[0].ID)
+	assert.Equal(t, fmt.Sprintf("g%05d", exportFlushSize+9), metrics[exportFlushSize+9].ID)
+}
+
+// failingSnapshotStorage - хранилище, чтение снимка которого завершается ошибкой.
+type failingSnapshotStorage struct {
+	*MemStorage
+}
+
+func (s failingSnapshotStorage) Snapshot(context.Context, func(utils.JSONMetric) error) error {
+	return errors.New("connection lost")
+}
+
+func TestExport_Error(t *testing.T) {
+	db := failingSnapshotStorage{newTransferStorage(map[string]float64{"Alloc": 1}, map[string]int64{})}
+	var buf bytes.Buffer
+	_, err := Export(context.Background(), db, &buf, FormatCSV)
+	require.Error(t, err)
+	// до начала чтения ничего не записывается, поэтому ошибку можно вернуть клиенту
+	assert.Zero(t, buf.Len())
+}
+
+func TestImport_Modes(t *testing.T) {
+	data := "id,type,value\nPollCount,counter,5\nAlloc,gauge,2.5\n"
+	tests := []struct {
+		name     string
+		mode     string
+		gauges   map[string]float64
+		counters map[string]int64
+	}{
+		{
+			name:     "merge",
+			mode:     ImportMerge,
+			gauges:   map[string]float64{"Alloc": 2.5, "Sys": 1},
+			counters: map[string]int64{"PollCount": 15},
+		},
+		{
+			name:     "replace",
+			mode:     ImportReplace,
+			gauges:   map[string]float64{"Alloc": 2.5},
+			counters: map[string]int64{"PollCount": 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTransferStorage(map[string]float64{"Alloc": 1, "Sys": 1}, map[string]int64{"PollCount": 10})
+			n, err := Import(context.Background(), db, strings.NewReader(data), FormatCSV, tt.mode)
+			require.NoError(t, err)
+			assert.Equal(t, 2, n)
+			assert.Equal(t, tt.gauges, db.GaugeMetrics)
+			assert.Equal(t, tt.counters, db.CounterMetrics)
+		})
+	}
+}
+
+func TestImport_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		mode   string
+		data   string
+		errMsg string
+	}{
+		{name: "format", format: "xml", mode: ImportMerge, errMsg: ErrTransferFormat.Error()},
+		{name: "mode", format: FormatCSV, mode: "append", errMsg: ErrImportMode.Error()},
+		{name: "csv header", format: FormatCSV, mode: ImportReplace, data: "name,type,value\n", errMsg: "record 1"},
+		{name: "csv value", format: FormatCSV, mode: ImportReplace, data: "id,type,value\nA,gauge,1\nB,gauge,x\n", errMsg: "record 2: invalid metric value"},
+		{name: "ndjson type", format: FormatNDJSON, mode: ImportReplace, data: `{"id":"A","type":"histogram","value":1}`, errMsg: "record 1: invalid metric type"},
+		{name: "ndjson id", format: FormatNDJSON, mode: ImportReplace, data: `{"type":"counter","delta":1}`, errMsg: "record 1: empty metric id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTransferStorage(map[string]float64{"Alloc": 1}, map[string]int64{})
+			_, err := Import(context.Background(), db, strings.NewReader(tt.data), tt.format, tt.mode)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errMsg)
+			assert.Equal(t, map[string]float64{"Alloc": 1}, db.GaugeMetrics)
+		})
+	}
+}
+
+func TestReadMetrics(t *testing.T) {
+	metrics, err := ReadMetrics(strings.NewReader("id,type,value\nAlloc,gauge,1.5\nPollCount,counter,3\n"), FormatCSV)
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	assert.Equal(t, 1.5, *metrics[0].Value)
+	assert.Equal(t, int64(3), *metrics[1].Delta)
+
+	_, err = ReadMetrics(strings.NewReader(`{"id":"a","type":"gauge","value":1,"hash":"x"}`+"\n"+`{"id":"","type":"gauge","value":1}`), FormatNDJSON)
+	var recordErr *RecordError
+	require.ErrorAs(t, err, &recordErr)
+	assert.Equal(t, 2, recordErr.Record)
+
+	_, err = ReadMetrics(strings.NewReader(""), "xml")
+	assert.ErrorIs(t, err, ErrTransferFormat)
+}
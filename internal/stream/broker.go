@@ -0,0 +1,213 @@
+// Package stream - публикация изменений метрик подписчикам.
+package stream
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tiraill/go_collect_metrics/internal/telemetry"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// DefaultHistorySize - количество последних событий, доступных для возобновления подписки.
+const DefaultHistorySize = 1024
+
+// DefaultBufferSize - размер буфера событий одного подписчика.
+const DefaultBufferSize = 256
+
+// Event - событие изменения метрики.
+type Event struct {
+	ID     uint64           // монотонно возрастающий номер события
+	Time   time.Time        // время публикации
+	Metric utils.JSONMetric // значение метрики после изменения
+}
+
+// Filter - фильтр событий подписки.
+type Filter struct {
+	Type  string          // тип метрики, пустой - все типы
+	Names map[string]bool // имена метрик, пустой - все имена
+}
+
+// Match - метод проверки соответствия метрики фильтру.
+func (f Filter) Match(m utils.JSONMetric) bool {
+	if f.Type != "" && m.MType != f.Type {
+		return false
+	}
+	if len(f.Names) > 0 && !f.Names[m.ID] {
+		return false
+	}
+	return true
+}
+
+// Subscription - подписка на события изменения метрик.
+// если подписчик не успевает читать события, новые события отбрасываются, а их количество учитывается.
+type Subscription struct {
+	broker  *Broker
+	filter  Filter
+	events  chan Event
+	dropped atomic.Uint64
+	missed  uint64
+	once    sync.Once
+}
+
+// Events - канал событий подписки, закрывается при вызове Close.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// TakeDropped - метод получения количества отброшенных событий с момента прошлого вызова.
+func (s *Subscription) TakeDropped() uint64 {
+	return s.dropped.Swap(0)
+}
+
+// Missed - количество событий, пропущенных до подписки и недоступных в истории.
+// ненулевое значение означает, что клиенту нужно заново получить все метрики.
+func (s *Subscription) Missed() uint64 {
+	return s.missed
+}
+
+// Close - метод завершения подписки.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.broker.unsubscribe(s)
+	})
+}
+
+func (s *Subscription) deliver(e Event) {
+	if !s.filter.Match(e.Metric) {
+		return
+	}
+	select {
+	case s.events <- e:
+	default:
+		s.dropped.Add(1)
+		telemetry.StreamDropped.With().Inc()
+	}
+}
+
+// Broker - рассылка событий изменения метрик подписчикам.
+// последние события хранятся в кольцевом буфере для возобновления подписки по Last-Event-ID.
+type Broker struct {
+	epoch       int64
+	mutex       sync.Mutex
+	lastID      uint64
+	history     []Event
+	next        int
+	bufferSize  int
+	subscribers map[*Subscription]struct{}
+	closed      bool
+	now         func() time.Time
+}
+
+// NewBroker - метод создания объекта Broker.
+func NewBroker(historySize, bufferSize int) *Broker {
+	if historySize < 1 {
+		historySize = DefaultHistorySize
+	}
+	if bufferSize < 1 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Broker{
+		epoch:       time.Now().UnixNano(),
+		history:     make([]Event, 0, historySize),
+		bufferSize:  bufferSize,
+		subscribers: make(map[*Subscription]struct{}),
+		now:         time.Now,
+	}
+}
+
+// Publish - метод публикации изменений метрик.
+// метод не блокируется на медленных подписчиках.
+func (b *Broker) Publish(metrics ...utils.JSONMetric) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := b.now()
+	for _, m := range metrics {
+		b.lastID++
+		e := Event{ID: b.lastID, Time: now, Metric: m}
+		if len(b.history) < cap(b.history) {
+			b.history = append(b.history, e)
+		} else {
+			b.history[b.next] = e
+			b.next = (b.next + 1) % len(b.history)
+		}
+		for s := range b.subscribers {
+			s.deliver(e)
+		}
+	}
+}
+
+// Subscribe - метод создания подписки.
+// если lastID больше нуля, подписчик сначала получает события из истории с номером больше lastID.
+// буфер подписки увеличивается на размер истории, чтобы события истории не отбрасывались.
+func (b *Broker) Subscribe(filter Filter, lastID uint64) *Subscription {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		s := &Subscription{broker: b, filter: filter, events: make(chan Event)}
+		close(s.events)
+		return s
+	}
+	var replay []Event
+	if lastID > 0 && lastID < b.lastID {
+		replay = b.since(lastID)
+	}
+	s := &Subscription{broker: b, filter: filter, events: make(chan Event, b.bufferSize+len(replay))}
+	if len(replay) > 0 && replay[0].ID > lastID+1 {
+		s.missed = replay[0].ID - lastID - 1
+	}
+	for _, e := range replay {
+		s.deliver(e)
+	}
+	b.subscribers[s] = struct{}{}
+	telemetry.StreamSubscribers.With().Inc()
+	return s
+}
+
+// Epoch - идентификатор экземпляра Broker.
+// номера событий разных экземпляров, например до и после перезапуска сервера, не сравнимы.
+func (b *Broker) Epoch() int64 {
+	return b.epoch
+}
+
+// LastID - номер последнего опубликованного события.
+func (b *Broker) LastID() uint64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.lastID
+}
+
+// since - события из истории с номером больше lastID в порядке публикации.
+func (b *Broker) since(lastID uint64) []Event {
+	ordered := append(append(make([]Event, 0, len(b.history)), b.history[b.next:]...), b.history[:b.next]...)
+	for i, e := range ordered {
+		if e.ID > lastID {
+			return ordered[i:]
+		}
+	}
+	return nil
+}
+
+// Close - метод завершения всех подписок, например при остановке сервера.
+// после закрытия новые подписки сразу завершаются.
+func (b *Broker) Close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.closed = true
+	for s := range b.subscribers {
+		delete(b.subscribers, s)
+		telemetry.StreamSubscribers.With().Dec()
+		close(s.events)
+	}
+}
+
+func (b *Broker) unsubscribe(s *Subscription) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if _, ok := b.subscribers[s]; ok {
+		delete(b.subscribers, s)
+		telemetry.StreamSubscribers.With().Dec()
+		close(s.events)
+	}
+}
@@ -0,0 +1,119 @@
+package stream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+func receive(t *testing.T, sub *Subscription, n int) []Event {
+	events := make([]Event, 0, n)
+	for i := 0; i < n; i++ {
+		select {
+		case e := <-sub.Events():
+			events = append(events, e)
+		default:
+			t.Fatalf("expected %d events, got %d", n, len(events))
+		}
+	}
+	return events
+}
+
+func TestBroker_Filter(t *testing.T) {
+	b := NewBroker(10, 10)
+	all := b.Subscribe(Filter{}, 0)
+	gauges := b.Subscribe(Filter{Type: "gauge"}, 0)
+	named := b.Subscribe(Filter{Names: map[string]bool{"PollCount": true}}, 0)
+
+	b.Publish(utils.NewGaugeJSONMetric("Alloc", 1), utils.NewCounterJSONMetric("PollCount", 2))
+
+	events := receive(t, all, 2)
+	assert.Equal(t, uint64(1), events[0].ID)
+	assert.Equal(t, uint64(2), events[1].ID)
+	assert.Equal(t, "Alloc", receive(t, gauges, 1)[0].Metric.ID)
+	assert.Equal(t, "PollCount", receive(t, named, 1)[0].Metric.ID)
+	assert.Empty(t, gauges.Events())
+	assert.Equal(t, uint64(2), b.LastID())
+}
+
+func TestBroker_SlowSubscriber(t *testing.T) {
+	b := NewBroker(10, 2)
+	sub := b.Subscribe(Filter{}, 0)
+	for i := 0; i < 5; i++ {
+		b.Publish(utils.NewGaugeJSONMetric("Alloc", float64(i)))
+	}
+	events := receive(t, sub, 2)
+	assert.Equal(t, []uint64{1, 2}, []uint64{events[0].ID, events[1].ID})
+	assert.Equal(t, uint64(3), sub.TakeDropped())
+	assert.Equal(t, uint64(0), sub.TakeDropped())
+}
+
+func TestBroker_Resume(t *testing.T) {
+	b := NewBroker(3, 10)
+	for i := 1; i <= 5; i++ {
+		b.Publish(utils.NewGaugeJSONMetric("Alloc", float64(i)))
+	}
+
+	sub := b.Subscribe(Filter{}, 3)
+	events := receive(t, sub, 2)
+	assert.Equal(t, []uint64{4, 5}, []uint64{events[0].ID, events[1].ID})
+	assert.Equal(t, uint64(0), sub.Missed())
+
+	// события 2 вытеснены из истории размером 3
+	sub = b.Subscribe(Filter{}, 1)
+	events = receive(t, sub, 3)
+	assert.Equal(t, uint64(3), events[0].ID)
+	assert.Equal(t, uint64(1), sub.Missed())
+
+	sub = b.Subscribe(Filter{}, 5)
+	assert.Empty(t, sub.Events())
+}
+
+func TestBroker_ResumeLargeHistory(t *testing.T) {
+	b := NewBroker(10, 2)
+	for i := 1; i <= 8; i++ {
+		b.Publish(utils.NewGaugeJSONMetric("Alloc", float64(i)))
+	}
+
+	// история длиннее буфера подписчика доставляется целиком, место под новые события остается
+	sub := b.Subscribe(Filter{}, 1)
+	b.Publish(utils.NewGaugeJSONMetric("Alloc", 9), utils.NewGaugeJSONMetric("Alloc", 10))
+	events := receive(t, sub, 9)
+	assert.Equal(t, uint64(2), events[0].ID)
+	assert.Equal(t, uint64(10), events[8].ID)
+	assert.Zero(t, sub.TakeDropped())
+}
+
+func TestBroker_Close(t *testing.T) {
+	b := NewBroker(10, 10)
+	sub := b.Subscribe(Filter{}, 0)
+	b.Close()
+	_, ok := <-sub.Events()
+	assert.False(t, ok)
+	sub.Close()
+
+	sub = b.Subscribe(Filter{}, 0)
+	_, ok = <-sub.Events()
+	assert.False(t, ok)
+}
+
+func TestStorage_Publish(t *testing.T) {
+	b := NewBroker(10, 10)
+	db := NewStorage(storage.NewStorage(&utils.StorageConfig{}), b)
+	sub := b.Subscribe(Filter{}, 0)
+	defer sub.Close()
+
+	_, err := db.UpdateJSONMetric(context.Background(), utils.NewCounterJSONMetric("PollCount", 2))
+	require.NoError(t, err)
+	_, err = db.UpdateJSONMetrics(context.Background(), []utils.JSONMetric{utils.NewCounterJSONMetric("PollCount", 3)})
+	require.NoError(t, err)
+
+	events := receive(t, sub, 2)
+	assert.Equal(t, int64(2), *events[0].Metric.Delta)
+	assert.Equal(t, int64(5), *events[1].Metric.Delta, "event carries the stored total")
+}
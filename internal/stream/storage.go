@@ -0,0 +1,52 @@
+package stream
+
+import (
+	"context"
+
+	"github.com/tiraill/go_collect_metrics/internal/storage"
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// Storage - обертка над storage.Storage, публикующая успешные изменения метрик.
+type Storage struct {
+	storage.Storage
+	broker *Broker
+}
+
+// NewStorage - метод создания хранилища с публикацией изменений.
+func NewStorage(db storage.Storage, broker *Broker) *Storage {
+	return &Storage{Storage: db, broker: broker}
+}
+
+// Broker - метод получения объекта рассылки изменений.
+func (s *Storage) Broker() *Broker {
+	return s.broker
+}
+
+func (s *Storage) UpdateJSONMetric(ctx context.Context, metric utils.JSONMetric) (utils.JSONMetric, error) {
+	result, err := s.Storage.UpdateJSONMetric(ctx, metric)
+	if err == nil {
+		s.broker.Publish(result)
+	}
+	return result, err
+}
+
+func (s *Storage) UpdateJSONMetrics(ctx context.Context, metrics []utils.JSONMetric) ([]utils.JSONMetric, error) {
+	result, err := s.Storage.UpdateJSONMetrics(ctx, metrics)
+	if err == nil {
+		s.broker.Publish(result...)
+	}
+	return result, err
+}
+
+// ReplaceMetrics - замена всех метрик с публикацией итоговых значений.
+// удаленные метрики, в том числе через DeleteMetric, не публикуются, подписчикам, которым это важно, нужно заново получить все метрики.
+func (s *Storage) ReplaceMetrics(ctx context.Context, metrics []utils.JSONMetric) error {
+	if err := s.Storage.ReplaceMetrics(ctx, metrics); err != nil {
+		return err
+	}
+	if all, err := s.Storage.GetAllMetrics(ctx); err == nil {
+		s.broker.Publish(all...)
+	}
+	return nil
+}
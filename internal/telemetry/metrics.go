@@ -0,0 +1,112 @@
+package telemetry
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// Default - реестр внутренних метрик сервера.
+var Default = NewRegistry()
+
+var (
+	// HTTPRequests - количество HTTP запросов по роуту, методу и статус коду.
+	HTTPRequests = Default.NewCounterVec("http_requests_total", "Total number of HTTP requests.", "route", "method", "code")
+	// HTTPDuration - длительность обработки HTTP запросов.
+	HTTPDuration = Default.NewHistogramVec("http_request_duration_seconds", "HTTP request latency in seconds.", DefaultBuckets, "route", "method")
+	// HTTPInFlight - количество HTTP запросов в обработке.
+	HTTPInFlight = Default.NewGaugeVec("http_requests_in_flight", "Number of HTTP requests being served.")
+	// GRPCRequests - количество gRPC вызовов по методу и статус коду.
+	GRPCRequests = Default.NewCounterVec("grpc_requests_total", "Total number of gRPC requests.", "method", "code")
+	// GRPCDuration - длительность обработки gRPC вызовов.
+	GRPCDuration = Default.NewHistogramVec("grpc_request_duration_seconds", "gRPC request latency in seconds.", DefaultBuckets, "method")
+	// GRPCInFlight - количество gRPC вызовов в обработке.
+	GRPCInFlight = Default.NewGaugeVec("grpc_requests_in_flight", "Number of gRPC requests being served.")
+	// ValidationErrors - количество метрик, не прошедших валидацию, по типу ошибки.
+	ValidationErrors = Default.NewCounterVec("metric_validation_errors_total", "Total number of rejected metrics by error type.", "transport", "error")
+	// StorageDuration - длительность операций с хранилищем.
+	StorageDuration = Default.NewHistogramVec("storage_operation_duration_seconds", "Storage operation latency in seconds.", DefaultBuckets, "backend", "operation")
+	// StorageErrors - количество ошибок операций с хранилищем.
+	StorageErrors = Default.NewCounterVec("storage_operation_errors_total", "Total number of failed storage operations.", "backend", "operation")
+	// FlushDuration - длительность сохранения MemStorage в файл.
+	FlushDuration = Default.NewHistogramVec("storage_file_flush_duration_seconds", "MemStorage file flush duration in seconds.", DefaultBuckets)
+	// StreamSubscribers - количество подписчиков потока изменений метрик.
+	StreamSubscribers = Default.NewGaugeVec("stream_subscribers", "Number of metric update stream subscribers.")
+	// StreamDropped - количество событий, отброшенных из-за переполнения буфера подписчика.
+	StreamDropped = Default.NewCounterVec("stream_dropped_events_total", "Total number of update events dropped for slow subscribers.")
+	// FlushErrors - количество ошибок сохранения MemStorage в файл.
+	FlushErrors = Default.NewCounterVec("storage_file_flush_errors_total", "Total number of failed MemStorage file flushes.")
+	// AuditDropped - количество записей журнала изменений, отброшенных из-за переполнения очереди.
+	AuditDropped = Default.NewCounterVec("audit_records_dropped_total", "Total number of audit records dropped because the audit queue was full.")
+)
+
+// Метрики агента, отдаются сервером диагностики агента.
+var (
+	// AgentReports - количество отчетов агента по серверу и результату: ok, error или skipped.
+	AgentReports = Default.NewCounterVec("agent_reports_total", "Total number of agent reports by server and result.", "server", "result")
+	// AgentReportDuration - длительность отправки отчета на сервер.
+	AgentReportDuration = Default.NewHistogramVec("agent_report_duration_seconds", "Agent report latency in seconds.", DefaultBuckets, "server")
+	// AgentServerUp - состояние сервера по последней отправке или проверке готовности: 1 - здоров, 0 - нет.
+	AgentServerUp = Default.NewGaugeVec("agent_server_up", "Whether the server accepted the last report or readiness check.", "server")
+	// AgentServerActive - сервер, принимающий отчеты в режиме failover: 1 - текущий, 0 - резервный.
+	AgentServerActive = Default.NewGaugeVec("agent_server_active", "Whether the server receives reports in failover mode.", "server")
+)
+
+// ValidationErrorLabel - метод получения значения метки для ошибки валидации метрики.
+func ValidationErrorLabel(err error) string {
+	switch {
+	case errors.Is(err, utils.ErrMetricHash):
+		return "hash"
+	case errors.Is(err, utils.ErrMetricType):
+		return "type"
+	case errors.Is(err, utils.ErrMetricValue):
+		return "value"
+	default:
+		return "other"
+	}
+}
+
+// ObserveValidationError - метод учета ошибки валидации метрики.
+func ObserveValidationError(transport string, err error) {
+	ValidationErrors.With(transport, ValidationErrorLabel(err)).Inc()
+}
+
+// Since - метод получения времени, прошедшего с момента start, в секундах.
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
+
+// DiagAddress - метод получения адреса сервера диагностики для открытия порта.
+// если хост не задан, например :9101, сервер доступен только с loopback адреса.
+func DiagAddress(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || host != "" {
+		return address
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+// NewServer - метод создания HTTP сервера диагностики.
+// сервер отдает внутренние метрики на /metrics, если withPprof - еще и профили pprof на /debug/pprof/.
+// профили раскрывают аргументы запуска процесса и память, поэтому сервер не проверяет доступ
+// и должен слушать адрес, недоступный извне.
+func NewServer(address string, withPprof bool) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Default.Handler())
+	if withPprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	return &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
@@ -0,0 +1,37 @@
+package telemetry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagAddress(t *testing.T) {
+	assert.Equal(t, "127.0.0.1:9101", DiagAddress(":9101"))
+	assert.Equal(t, "0.0.0.0:9101", DiagAddress("0.0.0.0:9101"))
+	assert.Equal(t, "10.0.0.1:9101", DiagAddress("10.0.0.1:9101"))
+	assert.Equal(t, "invalid", DiagAddress("invalid"))
+}
+
+func TestNewServer_Pprof(t *testing.T) {
+	tests := []struct {
+		name       string
+		withPprof  bool
+		path       string
+		statusCode int
+	}{
+		{name: "metrics", path: "/metrics", statusCode: http.StatusOK},
+		{name: "pprof disabled", path: "/debug/pprof/cmdline", statusCode: http.StatusNotFound},
+		{name: "pprof enabled", withPprof: true, path: "/debug/pprof/cmdline", statusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer("127.0.0.1:0", tt.withPprof)
+			w := httptest.NewRecorder()
+			server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, tt.statusCode, w.Code)
+		})
+	}
+}
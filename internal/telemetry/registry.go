@@ -0,0 +1,376 @@
+// Package telemetry - внутренние метрики сервера и агента в формате Prometheus.
+package telemetry
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets - границы бакетов гистограммы длительности по умолчанию, в секундах.
+var DefaultBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// collector - общий интерфейс семейства метрик.
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry - реестр внутренних метрик.
+type Registry struct {
+	mutex      sync.RWMutex
+	collectors map[string]collector
+}
+
+// NewRegistry - метод создания реестра метрик.
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+func (r *Registry) register(c collector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.collectors[c.name()]; ok {
+		panic(fmt.Sprintf("telemetry: duplicate metric %s", c.name()))
+	}
+	r.collectors[c.name()] = c
+}
+
+// WriteText - метод записи всех метрик реестра в текстовом формате Prometheus.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mutex.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	collectors := make([]collector, 0, len(names))
+	for _, name := range names {
+		collectors = append(collectors, r.collectors[name])
+	}
+	r.mutex.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler - метод возвращает HTTP обработчик для экспорта метрик реестра.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("content-type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		r.WriteText(w)
+	})
+}
+
+// vec - общая часть семейств метрик с метками.
+type vec[T any] struct {
+	fname  string
+	help   string
+	labels []string
+	mutex  sync.RWMutex
+	series map[string]*T
+	keys   map[string][]string
+	create func() *T
+}
+
+func newVec[T any](name, help string, labels []string, create func() *T) *vec[T] {
+	return &vec[T]{
+		fname:  name,
+		help:   help,
+		labels: labels,
+		series: make(map[string]*T),
+		keys:   make(map[string][]string),
+		create: create,
+	}
+}
+
+func (v *vec[T]) name() string {
+	return v.fname
+}
+
+func (v *vec[T]) with(values []string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("telemetry: %s expects %d label values, got %d", v.fname, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mutex.RLock()
+	s, ok := v.series[key]
+	v.mutex.RUnlock()
+	if ok {
+		return s
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if s, ok = v.series[key]; ok {
+		return s
+	}
+	s = v.create()
+	v.series[key] = s
+	v.keys[key] = append([]string(nil), values...)
+	return s
+}
+
+// sorted - метод возвращает серии, отсортированные по значениям меток.
+func (v *vec[T]) sorted() ([][]string, []*T) {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := v.keys[keys[i]], v.keys[keys[j]]
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+	values := make([][]string, 0, len(keys))
+	series := make([]*T, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, v.keys[key])
+		series = append(series, v.series[key])
+	}
+	return values, series
+}
+
+func (v *vec[T]) writeHeader(w io.Writer, mType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.fname, v.help, v.fname, mType)
+}
+
+func formatLabels(names, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(names)+len(extra)/2)
+	for i, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%q", name, values[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=%q", extra[i], extra[i+1]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// atomicFloat - значение float64 с блокировкой.
+type atomicFloat struct {
+	mutex sync.Mutex
+	value float64
+}
+
+func (f *atomicFloat) add(delta float64) {
+	f.mutex.Lock()
+	f.value += delta
+	f.mutex.Unlock()
+}
+
+func (f *atomicFloat) set(value float64) {
+	f.mutex.Lock()
+	f.value = value
+	f.mutex.Unlock()
+}
+
+func (f *atomicFloat) get() float64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.value
+}
+
+// Counter - монотонно возрастающий счетчик.
+type Counter struct {
+	value atomicFloat
+}
+
+// Inc - метод увеличения счетчика на единицу.
+func (c *Counter) Inc() {
+	c.value.add(1)
+}
+
+// Add - метод увеличения счетчика на неотрицательное значение.
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+	c.value.add(delta)
+}
+
+// Value - метод получения текущего значения счетчика.
+func (c *Counter) Value() float64 {
+	return c.value.get()
+}
+
+// CounterVec - семейство счетчиков с метками.
+type CounterVec struct {
+	*vec[Counter]
+}
+
+// NewCounterVec - метод создания и регистрации семейства счетчиков.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(name, help, labels, func() *Counter { return &Counter{} })}
+	r.register(c)
+	return c
+}
+
+// With - метод получения счетчика по значениям меток.
+func (c *CounterVec) With(values ...string) *Counter {
+	return c.with(values)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.writeHeader(w, "counter")
+	values, series := c.sorted()
+	for i, s := range series {
+		fmt.Fprintf(w, "%s%s %s\n", c.fname, formatLabels(c.labels, values[i]), formatFloat(s.Value()))
+	}
+}
+
+// Gauge - значение, которое может увеличиваться и уменьшаться.
+type Gauge struct {
+	value atomicFloat
+}
+
+// Set - метод установки значения.
+func (g *Gauge) Set(value float64) {
+	g.value.set(value)
+}
+
+// Add - метод изменения значения на delta.
+func (g *Gauge) Add(delta float64) {
+	g.value.add(delta)
+}
+
+// Inc - метод увеличения значения на единицу.
+func (g *Gauge) Inc() {
+	g.value.add(1)
+}
+
+// Dec - метод уменьшения значения на единицу.
+func (g *Gauge) Dec() {
+	g.value.add(-1)
+}
+
+// Value - метод получения текущего значения.
+func (g *Gauge) Value() float64 {
+	return g.value.get()
+}
+
+// GaugeVec - семейство gauge метрик с метками.
+type GaugeVec struct {
+	*vec[Gauge]
+}
+
+// NewGaugeVec - метод создания и регистрации семейства gauge метрик.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newVec(name, help, labels, func() *Gauge { return &Gauge{} })}
+	r.register(g)
+	return g
+}
+
+// With - метод получения gauge метрики по значениям меток.
+func (g *GaugeVec) With(values ...string) *Gauge {
+	return g.with(values)
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.writeHeader(w, "gauge")
+	values, series := g.sorted()
+	for i, s := range series {
+		fmt.Fprintf(w, "%s%s %s\n", g.fname, formatLabels(g.labels, values[i]), formatFloat(s.Value()))
+	}
+}
+
+// Histogram - распределение значений по бакетам.
+type Histogram struct {
+	mutex   sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// Observe - метод добавления значения в гистограмму.
+func (h *Histogram) Observe(value float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	i := sort.SearchFloat64s(h.buckets, value)
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.sum += value
+	h.count++
+}
+
+// Count - метод получения количества наблюдений.
+func (h *Histogram) Count() uint64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.count
+}
+
+func (h *Histogram) snapshot() ([]uint64, float64, uint64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	cumulative := make([]uint64, len(h.counts))
+	var total uint64
+	for i, c := range h.counts {
+		total += c
+		cumulative[i] = total
+	}
+	return cumulative, h.sum, h.count
+}
+
+// HistogramVec - семейство гистограмм с метками.
+type HistogramVec struct {
+	*vec[Histogram]
+	buckets []float64
+}
+
+// NewHistogramVec - метод создания и регистрации семейства гистограмм.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	h := &HistogramVec{buckets: sorted}
+	h.vec = newVec(name, help, labels, func() *Histogram {
+		return &Histogram{buckets: sorted, counts: make([]uint64, len(sorted))}
+	})
+	r.register(h)
+	return h
+}
+
+// With - метод получения гистограммы по значениям меток.
+func (h *HistogramVec) With(values ...string) *Histogram {
+	return h.with(values)
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.writeHeader(w, "histogram")
+	values, series := h.sorted()
+	for i, s := range series {
+		cumulative, sum, count := s.snapshot()
+		for j, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.fname, formatLabels(h.labels, values[i], "le", formatFloat(bound)), cumulative[j])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.fname, formatLabels(h.labels, values[i], "le", "+Inf"), count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.fname, formatLabels(h.labels, values[i]), formatFloat(sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.fname, formatLabels(h.labels, values[i]), count)
+	}
+}
@@ -0,0 +1,73 @@
+package telemetry
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("requests_total", "Total requests.", "route", "code")
+	inFlight := r.NewGaugeVec("in_flight", "In flight requests.")
+	duration := r.NewHistogramVec("duration_seconds", "Latency.", []float64{1, 0.1}, "route")
+
+	requests.With("/update/", "200").Inc()
+	requests.With("/update/", "200").Add(2)
+	requests.With("/update/", "200").Add(-1)
+	requests.With("/", "500").Inc()
+	inFlight.With().Inc()
+	inFlight.With().Inc()
+	inFlight.With().Dec()
+	duration.With("/").Observe(0.05)
+	duration.With("/").Observe(0.5)
+	duration.With("/").Observe(3)
+
+	var text bytes.Buffer
+	require.NoError(t, r.WriteText(&text))
+	assert.Equal(t, `# HELP duration_seconds Latency.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{route="/",le="0.1"} 1
+duration_seconds_bucket{route="/",le="1"} 2
+duration_seconds_bucket{route="/",le="+Inf"} 3
+duration_seconds_sum{route="/"} 3.55
+duration_seconds_count{route="/"} 3
+# HELP in_flight In flight requests.
+# TYPE in_flight gauge
+in_flight 1
+# HELP requests_total Total requests.
+# TYPE requests_total counter
+requests_total{route="/",code="500"} 1
+requests_total{route="/update/",code="200"} 3
+`, text.String())
+}
+
+func TestRegistry_Panics(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("requests_total", "Total requests.", "route")
+	assert.Panics(t, func() { r.NewCounterVec("requests_total", "Duplicate.") })
+	assert.Panics(t, func() { c.With("/", "200") })
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("requests_total", "Total requests.").With().Inc()
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, 200, rec.Code)
+	assert.Contains(t, rec.Header().Get("content-type"), "text/plain")
+	assert.Contains(t, rec.Body.String(), "requests_total 1\n")
+}
+
+func TestValidationErrorLabel(t *testing.T) {
+	assert.Equal(t, "hash", ValidationErrorLabel(utils.ErrMetricHash))
+	assert.Equal(t, "type", ValidationErrorLabel(utils.ErrMetricType))
+	assert.Equal(t, "value", ValidationErrorLabel(errors.Wrap(utils.ErrMetricValue, "bad")))
+	assert.Equal(t, "other", ValidationErrorLabel(errors.New("unexpected")))
+}
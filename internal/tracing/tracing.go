@@ -0,0 +1,127 @@
+// Package tracing - распределенная трассировка OpenTelemetry агента, сервера и хранилища.
+// контекст трассировки передается в заголовках HTTP и метаданных gRPC в формате W3C Trace Context.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+// Экспортеры span.
+const (
+	ExporterNone   = "none"   // span не экспортируются, контекст трассировки передается дальше
+	ExporterStdout = "stdout" // span выводятся в stdout в формате JSON
+	ExporterOTLP   = "otlp"   // span отправляются коллектору по OTLP/HTTP
+)
+
+// DefaultEndpoint - адрес локального коллектора OTLP/HTTP.
+const DefaultEndpoint = "http://localhost:4318"
+
+// otlpTracesPath - путь приема span коллектором OTLP/HTTP.
+const otlpTracesPath = "/v1/traces"
+
+// otlpTimeout - время на отправку одной пачки span коллектору.
+const otlpTimeout = 10 * time.Second
+
+// instrumentationName - имя библиотеки инструментирования в span.
+const instrumentationName = "github.com/tiraill/go_collect_metrics"
+
+// Check - метод проверки конфигурации трассировки.
+func Check(config utils.TraceConfig) error {
+	switch config.Exporter {
+	case "", ExporterNone, ExporterStdout:
+	case ExporterOTLP:
+		u, err := url.Parse(config.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("trace_endpoint %q must be http(s)://host:port", config.Endpoint)
+		}
+	default:
+		return fmt.Errorf("trace_exporter %q must be none, stdout or otlp", config.Exporter)
+	}
+	if config.SampleRatio < 0 || config.SampleRatio > 1 {
+		return fmt.Errorf("trace_sample_ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+// Setup - метод настройки трассировки процесса service.
+// возвращает метод остановки, который отправляет накопленные span, его нужно вызвать перед завершением процесса.
+// span запросов с родительским span создаются по решению родителя, остальные - с долей SampleRatio.
+func Setup(config utils.TraceConfig, service string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New()
+	case ExporterOTLP:
+		exporter, err = newOTLPExporter(config.Endpoint)
+	default:
+		err = Check(config)
+	}
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(service))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// newOTLPExporter - метод создания экспортера span коллектору по OTLP/HTTP на адрес endpoint, например http://localhost:4318.
+// если путь в endpoint не задан, span отправляются на /v1/traces.
+func newOTLPExporter(endpoint string) (sdktrace.SpanExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	path := strings.TrimRight(u.Path, "/")
+	if !strings.HasSuffix(path, otlpTracesPath) {
+		path += otlpTracesPath
+	}
+	options := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(path),
+		otlptracehttp.WithTimeout(otlpTimeout),
+	}
+	if u.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	return otlptracehttp.New(context.Background(), options...)
+}
+
+// Start - метод создания дочернего span операции name.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End - метод завершения span, ошибка операции записывается в span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/tiraill/go_collect_metrics/internal/utils"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  utils.TraceConfig
+		wantErr bool
+	}{
+		{name: "default", config: utils.TraceConfig{}},
+		{name: "stdout", config: utils.TraceConfig{Exporter: ExporterStdout, SampleRatio: 0.5}},
+		{name: "otlp", config: utils.TraceConfig{Exporter: ExporterOTLP, Endpoint: DefaultEndpoint, SampleRatio: 1}},
+		{name: "otlp without endpoint", config: utils.TraceConfig{Exporter: ExporterOTLP}, wantErr: true},
+		{name: "otlp with grpc endpoint", config: utils.TraceConfig{Exporter: ExporterOTLP, Endpoint: "localhost:4317"}, wantErr: true},
+		{name: "unknown exporter", config: utils.TraceConfig{Exporter: "jaeger"}, wantErr: true},
+		{name: "invalid ratio", config: utils.TraceConfig{SampleRatio: 1.5}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(tt.config)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var got coltracepb.ExportTraceServiceRequest
+	var path, contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, proto.Unmarshal(body, &got))
+	}))
+	defer server.Close()
+
+	exporter, err := newOTLPExporter(server.URL)
+	require.NoError(t, err)
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+	tracer := provider.Tracer("test")
+	ctx, parent := tracer.Start(context.Background(), "report")
+	_, child := tracer.Start(ctx, "send", trace.WithAttributes(attribute.Int("metrics", 3)))
+	End(child, errors.New("unavailable"))
+	parent.End()
+	require.NoError(t, provider.Shutdown(context.Background()))
+
+	assert.Equal(t, "/v1/traces", path)
+	assert.Equal(t, "application/x-protobuf", contentType)
+	require.Len(t, got.ResourceSpans, 1)
+	require.Len(t, got.ResourceSpans[0].ScopeSpans, 1)
+	spans := got.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 2)
+	send, report := spans[0], spans[1]
+	assert.Equal(t, "report", report.Name)
+	assert.Empty(t, report.ParentSpanId)
+	assert.Equal(t, "send", send.Name)
+	parentID := parent.SpanContext().SpanID()
+	assert.Equal(t, parentID[:], send.ParentSpanId)
+	assert.Equal(t, tracepb.Status_STATUS_CODE_ERROR, send.Status.Code)
+	assert.Equal(t, "unavailable", send.Status.Message)
+}
+
+func TestOTLPExporter_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad payload", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	provider := sdktrace.NewTracerProvider()
+	_, span := provider.Tracer("test").Start(context.Background(), "report")
+	span.End()
+	ro, ok := span.(sdktrace.ReadOnlySpan)
+	require.True(t, ok)
+	exporter, err := newOTLPExporter(server.URL + "/v1/traces/")
+	require.NoError(t, err)
+	err = exporter.ExportSpans(context.Background(), []sdktrace.ReadOnlySpan{ro})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "400")
+}
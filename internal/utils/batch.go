@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// PartialParam - параметр запроса, включающий режим частичной загрузки списка метрик.
+const PartialParam = "partial"
+
+// Статусы метрик в ответе частичной загрузки.
+const (
+	BatchStatusOK    = "ok"
+	BatchStatusError = "error"
+)
+
+// Коды ошибок отдельных метрик.
+const (
+	MetricCodeInvalid = "invalid_metric"
+	MetricCodeHash    = "invalid_metric_hash"
+	MetricCodeType    = "invalid_metric_type"
+	MetricCodeValue   = "invalid_metric_value"
+)
+
+// MetricErrorCode - метод получения кода ошибки валидации метрики.
+func MetricErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrMetricHash):
+		return MetricCodeHash
+	case errors.Is(err, ErrMetricType):
+		return MetricCodeType
+	case errors.Is(err, ErrMetricValue):
+		return MetricCodeValue
+	default:
+		return MetricCodeInvalid
+	}
+}
+
+// BatchResult - результат загрузки одной метрики из списка.
+type BatchResult struct {
+	Index   int         `json:"index"`             // позиция метрики в запросе
+	ID      string      `json:"id"`                // имя метрики
+	MType   string      `json:"type"`              // тип метрики
+	Status  string      `json:"status"`            // ok или error
+	Code    string      `json:"code,omitempty"`    // код ошибки
+	Message string      `json:"message,omitempty"` // описание ошибки
+	Metric  *JSONMetric `json:"metric,omitempty"`  // значение метрики после записи
+}
+
+// BatchResponse - ответ загрузки списка метрик в режиме частичной загрузки.
+type BatchResponse struct {
+	Applied int           `json:"applied"` // количество записанных метрик
+	Failed  int           `json:"failed"`  // количество отклоненных метрик
+	Results []BatchResult `json:"results"` // результаты в порядке метрик запроса
+}
+
+// NewBatchResponse - метод создания ответа частичной загрузки по результатам валидации.
+// errs - ошибки валидации по позициям метрик в запросе.
+// возвращает валидные метрики для записи, их результаты заполняются методом SetStored.
+func NewBatchResponse(metrics []JSONMetric, errs map[int]error) ([]JSONMetric, BatchResponse) {
+	valid := make([]JSONMetric, 0, len(metrics)-len(errs))
+	response := BatchResponse{Results: make([]BatchResult, len(metrics))}
+	for i, metric := range metrics {
+		result := BatchResult{Index: i, ID: metric.ID, MType: metric.MType, Status: BatchStatusOK}
+		if err, ok := errs[i]; ok {
+			result.Status, result.Code, result.Message = BatchStatusError, MetricErrorCode(err), err.Error()
+			response.Failed++
+		} else {
+			valid = append(valid, metric)
+		}
+		response.Results[i] = result
+	}
+	return valid, response
+}
+
+// SetStored - метод заполнения результатов записанных метрик.
+// stored - значения, возвращенные хранилищем, в порядке валидных метрик.
+func (r *BatchResponse) SetStored(stored []JSONMetric, hashKey string) {
+	next := 0
+	for i := range r.Results {
+		if r.Results[i].Status != BatchStatusOK || next >= len(stored) {
+			continue
+		}
+		metric := stored[next]
+		metric.Hash = CalcHash(metric.String(), hashKey)
+		r.Results[i].Metric = &metric
+		next++
+	}
+	r.Applied = next
+}
+
+// Rejected - метод получения результатов отклоненных метрик.
+func (r BatchResponse) Rejected() []BatchResult {
+	rejected := make([]BatchResult, 0, r.Failed)
+	for _, result := range r.Results {
+		if result.Status != BatchStatusOK {
+			rejected = append(rejected, result)
+		}
+	}
+	return rejected
+}
+
+// LoadBatchResponse - метод разбора ответа частичной загрузки списка метрик.
+func LoadBatchResponse(body []byte) (BatchResponse, error) {
+	var response BatchResponse
+	err := json.Unmarshal(body, &response)
+	return response, err
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBatchResponse(t *testing.T) {
+	metrics := []JSONMetric{
+		NewGaugeJSONMetric("Alloc", 1),
+		{ID: "Bad", MType: "histogram"},
+		NewCounterJSONMetric("PollCount", 2),
+	}
+	valid, response := NewBatchResponse(metrics, map[int]error{1: ErrMetricType})
+	assert.Equal(t, []JSONMetric{metrics[0], metrics[2]}, valid)
+	assert.Equal(t, 1, response.Failed)
+
+	response.SetStored([]JSONMetric{NewGaugeJSONMetric("Alloc", 1), NewCounterJSONMetric("PollCount", 5)}, "key")
+	assert.Equal(t, 2, response.Applied)
+	require.NotNil(t, response.Results[2].Metric)
+	assert.Equal(t, int64(5), *response.Results[2].Metric.Delta)
+	assert.Equal(t, CalcHash("PollCount:counter:5", "key"), response.Results[2].Metric.Hash)
+	assert.Nil(t, response.Results[1].Metric)
+	assert.Equal(t, []BatchResult{
+		{Index: 1, ID: "Bad", MType: "histogram", Status: BatchStatusError, Code: MetricCodeType, Message: ErrMetricType.Error()},
+	}, response.Rejected())
+}
+
+func TestMetricErrorCode(t *testing.T) {
+	assert.Equal(t, MetricCodeHash, MetricErrorCode(ErrMetricHash))
+	assert.Equal(t, MetricCodeValue, MetricErrorCode(errors.Wrap(ErrMetricValue, "Alloc")))
+	assert.Equal(t, MetricCodeInvalid, MetricErrorCode(errors.New("other")))
+}
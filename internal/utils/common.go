@@ -55,6 +55,9 @@ func ToFloat64(v interface{}) float64 {
 	}
 }
 
+// BodyHashHeader - заголовок с HMAC-SHA256 подписью тела запроса или ответа.
+const BodyHashHeader = "HashSHA256"
+
 // CalcHash - метод для вычисления хеш-суммы
 func CalcHash(data, hashKey string) *string {
 	if hashKey == "" {
@@ -65,3 +68,9 @@ func CalcHash(data, hashKey string) *string {
 	dst := fmt.Sprintf("%x", h.Sum(nil))
 	return &dst
 }
+
+// IsValidBodyHash - метод проверки подписи тела запроса или ответа.
+func IsValidBodyHash(body []byte, hash, hashKey string) bool {
+	actual := CalcHash(string(body), hashKey)
+	return actual != nil && hmac.Equal([]byte(*actual), []byte(hash))
+}
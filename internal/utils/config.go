@@ -1,246 +1,175 @@
 package utils
 
 import (
-	"encoding/json"
-	"flag"
 	"fmt"
-	"log"
 	"net/netip"
-	"os"
-	"strconv"
+	"strings"
 	"time"
 )
 
+// Структуры конфигурации заполняются пакетом config, json теги совпадают с ключами файла конфигурации.
+
 // AgentConfig - структура конфигурации агента.
 type AgentConfig struct {
-	Address        string        `json:"address,omitempty"`
-	ReportInterval time.Duration `json:"report_interval,omitempty"`
-	PollInterval   time.Duration `json:"poll_interval,omitempty"`
-	HashKey        string        `json:"hash_key,omitempty"`
-	CryptoKey      string        `json:"crypto_key,omitempty"`
-	RateLimit      int           `json:"rate_limit,omitempty"`
+	Address         string        `json:"address,omitempty"` // адрес сервера или список адресов через запятую
+	ReportInterval  time.Duration `json:"report_interval,omitempty"`
+	PollInterval    time.Duration `json:"poll_interval,omitempty"`
+	HashKey         string        `json:"hash_key,omitempty"`
+	CryptoKey       string        `json:"crypto_key,omitempty"`
+	RateLimit       int           `json:"rate_limit,omitempty"`
+	FanoutMode      string        `json:"fanout_mode,omitempty"`      // failover или replicate при нескольких серверах
+	HealthInterval  time.Duration `json:"health_interval,omitempty"`  // период проверки готовности серверов
+	DiagAddress     string        `json:"diag_address,omitempty"`     // адрес сервера диагностики, пустой - отключен
+	DiagPprof       bool          `json:"diag_pprof,omitempty"`       // профили pprof на сервере диагностики
+	CollectTimeout  time.Duration `json:"collect_timeout,omitempty"`  // время на один сбор метрик
+	SendTimeout     time.Duration `json:"send_timeout,omitempty"`     // время на отправку отчета одному серверу
+	ShutdownTimeout time.Duration `json:"shutdown_timeout,omitempty"` // время на последний сбор и отправку при остановке
+	SpoolSize       int           `json:"spool_size,omitempty"`       // отчетов в очереди на отправку, 0 - без очереди
+	PartialBatch    bool          `json:"partial_batch,omitempty"`    // частичная загрузка отчетов, сервер сохраняет валидные метрики
+	Log             LogConfig     `json:"-"`
+	Trace           TraceConfig   `json:"-"`
 }
 
-// ServerConfig - структура конфигурации сервера.
-type ServerConfig struct {
-	Address          string        `json:"address,omitempty"`
-	HashKey          string        `json:"hash_key,omitempty"`
-	CryptoKey        string        `json:"crypto_key,omitempty"`
-	TrustedSubnet    string        `json:"trusted_subnet,omitempty"`
-	TrustedNetPrefix *netip.Prefix `json:"-"`
+// Servers - метод получения списка адресов серверов в порядке приоритета.
+func (c AgentConfig) Servers() []string {
+	servers := make([]string, 0, 1)
+	for _, address := range strings.Split(c.Address, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			servers = append(servers, address)
+		}
+	}
+	return servers
 }
 
-// StorageConfig - структура конфигурации хранилища.
-type StorageConfig struct {
-	StoreInterval time.Duration `json:"store_interval,omitempty"`
-	StoreFile     string        `json:"store_file,omitempty"`
-	Restore       bool          `json:"restore,omitempty"`
-	DatabaseDSN   string        `json:"database_dsn,omitempty"`
+// TraceConfig - структура конфигурации трассировки.
+type TraceConfig struct {
+	Exporter    string  `json:"trace_exporter,omitempty"`     // none, stdout или otlp
+	Endpoint    string  `json:"trace_endpoint,omitempty"`     // адрес коллектора OTLP/HTTP
+	SampleRatio float64 `json:"trace_sample_ratio,omitempty"` // доля трассируемых запросов без родительского span
 }
 
-// EnvError - тип ошибки, связанный с получением переменной из окружения.
-type EnvError struct {
-	EnvName string
-	EnvType string
-	Err     error
+// LogConfig - структура конфигурации журнала.
+type LogConfig struct {
+	Level    string `json:"log_level,omitempty"`    // уровень по умолчанию: debug, info, warn, error
+	Levels   string `json:"log_levels,omitempty"`   // уровни компонентов, например http=debug,storage=warn
+	Format   string `json:"log_format,omitempty"`   // json или console
+	Sampling int    `json:"log_sampling,omitempty"` // одинаковых записей в секунду до прореживания, 0 - без прореживания
 }
 
-// метод преобразования ошибки EnvError к строке.
-func (e *EnvError) Error() string {
-	return fmt.Sprintf("Filed to parse %s env: %s: %v", e.EnvType, e.EnvName, e.Err)
+// ServerConfig - структура конфигурации сервера.
+type ServerConfig struct {
+	Address         string         `json:"address,omitempty"`
+	GRPCAddress     string         `json:"grpc_address,omitempty"` // адрес gRPC сервера, равный Address - общий порт с HTTP, пустой - отключен
+	HashKey         string         `json:"hash_key,omitempty"`
+	CryptoKey       string         `json:"crypto_key,omitempty"`
+	TrustedSubnet   string         `json:"trusted_subnet,omitempty"`      // подсети для изменения метрик
+	TrustedRead     string         `json:"trusted_read_subnet,omitempty"` // подсети для чтения метрик
+	TrustedProxies  string         `json:"trusted_proxies,omitempty"`     // подсети доверенных прокси
+	MetricsSubnet   string         `json:"metrics_subnet,omitempty"`      // подсети для экспорта метрик в Prometheus
+	MetricsToken    string         `json:"metrics_token,omitempty"`       // bearer токен для экспорта метрик в Prometheus
+	DiagAddress     string         `json:"diag_address,omitempty"`        // адрес сервера диагностики, пустой - отключен
+	DiagPprof       bool           `json:"diag_pprof,omitempty"`          // профили pprof на сервере диагностики
+	AdminToken      string         `json:"admin_token,omitempty"`         // bearer токен методов администрирования, пустой - отключены
+	ReplayWindow    time.Duration  `json:"replay_window,omitempty"`
+	NonceCacheSize  int            `json:"nonce_cache_size,omitempty"`
+	WritePrefixes   []netip.Prefix `json:"-"`
+	ReadPrefixes    []netip.Prefix `json:"-"`
+	ProxyPrefixes   []netip.Prefix `json:"-"`
+	MetricsPrefixes []netip.Prefix `json:"-"`
+	Limits          LimitsConfig   `json:"-"`
 }
 
-func newEnvError(eName, eType string, err error) error {
-	return &EnvError{
-		EnvName: eName,
-		EnvType: eType,
-		Err:     err,
-	}
+// LimitsConfig - структура конфигурации ограничений запросов к серверу.
+type LimitsConfig struct {
+	RateLimit           float64 `json:"client_rate_limit,omitempty"`     // запросов в секунду от одного клиента, 0 - без ограничений
+	RateBurst           int     `json:"client_rate_burst,omitempty"`     // максимальное количество запросов подряд
+	MaxBodySize         int     `json:"max_body_size,omitempty"`         // максимальный размер тела запроса в байтах
+	MaxDecompressedSize int     `json:"max_decompressed_size,omitempty"` // максимальный размер распакованного тела запроса в байтах
+	MaxBatchSize        int     `json:"max_batch_size,omitempty"`        // максимальное количество метрик в одном запросе
+	MaxImportSize       int     `json:"max_import_size,omitempty"`       // максимальный размер загрузки метрик до и после распаковки в байтах
 }
 
-func loadFromFile(filePath string, v any) error {
-	if filePath == "" {
-		return nil
+// ParseSubnets - метод разбора списков подсетей.
+// если подсети для чтения не заданы, чтение ограничивается подсетями для изменения метрик,
+// если не заданы подсети для экспорта в Prometheus - подсетями для чтения.
+func (c *ServerConfig) ParseSubnets() error {
+	var err error
+	if c.WritePrefixes, err = ParsePrefixes(c.TrustedSubnet); err != nil {
+		return fmt.Errorf("invalid trusted subnet: %w", err)
+	}
+	c.ReadPrefixes = c.WritePrefixes
+	if c.TrustedRead != "" {
+		if c.ReadPrefixes, err = ParsePrefixes(c.TrustedRead); err != nil {
+			return fmt.Errorf("invalid trusted read subnet: %w", err)
+		}
 	}
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return err
+	if c.ProxyPrefixes, err = ParsePrefixes(c.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid trusted proxies: %w", err)
 	}
-	err = json.Unmarshal(data, v)
-	if err != nil {
-		return err
+	c.MetricsPrefixes = c.ReadPrefixes
+	if c.MetricsSubnet != "" {
+		if c.MetricsPrefixes, err = ParsePrefixes(c.MetricsSubnet); err != nil {
+			return fmt.Errorf("invalid metrics subnet: %w", err)
+		}
 	}
 	return nil
 }
 
-func isFlagPassed(name string) bool {
-	found := false
-	flag.Visit(func(f *flag.Flag) {
-		if f.Name == name {
-			found = true
-		}
-	})
-	return found
-}
-
-func lookupString(flagName, envName, valueFromConfigFile, defaultFlagValue string) string {
-	var result string
-	if valueFromConfigFile != "" {
-		result = valueFromConfigFile
-	} else {
-		result = defaultFlagValue
-	}
-	if isFlagPassed(flagName) {
-		result = defaultFlagValue
-	}
-	valueEnv, ok := os.LookupEnv(envName)
-	if ok {
-		result = valueEnv
-	}
-	log.Printf("env %s = %v", envName, result)
-	return result
+// IsReplayProtected - метод проверяет, включена ли защита от повторной отправки запросов.
+// для проверки подписи запроса необходим ключ HashKey.
+func (c ServerConfig) IsReplayProtected() bool {
+	return c.HashKey != "" && c.ReplayWindow > 0
 }
 
-func lookupInt(flagName, envName string, valueFromConfigFile, defaultFlagValue int) (int, error) {
-	var result int
-	if valueFromConfigFile != 0 {
-		result = valueFromConfigFile
-	} else {
-		result = defaultFlagValue
-	}
-	if isFlagPassed(flagName) {
-		result = defaultFlagValue
-	}
-	valueEnv, ok := os.LookupEnv(envName)
-	if ok {
-		intVar, err := strconv.Atoi(valueEnv)
-		if err != nil {
-			return result, newEnvError(envName, "int", err)
-		} else {
-			result = intVar
-		}
-	}
-	log.Printf("env %s = %v", envName, result)
-	return result, nil
-}
+// DefaultDeleteReplayWindow - допустимое расхождение времени подписи запроса на удаление метрики,
+// если защита от повторной отправки остальных запросов выключена.
+const DefaultDeleteReplayWindow = 5 * time.Minute
 
-func lookupDuration(flagName, envName string, valueFromConfigFile, defaultFlagValue time.Duration) (time.Duration, error) {
-	var result time.Duration
-	if valueFromConfigFile != 0 {
-		result = valueFromConfigFile
-	} else {
-		result = defaultFlagValue
+// StampWindow - метод получения допустимого расхождения времени подписи запроса.
+// подпись запроса на удаление метрики проверяется при любом заданном ключе HashKey: подпись utils.DeletePayload
+// не меняется между запросами, и без защиты перехваченный запрос можно повторить после нового создания метрики.
+func (c ServerConfig) StampWindow() time.Duration {
+	if c.ReplayWindow > 0 {
+		return c.ReplayWindow
 	}
-	if isFlagPassed(flagName) {
-		result = defaultFlagValue
-	}
-	valueEnv, ok := os.LookupEnv(envName)
-	if ok {
-		value, err := time.ParseDuration(valueEnv)
-		if err != nil {
-			return result, newEnvError(envName, "duration", err)
-		} else {
-			result = value
-		}
-	}
-	log.Printf("env %s = %v", envName, result)
-	return result, nil
+	return DefaultDeleteReplayWindow
 }
 
-func lookupBool(flagName, envName string, valueFromConfigFile, defaultFlagValue bool) (bool, error) {
-	result := valueFromConfigFile
-	if isFlagPassed(flagName) {
-		result = defaultFlagValue
-	}
-	valueEnv, ok := os.LookupEnv(envName)
-	if ok {
-		value, err := strconv.ParseBool(valueEnv)
-		if err != nil {
-			return result, newEnvError(envName, "bool", err)
-		} else {
-			result = value
-		}
-	}
-	log.Printf("env %s = %v", envName, result)
-	return result, nil
+// StorageConfig - структура конфигурации хранилища.
+type StorageConfig struct {
+	StoreInterval time.Duration `json:"store_interval,omitempty"`
+	StoreFile     string        `json:"store_file,omitempty"`
+	Restore       bool          `json:"restore,omitempty"`
+	DatabaseDSN   string        `json:"database_dsn,omitempty"`
 }
 
-// MakeAgentConfig - метод создания конфигурации агента.
-// значения, переданные через параметры запуска, переопределяются значениями из переменных окружения.
-func MakeAgentConfig(
-	configFile string, address string, reportInterval time.Duration,
-	pollInterval time.Duration, hashKey string, cryptoKey string, rateLimit int,
-) (AgentConfig, error) {
-
-	var err error = nil
-	cfg := AgentConfig{}
-	configFile = lookupString("config", "CONFIG", "", configFile)
-	err = loadFromFile(configFile, &cfg)
-	if err != nil {
-		return cfg, err
-	}
-	cfg.Address = lookupString("a", "ADDRESS", cfg.Address, address)
-
-	cfg.ReportInterval, err = lookupDuration("r", "REPORT_INTERVAL", cfg.ReportInterval, reportInterval)
-	if err != nil {
-		return cfg, err
-	}
-	cfg.PollInterval, err = lookupDuration("p", "POLL_INTERVAL", cfg.PollInterval, pollInterval)
-	if err != nil {
-		return cfg, err
-	}
-	cfg.HashKey = lookupString("k", "KEY", cfg.HashKey, hashKey)
-	cfg.CryptoKey = lookupString("crypto-key", "CRYPTO_KEY", cfg.CryptoKey, cryptoKey)
-	cfg.RateLimit, err = lookupInt("l", "RATE_LIMIT", cfg.RateLimit, rateLimit)
-	if err != nil {
-		return cfg, err
-	}
-	return cfg, nil
+// AuditConfig - структура конфигурации журнала изменений метрик.
+type AuditConfig struct {
+	AuditFile       string        `json:"audit_file,omitempty"`        // файл журнала в формате JSON lines
+	AuditMaxSize    int           `json:"audit_max_size,omitempty"`    // размер файла журнала в байтах для ротации
+	AuditMaxBackups int           `json:"audit_max_backups,omitempty"` // количество хранимых файлов после ротации
+	AuditStdout     bool          `json:"audit_stdout,omitempty"`      // вывод журнала в stdout
+	AuditURL        string        `json:"audit_url,omitempty"`         // адрес webhook для отправки журнала
+	AuditTimeout    time.Duration `json:"audit_timeout,omitempty"`     // таймаут запроса к webhook
 }
 
-// MakeServerConfig - метод создания конфигурации сервера.
-// значения, переданные через параметры запуска, переопределяются значениями из переменных окружения.
-func MakeServerConfig(configFile, address, hashKey, cryptoKey, trustedSubnet string) (ServerConfig, error) {
-	var err error = nil
-	cfg := ServerConfig{}
-	configFile = lookupString("config", "CONFIG", "", configFile)
-	err = loadFromFile(configFile, &cfg)
-	if err != nil {
-		return cfg, err
-	}
-	cfg.Address = lookupString("a", "ADDRESS", cfg.Address, address)
-	cfg.HashKey = lookupString("k", "KEY", cfg.HashKey, hashKey)
-	cfg.CryptoKey = lookupString("crypto-key", "CRYPTO_KEY", cfg.CryptoKey, cryptoKey)
-	cfg.TrustedSubnet = lookupString("t", "TRUSTED_SUBNET", cfg.TrustedSubnet, trustedSubnet)
-	if cfg.TrustedSubnet != "" {
-		network, err := netip.ParsePrefix(cfg.TrustedSubnet)
-		if err != nil {
-			return cfg, err
-		}
-		cfg.TrustedNetPrefix = &network
-	}
-	return cfg, nil
+// AlertRule - правило оповещения о выходе значения метрики за порог.
+type AlertRule struct {
+	Name      string  `json:"name"`
+	Metric    string  `json:"metric"`             // имя метрики или шаблон имени, например cpu_*
+	Type      string  `json:"type,omitempty"`     // gauge или counter, пустой - любой тип
+	Op        string  `json:"op"`                 // сравнение значения с порогом: >, >=, <, <=, ==, !=
+	Threshold float64 `json:"threshold"`          // порог
+	For       string  `json:"for,omitempty"`      // длительность нарушения до срабатывания, например 5m
+	Severity  string  `json:"severity,omitempty"` // важность, передается в оповещении
 }
 
-// MakeStorageConfig - метод создания конфигурации хранилища.
-// значения, переданные через параметры запуска, переопределяются значениями из переменных окружения.
-func MakeStorageConfig(configFile string, restore bool, storeInterval time.Duration, storeFile, databaseDSN string) (StorageConfig, error) {
-	var err error = nil
-	cfg := StorageConfig{}
-	configFile = lookupString("config", "CONFIG", "", configFile)
-	err = loadFromFile(configFile, &cfg)
-	if err != nil {
-		return cfg, err
-	}
-	cfg.Restore, err = lookupBool("r", "RESTORE", cfg.Restore, restore)
-	if err != nil {
-		return cfg, err
-	}
-	cfg.StoreInterval, err = lookupDuration("i", "STORE_INTERVAL", cfg.StoreInterval, storeInterval)
-	if err != nil {
-		return cfg, err
-	}
-	cfg.StoreFile = lookupString("f", "STORE_FILE", cfg.StoreFile, storeFile)
-	cfg.DatabaseDSN = lookupString("d", "DATABASE_DSN", cfg.DatabaseDSN, databaseDSN)
-	return cfg, nil
+// AlertConfig - структура конфигурации оповещений.
+type AlertConfig struct {
+	AlertRules     []AlertRule   `json:"alert_rules,omitempty"`
+	AlertRulesFile string        `json:"alert_rules_file,omitempty"`      // файл с правилами {"alert_rules": [...]}, заменяет правила из конфигурации
+	AlertURL       string        `json:"alert_url,omitempty"`             // адрес webhook для отправки оповещений
+	AlertInterval  time.Duration `json:"alert_interval,omitempty"`        // периодичность проверки правил по всем метрикам
+	AlertRepeat    time.Duration `json:"alert_repeat_interval,omitempty"` // повтор оповещения о сработавшем правиле, 0 - без повтора
+	AlertTimeout   time.Duration `json:"alert_timeout,omitempty"`         // таймаут запроса к webhook
 }
@@ -5,20 +5,43 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
+	"fmt"
 	"os"
+
+	"github.com/youmark/pkcs8"
+)
+
+// PassphraseEnv is the environment variable with the passphrase of an encrypted private key.
+const PassphraseEnv = "CRYPTO_KEY_PASSPHRASE"
+
+// Key file formats.
+const (
+	KeyFormatPKIX  = "pkix"
+	KeyFormatPKCS1 = "pkcs1"
+	KeyFormatPKCS8 = "pkcs8"
+)
+
+var (
+	ErrNoPEMBlock   = errors.New("no PEM block found")
+	ErrKeyEncrypted = errors.New("private key is encrypted, set " + PassphraseEnv)
+	ErrPassphrase   = errors.New("wrong passphrase or corrupted private key")
+	ErrNotRSAKey    = errors.New("not an RSA key")
+	ErrKeyFormat    = errors.New("unsupported key format")
 )
 
 type PublicKey struct {
-	pub any
+	pub *rsa.PublicKey
 }
 
 type PrivateKey struct {
-	priv any
+	priv *rsa.PrivateKey
 }
 
 // LoadPublicKey loads a public key from the specified file path.
 //
 // It takes a filePath string as a parameter and returns a *PublicKey and an error.
+// PKIX and PKCS#1 encodings are accepted regardless of the PEM block type.
 func LoadPublicKey(filePath string) (*PublicKey, error) {
 	if filePath == "" {
 		return nil, nil
@@ -27,10 +50,13 @@ func LoadPublicKey(filePath string) (*PublicKey, error) {
 	if err != nil {
 		return nil, err
 	}
-	publicKeyBlock, _ := pem.Decode(publicKeyPEM)
-	publicKey, err := x509.ParsePKIXPublicKey(publicKeyBlock.Bytes)
+	block, err := decodePEM(publicKeyPEM)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("public key %s: %w", filePath, err)
+	}
+	publicKey, _, err := parsePublicKey(block)
+	if err != nil {
+		return nil, fmt.Errorf("public key %s: %w", filePath, err)
 	}
 	return &PublicKey{pub: publicKey}, nil
 }
@@ -38,6 +64,8 @@ func LoadPublicKey(filePath string) (*PublicKey, error) {
 // LoadPrivateKey loads a private key from the specified file path.
 //
 // It takes a filePath string as a parameter and returns a *PrivateKey and an error.
+// PKCS#1 and PKCS#8 encodings are accepted, an encrypted key is decrypted
+// with the passphrase from the CRYPTO_KEY_PASSPHRASE environment variable.
 func LoadPrivateKey(filePath string) (*PrivateKey, error) {
 	if filePath == "" {
 		return nil, nil
@@ -46,20 +74,102 @@ func LoadPrivateKey(filePath string) (*PrivateKey, error) {
 	if err != nil {
 		return nil, err
 	}
-	privateKeyBlock, _ := pem.Decode(privateKeyPEM)
-	privateKey, err := x509.ParsePKCS1PrivateKey(privateKeyBlock.Bytes)
+	block, err := decodePEM(privateKeyPEM)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("private key %s: %w", filePath, err)
+	}
+	privateKey, _, err := parsePrivateKey(block, []byte(os.Getenv(PassphraseEnv)))
+	if err != nil {
+		return nil, fmt.Errorf("private key %s: %w", filePath, err)
 	}
 	return &PrivateKey{priv: privateKey}, nil
 }
 
+// decodePEM returns the first PEM block of data.
+func decodePEM(data []byte) (*pem.Block, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrNoPEMBlock
+	}
+	return block, nil
+}
+
+// isPrivateBlock reports whether the PEM block holds a private key.
+func isPrivateBlock(block *pem.Block) bool {
+	switch block.Type {
+	case "RSA PRIVATE KEY", "PRIVATE KEY", "ENCRYPTED PRIVATE KEY":
+		return true
+	}
+	return false
+}
+
+// parsePublicKey parses a PKIX or PKCS#1 public key and returns it with its format.
+func parsePublicKey(block *pem.Block) (*rsa.PublicKey, string, error) {
+	if isPrivateBlock(block) {
+		return nil, "", fmt.Errorf("%w: expected public key, got %q", ErrKeyFormat, block.Type)
+	}
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		publicKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, "", fmt.Errorf("%w: %T", ErrNotRSAKey, key)
+		}
+		return publicKey, KeyFormatPKIX, nil
+	}
+	if publicKey, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return publicKey, KeyFormatPKCS1, nil
+	}
+	return nil, "", fmt.Errorf("%w: %q block is neither PKIX nor PKCS#1", ErrKeyFormat, block.Type)
+}
+
+// parsePrivateKey parses a PKCS#1 or PKCS#8 private key and returns it with its format.
+// Encrypted PKCS#8 and legacy OpenSSL encrypted PEM are decrypted with passphrase.
+func parsePrivateKey(block *pem.Block, passphrase []byte) (*rsa.PrivateKey, string, error) {
+	der := block.Bytes
+	switch {
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		if len(passphrase) == 0 {
+			return nil, KeyFormatPKCS8, ErrKeyEncrypted
+		}
+		key, err := pkcs8.ParsePKCS8PrivateKey(der, passphrase)
+		if err != nil {
+			return nil, KeyFormatPKCS8, fmt.Errorf("%w: %v", ErrPassphrase, err)
+		}
+		return rsaPrivateKey(key, KeyFormatPKCS8)
+	case x509.IsEncryptedPEMBlock(block):
+		// legacy OpenSSL encryption is only read for keys made by openssl genrsa -aes256, never written
+		if len(passphrase) == 0 {
+			return nil, "", ErrKeyEncrypted
+		}
+		var err error
+		if der, err = x509.DecryptPEMBlock(block, passphrase); err != nil {
+			return nil, "", fmt.Errorf("%w: %v", ErrPassphrase, err)
+		}
+	case !isPrivateBlock(block):
+		return nil, "", fmt.Errorf("%w: expected private key, got %q", ErrKeyFormat, block.Type)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, KeyFormatPKCS1, nil
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return rsaPrivateKey(key, KeyFormatPKCS8)
+	}
+	return nil, "", fmt.Errorf("%w: %q block is neither PKCS#1 nor PKCS#8", ErrKeyFormat, block.Type)
+}
+
+func rsaPrivateKey(key any, format string) (*rsa.PrivateKey, string, error) {
+	privateKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, format, fmt.Errorf("%w: %T", ErrNotRSAKey, key)
+	}
+	return privateKey, format, nil
+}
+
 // Encrypt encrypts the given data using the public key.
 //
 // It takes a string parameter 'data' which represents the data to be encrypted.
 // It returns a string which represents the encrypted data and an error if any.
 func (pub *PublicKey) Encrypt(data []byte) ([]byte, error) {
-	ciphertext, err := rsa.EncryptPKCS1v15(rand.Reader, pub.pub.(*rsa.PublicKey), data)
+	ciphertext, err := rsa.EncryptPKCS1v15(rand.Reader, pub.pub, data)
 	if err != nil {
 		return nil, err
 	}
@@ -71,7 +181,7 @@ func (pub *PublicKey) Encrypt(data []byte) ([]byte, error) {
 // The data parameter is the ciphertext to be decrypted.
 // It returns the plaintext string and an error if decryption fails.
 func (priv *PrivateKey) Decrypt(data []byte) ([]byte, error) {
-	plaintext, err := rsa.DecryptPKCS1v15(rand.Reader, priv.priv.(*rsa.PrivateKey), data)
+	plaintext, err := rsa.DecryptPKCS1v15(rand.Reader, priv.priv, data)
 	if err != nil {
 		return nil, err
 	}
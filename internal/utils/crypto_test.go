@@ -6,6 +6,7 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -45,8 +46,9 @@ func generateKeys(publicKeyPath, privateKeyPath string) {
 
 func TestCrypto(t *testing.T) {
 	data := []byte("Hello, World!")
-	publicKeyPath := "public.pem"
-	privateKeyPath := "private.pem"
+	dir := t.TempDir()
+	publicKeyPath := filepath.Join(dir, "public.pem")
+	privateKeyPath := filepath.Join(dir, "private.pem")
 	generateKeys(publicKeyPath, privateKeyPath)
 
 	publicKey, err := LoadPublicKey(publicKeyPath)
@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"os"
+)
+
+// AgentIDHeader - заголовок HTTP запроса с идентификатором агента, входит в подпись запроса.
+const AgentIDHeader = "X-Agent-ID"
+
+// AgentIDMetadataKey - ключ gRPC метаданных с идентификатором агента, входит в подпись запроса.
+const AgentIDMetadataKey = "x-agent-id"
+
+// maxAgentIDLength - максимальная длина идентификатора агента.
+const maxAgentIDLength = 255
+
+// AgentID - метод получения идентификатора агента по умолчанию: имени хоста.
+func AgentID() string {
+	hostname, err := os.Hostname()
+	if err != nil || len(hostname) > maxAgentIDLength {
+		return ""
+	}
+	return hostname
+}
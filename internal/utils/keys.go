@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/youmark/pkcs8"
+)
+
+// MinRSABits is the smallest RSA key size accepted by GenerateRSAKey.
+const MinRSABits = 2048
+
+// KeyInfo describes a PEM encoded key file.
+type KeyInfo struct {
+	Kind        string `json:"kind"`
+	Format      string `json:"format"`
+	Encrypted   bool   `json:"encrypted"`
+	Algorithm   string `json:"algorithm"`
+	Bits        int    `json:"bits,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// GenerateRSAKey generates an RSA private key of the given size.
+func GenerateRSAKey(bits int) (*rsa.PrivateKey, error) {
+	if bits < MinRSABits {
+		return nil, fmt.Errorf("key size %d is less than %d bits", bits, MinRSABits)
+	}
+	return rsa.GenerateKey(rand.Reader, bits)
+}
+
+// EncodePrivateKey returns the PEM encoding of key in the pkcs1 or pkcs8 format.
+// A non-empty passphrase encrypts the key, which is supported for pkcs8 only.
+func EncodePrivateKey(key *rsa.PrivateKey, format string, passphrase []byte) ([]byte, error) {
+	switch format {
+	case KeyFormatPKCS1:
+		if len(passphrase) > 0 {
+			return nil, errors.New("encryption requires the pkcs8 format")
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), nil
+	case KeyFormatPKCS8:
+		der, err := pkcs8.MarshalPrivateKey(key, passphrase, nil)
+		if err != nil {
+			return nil, err
+		}
+		blockType := "PRIVATE KEY"
+		if len(passphrase) > 0 {
+			blockType = "ENCRYPTED PRIVATE KEY"
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrKeyFormat, format)
+	}
+}
+
+// EncodePublicKey returns the PEM encoding of key in the PKIX format read by the agent.
+func EncodePublicKey(key *rsa.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the PKIX encoding of key,
+// so a private key and its public key have the same fingerprint.
+func Fingerprint(key *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]), nil
+}
+
+// InspectKey describes a PEM encoded public or private key.
+// An encrypted private key without passphrase is described without size and fingerprint.
+func InspectKey(data []byte, passphrase []byte) (KeyInfo, error) {
+	block, err := decodePEM(data)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	info := KeyInfo{Kind: "public", Algorithm: "RSA"}
+	var publicKey *rsa.PublicKey
+	if isPrivateBlock(block) {
+		info.Kind = "private"
+		info.Encrypted = block.Type == "ENCRYPTED PRIVATE KEY" || x509.IsEncryptedPEMBlock(block)
+		var privateKey *rsa.PrivateKey
+		privateKey, info.Format, err = parsePrivateKey(block, passphrase)
+		if errors.Is(err, ErrKeyEncrypted) {
+			return info, nil
+		}
+		if err != nil {
+			return KeyInfo{}, err
+		}
+		publicKey = &privateKey.PublicKey
+	} else if publicKey, info.Format, err = parsePublicKey(block); err != nil {
+		return KeyInfo{}, err
+	}
+	info.Bits = publicKey.N.BitLen()
+	if info.Fingerprint, err = Fingerprint(publicKey); err != nil {
+		return KeyInfo{}, err
+	}
+	return info, nil
+}
+
+// PublicKeyFromPEM returns the public key of a PEM encoded public or private key.
+func PublicKeyFromPEM(data []byte, passphrase []byte) (*rsa.PublicKey, error) {
+	block, err := decodePEM(data)
+	if err != nil {
+		return nil, err
+	}
+	if !isPrivateBlock(block) {
+		publicKey, _, err := parsePublicKey(block)
+		return publicKey, err
+	}
+	privateKey, _, err := parsePrivateKey(block, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return &privateKey.PublicKey, nil
+}
+
+// GenerateHMACKey returns a random hex encoded secret of size bytes for signing metrics.
+func GenerateHMACKey(size int) (string, error) {
+	if size < 16 {
+		return "", fmt.Errorf("secret size %d is less than 16 bytes", size)
+	}
+	secret := make([]byte, size)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
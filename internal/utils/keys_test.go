@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadKeys_Formats(t *testing.T) {
+	key, err := GenerateRSAKey(MinRSABits)
+	require.NoError(t, err)
+	publicPEM, err := EncodePublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	pkcs1PublicPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)})
+	pkcs1PEM, err := EncodePrivateKey(key, KeyFormatPKCS1, nil)
+	require.NoError(t, err)
+	pkcs8PEM, err := EncodePrivateKey(key, KeyFormatPKCS8, nil)
+	require.NoError(t, err)
+	encryptedPEM, err := EncodePrivateKey(key, KeyFormatPKCS8, []byte("passphrase"))
+	require.NoError(t, err)
+	legacyBlock, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key), []byte("passphrase"), x509.PEMCipherAES256)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, data, 0600))
+		return path
+	}
+	data := []byte("metrics")
+
+	for name, publicData := range map[string][]byte{"pkix": publicPEM, "pkcs1": pkcs1PublicPEM} {
+		publicKey, err := LoadPublicKey(write(name+".pub", publicData))
+		require.NoError(t, err, name)
+		tests := map[string][]byte{
+			"pkcs1":     pkcs1PEM,
+			"pkcs8":     pkcs8PEM,
+			"encrypted": encryptedPEM,
+			"legacy":    pem.EncodeToMemory(legacyBlock),
+		}
+		for keyName, privateData := range tests {
+			t.Setenv(PassphraseEnv, "passphrase")
+			privateKey, err := LoadPrivateKey(write(keyName+".pem", privateData))
+			require.NoError(t, err, keyName)
+			encrypted, err := publicKey.Encrypt(data)
+			require.NoError(t, err)
+			decrypted, err := privateKey.Decrypt(encrypted)
+			require.NoError(t, err)
+			assert.Equal(t, data, decrypted, name+"/"+keyName)
+		}
+	}
+}
+
+func TestLoadKeys_Errors(t *testing.T) {
+	key, err := GenerateRSAKey(MinRSABits)
+	require.NoError(t, err)
+	encryptedPEM, err := EncodePrivateKey(key, KeyFormatPKCS8, []byte("passphrase"))
+	require.NoError(t, err)
+	publicPEM, err := EncodePublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, data, 0600))
+		return path
+	}
+
+	_, err = LoadPublicKey(write("empty.pem", nil))
+	assert.ErrorIs(t, err, ErrNoPEMBlock)
+	_, err = LoadPrivateKey(write("text.pem", []byte("not a key")))
+	assert.ErrorIs(t, err, ErrNoPEMBlock)
+	_, err = LoadPrivateKey(write("garbage.pem", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("garbage")})))
+	assert.ErrorIs(t, err, ErrKeyFormat)
+	_, err = LoadPrivateKey(write("public.pem", publicPEM))
+	assert.ErrorIs(t, err, ErrKeyFormat)
+	_, err = LoadPublicKey(write("private.pem", encryptedPEM))
+	assert.ErrorIs(t, err, ErrKeyFormat)
+
+	t.Setenv(PassphraseEnv, "")
+	_, err = LoadPrivateKey(write("encrypted.pem", encryptedPEM))
+	assert.ErrorIs(t, err, ErrKeyEncrypted)
+	t.Setenv(PassphraseEnv, "wrong")
+	_, err = LoadPrivateKey(write("encrypted.pem", encryptedPEM))
+	assert.ErrorIs(t, err, ErrPassphrase)
+
+	_, err = EncodePrivateKey(key, KeyFormatPKCS1, []byte("passphrase"))
+	assert.Error(t, err)
+	_, err = GenerateRSAKey(1024)
+	assert.Error(t, err)
+}
+
+func TestInspectKey(t *testing.T) {
+	key, err := GenerateRSAKey(MinRSABits)
+	require.NoError(t, err)
+	fingerprint, err := Fingerprint(&key.PublicKey)
+	require.NoError(t, err)
+	publicPEM, err := EncodePublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	encryptedPEM, err := EncodePrivateKey(key, KeyFormatPKCS8, []byte("passphrase"))
+	require.NoError(t, err)
+
+	info, err := InspectKey(publicPEM, nil)
+	require.NoError(t, err)
+	assert.Equal(t, KeyInfo{Kind: "public", Format: KeyFormatPKIX, Algorithm: "RSA", Bits: MinRSABits, Fingerprint: fingerprint}, info)
+
+	info, err = InspectKey(encryptedPEM, nil)
+	require.NoError(t, err)
+	assert.Equal(t, KeyInfo{Kind: "private", Format: KeyFormatPKCS8, Encrypted: true, Algorithm: "RSA"}, info)
+
+	info, err = InspectKey(encryptedPEM, []byte("passphrase"))
+	require.NoError(t, err)
+	assert.Equal(t, fingerprint, info.Fingerprint)
+
+	secret, err := GenerateHMACKey(32)
+	require.NoError(t, err)
+	assert.Len(t, secret, 64)
+}
@@ -96,6 +96,12 @@ func (m JSONMetric) String() string {
 	}
 }
 
+// DeletePayload - метод получения подписываемых данных запроса на удаление метрики.
+// у запроса на удаление нет тела, поэтому подписывается тип и имя метрики.
+func DeletePayload(mType, id string) []byte {
+	return []byte("delete:" + mType + ":" + id)
+}
+
 // ValueString - метод приведения значения метрики к строке.
 func (m JSONMetric) ValueString() string {
 	switch m.MType {
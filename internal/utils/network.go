@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// ParsePrefixes - метод разбора списка подсетей IPv4 и IPv6, разделенных запятыми.
+// адрес без маски рассматривается как подсеть из одного адреса.
+func ParsePrefixes(value string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// ContainsAddr - метод проверяет, входит ли адрес хотя бы в одну из подсетей.
+func ContainsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRemoteAddr - метод разбора адреса клиента в формате host:port или host.
+func ParseRemoteAddr(remoteAddr string) (netip.Addr, error) {
+	if addrPort, err := netip.ParseAddrPort(remoteAddr); err == nil {
+		return addrPort.Addr().Unmap(), nil
+	}
+	addr, err := netip.ParseAddr(strings.Trim(remoteAddr, "[]"))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addr.Unmap(), nil
+}
+
+// ResolveClientIP - метод определения адреса клиента с учетом доверенных прокси.
+// заголовки X-Forwarded-For и X-Real-IP учитываются, только если запрос пришел от доверенного прокси.
+// цепочка X-Forwarded-For просматривается справа налево до первого адреса, не являющегося доверенным прокси.
+func ResolveClientIP(remote netip.Addr, forwardedFor, realIP string, proxies []netip.Prefix) netip.Addr {
+	if !ContainsAddr(proxies, remote) {
+		return remote
+	}
+	if forwardedFor != "" {
+		hops := strings.Split(forwardedFor, ",")
+		client := remote
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := ParseRemoteAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				return client
+			}
+			client = addr
+			if !ContainsAddr(proxies, addr) {
+				return addr
+			}
+		}
+		return client
+	}
+	if realIP != "" {
+		if addr, err := ParseRemoteAddr(strings.TrimSpace(realIP)); err == nil {
+			return addr
+		}
+	}
+	return remote
+}
+
+// LocalAddrFor - метод определения локального адреса, с которого отправляются запросы на сервер.
+// сокет UDP не отправляет пакетов, но позволяет узнать адрес исходящего интерфейса
+// с учетом таблицы маршрутизации, что корректно работает на хостах с несколькими интерфейсами и только с IPv6.
+func LocalAddrFor(serverURL string) (netip.Addr, error) {
+	host := serverURL
+	if u, err := url.Parse(serverURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), "80")
+	}
+	conn, err := net.Dial("udp", host)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer conn.Close()
+	return ParseRemoteAddr(conn.LocalAddr().String())
+}
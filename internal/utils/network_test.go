@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes("192.168.1.0/24, 10.0.0.1 ,2001:db8::/32,")
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("192.168.1.0/24"),
+		netip.MustParsePrefix("10.0.0.1/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}, prefixes)
+
+	prefixes, err = ParsePrefixes("")
+	require.NoError(t, err)
+	assert.Empty(t, prefixes)
+
+	_, err = ParsePrefixes("192.168.1.0/24,foo")
+	assert.NotNil(t, err)
+}
+
+func TestContainsAddr(t *testing.T) {
+	prefixes, _ := ParsePrefixes("192.168.1.0/24,2001:db8::/32")
+	assert.True(t, ContainsAddr(prefixes, netip.MustParseAddr("192.168.1.10")))
+	assert.True(t, ContainsAddr(prefixes, netip.MustParseAddr("::ffff:192.168.1.10")))
+	assert.True(t, ContainsAddr(prefixes, netip.MustParseAddr("2001:db8::1")))
+	assert.False(t, ContainsAddr(prefixes, netip.MustParseAddr("10.0.0.1")))
+	assert.False(t, ContainsAddr(nil, netip.MustParseAddr("10.0.0.1")))
+}
+
+func TestParseRemoteAddr(t *testing.T) {
+	for input, want := range map[string]string{
+		"10.0.0.1:5000":     "10.0.0.1",
+		"10.0.0.1":          "10.0.0.1",
+		"[2001:db8::1]:443": "2001:db8::1",
+		"2001:db8::1":       "2001:db8::1",
+	} {
+		addr, err := ParseRemoteAddr(input)
+		require.NoError(t, err)
+		assert.Equal(t, want, addr.String())
+	}
+	_, err := ParseRemoteAddr("localhost:80")
+	assert.NotNil(t, err)
+}
+
+func TestResolveClientIP(t *testing.T) {
+	proxies, _ := ParsePrefixes("10.0.0.0/8")
+	tests := []struct {
+		name         string
+		remote       string
+		forwardedFor string
+		realIP       string
+		want         string
+	}{
+		{name: "untrusted remote ignores headers", remote: "192.168.1.5", forwardedFor: "1.1.1.1", realIP: "2.2.2.2", want: "192.168.1.5"},
+		{name: "trusted proxy forwarded for", remote: "10.0.0.1", forwardedFor: "1.1.1.1, 10.0.0.2", want: "1.1.1.1"},
+		{name: "spoofed leftmost hop", remote: "10.0.0.1", forwardedFor: "3.3.3.3, 1.1.1.1", want: "1.1.1.1"},
+		{name: "trusted proxy real ip", remote: "10.0.0.1", realIP: "2001:db8::1", want: "2001:db8::1"},
+		{name: "trusted proxy without headers", remote: "10.0.0.1", want: "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip := ResolveClientIP(netip.MustParseAddr(tt.remote), tt.forwardedFor, tt.realIP, proxies)
+			assert.Equal(t, tt.want, ip.String())
+		})
+	}
+}
+
+func TestLocalAddrFor(t *testing.T) {
+	addr, err := LocalAddrFor("http://127.0.0.1:8080")
+	require.NoError(t, err)
+	assert.True(t, addr.IsLoopback())
+}
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Типы содержимого для экспорта метрик в формате Prometheus.
+const (
+	PrometheusContentType  = "text/plain; version=0.0.4; charset=utf-8"
+	OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// SanitizeMetricName - метод приведения имени метрики к правилам Prometheus: [a-zA-Z_:][a-zA-Z0-9_:]*.
+// недопустимые символы заменяются на '_', перед начальной цифрой добавляется '_'.
+func SanitizeMetricName(name string) string {
+	if name == "" {
+		return "_"
+	}
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+func formatPrometheusValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+type promFamily struct {
+	name  string
+	mType string
+	value string
+}
+
+// WritePrometheus - метод записи метрик в текстовом формате Prometheus или OpenMetrics.
+// метрики сортируются по имени; при совпадении имен после приведения к правилам
+// Prometheus остается первая метрика, чтобы не нарушать уникальность семейств.
+func WritePrometheus(w io.Writer, metrics []JSONMetric, openMetrics bool) error {
+	families := make([]promFamily, 0, len(metrics))
+	seen := make(map[string]bool)
+	sorted := make([]JSONMetric, len(metrics))
+	copy(sorted, metrics)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].ID != sorted[j].ID {
+			return sorted[i].ID < sorted[j].ID
+		}
+		return sorted[i].MType < sorted[j].MType
+	})
+	for _, metric := range sorted {
+		family := promFamily{name: SanitizeMetricName(metric.ID), mType: metric.MType}
+		switch metric.MType {
+		case "gauge":
+			if metric.Value == nil {
+				continue
+			}
+			family.value = formatPrometheusValue(*metric.Value)
+		case "counter":
+			if metric.Delta == nil {
+				continue
+			}
+			family.value = strconv.FormatInt(*metric.Delta, 10)
+			if openMetrics {
+				family.name = strings.TrimSuffix(family.name, "_total")
+			}
+		default:
+			continue
+		}
+		if seen[family.name] {
+			continue
+		}
+		seen[family.name] = true
+		families = append(families, family)
+	}
+
+	for _, family := range families {
+		sample := family.name
+		if openMetrics && family.mType == "counter" {
+			sample += "_total"
+		}
+		if _, err := fmt.Fprintf(w, "# TYPE %s %s\n%s %s\n", family.name, family.mType, sample, family.value); err != nil {
+			return err
+		}
+	}
+	if openMetrics {
+		if _, err := io.WriteString(w, "# EOF\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizeMetricName(t *testing.T) {
+	assert.Equal(t, "Alloc", SanitizeMetricName("Alloc"))
+	assert.Equal(t, "cpu_utilization_1", SanitizeMetricName("cpu.utilization-1"))
+	assert.Equal(t, "_1st", SanitizeMetricName("1st"))
+	assert.Equal(t, "ns:metric_", SanitizeMetricName("ns:metric✓"))
+	assert.Equal(t, "_", SanitizeMetricName(""))
+}
+
+func TestWritePrometheus(t *testing.T) {
+	metrics := []JSONMetric{
+		NewGaugeJSONMetric("Sys", 1.5),
+		NewCounterJSONMetric("PollCount", 10),
+		NewGaugeJSONMetric("Alloc", math.Inf(1)),
+		NewCounterJSONMetric("requests_total", 3),
+	}
+
+	var text bytes.Buffer
+	require.NoError(t, WritePrometheus(&text, metrics, false))
+	assert.Equal(t, `# TYPE Alloc gauge
+Alloc +Inf
+# TYPE PollCount counter
+PollCount 10
+# TYPE Sys gauge
+Sys 1.5
+# TYPE requests_total counter
+requests_total 3
+`, text.String())
+
+	var om bytes.Buffer
+	require.NoError(t, WritePrometheus(&om, metrics, true))
+	assert.Equal(t, `# TYPE Alloc gauge
+Alloc +Inf
+# TYPE PollCount counter
+PollCount_total 10
+# TYPE Sys gauge
+Sys 1.5
+# TYPE requests counter
+requests_total 3
+# EOF
+`, om.String())
+}
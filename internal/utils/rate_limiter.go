@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// cleanupInterval - периодичность удаления неактивных клиентов из RateLimiter.
+const cleanupInterval = time.Minute
+
+// DefaultRateLimitClients - максимальное количество клиентов в RateLimiter по умолчанию.
+const DefaultRateLimitClients = 100000
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter - ограничение частоты запросов по алгоритму token bucket
+// с отдельным bucket для каждого клиента.
+type RateLimiter struct {
+	rate        float64
+	burst       float64
+	mutex       sync.Mutex
+	buckets     map[string]*tokenBucket
+	size        int
+	lastCleanup time.Time
+	now         func() time.Time
+}
+
+// NewRateLimiter - метод создания объекта RateLimiter.
+// rate - количество запросов в секунду, burst - максимальное количество запросов подряд.
+// количество клиентов ограничено DefaultRateLimitClients.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return &RateLimiter{
+		rate:        rate,
+		burst:       float64(burst),
+		buckets:     make(map[string]*tokenBucket),
+		size:        DefaultRateLimitClients,
+		lastCleanup: time.Now(),
+		now:         time.Now,
+	}
+}
+
+// Allow - метод проверяет, может ли клиент выполнить запрос.
+// если лимит исчерпан, возвращается время, через которое запрос можно повторить.
+// если клиентов слишком много и ни один bucket не восстановился, запрос нового клиента отклоняется.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	l.cleanup(now, false)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= l.size {
+			l.cleanup(now, true)
+		}
+		if len(l.buckets) >= l.size {
+			return false, time.Duration(float64(time.Second) / l.rate)
+		}
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// cleanup - метод удаляет клиентов, bucket которых полностью восстановился.
+// без force удаление выполняется не чаще cleanupInterval.
+func (l *RateLimiter) cleanup(now time.Time, force bool) {
+	if !force && now.Sub(l.lastCleanup) < cleanupInterval {
+		return
+	}
+	l.lastCleanup = now
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) > full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RetryAfterSeconds - метод округления времени ожидания до целых секунд для заголовка Retry-After.
+func RetryAfterSeconds(wait time.Duration) int {
+	return int(math.Max(1, math.Ceil(wait.Seconds())))
+}
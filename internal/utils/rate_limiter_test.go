@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := NewRateLimiter(2, 3)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, _ := limiter.Allow("10.0.0.1")
+		assert.True(t, ok)
+	}
+	ok, wait := limiter.Allow("10.0.0.1")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	ok, _ = limiter.Allow("10.0.0.2")
+	assert.True(t, ok)
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = limiter.Allow("10.0.0.1")
+	assert.True(t, ok)
+}
+
+func TestRateLimiter_Cleanup(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := NewRateLimiter(1, 1)
+	limiter.now = func() time.Time { return now }
+	limiter.lastCleanup = now
+
+	limiter.Allow("10.0.0.1")
+	now = now.Add(2 * cleanupInterval)
+	limiter.Allow("10.0.0.2")
+	assert.Len(t, limiter.buckets, 1)
+}
+
+func TestRateLimiter_Bounded(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := NewRateLimiter(1, 1)
+	limiter.now = func() time.Time { return now }
+	limiter.size = 2
+
+	for _, key := range []string{"10.0.0.1", "10.0.0.2"} {
+		ok, _ := limiter.Allow(key)
+		assert.True(t, ok)
+	}
+	ok, wait := limiter.Allow("10.0.0.3")
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait)
+	assert.Len(t, limiter.buckets, 2)
+
+	now = now.Add(2 * time.Second)
+	ok, _ = limiter.Allow("10.0.0.3")
+	assert.True(t, ok)
+	assert.Len(t, limiter.buckets, 1)
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	assert.Equal(t, 1, RetryAfterSeconds(0))
+	assert.Equal(t, 1, RetryAfterSeconds(300*time.Millisecond))
+	assert.Equal(t, 3, RetryAfterSeconds(2100*time.Millisecond))
+}
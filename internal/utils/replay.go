@@ -0,0 +1,260 @@
+package utils
+
+import (
+	"container/list"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/tiraill/go_collect_metrics/cmd/proto"
+)
+
+// Заголовки HTTP запроса с подписью для защиты от повторной отправки.
+const (
+	TimestampHeader = "X-Request-Timestamp"
+	NonceHeader     = "X-Request-Nonce"
+	SignatureHeader = "X-Request-Signature"
+)
+
+// Ключи gRPC метаданных с подписью для защиты от повторной отправки.
+const (
+	TimestampMetadataKey = "x-request-timestamp"
+	NonceMetadataKey     = "x-request-nonce"
+	SignatureMetadataKey = "x-request-signature"
+)
+
+// DefaultNonceCacheSize - размер кэша nonce по умолчанию.
+const DefaultNonceCacheSize = 10000
+
+// ErrRequestStamp ошибка отсутствующей или невалидной подписи запроса.
+var ErrRequestStamp = errors.New("invalid request stamp")
+
+// ErrRequestExpired ошибка времени запроса вне допустимого окна.
+var ErrRequestExpired = errors.New("request timestamp outside allowed window")
+
+// ErrRequestReplay ошибка повторного использования nonce.
+var ErrRequestReplay = errors.New("request nonce already used")
+
+// ErrReplayCacheFull ошибка заполненного кэша nonce: все nonce в кэше еще действуют, запрос не принимается.
+var ErrReplayCacheFull = errors.New("nonce cache is full")
+
+// RequestStamp - подпись запроса: время отправки, nonce, идентификатор агента и HMAC.
+type RequestStamp struct {
+	Timestamp int64  // время отправки запроса в формате unix
+	Nonce     string // случайное одноразовое значение
+	AgentID   string // идентификатор агента, пустой, если клиент его не передает
+	Signature string // HMAC от времени, nonce, идентификатора агента и тела запроса
+}
+
+func newNonce() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// stampData - метод получения подписываемых данных запроса.
+// nonce не содержит ':', а хеш тела имеет фиксированную длину, поэтому идентификатор агента выделяется однозначно.
+// без идентификатора формат совпадает с подписью клиентов, которые его не передают.
+func stampData(timestamp int64, nonce, agentID string, payload []byte) string {
+	if agentID == "" {
+		return fmt.Sprintf("%d:%s:%x", timestamp, nonce, sha256.Sum256(payload))
+	}
+	return fmt.Sprintf("%d:%s:%s:%x", timestamp, nonce, agentID, sha256.Sum256(payload))
+}
+
+// NewRequestStamp - метод создания подписи запроса агента agentID, пустой agentID не передается.
+// если ключ не задан, подпись не создается.
+func NewRequestStamp(payload []byte, agentID, hashKey string) *RequestStamp {
+	if hashKey == "" {
+		return nil
+	}
+	stamp := &RequestStamp{
+		Timestamp: time.Now().Unix(),
+		Nonce:     newNonce(),
+		AgentID:   agentID,
+	}
+	stamp.Signature = *CalcHash(stampData(stamp.Timestamp, stamp.Nonce, stamp.AgentID, payload), hashKey)
+	return stamp
+}
+
+// ParseRequestStamp - метод разбора подписи запроса из строковых значений заголовков.
+// идентификатор агента не обязателен.
+func ParseRequestStamp(timestamp, nonce, agentID, signature string) (RequestStamp, error) {
+	if timestamp == "" || nonce == "" || signature == "" || strings.Contains(nonce, ":") || len(agentID) > maxAgentIDLength {
+		return RequestStamp{}, ErrRequestStamp
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return RequestStamp{}, ErrRequestStamp
+	}
+	return RequestStamp{Timestamp: ts, Nonce: nonce, AgentID: agentID, Signature: signature}, nil
+}
+
+// IsValidSignature - метод проверки подписи запроса.
+// Подписи сравниваются за постоянное время, чтобы время ответа не раскрывало совпавшую часть подписи.
+func (s RequestStamp) IsValidSignature(payload []byte, hashKey string) bool {
+	actual := CalcHash(stampData(s.Timestamp, s.Nonce, s.AgentID, payload), hashKey)
+	if actual == nil {
+		return false
+	}
+	expected, err := hex.DecodeString(*actual)
+	if err != nil {
+		return false
+	}
+	signature, err := hex.DecodeString(s.Signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(expected, signature)
+}
+
+type nonceEntry struct {
+	nonce   string
+	expires time.Time
+}
+
+// ReplayGuard - проверка запросов на повторную отправку.
+// хранит ограниченный кэш недавно использованных nonce.
+type ReplayGuard struct {
+	window time.Duration
+	size   int
+	mutex  sync.Mutex
+	order  *list.List
+	nonces map[string]*list.Element
+	now    func() time.Time
+}
+
+// NewReplayGuard - метод создания объекта ReplayGuard.
+// window - допустимое расхождение часов клиента и сервера, size - максимальный размер кэша nonce.
+// nonce хранится 2*window, поэтому size должен быть не меньше числа подписанных запросов за это время.
+func NewReplayGuard(window time.Duration, size int) *ReplayGuard {
+	if size <= 0 {
+		size = DefaultNonceCacheSize
+	}
+	return &ReplayGuard{
+		window: window,
+		size:   size,
+		order:  list.New(),
+		nonces: make(map[string]*list.Element),
+		now:    time.Now,
+	}
+}
+
+// Check - метод проверки подписи, времени и уникальности nonce запроса.
+func (g *ReplayGuard) Check(stamp RequestStamp, payload []byte, hashKey string) error {
+	if !stamp.IsValidSignature(payload, hashKey) {
+		return ErrRequestStamp
+	}
+	now := g.now()
+	sent := time.Unix(stamp.Timestamp, 0)
+	if sent.Before(now.Add(-g.window)) || sent.After(now.Add(g.window)) {
+		return ErrRequestExpired
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.evictExpired(now)
+	if _, ok := g.nonces[stamp.Nonce]; ok {
+		return ErrRequestReplay
+	}
+	// действующие nonce не удаляются: иначе клиент мог бы вытеснить перехваченный nonce и повторить запрос внутри окна
+	if g.order.Len() >= g.size {
+		return ErrReplayCacheFull
+	}
+	// запрос с этим nonce может быть принят не позднее sent+window <= now+2*window,
+	// поэтому время хранения отсчитывается от момента получения и кэш упорядочен по нему.
+	entry := nonceEntry{nonce: stamp.Nonce, expires: now.Add(2 * g.window)}
+	g.nonces[stamp.Nonce] = g.order.PushBack(entry)
+	return nil
+}
+
+// Len - метод возвращает количество nonce в кэше.
+func (g *ReplayGuard) Len() int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.order.Len()
+}
+
+func (g *ReplayGuard) evictExpired(now time.Time) {
+	for e := g.order.Front(); e != nil && e.Value.(nonceEntry).expires.Before(now); e = g.order.Front() {
+		g.removeElement(e)
+	}
+}
+
+func (g *ReplayGuard) removeElement(e *list.Element) {
+	g.order.Remove(e)
+	delete(g.nonces, e.Value.(nonceEntry).nonce)
+}
+
+// streamBatchPayload - данные пачки потока метрик для подписи, поля подписи не входят в подписываемые данные.
+func streamBatchPayload(request *pb.StreamMetricsRequest) ([]byte, error) {
+	unsigned := proto.Clone(request).(*pb.StreamMetricsRequest)
+	unsigned.Timestamp, unsigned.Nonce, unsigned.Signature = 0, "", ""
+	return proto.MarshalOptions{Deterministic: true}.Marshal(unsigned)
+}
+
+// SignStreamBatch - метод добавления подписи в пачку потока метрик.
+// в отличие от unary методов подпись передается в самом сообщении, так как метаданные потока отправляются один раз.
+// если ключ не задан, подпись не создается.
+func SignStreamBatch(request *pb.StreamMetricsRequest, hashKey string) error {
+	payload, err := streamBatchPayload(request)
+	if err != nil {
+		return err
+	}
+	stamp := NewRequestStamp(payload, "", hashKey)
+	if stamp == nil {
+		return nil
+	}
+	request.Timestamp, request.Nonce, request.Signature = stamp.Timestamp, stamp.Nonce, stamp.Signature
+	return nil
+}
+
+// CheckStreamBatch - метод проверки подписи, времени и уникальности nonce пачки потока метрик.
+func (g *ReplayGuard) CheckStreamBatch(request *pb.StreamMetricsRequest, hashKey string) error {
+	if request.Nonce == "" || request.Signature == "" || strings.Contains(request.Nonce, ":") {
+		return ErrRequestStamp
+	}
+	payload, err := streamBatchPayload(request)
+	if err != nil {
+		return ErrRequestStamp
+	}
+	stamp := RequestStamp{Timestamp: request.Timestamp, Nonce: request.Nonce, Signature: request.Signature}
+	return g.Check(stamp, payload, hashKey)
+}
+
+// SignContext - метод добавления в метаданные gRPC подписи запроса для защиты от повторной отправки.
+// непустой идентификатор агента передается вместе с подписью и входит в подписываемые данные.
+// если ключ не задан, контекст возвращается без изменений.
+func SignContext(ctx context.Context, request proto.Message, agentID, hashKey string) (context.Context, error) {
+	payload, err := proto.MarshalOptions{Deterministic: true}.Marshal(request)
+	if err != nil {
+		return ctx, err
+	}
+	stamp := NewRequestStamp(payload, agentID, hashKey)
+	if stamp == nil {
+		return ctx, nil
+	}
+	pairs := []string{
+		TimestampMetadataKey, strconv.FormatInt(stamp.Timestamp, 10),
+		NonceMetadataKey, stamp.Nonce,
+		SignatureMetadataKey, stamp.Signature,
+	}
+	if stamp.AgentID != "" {
+		pairs = append(pairs, AgentIDMetadataKey, stamp.AgentID)
+	}
+	return metadata.AppendToOutgoingContext(ctx, pairs...), nil
+}
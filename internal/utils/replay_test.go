@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/tiraill/go_collect_metrics/cmd/proto"
+)
+
+func TestNewRequestStamp(t *testing.T) {
+	payload := []byte(`[{"id":"PollCount","type":"counter","delta":1}]`)
+
+	assert.Nil(t, NewRequestStamp(payload, "", ""))
+
+	stamp := NewRequestStamp(payload, "", "key")
+	require.NotNil(t, stamp)
+	assert.NotEmpty(t, stamp.Nonce)
+	assert.True(t, stamp.IsValidSignature(payload, "key"))
+	assert.False(t, stamp.IsValidSignature(payload, "other"))
+	assert.False(t, stamp.IsValidSignature([]byte("tampered"), "key"))
+
+	// подпись сравнивается по значению, а не по записи
+	upper := *stamp
+	upper.Signature = strings.ToUpper(stamp.Signature)
+	assert.True(t, upper.IsValidSignature(payload, "key"))
+	for _, signature := range []string{"", "zz", stamp.Signature[:len(stamp.Signature)-2]} {
+		forged := *stamp
+		forged.Signature = signature
+		assert.False(t, forged.IsValidSignature(payload, "key"))
+	}
+}
+
+func TestNewRequestStamp_AgentID(t *testing.T) {
+	payload := []byte("body")
+	stamp := NewRequestStamp(payload, "host-1", "key")
+	require.NotNil(t, stamp)
+	assert.Equal(t, "host-1", stamp.AgentID)
+	assert.True(t, stamp.IsValidSignature(payload, "key"))
+
+	// идентификатор агента нельзя заменить или убрать без новой подписи
+	forged := *stamp
+	forged.AgentID = "host-2"
+	assert.False(t, forged.IsValidSignature(payload, "key"))
+	forged.AgentID = ""
+	assert.False(t, forged.IsValidSignature(payload, "key"))
+}
+
+func TestParseRequestStamp(t *testing.T) {
+	stamp, err := ParseRequestStamp("1700000000", "abc", "", "sig")
+	assert.Nil(t, err)
+	assert.Equal(t, RequestStamp{Timestamp: 1700000000, Nonce: "abc", Signature: "sig"}, stamp)
+
+	stamp, err = ParseRequestStamp("1700000000", "abc", "host-1", "sig")
+	assert.Nil(t, err)
+	assert.Equal(t, "host-1", stamp.AgentID)
+
+	_, err = ParseRequestStamp("", "abc", "", "sig")
+	assert.Equal(t, ErrRequestStamp, err)
+	_, err = ParseRequestStamp("now", "abc", "", "sig")
+	assert.Equal(t, ErrRequestStamp, err)
+	_, err = ParseRequestStamp("1700000000", "a:b", "", "sig")
+	assert.Equal(t, ErrRequestStamp, err)
+	_, err = ParseRequestStamp("1700000000", "abc", strings.Repeat("a", maxAgentIDLength+1), "sig")
+	assert.Equal(t, ErrRequestStamp, err)
+}
+
+func TestReplayGuard_Check(t *testing.T) {
+	payload := []byte("body")
+	now := time.Unix(1700000000, 0)
+	guard := NewReplayGuard(time.Minute, 10)
+	guard.now = func() time.Time { return now }
+
+	sign := func(ts time.Time, nonce string) RequestStamp {
+		return RequestStamp{
+			Timestamp: ts.Unix(),
+			Nonce:     nonce,
+			Signature: *CalcHash(stampData(ts.Unix(), nonce, "", payload), "key"),
+		}
+	}
+
+	assert.Nil(t, guard.Check(sign(now, "n1"), payload, "key"))
+	assert.Equal(t, ErrRequestReplay, guard.Check(sign(now, "n1"), payload, "key"))
+	assert.Equal(t, ErrRequestExpired, guard.Check(sign(now.Add(-2*time.Minute), "n2"), payload, "key"))
+	assert.Equal(t, ErrRequestExpired, guard.Check(sign(now.Add(2*time.Minute), "n3"), payload, "key"))
+	assert.Equal(t, ErrRequestStamp, guard.Check(sign(now, "n4"), []byte("other"), "key"))
+
+	now = now.Add(3 * time.Minute)
+	assert.Nil(t, guard.Check(sign(now, "n5"), payload, "key"))
+	assert.Equal(t, 1, guard.Len())
+}
+
+func TestReplayGuard_Bounded(t *testing.T) {
+	payload := []byte("body")
+	now := time.Unix(1700000000, 0)
+	guard := NewReplayGuard(time.Minute, 3)
+	guard.now = func() time.Time { return now }
+	check := func(nonce string) error {
+		stamp := RequestStamp{Timestamp: now.Unix(), Nonce: nonce}
+		stamp.Signature = *CalcHash(stampData(stamp.Timestamp, stamp.Nonce, "", payload), "key")
+		return guard.Check(stamp, payload, "key")
+	}
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, check(strconv.Itoa(i)))
+	}
+	// действующие nonce не вытесняются новыми запросами
+	assert.Equal(t, ErrReplayCacheFull, check("3"))
+	assert.Equal(t, ErrRequestReplay, check("0"))
+	assert.Equal(t, 3, guard.Len())
+
+	now = now.Add(3 * time.Minute)
+	assert.Nil(t, check("4"))
+	assert.Equal(t, 1, guard.Len())
+}
+
+func TestReplayGuard_CheckStreamBatch(t *testing.T) {
+	request := &pb.StreamMetricsRequest{Sequence: 1, Metrics: []*pb.Metric{{Id: "PollCount", Type: "counter", Delta: 1}}}
+	guard := NewReplayGuard(time.Minute, 10)
+
+	assert.Equal(t, ErrRequestStamp, guard.CheckStreamBatch(request, "key"))
+	require.NoError(t, SignStreamBatch(request, "key"))
+	assert.NotEmpty(t, request.Signature)
+	assert.NoError(t, guard.CheckStreamBatch(request, "key"))
+	assert.Equal(t, ErrRequestReplay, guard.CheckStreamBatch(request, "key"))
+
+	require.NoError(t, SignStreamBatch(request, "key"))
+	request.Metrics[0].Delta = 2
+	assert.Equal(t, ErrRequestStamp, guard.CheckStreamBatch(request, "key"))
+}
+
+func TestSignContext(t *testing.T) {
+	request := &pb.SaveMetricRequest{Metric: &pb.Metric{Id: "PollCount", Type: "counter", Delta: 1}}
+	ctx, err := SignContext(context.Background(), request, "host-1", "key")
+	require.NoError(t, err)
+	md, _ := metadata.FromOutgoingContext(ctx)
+	stamp, err := ParseRequestStamp(
+		md.Get(TimestampMetadataKey)[0], md.Get(NonceMetadataKey)[0], md.Get(AgentIDMetadataKey)[0], md.Get(SignatureMetadataKey)[0],
+	)
+	require.NoError(t, err)
+	payload, err := proto.MarshalOptions{Deterministic: true}.Marshal(request)
+	require.NoError(t, err)
+	assert.NoError(t, NewReplayGuard(time.Minute, 10).Check(stamp, payload, "key"))
+
+	ctx, err = SignContext(context.Background(), request, "host-1", "")
+	require.NoError(t, err)
+	_, ok := metadata.FromOutgoingContext(ctx)
+	assert.False(t, ok)
+}
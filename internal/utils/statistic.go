@@ -1,7 +1,7 @@
 package utils
 
 import (
-	"log"
+	"context"
 	"math/rand"
 	"runtime"
 	"sync"
@@ -55,7 +55,6 @@ func (s *Statistic) CollectRuntime() {
 	s.Counter++
 	s.RndValue = rand.Float64()
 	s.Rtm = getRtm()
-	log.Println("Collect runtime statistic", s.Counter)
 }
 
 // CollectMemCPU - метод для сбора Memory и CPU метрик.
@@ -64,7 +63,30 @@ func (s *Statistic) CollectMemCPU() {
 	defer s.Mutex.Unlock()
 	s.MemStat = getMemStat()
 	s.CPUUtilization = getCPUStat()
-	log.Println("Collect mem cpu statistic")
+}
+
+// Collect - метод сбора Runtime, Memory и CPU метрик за один проход.
+// Memory и CPU метрики собираются до блокировки и не обновляются, если сбор прерван отменой ctx.
+func (s *Statistic) Collect(ctx context.Context) error {
+	memStat, memErr := mem.VirtualMemoryWithContext(ctx)
+	cpuUtilization, cpuErr := cpu.PercentWithContext(ctx, 0, true)
+	rtm := getRtm()
+
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	s.Counter++
+	s.RndValue = rand.Float64()
+	s.Rtm = rtm
+	if memErr == nil {
+		s.MemStat = memStat
+	}
+	if cpuErr == nil {
+		s.CPUUtilization = cpuUtilization
+	}
+	if memErr != nil {
+		return memErr
+	}
+	return cpuErr
 }
 
 // ResetCounter - метод для сброса счетчика Counter.
@@ -74,6 +96,23 @@ func (s *Statistic) ResetCounter() {
 	s.Counter = 0
 }
 
+// TakeCounter - метод получения значения счетчика Counter со сбросом.
+// используется, когда отправленное значение может вернуться через AddCounter при неудачной отправке.
+func (s *Statistic) TakeCounter() int64 {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	counter := s.Counter
+	s.Counter = 0
+	return counter
+}
+
+// AddCounter - метод возврата в счетчик Counter значения, которое не удалось отправить.
+func (s *Statistic) AddCounter(delta int64) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	s.Counter += delta
+}
+
 // Copy - метод для создания копии структуры Statistic.
 func (s *Statistic) Copy() *Statistic {
 	s.Mutex.RLock()
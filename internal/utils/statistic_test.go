@@ -37,6 +37,17 @@ func TestStatistic_ResetCounter(t *testing.T) {
 	assert.Equal(t, int64(0), statistic.Counter)
 }
 
+func TestStatistic_TakeCounter(t *testing.T) {
+	statistic := NewStatistic()
+	statistic.CollectRuntime()
+	statistic.CollectRuntime()
+	assert.Equal(t, int64(2), statistic.TakeCounter())
+	assert.Equal(t, int64(0), statistic.Counter)
+	statistic.CollectRuntime()
+	statistic.AddCounter(2)
+	assert.Equal(t, int64(3), statistic.Counter)
+}
+
 func TestStatistic_Copy(t *testing.T) {
 	statistic := NewStatistic()
 	statistic.CollectRuntime()